@@ -11,10 +11,16 @@ import (
 	"github.com/ilikeorangutans/phts/db"
 	"github.com/ilikeorangutans/phts/model"
 	"github.com/ilikeorangutans/phts/pkg/database"
+	model2 "github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+	"github.com/jmoiron/sqlx"
 )
 
 func CreateAlbumHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
 	collection, _ := r.Context().Value("collection").(db.Collection)
 
 	decoder := json.NewDecoder(r.Body)
@@ -48,6 +54,9 @@ func CreateAlbumHandler(w http.ResponseWriter, r *http.Request) {
 
 func UpdateAlbumHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
 	collection, _ := r.Context().Value("collection").(db.Collection)
 
 	decoder := json.NewDecoder(r.Body)
@@ -107,6 +116,10 @@ func AlbumListPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	collection, _ := r.Context().Value("collection").(*db.Collection)
 	paginator := database.PaginatorFromRequest(r.URL.Query())
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
 
 	db := model.DBFromRequest(r)
 	backend := model.StorageFromRequest(r)
@@ -118,7 +131,7 @@ func AlbumListPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	photoRepo := model.NewPhotoRepository(db, backend)
 
 	album, _ := r.Context().Value("album").(model.Album)
-	photos, paginator, err := photoRepo.ListAlbum(collection, album, paginator, configs)
+	photos, paginator, err := photoRepo.ListAlbum(collection, album, paginator, configs, filter)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -144,21 +157,29 @@ func AlbumDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// DeleteAlbumHandler moves the album to the trash, its photos stay in the collection.
 func DeleteAlbumHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	collection, _ := r.Context().Value("collection").(db.Collection)
-	album, _ := r.Context().Value("album").(model.Album)
-
-	db := model.DBFromRequest(r)
-	albumRepo := model.NewAlbumRepository(db)
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
 
-	err := albumRepo.Delete(collection, album)
+	albumID, err := strconv.ParseInt(chi.URLParam(r, "albumID"), 10, 64)
 	if err != nil {
-		log.Fatal(err)
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
 	}
+
+	changeTrash(w, r, "delete album", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model2.NewTrashRepo().TrashAlbum(ctx, tx, collection, albumID)
+	})
 }
 func AddPhotosToAlbumHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
 	collection, _ := r.Context().Value("collection").(db.Collection)
 	album, _ := r.Context().Value("album").(model.Album)
 	db := model.DBFromRequest(r)
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// addMemberRequest names an existing user to add to the collection and their role.
+type addMemberRequest struct {
+	Email string     `json:"email"`
+	Role  model.Role `json:"role"`
+}
+
+// changeRoleRequest is the new role of a member.
+type changeRoleRequest struct {
+	Role model.Role `json:"role"`
+}
+
+// ListCollectionMembersHandler lists the members of the collection and their roles.
+func ListCollectionMembersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	members, err := model.NewCollectionMemberRepo().List(ctx, dbx, collection)
+	if err != nil {
+		log.Printf("could not list members: %+v", err)
+		http.Error(w, "could not list members", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(members); err != nil {
+		log.Printf("could not encode members: %v", err)
+	}
+}
+
+// AddCollectionMemberHandler gives an existing user access to the collection. Only owners may add members.
+func AddCollectionMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleOwner) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	var req addMemberRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "role must be owner, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	user, err := model.NewUserRepo(dbx).FindByEmail(req.Email)
+	if errors.Cause(err) == sql.ErrNoRows {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not find user: %+v", err)
+		http.Error(w, "could not add member", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	member, err := model.NewCollectionMemberRepo().Add(ctx, dbx, collection, user, req.Role)
+	if err == model.ErrAlreadyMember {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("could not add member: %+v", err)
+		http.Error(w, "could not add member", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(member); err != nil {
+		log.Printf("could not encode member: %v", err)
+	}
+}
+
+// ChangeCollectionMemberHandler changes the role of a member of the collection. Only owners may change roles, and
+// the last owner cannot give up ownership.
+func ChangeCollectionMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleOwner) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	var req changeRoleRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.Role.Valid() {
+		http.Error(w, "role must be owner, editor or viewer", http.StatusBadRequest)
+		return
+	}
+
+	var member model.CollectionMember
+	ok := changeMembers(w, r, "change role", func(ctx context.Context, tx *sqlx.Tx) (err error) {
+		member, err = model.NewCollectionMemberRepo().ChangeRole(ctx, tx, collection, userID, req.Role)
+		return err
+	})
+	if !ok {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(member); err != nil {
+		log.Printf("could not encode member: %v", err)
+	}
+}
+
+// RemoveCollectionMemberHandler takes access to the collection away from a member. Only owners may remove members,
+// and the last owner cannot be removed.
+func RemoveCollectionMemberHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleOwner) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	ok := changeMembers(w, r, "remove member", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model.NewCollectionMemberRepo().Remove(ctx, tx, collection, userID)
+	})
+	if ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changeMembers changes the members of a collection with the given function in a transaction. Writes not found if
+// the user is not a member, conflict if the collection would lose its last owner, or an error naming the action if
+// it fails. Returns whether it succeeded.
+func changeMembers(w http.ResponseWriter, r *http.Request, action string, f func(ctx context.Context, tx *sqlx.Tx) error) bool {
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return false
+	}
+
+	err = f(ctx, tx)
+	if err == model.ErrNotMember {
+		tx.Rollback()
+		http.Error(w, "not found", http.StatusNotFound)
+		return false
+	} else if err == model.ErrLastOwner {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("could not %s: %+v", action, err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -1,17 +1,17 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"io"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 
 	"github.com/ilikeorangutans/phts/db"
@@ -20,6 +20,7 @@ import (
 	"github.com/ilikeorangutans/phts/web"
 
 	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/images"
 	newmod "github.com/ilikeorangutans/phts/pkg/model"
 )
 
@@ -39,11 +40,15 @@ func PhotoStreamHandler(w http.ResponseWriter, r *http.Request) {
 	photoRepo := model2.NewPhotoRepo()
 
 	paginator := database.PaginatorFromRequest(r.URL.Query())
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	photos, _, err := photoRepo.List(ctx, dbx, user, paginator)
+	photos, _, err := photoRepo.List(ctx, dbx, user, paginator, filter)
 	if err != nil {
 		http.Error(w, "list failed", http.StatusInternalServerError)
 		return
@@ -85,28 +90,30 @@ func ShowCollectionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// DeleteCollectionHandler moves the collection to the trash. It can be restored until it is purged.
 func DeleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	collection, _ := r.Context().Value("collection").(*db.Collection)
+	if !requireRole(w, r, model2.RoleOwner) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
 
-	colRepo := model.CollectionRepoFromRequest(r)
-	err := colRepo.Delete(collection)
-	if err != nil {
-		log.Fatal(err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	ok := changeTrash(w, r, "delete collection", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model2.NewTrashRepo().TrashCollection(ctx, tx, collection)
+	})
+	if !ok {
+		return
 	}
 
 	encoder := json.NewEncoder(w)
-	err = encoder.Encode(collection)
-	if err != nil {
-		log.Fatal(err)
+	if err := encoder.Encode(collection); err != nil {
+		log.Printf("could not encode collection: %v", err)
 	}
 }
 func ServeRenditionHandler(w http.ResponseWriter, r *http.Request) {
-	collection, _ := r.Context().Value("collection").(*db.Collection)
-
-	db := model.DBFromRequest(r)
-	backend := model.StorageFromRequest(r)
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+	backend := web.StorageBackendFromRequest(r)
 
 	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
@@ -114,47 +121,24 @@ func ServeRenditionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	renditionRepo := model.NewRenditionRepository(db)
-	rendition, err := renditionRepo.FindByID(collection, id)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	rendition, err := model2.FindServableRenditionInCollection(ctx, dbx, collection, id)
 	if err != nil {
 		log.Printf("rendition not found: %v", err.Error())
 		http.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Last-Modified", rendition.UpdatedAt.Format(http.TimeFormat))
-	w.Header().Set("Cache-Control", "max-age=3600")
-
-	if modifiedSince := r.Header.Get("If-Modified-Since"); modifiedSince != "" {
-		if timestamp, err := time.Parse(http.TimeFormat, modifiedSince); err == nil {
-			if rendition.UpdatedAt.After(timestamp) {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
-		}
-	}
-
-	data, err := backend.Get(id)
+	variants, err := model2.FindServableVariantsInCollection(ctx, dbx, collection, rendition)
 	if err != nil {
-		log.Printf("binary not found for rendition: %v", err.Error())
-		http.Error(w, "binary not found for rendition", http.StatusNotFound)
-		return
+		log.Printf("could not find variants of rendition %d: %v", rendition.ID, err)
 	}
+	rendition = web.NegotiateRendition(r.Header.Get("Accept"), rendition, variants)
+	w.Header().Add("Vary", "Accept")
 
-	w.Header().Set("Content-Type", rendition.Format)
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-
-	if r.Method == "HEAD" {
-		return
-	}
-
-	written, err := io.Copy(w, bytes.NewReader(data))
-	if err != nil {
-		log.Fatalf("error while writing binary to respose: %s", err.Error())
-	}
-	if written < int64(len(data)) {
-		log.Printf("wrote %d/%d bytes", written, len(data))
-	}
+	web.ServeRendition(w, r, dbx, backend, rendition)
 }
 
 type createCollectionRequest struct {
@@ -226,6 +210,9 @@ func CreateCollectionHandler(w http.ResponseWriter, r *http.Request) {
 func UploadPhotoHandler(w http.ResponseWriter, r *http.Request) {
 	// TODO define error response format
 	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
 	defer r.Body.Close()
 	err := r.ParseMultipartForm(32 << 23)
 	if err != nil {
@@ -246,23 +233,51 @@ func UploadPhotoHandler(w http.ResponseWriter, r *http.Request) {
 
 	dbx := web.DBFromRequest(r)
 	storage := web.StorageBackendFromRequest(r)
+	geocoder := web.GeocoderFromRequest(r)
 	collectionRepo, _ := model2.NewCollectionRepo(dbx)
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
 	photoUpload, err := model2.FromReader(file, fileHeader.Filename)
-	if err != nil {
+	if images.IsUnsupportedFormat(err) || errors.Is(err, model2.ErrInvalidFiletype) {
+		log.Printf("rejected upload %q: %v", fileHeader.Filename, err)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
 		log.Printf("error creating upload from request file %v", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+
+	if user, err := web.UserFromRequest(r); err == nil {
+		photoUpload.UserID = user.ID
+	}
+
+	// An .xmp sidecar with the photo's title, description, keywords, rating and copyright may come with the image.
+	sidecar, sidecarHeader, err := r.FormFile("sidecar")
+	if err == nil {
+		defer sidecar.Close()
+		if !strings.EqualFold(filepath.Ext(sidecarHeader.Filename), ".xmp") {
+			log.Printf("rejected sidecar %q", sidecarHeader.Filename)
+			http.Error(w, "sidecar must be an .xmp file", http.StatusBadRequest)
+			return
+		}
+		photoUpload.Sidecar = sidecar
+	} else if err != http.ErrMissingFile {
+		log.Printf("error parsing form: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel = context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
 
-	queue := web.GetRenditionUpdateRequestQueueFromRequest(r)
-
-	collection, photos, err := collectionRepo.AddPhotos(ctx, dbx, storage, collection, queue, photoUpload)
-	if err != nil {
+	collection, photos, err := collectionRepo.AddPhotos(ctx, dbx, storage, geocoder, collection, photoUpload)
+	if images.IsUnsupportedFormat(errors.Cause(err)) {
+		log.Printf("rejected upload %q: %v", fileHeader.Filename, err)
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	} else if err != nil {
 		log.Printf("could not add photo: %+v", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -306,6 +321,10 @@ func RenditionConfigurationIDsFromQuery(applicableConfigs model.RenditionConfigu
 func ListRecentPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	collection, _ := r.Context().Value("collection").(*db.Collection)
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
 
 	var err error
 	colRepo := model.CollectionRepoFromRequest(r)
@@ -313,7 +332,7 @@ func ListRecentPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	configs := RenditionConfigurationIDsFromQuery(applicableConfigs, r.URL.Query().Get("rendition-configuration-ids"))
 
 	photoRepo := model.PhotoRepoFromRequest(r)
-	photos, paginator, err := photoRepo.List(collection, database.PaginatorFromRequest(r.URL.Query()), configs)
+	photos, paginator, err := photoRepo.List(collection, database.PaginatorFromRequest(r.URL.Query()), configs, filter)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -331,6 +350,61 @@ func ListRecentPhotosHandler(w http.ResponseWriter, r *http.Request) {
 
 func CreatePhotoShareHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
+
+	shareRequest, err := ShareRequestFromRequest(r)
+	if err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	shareRequest.PhotoIDs = []int64{shareRequest.PhotoID}
+	shareRequest.AlbumID = 0
+
+	if _, ok := createShare(w, r, shareRequest); !ok {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.Encode(shareRequest)
+}
+
+// CreateShareHandler shares photos of the collection, in the order given, or an album of the collection with all the
+// photos it has at any time.
+func CreateShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleEditor) {
+		return
+	}
+
+	shareRequest, err := ShareRequestFromRequest(r)
+	if err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(shareRequest.PhotoIDs) > maxSharePhotos {
+		http.Error(w, "too many photos", http.StatusBadRequest)
+		return
+	}
+
+	share, ok := createShare(w, r, shareRequest)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(share); err != nil {
+		log.Printf("could not encode share: %v", err)
+	}
+}
+
+// createShare publishes a share of the photos or album of the collection in the request. Writes an error and returns
+// false if the share could not be published.
+func createShare(w http.ResponseWriter, r *http.Request, shareRequest ShareRequest) (model.Share, bool) {
 	collection, _ := r.Context().Value("collection").(*db.Collection)
 
 	db := model.DBFromRequest(r)
@@ -343,35 +417,47 @@ func CreatePhotoShareHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("error loading rendition configs: %s", err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	shareRequest, err := ShareRequestFromRequest(r)
-	if err != nil {
-		log.Printf("error parsing JSON: %s", err.Error())
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return model.Share{}, false
 	}
 
 	shareSite, err := shareSiteRepo.FindByID(shareRequest.ShareSiteID)
 	if err != nil {
 		log.Printf("cannot find share site: %s", err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return model.Share{}, false
 	}
 
-	photo, err := photoRepo.FindByID(collection, shareRequest.PhotoID)
+	expiresAt, err := shareRequest.Expiry(time.Now())
 	if err != nil {
-		log.Printf("cannot find photo: %s", err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return model.Share{}, false
 	}
 
 	builder := shareSite.Builder().
 		FromCollection(collection).
-		AddPhoto(photo).
+		ExpiresAt(expiresAt).
 		AllowRenditions(shareRequest.FilterRenditionConfigurations(renditionConfigs))
 
+	for _, id := range shareRequest.PhotoIDs {
+		photo, err := photoRepo.FindByID(collection, id)
+		if err != nil {
+			log.Printf("cannot find photo: %s", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return model.Share{}, false
+		}
+		builder = builder.AddPhotos(photo)
+	}
+
+	if shareRequest.AlbumID != 0 {
+		album, err := model.NewAlbumRepository(db).FindByID(*collection, shareRequest.AlbumID)
+		if err != nil {
+			log.Printf("cannot find album: %s", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return model.Share{}, false
+		}
+		builder = builder.FromAlbum(album)
+	}
+
 	if shareRequest.GenerateRandomSlug() {
 		builder = builder.WithRandomSlug()
 	} else {
@@ -381,18 +467,17 @@ func CreatePhotoShareHandler(w http.ResponseWriter, r *http.Request) {
 	share, errors := builder.Build()
 	if len(errors) > 0 {
 		log.Printf("errors from builder: %v", errors)
-		http.Error(w, "error from builder", http.StatusBadRequest)
-		return
+		http.Error(w, errors[0].Error(), http.StatusBadRequest)
+		return model.Share{}, false
 	}
 	share, err = shareRepo.Publish(share)
 	if err != nil {
 		log.Printf("error saving: %s", err.Error())
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return model.Share{}, false
 	}
 
-	encoder := json.NewEncoder(w)
-	encoder.Encode(shareRequest)
+	return share, true
 }
 
 func ShowPhotoHandler(w http.ResponseWriter, r *http.Request) {
@@ -428,6 +513,33 @@ func ShowPhotoHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	photo.Renditions = renditions
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	exif, err := model2.FindExifForPhoto(ctx, web.DBFromRequest(r), model2.Photo{Record: photo.Record})
+	if err != nil {
+		log.Printf("could not load exif tags: %v", err)
+		http.Error(w, "could not load exif tags", http.StatusInternalServerError)
+		return
+	}
+	photo.Exif = exif
+	properties, err := model2.FindMetadataForPhoto(ctx, web.DBFromRequest(r), model2.Photo{Record: photo.Record})
+	if err != nil {
+		log.Printf("could not load photo metadata: %v", err)
+		http.Error(w, "could not load photo metadata", http.StatusInternalServerError)
+		return
+	}
+	photo.Metadata = properties
+	tags, err := model2.NewTagRepo().ForPhoto(ctx, web.DBFromRequest(r), model2.Photo{Record: photo.Record})
+	if err != nil {
+		log.Printf("could not load tags: %v", err)
+		http.Error(w, "could not load tags", http.StatusInternalServerError)
+		return
+	}
+	photo.Tags = []string{}
+	for _, tag := range tags {
+		photo.Tags = append(photo.Tags, tag.Name)
+	}
 	w.Header().Set("Last-Modified", photo.UpdatedAt.Format(http.TimeFormat))
 
 	encoder := json.NewEncoder(w)
@@ -436,33 +548,23 @@ func ShowPhotoHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// DeletePhotoHandler moves the photo to the trash. It can be restored until it is purged.
 func DeletePhotoHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	collection, _ := r.Context().Value("collection").(*db.Collection)
-
-	db := model.DBFromRequest(r)
-	backend := model.StorageFromRequest(r)
-
-	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
-	if err != nil {
-		http.Error(w, "invalid id", http.StatusNotFound)
+	if !requireRole(w, r, model2.RoleEditor) {
 		return
 	}
+	collection := web.CollectionFromRequest(r)
 
-	photoRepo := model.NewPhotoRepository(db, backend)
-	photo, err := photoRepo.FindByID(collection, id)
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		log.Printf("photo not found: %v", err.Error())
-		http.Error(w, "not found", http.StatusNotFound)
+		http.Error(w, "invalid id", http.StatusNotFound)
 		return
 	}
 
-	err = photoRepo.Delete(collection, photo)
-
-	if err != nil {
-		log.Printf("Error deleting photo %s", err.Error())
-		http.Error(w, `{"message":"error deleting photo"}`, http.StatusInternalServerError)
-	}
+	changeTrash(w, r, "delete photo", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model2.NewTrashRepo().TrashPhotos(ctx, tx, collection, []int64{id})
+	})
 }
 func ShowPhotoSharesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -528,6 +630,9 @@ func ListRenditionConfigurationsHandler(w http.ResponseWriter, r *http.Request)
 
 func CreateRenditionConfigurationHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model2.RoleOwner) {
+		return
+	}
 
 	dbx := model.DBFromRequest(r)
 	repo := model.NewRenditionConfigurationRepository(dbx)
@@ -543,6 +648,18 @@ func CreateRenditionConfigurationHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := config.ResizeMode().Validate(config.Width, config.Height); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.MetadataPolicy().Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := images.CanEncode(config.OutputFormat()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	config, err = repo.Save(collection, config)
 	if err != nil {
 		log.Printf("error saving: %s", err.Error())
@@ -559,6 +676,10 @@ func ListPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	collection, _ := r.Context().Value("collection").(*db.Collection)
 
 	paginator := database.PaginatorFromRequest(r.URL.Query())
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
 
 	db := model.DBFromRequest(r)
 	backend := model.StorageFromRequest(r)
@@ -568,7 +689,7 @@ func ListPhotosHandler(w http.ResponseWriter, r *http.Request) {
 	configs := RenditionConfigurationIDsFromQuery(applicableConfigs, r.URL.Query().Get("rendition-configuration-ids"))
 
 	photoRepo := model.NewPhotoRepository(db, backend)
-	photos, paginator, err := photoRepo.List(collection, paginator, configs)
+	photos, paginator, err := photoRepo.List(collection, paginator, configs, filter)
 	if err != nil {
 		log.Fatal(err)
 	}
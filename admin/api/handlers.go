@@ -11,6 +11,8 @@ import (
 	"github.com/ilikeorangutans/phts/web"
 )
 
+// RequireCollection looks up the collection with the slug in the current url params and stores it in the context. If the
+// current user is not a member of the collection, 404 is returned.
 func RequireCollection(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		slug := chi.URLParam(r, "slug")
@@ -30,7 +32,8 @@ func RequireCollection(next http.Handler) http.Handler {
 }
 
 // RequireCollectionBySlug checks the current url params for a slug and looks up the collection with that slug and stores it in the context.
-// If no such collection exists for the current user, 404 is returned.
+// If no such collection exists for the current user, 404 is returned. Viewers may only read, anything but GET and HEAD
+// requests returns 403 for them.
 func RequireCollectionBySlug(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		slug := chi.URLParam(r, "slug")
@@ -51,6 +54,10 @@ func RequireCollectionBySlug(next http.Handler) http.Handler {
 			http.NotFound(w, r)
 			return
 		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !col.Role.Allows(model2.RoleEditor) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
 
 		ctx = context.WithValue(r.Context(), web.CollectionKey, col)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -58,3 +65,13 @@ func RequireCollectionBySlug(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(fn)
 }
+
+// requireRole writes forbidden unless the role of the current user in the collection of the request allows the given
+// role. Returns whether it does.
+func requireRole(w http.ResponseWriter, r *http.Request, role model2.Role) bool {
+	if !web.CollectionFromRequest(r).Role.Allows(role) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return false
+	}
+	return true
+}
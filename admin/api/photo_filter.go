@@ -0,0 +1,36 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/pql"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// photoFilterFromRequest reads the photo filter of the request. Ratings are those of the user making the request. If
+// the filter is invalid it writes a bad request, with the error pointing at the offending token for invalid queries,
+// and returns false.
+func photoFilterFromRequest(w http.ResponseWriter, r *http.Request) (db.PhotoFilter, bool) {
+	filter, err := db.PhotoFilterFromQuery(r.URL.Query())
+	if err == nil {
+		if user, err := web.UserFromRequest(r); err == nil {
+			filter.RatedBy = user.ID
+		}
+		return filter, true
+	}
+
+	queryErr, ok := err.(*pql.Error)
+	if !ok {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return filter, false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if err := json.NewEncoder(w).Encode(queryErr); err != nil {
+		log.Printf("could not encode query error: %v", err)
+	}
+	return filter, false
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// boundingBoxFromQuery reads the north, south, east and west query parameters.
+func boundingBoxFromQuery(query url.Values) (model.BoundingBox, error) {
+	var box model.BoundingBox
+	for _, edge := range []struct {
+		name  string
+		value *float64
+	}{
+		{"north", &box.North},
+		{"south", &box.South},
+		{"east", &box.East},
+		{"west", &box.West},
+	} {
+		value, err := strconv.ParseFloat(query.Get(edge.name), 64)
+		if err != nil {
+			return box, fmt.Errorf("invalid or missing %s", edge.name)
+		}
+		*edge.value = value
+	}
+
+	return box, box.Validate()
+}
+
+// ListPhotosInBoundingBoxHandler lists the photos in the collection taken inside the bounding box given by the north,
+// south, east and west query parameters. They can be filtered by place with the city, region and country parameters
+// and by a query like tag:family rating>=4 with the query parameter.
+func ListPhotosInBoundingBoxHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	box, err := boundingBoxFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	photos, paginator, err := model.NewPhotoRepo().ListInBoundingBox(ctx, dbx, collection, box, filter, database.PaginatorFromRequest(r.URL.Query()))
+	if err != nil {
+		log.Printf("could not list photos in bounding box: %+v", err)
+		http.Error(w, "could not list photos", http.StatusInternalServerError)
+		return
+	}
+
+	resp := ResponseWithPaginator{
+		Data:      photos,
+		Paginator: paginator,
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("could not encode photos: %v", err)
+	}
+}
+
+// PhotoLocationClustersHandler returns the number of photos per grid cell inside the bounding box given by the
+// north, south, east and west query parameters. The zoom parameter is the map zoom level that decides the size of the
+// cells, it defaults to 0.
+func PhotoLocationClustersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	box, err := boundingBoxFromQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	zoom := 0
+	if s := r.URL.Query().Get("zoom"); s != "" {
+		zoom, err = strconv.Atoi(s)
+		if err != nil || zoom < 0 || zoom > model.MaxClusterZoom {
+			http.Error(w, fmt.Sprintf("zoom must be between 0 and %d", model.MaxClusterZoom), http.StatusBadRequest)
+			return
+		}
+	}
+
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	clusters, err := model.NewPhotoRepo().ClusterInBoundingBox(ctx, dbx, collection, box, filter, zoom)
+	if err != nil {
+		log.Printf("could not cluster photos: %+v", err)
+		http.Error(w, "could not cluster photos", http.StatusInternalServerError)
+		return
+	}
+
+	resp := struct {
+		Zoom     int                     `json:"zoom"`
+		CellSize float64                 `json:"cellSize"`
+		Clusters []model.LocationCluster `json:"clusters"`
+	}{
+		Zoom:     zoom,
+		CellSize: model.ClusterCellSize(zoom),
+		Clusters: clusters,
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("could not encode clusters: %v", err)
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// maxTransferPhotos is the number of photos that can be moved or copied in one request.
+const maxTransferPhotos = 500
+
+// transferPhotosRequest names the collection to move or copy photos to and what happens to their album memberships
+// and shares. PhotoIDs is only read by the bulk endpoints.
+type transferPhotosRequest struct {
+	model.TransferOptions
+	TargetCollectionID int64   `json:"targetCollectionID"`
+	PhotoIDs           []int64 `json:"photoIDs"`
+}
+
+// MovePhotoHandler moves a single photo of the collection to another collection of the user.
+func MovePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	transferPhotoHandler(w, r, true)
+}
+
+// CopyPhotoHandler copies a single photo of the collection to another collection of the user.
+func CopyPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	transferPhotoHandler(w, r, false)
+}
+
+// BulkMovePhotosHandler moves photos of the collection to another collection of the user.
+func BulkMovePhotosHandler(w http.ResponseWriter, r *http.Request) {
+	transferPhotosHandler(w, r, true)
+}
+
+// BulkCopyPhotosHandler copies photos of the collection to another collection of the user.
+func BulkCopyPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	transferPhotosHandler(w, r, false)
+}
+
+func transferPhotoHandler(w http.ResponseWriter, r *http.Request, move bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	var req transferPhotosRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	photos, ok := transferPhotos(w, r, req, []int64{id}, move)
+	if !ok {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(photos[0]); err != nil {
+		log.Printf("could not encode photo: %v", err)
+	}
+}
+
+func transferPhotosHandler(w http.ResponseWriter, r *http.Request, move bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req transferPhotosRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.PhotoIDs) == 0 {
+		http.Error(w, "no photos given", http.StatusBadRequest)
+		return
+	}
+	if len(req.PhotoIDs) > maxTransferPhotos {
+		http.Error(w, "too many photos", http.StatusBadRequest)
+		return
+	}
+
+	photos, ok := transferPhotos(w, r, req, req.PhotoIDs, move)
+	if !ok {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(photos); err != nil {
+		log.Printf("could not encode photos: %v", err)
+	}
+}
+
+// transferPhotos moves or copies the given photos of the collection in the request to the target collection. The
+// target has to be a collection the user may edit. Writes an error and returns false if the photos could not be
+// transferred.
+func transferPhotos(w http.ResponseWriter, r *http.Request, req transferPhotosRequest, photoIDs []int64, move bool) ([]model.Photo, bool) {
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+	backend := web.StorageBackendFromRequest(r)
+	action := "copy photos"
+	if move {
+		action = "move photos"
+	}
+
+	user, err := web.UserFromRequest(r)
+	if err != nil {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return nil, false
+	}
+	if err := req.Validate(move); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if req.TargetCollectionID == collection.ID {
+		http.Error(w, model.ErrSameCollection.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+
+	collectionRepo, _ := model.NewCollectionRepo(dbx)
+	target, err := collectionRepo.FindByIDAndUser(ctx, dbx, req.TargetCollectionID, user)
+	if errors.Cause(err) == sql.ErrNoRows {
+		http.Error(w, "target collection not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("could not find collection %d: %+v", req.TargetCollectionID, err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return nil, false
+	}
+	if !target.Role.Allows(model.RoleEditor) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return nil, false
+	}
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Moving leaves binaries of dropped renditions behind which can only go once the move is committed, copying
+	// writes binaries of new renditions which have to go if it isn't.
+	var photos []model.Photo
+	var renditionIDs []int64
+	photoRepo := model.NewPhotoRepo()
+	if move {
+		photos, renditionIDs, err = photoRepo.MovePhotos(ctx, tx, collection, target, photoIDs, req.TransferOptions)
+	} else {
+		photos, renditionIDs, err = photoRepo.CopyPhotos(ctx, tx, backend, collection, target, photoIDs, req.TransferOptions)
+	}
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil && !move {
+		for _, id := range renditionIDs {
+			if err := backend.Delete(id); err != nil {
+				log.Printf("could not delete binary of rendition %d: %v", id, err)
+			}
+		}
+	}
+
+	if err == model.ErrPhotoNotInCollection {
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("could not %s: %+v", action, err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if move {
+		for _, id := range renditionIDs {
+			if err := backend.Delete(id); err != nil {
+				log.Printf("could not delete binary of rendition %d: %v", id, err)
+			}
+		}
+	}
+
+	return photos, true
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+type focalPointRequest struct {
+	// FocalPoint is the new focal point, null clears it.
+	FocalPoint *images.FocalPoint `json:"focalPoint"`
+}
+
+// SetPhotoFocalPointHandler sets or clears the focal point of a photo. Its fill renditions are marked outdated and the
+// photo is queued so they get cropped around the new focal point.
+func SetPhotoFocalPointHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	var req focalPointRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.FocalPoint != nil {
+		if err := req.FocalPoint.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	photoRepo := model.NewPhotoRepo()
+	photo, err := photoRepo.FindInCollection(ctx, dbx, collection, id)
+	if err != nil {
+		log.Printf("photo not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not set focal point", http.StatusInternalServerError)
+		return
+	}
+
+	photo, outdated, err := photoRepo.SetFocalPoint(ctx, tx, photo, req.FocalPoint)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("could not set focal point: %+v", err)
+		http.Error(w, "could not set focal point", http.StatusInternalServerError)
+		return
+	}
+
+	if outdated > 0 {
+		if err := model.NewRenditionJobRepo().Enqueue(ctx, tx, photo.ID); err != nil {
+			tx.Rollback()
+			log.Printf("could not enqueue rendition job: %+v", err)
+			http.Error(w, "could not set focal point", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not set focal point", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(photo); err != nil {
+		log.Printf("could not encode photo: %v", err)
+	}
+}
+
+// maxBulkUpdatePhotos is the number of photos that can be updated in one request.
+const maxBulkUpdatePhotos = 500
+
+// photoChangeRequest changes the editable fields of photos. Fields left out are not changed.
+type photoChangeRequest struct {
+	Description *string `json:"description"`
+	// TakenAt is an RFC 3339 time like 2019-07-14T18:30:00+02:00. If Timezone is set it may leave out the offset and
+	// is converted to that zone. The photo keeps the local time and the offset of the zone.
+	TakenAt *string `json:"takenAt"`
+	// Timezone is the name of a zone like Europe/Lisbon.
+	Timezone  string `json:"timezone"`
+	Published *bool  `json:"published"`
+}
+
+// change returns the photo change of this request.
+func (req photoChangeRequest) change() (model.PhotoChange, error) {
+	change := model.PhotoChange{Description: req.Description, Published: req.Published}
+	if req.TakenAt != nil {
+		takenAt, err := parseTakenAt(*req.TakenAt, req.Timezone)
+		if err != nil {
+			return change, err
+		}
+		change.TakenAt = &takenAt
+	} else if req.Timezone != "" {
+		return change, fmt.Errorf("timezone given without takenAt")
+	}
+	return change, change.Validate()
+}
+
+// parseTakenAt parses an RFC 3339 time in the given zone. Without a zone the time must have an offset.
+func parseTakenAt(s, zone string) (time.Time, error) {
+	if zone == "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return t, fmt.Errorf("takenAt must be a time like 2019-07-14T18:30:00+02:00")
+		}
+		return t, nil
+	}
+
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown timezone %q", zone)
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.In(location), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02T15:04:05", s, location)
+	if err != nil {
+		return t, fmt.Errorf("takenAt must be a time like 2019-07-14T18:30:00")
+	}
+	return t, nil
+}
+
+type updatePhotoRequest struct {
+	photoChangeRequest
+	// UpdatedAt is when the photo was last updated as the client knows it. The update fails if it changed since.
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
+
+// photoVersion identifies a photo as the client knows it.
+type photoVersion struct {
+	ID        int64     `json:"id"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type bulkUpdatePhotosRequest struct {
+	photoChangeRequest
+	Photos []photoVersion `json:"photos"`
+}
+
+// photoConflictResponse lists photos that were updated since the client read them, as they are now.
+type photoConflictResponse struct {
+	Error  string        `json:"error"`
+	Photos []model.Photo `json:"photos"`
+}
+
+// UpdatePhotoHandler changes the description, capture time or published flag of a photo. The request must have the
+// updatedAt time of the photo; if the photo was updated since, it responds with a conflict and the photo as it is now.
+func UpdatePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	var req updatePhotoRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.UpdatedAt == nil {
+		http.Error(w, "missing updatedAt", http.StatusBadRequest)
+		return
+	}
+	change, err := req.change()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	photo, err := model.NewPhotoRepo().Change(ctx, dbx, collection, id, *req.UpdatedAt, change)
+	if err == model.ErrPhotoNotInCollection {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	} else if err == model.ErrPhotoModified {
+		encodePhotoConflict(w, []model.Photo{photo})
+		return
+	} else if err != nil {
+		log.Printf("could not update photo %d: %+v", id, err)
+		http.Error(w, "could not update photo", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(photo); err != nil {
+		log.Printf("could not encode photo: %v", err)
+	}
+}
+
+// BulkUpdatePhotosHandler applies the same change to several photos in one transaction. Each photo is given with the
+// updatedAt time the client knows; if any of them was updated since, nothing is changed and it responds with a conflict
+// listing those photos as they are now.
+func BulkUpdatePhotosHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	var req bulkUpdatePhotosRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Photos) == 0 {
+		http.Error(w, "no photos given", http.StatusBadRequest)
+		return
+	}
+	if len(req.Photos) > maxBulkUpdatePhotos {
+		http.Error(w, "too many photos", http.StatusBadRequest)
+		return
+	}
+	change, err := req.change()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not update photos", http.StatusInternalServerError)
+		return
+	}
+
+	photoRepo := model.NewPhotoRepo()
+	photos := []model.Photo{}
+	conflicts := []model.Photo{}
+	for _, version := range req.Photos {
+		photo, err := photoRepo.Change(ctx, tx, collection, version.ID, version.UpdatedAt, change)
+		if err == model.ErrPhotoModified {
+			conflicts = append(conflicts, photo)
+			continue
+		} else if err == model.ErrPhotoNotInCollection {
+			tx.Rollback()
+			http.Error(w, fmt.Sprintf("photo %d not found", version.ID), http.StatusNotFound)
+			return
+		} else if err != nil {
+			tx.Rollback()
+			log.Printf("could not update photo %d: %+v", version.ID, err)
+			http.Error(w, "could not update photos", http.StatusInternalServerError)
+			return
+		}
+		photos = append(photos, photo)
+	}
+
+	if len(conflicts) > 0 {
+		tx.Rollback()
+		encodePhotoConflict(w, conflicts)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not update photos", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(photos); err != nil {
+		log.Printf("could not encode photos: %v", err)
+	}
+}
+
+func encodePhotoConflict(w http.ResponseWriter, photos []model.Photo) {
+	w.WriteHeader(http.StatusConflict)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(photoConflictResponse{Error: "photo was modified", Photos: photos}); err != nil {
+		log.Printf("could not encode conflict: %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// maxBulkRatePhotos is the number of photos that can be rated in one request.
+const maxBulkRatePhotos = 500
+
+// ratingChangeRequest changes the rating, favorite flag or color label of photos. Fields left out are not changed.
+type ratingChangeRequest struct {
+	model.RatingChange
+	// PhotoIDs are the photos to change, only used for bulk changes.
+	PhotoIDs []int64 `json:"photoIDs"`
+}
+
+// ShowPhotoRatingHandler returns how the user rated a photo.
+func ShowPhotoRatingHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+	user, err := web.UserFromRequest(r)
+	if err != nil {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	photo, err := model.NewPhotoRepo().FindInCollection(ctx, dbx, collection, id)
+	if err != nil {
+		log.Printf("photo not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	rating, err := model.NewRatingRepo().ForPhoto(ctx, dbx, user, photo)
+	if err != nil {
+		log.Printf("could not get rating of photo %d: %+v", photo.ID, err)
+		http.Error(w, "could not get rating", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(rating); err != nil {
+		log.Printf("could not encode rating: %v", err)
+	}
+}
+
+// RatePhotoHandler changes how the user rated a photo and returns the new rating.
+func RatePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	req, ok := decodeRatingChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	req.PhotoIDs = []int64{id}
+
+	ratings, ok := ratePhotos(w, r, req)
+	if !ok {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ratings[0]); err != nil {
+		log.Printf("could not encode rating: %v", err)
+	}
+}
+
+// BulkRatePhotosHandler applies the same rating change to several photos at once. All photos must be in the
+// collection.
+func BulkRatePhotosHandler(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeRatingChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(req.PhotoIDs) == 0 {
+		http.Error(w, "no photos given", http.StatusBadRequest)
+		return
+	}
+	if len(req.PhotoIDs) > maxBulkRatePhotos {
+		http.Error(w, "too many photos", http.StatusBadRequest)
+		return
+	}
+
+	ratings, ok := ratePhotos(w, r, req)
+	if !ok {
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(ratings); err != nil {
+		log.Printf("could not encode ratings: %v", err)
+	}
+}
+
+// decodeRatingChangeRequest decodes and validates a rating change request. Writes an error and returns false if the
+// request is invalid.
+func decodeRatingChangeRequest(w http.ResponseWriter, r *http.Request) (ratingChangeRequest, bool) {
+	w.Header().Set("Content-Type", "application/json")
+	var req ratingChangeRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	if req.Empty() {
+		http.Error(w, "no changes given", http.StatusBadRequest)
+		return req, false
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// ratePhotos applies the rating change of the request in a transaction. Writes an error and returns false if it fails.
+func ratePhotos(w http.ResponseWriter, r *http.Request, req ratingChangeRequest) ([]model.PhotoRating, bool) {
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+	user, err := web.UserFromRequest(r)
+	if err != nil {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not rate photos", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	ratings, err := model.NewRatingRepo().Rate(ctx, tx, user, collection, req.PhotoIDs, req.RatingChange)
+	if err == model.ErrPhotoNotInCollection {
+		tx.Rollback()
+		http.Error(w, "not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("could not rate photos: %+v", err)
+		http.Error(w, "could not rate photos", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not rate photos", http.StatusInternalServerError)
+		return nil, false
+	}
+	return ratings, true
+}
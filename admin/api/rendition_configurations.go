@@ -0,0 +1,230 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+type renditionConfigurationResponse struct {
+	model.RenditionConfiguration
+	// Progress tells how many photos in the collection already have a rendition made from the current version.
+	Progress model.RenditionConfigurationProgress `json:"progress"`
+	// Enqueued is the number of rendition jobs that were enqueued to bring outdated renditions up to date.
+	Enqueued int64 `json:"enqueued,omitempty"`
+}
+
+// renditionConfigurationFromRequest finds the rendition configuration in the url params in the current collection.
+func renditionConfigurationFromRequest(ctx context.Context, r *http.Request) (model.RenditionConfiguration, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "configID"), 10, 64)
+	if err != nil {
+		return model.RenditionConfiguration{}, errors.Wrap(err, "invalid id")
+	}
+
+	return model.FindRenditionConfigurationInCollection(ctx, web.DBFromRequest(r), web.CollectionFromRequest(r), id)
+}
+
+func encodeRenditionConfiguration(w http.ResponseWriter, resp renditionConfigurationResponse) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("could not encode rendition configuration: %v", err)
+	}
+}
+
+// ShowRenditionConfigurationHandler shows a rendition configuration together with the progress of bringing the
+// collection's renditions up to date with its current version.
+func ShowRenditionConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	config, err := renditionConfigurationFromRequest(ctx, r)
+	if err != nil {
+		log.Printf("rendition configuration not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	progress, err := model.FindRenditionConfigurationProgress(ctx, dbx, collection, config)
+	if err != nil {
+		log.Printf("could not find progress: %+v", err)
+		http.Error(w, "could not find progress", http.StatusInternalServerError)
+		return
+	}
+
+	encodeRenditionConfiguration(w, renditionConfigurationResponse{RenditionConfiguration: config, Progress: progress})
+}
+
+// UpdateRenditionConfigurationHandler updates a rendition configuration of the current collection. Fields missing
+// from the request keep their current value. If the change makes existing renditions outdated, all photos in the
+// collection are queued for regeneration.
+func UpdateRenditionConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleOwner) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	existing, err := renditionConfigurationFromRequest(ctx, r)
+	if err != nil {
+		log.Printf("rendition configuration not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	config := existing
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&config); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Only the rendering and caching settings may be changed.
+	config.Record = existing.Record
+	config.Timestamps = existing.Timestamps
+	config.CollectionID = existing.CollectionID
+	config.Original = existing.Original
+	config.Private = existing.Private
+	config.Version = existing.Version
+
+	if config.Quality < 1 || config.Quality > 100 {
+		http.Error(w, "quality must be between 1 and 100", http.StatusBadRequest)
+		return
+	}
+	if config.Width < 0 || config.Height < 0 {
+		http.Error(w, "width and height must not be negative", http.StatusBadRequest)
+		return
+	}
+	if err := config.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if existing.Shareable() && !config.Shareable() {
+		shared, err := model.IsRenditionConfigurationShared(ctx, dbx, existing)
+		if err != nil {
+			log.Printf("could not check shares: %+v", err)
+			http.Error(w, "could not update rendition configuration", http.StatusInternalServerError)
+			return
+		}
+		if shared {
+			http.Error(w, "rendition configuration is shared and must strip all metadata", http.StatusConflict)
+			return
+		}
+	}
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not update rendition configuration", http.StatusInternalServerError)
+		return
+	}
+
+	config, err = model.UpdateRenditionConfiguration(ctx, tx, config)
+	if err == model.ErrSystemRenditionConfiguration {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("could not update rendition configuration: %+v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var enqueued int64
+	if config.Version != existing.Version {
+		enqueued, err = model.NewRenditionJobRepo().EnqueueCollection(ctx, tx, collection)
+		if err != nil {
+			tx.Rollback()
+			log.Printf("could not enqueue rendition jobs: %+v", err)
+			http.Error(w, "could not update rendition configuration", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not update rendition configuration", http.StatusInternalServerError)
+		return
+	}
+
+	progress, err := model.FindRenditionConfigurationProgress(ctx, dbx, collection, config)
+	if err != nil {
+		log.Printf("could not find progress: %+v", err)
+		http.Error(w, "could not find progress", http.StatusInternalServerError)
+		return
+	}
+
+	encodeRenditionConfiguration(w, renditionConfigurationResponse{RenditionConfiguration: config, Progress: progress, Enqueued: enqueued})
+}
+
+// DeleteRenditionConfigurationHandler deletes a rendition configuration of the current collection, all renditions
+// made from it, and their binaries.
+func DeleteRenditionConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleOwner) {
+		return
+	}
+	dbx := web.DBFromRequest(r)
+	backend := web.StorageBackendFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	config, err := renditionConfigurationFromRequest(ctx, r)
+	if err != nil {
+		log.Printf("rendition configuration not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not delete rendition configuration", http.StatusInternalServerError)
+		return
+	}
+
+	renditionIDs, err := model.DeleteRenditionConfiguration(ctx, tx, config)
+	if err == model.ErrSystemRenditionConfiguration {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("could not delete rendition configuration: %+v", err)
+		http.Error(w, "could not delete rendition configuration", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not delete rendition configuration", http.StatusInternalServerError)
+		return
+	}
+
+	for _, id := range renditionIDs {
+		if err := backend.Delete(id); err != nil {
+			log.Printf("could not delete binary for rendition %d: %v", id, err)
+		}
+	}
+
+	encodeRenditionConfiguration(w, renditionConfigurationResponse{RenditionConfiguration: config})
+}
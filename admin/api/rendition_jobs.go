@@ -0,0 +1,212 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// defaultRenditionJobStates are listed when the request does not ask for specific states.
+var defaultRenditionJobStates = []model.RenditionJobState{
+	model.RenditionJobPending,
+	model.RenditionJobRunning,
+	model.RenditionJobFailed,
+}
+
+// renditionJobStatesFromQuery parses a comma separated list of job states such as "failed,running".
+func renditionJobStatesFromQuery(states string) ([]model.RenditionJobState, error) {
+	if len(states) == 0 {
+		return defaultRenditionJobStates, nil
+	}
+
+	var result []model.RenditionJobState
+	for _, s := range strings.Split(states, ",") {
+		state, err := model.ParseRenditionJobState(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, state)
+	}
+
+	return result, nil
+}
+
+// RequireRenditionJob looks up the rendition job from the url params in the current collection and stores it in the
+// context. If there is no such job, 404 is returned.
+func RequireRenditionJob(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "jobID"), 10, 64)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		collection := web.CollectionFromRequest(r)
+		dbx := web.DBFromRequest(r)
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		job, err := model.NewRenditionJobRepo().FindInCollection(ctx, dbx, collection, id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(web.AddRenditionJobToContext(r.Context(), job)))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// ListRenditionJobsHandler lists the rendition jobs of all photos in the current collection. The states to list can
+// be given as a comma separated list in the state query parameter; by default pending, running and failed jobs are
+// listed.
+func ListRenditionJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	states, err := renditionJobStatesFromQuery(r.URL.Query().Get("state"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	jobs, paginator, err := model.NewRenditionJobRepo().ListInCollection(ctx, dbx, collection, states, database.PaginatorFromRequest(r.URL.Query()))
+	if err != nil {
+		log.Printf("could not list rendition jobs: %+v", err)
+		http.Error(w, "could not list rendition jobs", http.StatusInternalServerError)
+		return
+	}
+
+	encodeRenditionJobs(w, jobs, paginator)
+}
+
+// ListPhotoRenditionJobsHandler lists the rendition jobs of a single photo in the current collection. Accepts the
+// same state query parameter as ListRenditionJobsHandler.
+func ListPhotoRenditionJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	photoID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	states, err := renditionJobStatesFromQuery(r.URL.Query().Get("state"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	jobs, paginator, err := model.NewRenditionJobRepo().ListForPhoto(ctx, dbx, collection, photoID, states, database.PaginatorFromRequest(r.URL.Query()))
+	if err != nil {
+		log.Printf("could not list rendition jobs: %+v", err)
+		http.Error(w, "could not list rendition jobs", http.StatusInternalServerError)
+		return
+	}
+
+	encodeRenditionJobs(w, jobs, paginator)
+}
+
+func encodeRenditionJobs(w http.ResponseWriter, jobs []model.RenditionJob, paginator database.Paginator) {
+	resp := ResponseWithPaginator{
+		Data:      jobs,
+		Paginator: paginator,
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("could not encode rendition jobs: %v", err)
+	}
+}
+
+func ShowRenditionJobHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encodeRenditionJob(w, web.RenditionJobFromRequest(r))
+}
+
+// RetryRenditionJobHandler puts a failed or cancelled job back into the queue.
+func RetryRenditionJobHandler(w http.ResponseWriter, r *http.Request) {
+	transitionRenditionJob(w, r, (*model.RenditionJobRepo).Retry)
+}
+
+// CancelRenditionJobHandler cancels a pending, running or failed job.
+func CancelRenditionJobHandler(w http.ResponseWriter, r *http.Request) {
+	transitionRenditionJob(w, r, (*model.RenditionJobRepo).Cancel)
+}
+
+type renditionJobTransition func(*model.RenditionJobRepo, context.Context, sqlx.QueryerContext, model.RenditionJob) (model.RenditionJob, error)
+
+func transitionRenditionJob(w http.ResponseWriter, r *http.Request, transition renditionJobTransition) {
+	w.Header().Set("Content-Type", "application/json")
+	job := web.RenditionJobFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	job, err := transition(model.NewRenditionJobRepo(), ctx, dbx, job)
+	if errors.Is(err, model.ErrRenditionJobStateConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("could not update rendition job %d: %+v", job.ID, err)
+		http.Error(w, "could not update rendition job", http.StatusInternalServerError)
+		return
+	}
+
+	encodeRenditionJob(w, job)
+}
+
+func encodeRenditionJob(w http.ResponseWriter, job model.RenditionJob) {
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(job); err != nil {
+		log.Printf("could not encode rendition job: %v", err)
+	}
+}
+
+type requeueRenditionJobsResponse struct {
+	Requeued int64 `json:"requeued"`
+}
+
+// RequeueFailedRenditionJobsHandler retries all failed rendition jobs in the current collection.
+func RequeueFailedRenditionJobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	n, err := model.NewRenditionJobRepo().RequeueFailedInCollection(ctx, dbx, collection)
+	if err != nil {
+		log.Printf("could not requeue rendition jobs: %+v", err)
+		http.Error(w, "could not requeue rendition jobs", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(requeueRenditionJobsResponse{Requeued: n}); err != nil {
+		log.Printf("could not encode response: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+type searchResponse struct {
+	Data      []model.SearchResult     `json:"data"`
+	Paginator database.OffsetPaginator `json:"paginator"`
+}
+
+// SearchHandler searches the photos in all collections of the user for the q query parameter. Results are ranked and
+// paginated with the limit, offset, orderBy and order parameters, and can be filtered like photo listings.
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	dbx := web.DBFromRequest(r)
+	user, err := web.UserFromRequest(r)
+	if err != nil {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	if model.SearchQuery(query.Get("q")) == "" {
+		http.Error(w, "missing or empty q", http.StatusBadRequest)
+		return
+	}
+
+	filter, ok := photoFilterFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	results, paginator, err := model.NewPhotoRepo().Search(ctx, dbx, user, query.Get("q"), filter, model.SearchPaginator.PaginatorFromQuery(query))
+	if err != nil {
+		log.Printf("could not search photos: %+v", err)
+		http.Error(w, "could not search photos", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(searchResponse{Data: results, Paginator: paginator}); err != nil {
+		log.Printf("could not encode search results: %v", err)
+	}
+}
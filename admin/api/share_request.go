@@ -3,6 +3,11 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
 
 	"github.com/ilikeorangutans/phts/model"
 )
@@ -14,8 +19,61 @@ func ShareRequestFromRequest(r *http.Request) (result ShareRequest, err error) {
 	return result, err
 }
 
+// maxSharePhotos is the number of photos that can be picked for one share.
+const maxSharePhotos = 500
+
+// ShareExpiry is when a share expires, either at an absolute time or after a duration like "36h" or "7d". A share
+// without either never expires.
+type ShareExpiry struct {
+	ExpiresAt *time.Time `json:"expiresAt"`
+	ExpiresIn string     `json:"expiresIn"`
+}
+
+// Expiry returns when the share expires if it is published at the given time, or nil if it never does.
+func (s ShareExpiry) Expiry(now time.Time) (*time.Time, error) {
+	if s.ExpiresAt != nil && s.ExpiresIn != "" {
+		return nil, errors.New("give either expiresAt or expiresIn, not both")
+	}
+	if s.ExpiresAt != nil {
+		if !s.ExpiresAt.After(now) {
+			return nil, errors.New("expiresAt must be in the future")
+		}
+		return s.ExpiresAt, nil
+	}
+	if s.ExpiresIn == "" {
+		return nil, nil
+	}
+
+	duration, err := parseExpiresIn(s.ExpiresIn)
+	if err != nil {
+		return nil, errors.Errorf("invalid expiresIn %q", s.ExpiresIn)
+	}
+	if duration <= 0 {
+		return nil, errors.New("expiresIn must be positive")
+	}
+	expiresAt := now.Add(duration)
+	return &expiresAt, nil
+}
+
+// parseExpiresIn parses a duration as understood by time.ParseDuration, or a number of days like "7d".
+func parseExpiresIn(input string) (time.Duration, error) {
+	if strings.HasSuffix(input, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(input, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(input)
+}
+
+// ShareRequest describes a share to publish. A share is either of the photos in PhotoIDs, in that order, or of the
+// album with AlbumID. PhotoID is read by the endpoint sharing a single photo.
 type ShareRequest struct {
+	ShareExpiry
 	PhotoID           int64   `json:"photoID"`
+	PhotoIDs          []int64 `json:"photoIDs"`
+	AlbumID           int64   `json:"albumID"`
 	ShareSiteID       int64   `json:"shareSiteID"`
 	SlugStrategy      string  `json:"slugStrategy"`
 	Slug              string  `json:"slug"`
@@ -30,7 +88,12 @@ func (s ShareRequest) FilterRenditionConfigurations(input model.RenditionConfigu
 	result := model.RenditionConfigurations{}
 	if len(s.AllowedRenditions) == 0 {
 		// TODO not sure if this is a good default
-		return input
+		for _, config := range input {
+			if config.Shareable() {
+				result = append(result, config)
+			}
+		}
+		return result
 	}
 
 	for _, config := range input {
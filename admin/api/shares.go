@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// UpdateShareHandler changes when a share of the collection expires. The expiry is replaced by the one in the
+// request, so a request without expiresAt and expiresIn makes the share never expire.
+func UpdateShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleEditor) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+
+	var req ShareExpiry
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	expiresAt, err := req.Expiry(time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changeShare(w, r, "update share", func(ctx context.Context, tx *sqlx.Tx, id int64) (model.Share, error) {
+		return model.NewShareRepo().SetExpiry(ctx, tx, collection, id, expiresAt)
+	})
+}
+
+// RevokeShareHandler stops a share of the collection from being served until it is unrevoked.
+func RevokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleEditor) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+
+	changeShare(w, r, "revoke share", func(ctx context.Context, tx *sqlx.Tx, id int64) (model.Share, error) {
+		return model.NewShareRepo().Revoke(ctx, tx, collection, id)
+	})
+}
+
+// UnrevokeShareHandler serves a revoked share of the collection again, unless it expired.
+func UnrevokeShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleEditor) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+
+	changeShare(w, r, "unrevoke share", func(ctx context.Context, tx *sqlx.Tx, id int64) (model.Share, error) {
+		return model.NewShareRepo().Unrevoke(ctx, tx, collection, id)
+	})
+}
+
+// DeleteShareHandler deletes a share of the collection for good.
+func DeleteShareHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !requireRole(w, r, model.RoleEditor) {
+		return
+	}
+	collection := web.CollectionFromRequest(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "shareID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	dbx := web.DBFromRequest(r)
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	err = model.NewShareRepo().Delete(ctx, dbx, collection, id)
+	if err == model.ErrShareNotFound {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not delete share: %+v", err)
+		http.Error(w, "could not delete share", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeShare changes the share with the id in the request with the given function in a transaction and writes the
+// changed share. Writes not found if the share is not in the collection, or an error naming the action if it fails.
+func changeShare(w http.ResponseWriter, r *http.Request, action string, f func(ctx context.Context, tx *sqlx.Tx, id int64) (model.Share, error)) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "shareID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return
+	}
+
+	share, err := f(ctx, tx, id)
+	if err == model.ErrShareNotFound {
+		tx.Rollback()
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("could not %s: %+v", action, err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(share); err != nil {
+		log.Printf("could not encode share: %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+const (
+	defaultTagAutocompleteLimit = 10
+	maxTagAutocompleteLimit     = 100
+	// maxBulkTagPhotos is the number of photos that can be tagged in one request.
+	maxBulkTagPhotos = 500
+)
+
+// tagChangeRequest lists tags to add to and remove from photos. Tags are added before they are removed.
+type tagChangeRequest struct {
+	// PhotoIDs are the photos to change, only used for bulk changes.
+	PhotoIDs []int64  `json:"photoIDs"`
+	Add      []string `json:"add"`
+	Remove   []string `json:"remove"`
+}
+
+type tagChangeResponse struct {
+	// Added are the tags added to the photos.
+	Added []model.Tag `json:"added"`
+	// Removed is the number of tags removed from photos.
+	Removed int64 `json:"removed"`
+}
+
+// ListTagsHandler lists the tags in the collection starting with the prefix query parameter, ignoring case, for
+// autocompletion. The most used tags come first; the limit parameter sets how many are returned.
+func ListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	limit, err := strconv.ParseUint(r.URL.Query().Get("limit"), 10, 64)
+	if err != nil || limit == 0 || limit > maxTagAutocompleteLimit {
+		limit = defaultTagAutocompleteLimit
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tags, err := model.NewTagRepo().Autocomplete(ctx, dbx, collection, r.URL.Query().Get("prefix"), limit)
+	if err != nil {
+		log.Printf("could not list tags: %+v", err)
+		http.Error(w, "could not list tags", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(tags); err != nil {
+		log.Printf("could not encode tags: %v", err)
+	}
+}
+
+// ListPhotoTagsHandler lists the tags of a photo.
+func ListPhotoTagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	photo, err := model.NewPhotoRepo().FindInCollection(ctx, dbx, collection, id)
+	if err != nil {
+		log.Printf("photo not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	tags, err := model.NewTagRepo().ForPhoto(ctx, dbx, photo)
+	if err != nil {
+		log.Printf("could not list tags of photo %d: %+v", photo.ID, err)
+		http.Error(w, "could not list tags", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(tags); err != nil {
+		log.Printf("could not encode tags: %v", err)
+	}
+}
+
+// UpdatePhotoTagsHandler adds tags to and removes tags from a photo and returns its tags.
+func UpdatePhotoTagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	req, ok := decodeTagChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	req.PhotoIDs = []int64{id}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	photo, err := model.NewPhotoRepo().FindInCollection(ctx, dbx, collection, id)
+	if err != nil {
+		log.Printf("photo not found: %v", err)
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if _, err := changeTags(ctx, dbx, collection, req); err != nil {
+		log.Printf("could not change tags of photo %d: %+v", photo.ID, err)
+		http.Error(w, "could not change tags", http.StatusInternalServerError)
+		return
+	}
+
+	tags, err := model.NewTagRepo().ForPhoto(ctx, dbx, photo)
+	if err != nil {
+		log.Printf("could not list tags of photo %d: %+v", photo.ID, err)
+		http.Error(w, "could not list tags", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(tags); err != nil {
+		log.Printf("could not encode tags: %v", err)
+	}
+}
+
+// BulkUpdatePhotoTagsHandler adds tags to and removes tags from several photos at once. All photos must be in the
+// collection.
+func BulkUpdatePhotoTagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+
+	req, ok := decodeTagChangeRequest(w, r)
+	if !ok {
+		return
+	}
+	if len(req.PhotoIDs) == 0 {
+		http.Error(w, "no photos given", http.StatusBadRequest)
+		return
+	}
+	if len(req.PhotoIDs) > maxBulkTagPhotos {
+		http.Error(w, "too many photos", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	resp, err := changeTags(ctx, dbx, collection, req)
+	if err == model.ErrPhotoNotInCollection {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("could not change tags: %+v", err)
+		http.Error(w, "could not change tags", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(resp); err != nil {
+		log.Printf("could not encode response: %v", err)
+	}
+}
+
+// decodeTagChangeRequest decodes and normalizes the tags of a tag change request. Writes an error and returns false if
+// the request is invalid.
+func decodeTagChangeRequest(w http.ResponseWriter, r *http.Request) (tagChangeRequest, bool) {
+	var req tagChangeRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+
+	var err error
+	if req.Add, err = model.NormalizeTagNames(req.Add); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	if req.Remove, err = model.NormalizeTagNames(req.Remove); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return req, false
+	}
+	return req, true
+}
+
+// changeTags applies the given tag changes in a transaction.
+func changeTags(ctx context.Context, dbx *sqlx.DB, collection model.Collection, req tagChangeRequest) (tagChangeResponse, error) {
+	resp := tagChangeResponse{Added: []model.Tag{}}
+	tagRepo := model.NewTagRepo()
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return resp, errors.Wrap(err, "could not begin transaction")
+	}
+
+	added, err := tagRepo.AddToPhotos(ctx, tx, collection, req.PhotoIDs, req.Add)
+	if err != nil {
+		tx.Rollback()
+		return resp, err
+	}
+	if added != nil {
+		resp.Added = added
+	}
+
+	if resp.Removed, err = tagRepo.RemoveFromPhotos(ctx, tx, collection, req.PhotoIDs, req.Remove); err != nil {
+		tx.Rollback()
+		return resp, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return resp, errors.Wrap(err, "could not commit")
+	}
+	return resp, nil
+}
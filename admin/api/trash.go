@@ -0,0 +1,191 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/web"
+)
+
+// trashResponse lists the trashed photos and albums of a collection. Photos are paginated, most recently trashed
+// first.
+type trashResponse struct {
+	Paginator database.Paginator `json:"paginator"`
+	Photos    []model.Photo      `json:"photos"`
+	Albums    []db.AlbumRecord   `json:"albums"`
+}
+
+// restorePhotosRequest lists the photos to take out of the trash.
+type restorePhotosRequest struct {
+	PhotoIDs []int64 `json:"photoIDs"`
+}
+
+// ListTrashHandler lists the trashed photos and albums of the collection.
+func ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+	dbx := web.DBFromRequest(r)
+	paginator := database.PaginatorFromRequest(r.URL.Query())
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	repo := model.NewTrashRepo()
+	photos, paginator, err := repo.ListPhotos(ctx, dbx, collection, paginator)
+	if err != nil {
+		log.Printf("could not list trashed photos: %+v", err)
+		http.Error(w, "could not list trash", http.StatusInternalServerError)
+		return
+	}
+	albums, err := repo.ListAlbums(ctx, dbx, collection)
+	if err != nil {
+		log.Printf("could not list trashed albums: %+v", err)
+		http.Error(w, "could not list trash", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(trashResponse{Paginator: paginator, Photos: photos, Albums: albums}); err != nil {
+		log.Printf("could not encode trash: %v", err)
+	}
+}
+
+// RestorePhotosHandler takes trashed photos of the collection out of the trash.
+func RestorePhotosHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+
+	var req restorePhotosRequest
+	decoder := json.NewDecoder(r.Body)
+	defer r.Body.Close()
+	if err := decoder.Decode(&req); err != nil {
+		log.Printf("error parsing JSON: %s", err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.PhotoIDs) == 0 {
+		http.Error(w, "no photos given", http.StatusBadRequest)
+		return
+	}
+
+	ok := changeTrash(w, r, "restore photos", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model.NewTrashRepo().RestorePhotos(ctx, tx, collection, req.PhotoIDs)
+	})
+	if ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// RestoreAlbumHandler takes a trashed album of the collection out of the trash.
+func RestoreAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	collection := web.CollectionFromRequest(r)
+
+	albumID, err := strconv.ParseInt(chi.URLParam(r, "albumID"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	ok := changeTrash(w, r, "restore album", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model.NewTrashRepo().RestoreAlbum(ctx, tx, collection, albumID)
+	})
+	if ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ListTrashedCollectionsHandler lists the trashed collections of the user.
+func ListTrashedCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	dbx := web.DBFromRequest(r)
+	user, err := web.UserFromRequest(r)
+	if err != nil {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	collections, err := model.NewTrashRepo().ListCollections(ctx, dbx, user)
+	if err != nil {
+		log.Printf("could not list trashed collections: %+v", err)
+		http.Error(w, "could not list trash", http.StatusInternalServerError)
+		return
+	}
+
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(collections); err != nil {
+		log.Printf("could not encode collections: %v", err)
+	}
+}
+
+// RestoreCollectionHandler takes a trashed collection of the user out of the trash.
+func RestoreCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	user, err := web.UserFromRequest(r)
+	if err != nil {
+		http.Error(w, "no user", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusNotFound)
+		return
+	}
+
+	ok := changeTrash(w, r, "restore collection", func(ctx context.Context, tx *sqlx.Tx) error {
+		return model.NewTrashRepo().RestoreCollection(ctx, tx, user, id)
+	})
+	if ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changeTrash moves things in or out of the trash with the given function in a transaction. Writes not found if
+// there is nothing to move, or an error naming the action if it fails. Returns whether it succeeded.
+func changeTrash(w http.ResponseWriter, r *http.Request, action string, f func(ctx context.Context, tx *sqlx.Tx) error) bool {
+	dbx := web.DBFromRequest(r)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		log.Printf("could not begin transaction: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return false
+	}
+
+	err = f(ctx, tx)
+	if err == model.ErrNotInTrash || err == model.ErrPhotoNotInCollection || err == sql.ErrNoRows {
+		tx.Rollback()
+		http.Error(w, "not found", http.StatusNotFound)
+		return false
+	} else if err != nil {
+		tx.Rollback()
+		log.Printf("could not %s: %+v", action, err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("could not commit: %v", err)
+		http.Error(w, "could not "+action, http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
@@ -1,21 +1,22 @@
 package public
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"io"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/go-chi/chi"
-	"github.com/ilikeorangutans/phts/model"
+	"github.com/ilikeorangutans/phts/pkg/database"
 	newmodel "github.com/ilikeorangutans/phts/pkg/model"
 	"github.com/ilikeorangutans/phts/web"
+	"github.com/pkg/errors"
 )
 
+// ViewShareHandler shows a share with a page of its photos. The page is picked with the offset and limit query
+// parameters. Expired and revoked shares are gone.
 func ViewShareHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -25,22 +26,26 @@ func ViewShareHandler(w http.ResponseWriter, r *http.Request) {
 	slug := chi.URLParam(r, "slug")
 	dbx := web.DBFromRequest(r)
 	shareSite := r.Context().Value(web.ShareSiteKey).(newmodel.ShareSite)
-	share, err := newmodel.FindSharedPhotoBySlug(ctx, dbx, shareSite, slug)
-	if err != nil {
+	paginator := newmodel.SharePhotosPaginator.PaginatorFromQuery(r.URL.Query())
+	share, paginator, err := newmodel.FindSharedPhotosBySlug(ctx, dbx, shareSite, slug, paginator)
+	if errors.Cause(err) == newmodel.ErrShareGone {
+		http.Error(w, "share is gone", http.StatusGone)
+		return
+	} else if err != nil {
 		log.Printf("could not get share: %v", err)
 		http.NotFound(w, r)
 		return
 	}
 
 	encoder := json.NewEncoder(w)
-	err = encoder.Encode(newViewShareResponse(share))
+	err = encoder.Encode(newViewShareResponse(share, paginator))
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func newViewShareResponse(share newmodel.ShareWithPhotos) viewShareResponse {
-	var photos []sharedPhoto
+func newViewShareResponse(share newmodel.ShareWithPhotos, paginator database.OffsetPaginator) viewShareResponse {
+	photos := []sharedPhoto{}
 	for _, photo := range share.Photos {
 		var renditions []sharedRendition
 		for _, rendition := range photo.Renditions {
@@ -74,6 +79,7 @@ func newViewShareResponse(share newmodel.ShareWithPhotos) viewShareResponse {
 			Slug:      share.Share.Slug,
 			CreatedAt: share.Share.CreatedAt,
 		},
+		Paginator:               paginator,
 		Photos:                  photos,
 		RenditionConfigurations: renditions,
 	}
@@ -81,6 +87,7 @@ func newViewShareResponse(share newmodel.ShareWithPhotos) viewShareResponse {
 
 type viewShareResponse struct {
 	Share                   shareResponse                  `json:"share"`
+	Paginator               database.OffsetPaginator       `json:"paginator"`
 	Photos                  []sharedPhoto                  `json:"photos"`
 	RenditionConfigurations []sharedRenditionConfiguration `json:"rendition_configurations"`
 }
@@ -110,17 +117,24 @@ type sharedRendition struct {
 	RenditionConfigurationID int64 `json:"rendition_configuration_id"`
 }
 
+// ServeShareRenditionHandler serves a rendition of a photo in the share. Expired and revoked shares are gone, so
+// caches have to revalidate renditions of shares instead of keeping them for as long as the rendition configuration
+// allows.
 func ServeShareRenditionHandler(w http.ResponseWriter, r *http.Request) {
-	db := model.DBFromRequest(r)
-	storage := model.StorageFromRequest(r)
-	shareSite := r.Context().Value("shareSite").(model.ShareSite)
-	shareRepo := model.NewShareRepository(db)
-	renditionRepo := model.NewRenditionRepository(db)
+	dbx := web.DBFromRequest(r)
+	backend := web.StorageBackendFromRequest(r)
+	shareSite := r.Context().Value(web.ShareSiteKey).(newmodel.ShareSite)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
 
 	slug := chi.URLParam(r, "slug")
 
-	share, err := shareRepo.FindByShareSiteAndSlug(shareSite, slug)
-	if err != nil {
+	share, err := newmodel.FindShareBySiteAndSlug(ctx, dbx, shareSite, slug)
+	if err == newmodel.ErrShareGone {
+		http.Error(w, "share is gone", http.StatusGone)
+		return
+	} else if err != nil {
 		log.Printf("No share found for slug %s and share site %s", slug, shareSite.Domain)
 		http.NotFound(w, r)
 		return
@@ -133,44 +147,20 @@ func ServeShareRenditionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rendition, err := renditionRepo.FindByShareAndID(share, id)
+	rendition, err := newmodel.FindServableRenditionInShare(ctx, dbx, share, id)
 	if err != nil {
 		log.Printf("could not find rendition")
 		http.NotFound(w, r)
 		return
 	}
 
-	w.Header().Set("Last-Modified", rendition.UpdatedAt.Format(http.TimeFormat))
-	w.Header().Set("Cache-Control", "max-age=3600")
-
-	if modifiedSince := r.Header.Get("If-Modified-Since"); modifiedSince != "" {
-		if timestamp, err := time.Parse(http.TimeFormat, modifiedSince); err == nil {
-			if rendition.UpdatedAt.After(timestamp) {
-				w.WriteHeader(http.StatusNotModified)
-				return
-			}
-		}
-	}
-
-	data, err := storage.Get(id)
+	variants, err := newmodel.FindServableVariantsInShare(ctx, dbx, share, rendition)
 	if err != nil {
-		log.Printf("binary not found for rendition: %v", err.Error())
-		http.Error(w, "binary not found for rendition", http.StatusNotFound)
-		return
-	}
-
-	w.Header().Set("Content-Type", rendition.Format)
-	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
-
-	if r.Method == "HEAD" {
-		return
+		log.Printf("could not find variants of rendition %d: %v", rendition.ID, err)
 	}
+	rendition = web.NegotiateRendition(r.Header.Get("Accept"), rendition, variants)
+	rendition.CacheControl = "no-cache"
+	w.Header().Add("Vary", "Accept")
 
-	written, err := io.Copy(w, bytes.NewReader(data))
-	if err != nil {
-		log.Fatalf("error while writing binary to respose: %s", err.Error())
-	}
-	if written < int64(len(data)) {
-		log.Printf("wrote %d/%d bytes", written, len(data))
-	}
+	web.ServeRendition(w, r, dbx, backend, rendition)
 }
@@ -0,0 +1,152 @@
+package public
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/ilikeorangutans/phts/web"
+	"github.com/jmoiron/sqlx"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveShareRendition stores the given binary as rendition 101 of photo 42 in share 5 and requests it through
+// ServeShareRenditionHandler.
+func serveShareRendition(t *testing.T, binary []byte, format string) *httptest.ResponseRecorder {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	dbx := sqlx.NewDb(conn, "postgres")
+
+	dir, err := ioutil.TempDir("", "phts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	backend := storage.NewFileBackend(dir)
+	if err := backend.Put(101, bytes.NewReader(binary), int64(len(binary)), format); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	renditionColumns := []string{"id", "photo_id", "rendition_configuration_id", "width", "height", "format", "content_hash", "cache_control", "created_at", "updated_at"}
+	mock.ExpectQuery("SELECT \\* FROM shares").
+		WithArgs(3, "holidays").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "album_id", "share_site_id", "slug"}).AddRow(5, 7, nil, 3, "holidays"))
+	mock.ExpectQuery("SELECT r.\\*, rc.cache_control FROM renditions AS r .* WHERE r.photo_id in \\(SELECT photos.id FROM photos join .* WHERE photos.collection_id = \\$3 AND photos.deleted_at IS NULL\\) AND r.id = \\$4 AND rc.metadata = \\$5 AND src.share_id = \\$6").
+		WithArgs(5, nil, 7, 101, "strip", 5).
+		WillReturnRows(sqlmock.NewRows(renditionColumns).AddRow(101, 42, 3, 20, 12, format, "abc", "", now, now))
+	mock.ExpectQuery("SELECT r.\\*, rc.cache_control FROM renditions AS r .* rc.metadata = \\$7 AND src.share_id = \\$8 AND \\(rc.width, rc.height, rc.resize, rc.original, rc.mode, rc.quality, rc.metadata\\) = \\(select .* where id = \\$9\\)").
+		WithArgs(5, nil, 7, 12, 42, 20, "strip", 5, 3).
+		WillReturnRows(sqlmock.NewRows(renditionColumns).AddRow(101, 42, 3, 20, 12, format, "abc", "", now, now))
+
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("slug", "holidays")
+	routeContext.URLParams.Add("renditionID", "101")
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, routeContext)
+	ctx = web.AddDBToContext(ctx, dbx)
+	ctx = web.AddStorageBackendToContext(ctx, backend)
+	ctx = context.WithValue(ctx, web.ShareSiteKey, model.ShareSite{Record: db.Record{ID: 3}})
+	req := httptest.NewRequest("GET", "/holidays/renditions/101", nil).WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	ServeShareRenditionHandler(w, req)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	return w
+}
+
+func TestServeShareRenditionHandlerNeverServesGPS(t *testing.T) {
+	original, err := ioutil.ReadFile("../../pkg/images/testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := exif.Decode(bytes.NewReader(original))
+	assert.NoError(t, err)
+	_, _, err = e.LatLong()
+	assert.NoError(t, err, "fixture must have a location")
+
+	tests := []struct {
+		name   string
+		config model.RenditionConfiguration
+	}{
+		{"full size", model.RenditionConfiguration{}},
+		{"resized", model.RenditionConfiguration{Resize: true, Width: 20}},
+		{"resized png", model.RenditionConfiguration{Resize: true, Width: 20, Format: "image/png"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.True(t, test.config.Shareable())
+			rendition, binary, err := test.config.Process(context.Background(), bytes.NewReader(original), images.CenterFocalPoint)
+			assert.NoError(t, err)
+			defer binary.Close()
+			data, err := ioutil.ReadAll(binary)
+			assert.NoError(t, err)
+
+			w := serveShareRendition(t, data, rendition.Format)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			body := w.Body.Bytes()
+			assert.NotEmpty(t, body)
+			assert.NotContains(t, string(body), "xmpmeta")
+			assert.NotContains(t, string(body), "Jane Doe")
+			assert.NotContains(t, string(body), "SN123456")
+			if e, err := exif.Decode(bytes.NewReader(body)); err == nil {
+				_, err := e.Get(exif.GPSInfoIFDPointer)
+				assert.Error(t, err)
+				_, _, err = e.LatLong()
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestServeShareRenditionHandlerRevokedShareIsGone(t *testing.T) {
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	dbx := sqlx.NewDb(conn, "postgres")
+
+	revokedAt := time.Now().Add(-time.Hour)
+	mock.ExpectQuery("SELECT \\* FROM shares").
+		WithArgs(3, "holidays").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "album_id", "share_site_id", "slug", "expires_at", "revoked_at"}).AddRow(5, 7, nil, 3, "holidays", nil, revokedAt))
+
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("slug", "holidays")
+	routeContext.URLParams.Add("renditionID", "101")
+	ctx := context.WithValue(context.Background(), chi.RouteCtxKey, routeContext)
+	ctx = web.AddDBToContext(ctx, dbx)
+	ctx = web.AddStorageBackendToContext(ctx, storage.NewFileBackend(os.TempDir()))
+	ctx = context.WithValue(ctx, web.ShareSiteKey, model.ShareSite{Record: db.Record{ID: 3}})
+	req := httptest.NewRequest("GET", "/holidays/renditions/101", nil).WithContext(ctx)
+
+	w := httptest.NewRecorder()
+	ServeShareRenditionHandler(w, req)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestConfigurationsKeepingMetadataAreNotShareable(t *testing.T) {
+	assert.True(t, model.RenditionConfiguration{}.Shareable())
+	assert.False(t, model.RenditionConfiguration{Metadata: images.MetadataSafe}.Shareable())
+	assert.False(t, model.RenditionConfiguration{Metadata: images.MetadataKeep}.Shareable())
+}
@@ -42,6 +42,8 @@ func parseConfig() server.Config {
 		FrontendStaticFilePath: viper.GetString("frontend_static_file_path"),
 		AdminStaticFilePath:    viper.GetString("admin_static_file_path"),
 		JWTSecret:              viper.GetString("jwt_secret"),
+		GeoNamesPath:           viper.GetString("geonames_path"),
+		TrashRetention:         viper.GetDuration("trash_retention"),
 	}
 }
 
@@ -67,6 +69,8 @@ func setupEnvVars() {
 
 		"frontend_static_file_path": "ui/dist/frontend/",
 		"admin_static_file_path":    "ui/dist/admin/",
+
+		"trash_retention": "720h",
 	}
 
 	for key, value := range defaults {
@@ -91,6 +95,23 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("could not create Main")
 	}
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backfill-exif":
+			if err := main.BackfillExif(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not backfill exif tags")
+			}
+		case "backfill-places":
+			if err := main.BackfillPlaces(ctx); err != nil {
+				log.Fatal().Err(err).Msg("could not backfill places")
+			}
+		default:
+			log.Fatal().Str("command", os.Args[1]).Msg("unknown command, known commands are: backfill-exif, backfill-places")
+		}
+		return
+	}
+
 	if err := main.Run(ctx); err != nil {
 		log.Fatal().Err(err).Msg("could not run Main")
 	}
@@ -12,11 +12,12 @@ type AlbumRecord struct {
 	Record
 	Timestamps
 
-	Name         string `db:"name" json:"name"`
-	Slug         string `db:"slug" json:"slug"`
-	CollectionID int64  `db:"collection_id" json:"collectionID"`
-	PhotoCount   int    `db:"photo_count" json:"photoCount"`
-	CoverPhotoID *int64 `db:"cover_photo_id" json:"coverPhotoID"`
+	Name         string     `db:"name" json:"name"`
+	Slug         string     `db:"slug" json:"slug"`
+	CollectionID int64      `db:"collection_id" json:"collectionID"`
+	PhotoCount   int        `db:"photo_count" json:"photoCount"`
+	CoverPhotoID *int64     `db:"cover_photo_id" json:"coverPhotoID"`
+	DeletedAt    *time.Time `db:"deleted_at" json:"deletedAt"`
 }
 
 type AlbumDB interface {
@@ -48,7 +49,8 @@ func (a *albumSQLDB) albumsInCollection(collectionID int64) sq.SelectBuilder {
 		From("albums").
 		Where(
 			sq.Eq{
-				"collection_id": collectionID,
+				"collection_id":     collectionID,
+				"albums.deleted_at": nil,
 			},
 		)
 }
@@ -127,7 +129,7 @@ func (a *albumSQLDB) AddPhotos(collectionID int64, id int64, photoIDs []int64) e
 		}
 	}
 
-	sql := "UPDATE albums SET photo_count = (SELECT COUNT(*) FROM album_photos WHERE album_id = $1) WHERE id = $1"
+	sql := "UPDATE albums SET photo_count = (SELECT COUNT(*) FROM album_photos JOIN photos ON (photos.id = album_photos.photo_id) WHERE album_id = $1 AND photos.deleted_at IS NULL) WHERE id = $1"
 	_, err = a.db.Exec(sql, id)
 
 	if err != nil {
@@ -139,8 +141,9 @@ func (a *albumSQLDB) AddPhotos(collectionID int64, id int64, photoIDs []int64) e
 	return tx.Commit()
 }
 
+// Delete moves the album to the trash. Its photos stay where they are.
 func (a *albumSQLDB) Delete(collectionID int64, id int64) error {
-	sql := "DELETE FROM albums WHERE collection_id = $1 AND id = $2"
-	_, err := a.db.Exec(sql, collectionID, id)
+	sql := "UPDATE albums SET deleted_at = $1 WHERE collection_id = $2 AND id = $3 AND deleted_at IS NULL"
+	_, err := a.db.Exec(sql, a.clock().UTC(), collectionID, id)
 	return err
 }
@@ -12,6 +12,7 @@ type CollectionDB interface {
 	// TODO use paginator
 	List(userID int64, count int, afterID int64, orderBy string) ([]*Collection, error)
 	Delete(int64) error
+	// Assign makes the user the owner of the collection.
 	Assign(userID int64, collectionID int64) error
 	CanAccess(userID int64, collectionID int64) bool
 }
@@ -30,15 +31,21 @@ type collectionSQLDB struct {
 	clock Clock
 }
 
+// CanAccess returns whether the user is a member of the collection, in any role.
 func (c *collectionSQLDB) CanAccess(userID int64, collectionID int64) bool {
-	// TODO implement me
-	return true
+	var member bool
+	err := c.db.QueryRowx("SELECT exists(SELECT 1 FROM users_collections WHERE user_id = $1 AND collection_id = $2)", userID, collectionID).Scan(&member)
+	if err != nil {
+		log.Printf("could not check access of user %d to collection %d: %v", userID, collectionID, err)
+		return false
+	}
+	return member
 }
 
 // TODO this should use a paginator
 func (c *collectionSQLDB) List(userID int64, count int, afterID int64, orderBy string) ([]*Collection, error) {
 	result := []*Collection{}
-	sql := "SELECT c.* FROM collections AS c, users_collections AS uc WHERE uc.user_id = $1 AND uc.collection_id = c.id AND c.id > $2 order by $3 limit $4"
+	sql := "SELECT c.* FROM collections AS c, users_collections AS uc WHERE uc.user_id = $1 AND uc.collection_id = c.id AND c.deleted_at IS NULL AND c.id > $2 order by $3 limit $4"
 	rows, err := c.db.Queryx(
 		sql,
 		userID,
@@ -66,24 +73,25 @@ func (c *collectionSQLDB) List(userID int64, count int, afterID int64, orderBy s
 func (c *collectionSQLDB) Assign(userID int64, collectionID int64) error {
 	log.Printf("Assigning collection %d to user %d", collectionID, userID)
 	now := c.clock()
-	_, err := c.db.Exec("INSERT INTO users_collections (user_id, collection_id, created_at, updated_at) VALUES ($1, $2, $3, $4)", userID, collectionID, now, now)
+	_, err := c.db.Exec("INSERT INTO users_collections (user_id, collection_id, role, created_at, updated_at) VALUES ($1, $2, 'owner', $3, $4)", userID, collectionID, now, now)
 	return err
 }
 
 func (c *collectionSQLDB) FindByID(id int64) (*Collection, error) {
 	record := &Collection{}
-	err := c.db.QueryRowx("SELECT * FROM collections WHERE id = $1 LIMIT 1", id).StructScan(record)
+	err := c.db.QueryRowx("SELECT * FROM collections WHERE id = $1 AND deleted_at IS NULL LIMIT 1", id).StructScan(record)
 	return record, err
 }
 
+// Delete moves the collection to the trash. Its photos and albums are purged with it.
 func (c *collectionSQLDB) Delete(id int64) error {
-	sql := "DELETE FROM collections WHERE id=$1"
-	return checkResult(c.db.Exec(sql, id))
+	sql := "UPDATE collections SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL"
+	return checkResult(c.db.Exec(sql, c.clock().UTC(), id))
 }
 
 func (c *collectionSQLDB) FindBySlug(slug string) (*Collection, error) {
 	record := &Collection{}
-	err := c.db.QueryRowx("SELECT * FROM collections WHERE slug = $1 LIMIT 1", slug).StructScan(record)
+	err := c.db.QueryRowx("SELECT * FROM collections WHERE slug = $1 AND deleted_at IS NULL LIMIT 1", slug).StructScan(record)
 	return record, err
 }
 
@@ -91,7 +99,7 @@ func (c *collectionSQLDB) Save(record *Collection) error {
 	var err error
 	if record.IsPersisted() {
 		record.JustUpdated(c.clock)
-		sql := "UPDATE collections SET name = $1, slug = $2, updated_at = $3, photo_count = (SELECT count(*) FROM photos WHERE collection_id = $4) WHERE id = $4"
+		sql := "UPDATE collections SET name = $1, slug = $2, updated_at = $3, photo_count = (SELECT count(*) FROM photos WHERE collection_id = $4 AND deleted_at IS NULL) WHERE id = $4"
 		record.UpdatedAt = c.clock()
 		err = checkResult(c.db.Exec(
 			sql,
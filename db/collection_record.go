@@ -1,10 +1,13 @@
 package db
 
+import "time"
+
 // Collection is a single database level record of a collection.
 type Collection struct {
 	Record
 	Timestamps
 	Sluggable
-	Name       string `db:"name" json:"name"`
-	PhotoCount int    `db:"photo_count" json:"photoCount"`
+	Name       string     `db:"name" json:"name"`
+	PhotoCount int        `db:"photo_count" json:"photoCount"`
+	DeletedAt  *time.Time `db:"deleted_at" json:"deletedAt"`
 }
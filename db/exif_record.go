@@ -1,7 +1,10 @@
 package db
 
 import (
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/rwcarlsen/goexif/tiff"
@@ -20,21 +23,89 @@ type ExifRecord struct {
 	Denominator int64      `db:"denom" json:"denominator"`
 	DateTime    *time.Time `db:"datetime" json:"datetime"`
 	Floating    float64    `db:"floating" json:"float"`
+	// Values holds all values of tags with more than one value. Num, Denominator and Floating hold the first.
+	Values ExifValues `db:"value_list" json:"values,omitempty"`
+	// Display is the value formatted for people, e.g. "1/250 s" for an exposure time.
+	Display string `db:"display" json:"display"`
 }
 
 func (e ExifRecord) String() string {
+	if e.Display != "" {
+		return e.Display
+	}
+
 	switch tiff.DataType(e.Type) {
-	case tiff.DTAscii:
-		return fmt.Sprintf("%s", e.StringValue)
-	case tiff.DTLong, tiff.DTShort:
-		return fmt.Sprintf("%d", e.Num)
+	case tiff.DTAscii, tiff.DTUndefined:
+		if e.StringValue != "" || len(e.Values) == 0 {
+			return e.StringValue
+		}
+	}
+
+	if len(e.Values) > 0 {
+		values := make([]string, len(e.Values))
+		for i, value := range e.Values {
+			values[i] = value.format(tiff.DataType(e.Type))
+		}
+		return strings.Join(values, ", ")
+	}
+	return ExifValue{Num: e.Num, Denominator: e.Denominator, Floating: e.Floating}.format(tiff.DataType(e.Type))
+}
+
+// ForDisplay returns a copy of the record with its value formatted as a string and the name of its type filled in.
+func (e ExifRecord) ForDisplay() ExifRecord {
+	e.StringValue = e.String()
+	e.TypeName = typeNames[tiff.DataType(e.Type)]
+	return e
+}
+
+// ExifValue is one of the values of an exif tag.
+type ExifValue struct {
+	Num         int64   `json:"number"`
+	Denominator int64   `json:"denominator,omitempty"`
+	Floating    float64 `json:"float,omitempty"`
+}
+
+func (v ExifValue) format(dataType tiff.DataType) string {
+	switch dataType {
+	case tiff.DTByte, tiff.DTShort, tiff.DTLong, tiff.DTSByte, tiff.DTSShort, tiff.DTSLong, tiff.DTUndefined:
+		return fmt.Sprintf("%d", v.Num)
 	case tiff.DTRational, tiff.DTSRational:
-		return fmt.Sprintf("%d/%d", e.Num, e.Denominator)
+		return fmt.Sprintf("%d/%d", v.Num, v.Denominator)
+	case tiff.DTFloat, tiff.DTDouble:
+		return fmt.Sprintf("%g", v.Floating)
 	}
-	// TODO something doesn't work here
 	return "unknown"
 }
 
+// ExifValues are stored as a JSON array.
+type ExifValues []ExifValue
+
+// Value implements driver.Valuer.
+func (v ExifValues) Value() (driver.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (v *ExifValues) Scan(src interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(src, v)
+	case string:
+		return json.Unmarshal([]byte(src), v)
+	}
+	return fmt.Errorf("can't scan %T into exif values", src)
+}
+
 type ExifDB interface {
 	ByTag(photoID int64, tag string) (ExifRecord, error)
 	AllForPhoto(photoID int64) ([]ExifRecord, error)
@@ -54,7 +125,7 @@ type exifSQLDB struct {
 }
 
 func (e *exifSQLDB) Save(photoID int64, record ExifRecord) (ExifRecord, error) {
-	sql := "INSERT INTO exif (photo_id, value_type, tag, string, num, denom, datetime, floating, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id"
+	sql := "INSERT INTO exif (photo_id, value_type, tag, string, num, denom, datetime, floating, value_list, display, created_at, updated_at) values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id"
 	if record.IsPersisted() {
 		// TODO do we ever update exif tags?
 		return record, fmt.Errorf("exif tags cannot be updated")
@@ -71,6 +142,8 @@ func (e *exifSQLDB) Save(photoID int64, record ExifRecord) (ExifRecord, error) {
 		record.Denominator,
 		record.DateTime,
 		record.Floating,
+		record.Values,
+		record.Display,
 		e.clock(),
 		e.clock(),
 	).Scan(&record.ID)
@@ -93,9 +166,7 @@ func (e *exifSQLDB) AllForPhoto(photoID int64) ([]ExifRecord, error) {
 		if err != nil {
 			return nil, err
 		}
-		record.StringValue = record.String()
-		record.TypeName = typeNames[tiff.DataType(record.Type)]
-		records = append(records, record)
+		records = append(records, record.ForDisplay())
 	}
 
 	return records, nil
@@ -0,0 +1,3 @@
+alter table photos drop column focal_y;
+alter table photos drop column focal_x;
+alter table rendition_configurations drop column mode;
@@ -0,0 +1,3 @@
+alter table rendition_configurations add column mode varchar(16) not null default 'fit-width';
+alter table photos add column focal_x double precision check (focal_x between 0 and 1);
+alter table photos add column focal_y double precision check (focal_y between 0 and 1);
@@ -0,0 +1,4 @@
+alter table rendition_configurations add column metadata varchar(16) not null default 'strip';
+update rendition_configurations set metadata = 'keep' where original;
+-- Renditions that were copied from originals carry all their metadata, so they have to be made again.
+update rendition_configurations set version = version + 1 where not resize and not original;
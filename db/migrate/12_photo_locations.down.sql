@@ -0,0 +1,6 @@
+drop index photos_location_idx;
+alter table photos drop constraint photos_coordinates;
+alter table photos drop column direction;
+alter table photos drop column altitude;
+alter table photos drop column longitude;
+alter table photos drop column latitude;
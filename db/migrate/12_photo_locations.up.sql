@@ -0,0 +1,6 @@
+alter table photos add column latitude double precision check (latitude between -90 and 90);
+alter table photos add column longitude double precision check (longitude between -180 and 180);
+alter table photos add column altitude double precision;
+alter table photos add column direction double precision check (direction >= 0 and direction < 360);
+alter table photos add constraint photos_coordinates check ((latitude is null) = (longitude is null));
+create index photos_location_idx on photos (collection_id, latitude, longitude) where latitude is not null;
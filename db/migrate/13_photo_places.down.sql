@@ -0,0 +1,8 @@
+drop index photos_country_code_idx;
+drop index photos_country_idx;
+drop index photos_region_idx;
+drop index photos_city_idx;
+alter table photos drop column country_code;
+alter table photos drop column country;
+alter table photos drop column region;
+alter table photos drop column city;
@@ -0,0 +1,8 @@
+alter table photos add column city varchar(200) not null default '';
+alter table photos add column region varchar(200) not null default '';
+alter table photos add column country varchar(200) not null default '';
+alter table photos add column country_code varchar(2) not null default '';
+create index photos_city_idx on photos (collection_id, lower(city));
+create index photos_region_idx on photos (collection_id, lower(region));
+create index photos_country_idx on photos (collection_id, lower(country));
+create index photos_country_code_idx on photos (collection_id, country_code);
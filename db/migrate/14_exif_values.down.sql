@@ -0,0 +1,2 @@
+alter table exif drop column display;
+alter table exif drop column value_list;
@@ -0,0 +1,2 @@
+alter table exif add column value_list jsonb;
+alter table exif add column display varchar(256) not null default '';
@@ -0,0 +1,4 @@
+drop index photo_metadata_photo_id_name_idx;
+drop table photo_metadata;
+alter table photos drop column copyright;
+alter table photos drop column title;
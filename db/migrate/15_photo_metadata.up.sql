@@ -0,0 +1,12 @@
+alter table photos add column title varchar(256) not null default '';
+alter table photos add column copyright varchar(512) not null default '';
+create table photo_metadata (
+  id serial primary key,
+  photo_id integer not null references photos(id) on delete cascade,
+  name varchar(32) not null,
+  value text not null,
+  source varchar(32) not null,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+create index photo_metadata_photo_id_name_idx on photo_metadata (photo_id, name);
@@ -0,0 +1,2 @@
+drop table photo_tags;
+drop table tags;
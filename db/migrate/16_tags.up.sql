@@ -0,0 +1,37 @@
+create table tags (
+  id serial primary key,
+  collection_id integer not null references collections(id) on delete cascade,
+  name varchar(64) not null,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+create unique index tags_collection_id_name_idx on tags (collection_id, lower(name));
+-- Autocomplete looks tags up by prefix.
+create index tags_collection_id_name_prefix_idx on tags (collection_id, lower(name) text_pattern_ops);
+
+create table photo_tags (
+  photo_id integer not null references photos(id) on delete cascade,
+  tag_id integer not null references tags(id) on delete cascade,
+  created_at timestamp not null,
+  primary key (photo_id, tag_id)
+);
+
+create index on photo_tags (tag_id);
+
+-- Keywords imported from XMP and IPTC become tags.
+insert into tags (collection_id, name, created_at, updated_at)
+  select distinct on (p.collection_id, lower(m.value)) p.collection_id, m.value, now(), now()
+  from photo_metadata m
+  join photos p on (p.id = m.photo_id)
+  where m.name = 'keyword' and char_length(m.value) <= 64 and position(',' in m.value) = 0
+  order by p.collection_id, lower(m.value), m.id
+  on conflict do nothing;
+
+insert into photo_tags (photo_id, tag_id, created_at)
+  select distinct m.photo_id, t.id, now()
+  from photo_metadata m
+  join photos p on (p.id = m.photo_id)
+  join tags t on (t.collection_id = p.collection_id and lower(t.name) = lower(m.value))
+  where m.name = 'keyword'
+  on conflict do nothing;
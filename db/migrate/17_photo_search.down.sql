@@ -0,0 +1,11 @@
+drop trigger photo_search_exif_delete on exif;
+drop trigger photo_search_exif_insert on exif;
+drop trigger photo_search_albums on albums;
+drop trigger photo_search_album_photos on album_photos;
+drop trigger photo_search_photo_tags on photo_tags;
+drop trigger photo_search_photos on photos;
+drop function photo_search_albums_trigger();
+drop function photo_search_photo_id_trigger();
+drop function photo_search_photos_trigger();
+drop function refresh_photo_search(integer);
+drop table photo_search;
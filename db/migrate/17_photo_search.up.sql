@@ -0,0 +1,82 @@
+-- The search index of a photo lives in its own table so photos can still be selected with select *.
+create table photo_search (
+  photo_id integer primary key references photos(id) on delete cascade,
+  -- document is the searchable text of the photo, used for highlighting.
+  document text not null,
+  search_vector tsvector not null
+);
+
+create index photo_search_vector_idx on photo_search using gin (search_vector);
+
+-- refresh_photo_search rebuilds the search index of a photo from its title, description, filename, tags, albums and
+-- camera and lens exif tags. Titles and tags weigh the most, camera and lens the least.
+create function refresh_photo_search(refreshed_photo_id integer) returns void as $$
+declare
+  photo record;
+  tag_names text;
+  album_names text;
+  camera text;
+begin
+  select * into photo from photos where id = refreshed_photo_id;
+  if not found then
+    delete from photo_search where photo_id = refreshed_photo_id;
+    return;
+  end if;
+
+  select coalesce(string_agg(t.name, ' ' order by lower(t.name)), '') into tag_names
+    from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = refreshed_photo_id;
+  select coalesce(string_agg(a.name, ' ' order by a.name), '') into album_names
+    from album_photos ap join albums a on (a.id = ap.album_id) where ap.photo_id = refreshed_photo_id;
+  select coalesce(string_agg(e.string, ' ' order by e.tag), '') into camera
+    from exif e where e.photo_id = refreshed_photo_id and e.tag in ('Make', 'Model', 'LensMake', 'LensModel');
+
+  insert into photo_search (photo_id, document, search_vector) values (
+    refreshed_photo_id,
+    concat_ws(' ', nullif(photo.title, ''), nullif(photo.description, ''), photo.filename, nullif(tag_names, ''), nullif(album_names, ''), nullif(camera, '')),
+    setweight(to_tsvector('simple', photo.title || ' ' || tag_names), 'A') ||
+      setweight(to_tsvector('simple', photo.description || ' ' || album_names), 'B') ||
+      -- Split filenames like IMG_1234.jpg into words as well.
+      setweight(to_tsvector('simple', photo.filename || ' ' || regexp_replace(photo.filename, '[^[:alnum:]]+', ' ', 'g') || ' ' || camera), 'C')
+  ) on conflict (photo_id) do update set document = excluded.document, search_vector = excluded.search_vector;
+end;
+$$ language plpgsql;
+
+create function photo_search_photos_trigger() returns trigger as $$
+begin
+  perform refresh_photo_search(new.id);
+  return null;
+end;
+$$ language plpgsql;
+
+create function photo_search_photo_id_trigger() returns trigger as $$
+begin
+  if tg_op = 'DELETE' then
+    perform refresh_photo_search(old.photo_id);
+  else
+    perform refresh_photo_search(new.photo_id);
+  end if;
+  return null;
+end;
+$$ language plpgsql;
+
+create function photo_search_albums_trigger() returns trigger as $$
+begin
+  perform refresh_photo_search(photo_id) from album_photos where album_id = new.id;
+  return null;
+end;
+$$ language plpgsql;
+
+create trigger photo_search_photos after insert or update of title, description, filename on photos
+  for each row execute procedure photo_search_photos_trigger();
+create trigger photo_search_photo_tags after insert or delete on photo_tags
+  for each row execute procedure photo_search_photo_id_trigger();
+create trigger photo_search_album_photos after insert or delete on album_photos
+  for each row execute procedure photo_search_photo_id_trigger();
+create trigger photo_search_albums after update of name on albums
+  for each row when (old.name is distinct from new.name) execute procedure photo_search_albums_trigger();
+create trigger photo_search_exif_insert after insert on exif
+  for each row when (new.tag in ('Make', 'Model', 'LensMake', 'LensModel')) execute procedure photo_search_photo_id_trigger();
+create trigger photo_search_exif_delete after delete on exif
+  for each row when (old.tag in ('Make', 'Model', 'LensMake', 'LensModel')) execute procedure photo_search_photo_id_trigger();
+
+select refresh_photo_search(id) from photos;
@@ -0,0 +1 @@
+drop table photo_ratings;
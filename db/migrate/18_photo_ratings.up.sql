@@ -0,0 +1,13 @@
+create table photo_ratings (
+  photo_id integer not null references photos(id) on delete cascade,
+  user_id integer not null references users(id) on delete cascade,
+  -- 0 means not rated.
+  rating smallint not null default 0 check (rating between 0 and 5),
+  favorite boolean not null default false,
+  color varchar(16) not null default '' check (color in ('', 'red', 'yellow', 'green', 'blue', 'purple')),
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  primary key (photo_id, user_id)
+);
+
+create index on photo_ratings (user_id, rating);
@@ -0,0 +1,3 @@
+alter table collections drop column deleted_at;
+alter table albums drop column deleted_at;
+alter table photos drop column deleted_at;
@@ -0,0 +1,8 @@
+-- Trashed rows have deleted_at set. They are hidden and purged once they have been in the trash for the retention period.
+alter table photos add column deleted_at timestamp;
+alter table albums add column deleted_at timestamp;
+alter table collections add column deleted_at timestamp;
+
+create index on photos (deleted_at) where deleted_at is not null;
+create index on albums (deleted_at) where deleted_at is not null;
+create index on collections (deleted_at) where deleted_at is not null;
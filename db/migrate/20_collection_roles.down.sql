@@ -0,0 +1 @@
+alter table users_collections drop column role;
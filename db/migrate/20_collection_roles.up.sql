@@ -0,0 +1,4 @@
+-- Members of a collection are owners, editors or viewers. Everyone who had access so far created the collection.
+alter table users_collections add column role varchar(16) not null default 'owner' check (role in ('owner', 'editor', 'viewer'));
+
+create index on users_collections (collection_id, role);
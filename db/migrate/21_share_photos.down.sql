@@ -0,0 +1,10 @@
+-- Only the first photo of each share is kept, album shares are lost.
+alter table shares add column photo_id integer references photos(id);
+
+update shares set photo_id = (
+  select photo_id from share_photos sp where sp.share_id = shares.id order by sp.sort_order, sp.photo_id limit 1
+);
+delete from shares where photo_id is null;
+
+drop table share_photos;
+alter table shares drop column album_id;
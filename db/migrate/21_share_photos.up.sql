@@ -0,0 +1,18 @@
+-- A share is either a hand-picked set of photos in share_photos, or an album whose photos are shared as it changes.
+alter table shares add column album_id integer references albums(id) on delete cascade;
+
+create table share_photos (
+  share_id integer not null references shares(id) on delete cascade,
+  photo_id integer not null references photos(id) on delete cascade,
+  sort_order integer not null default 0,
+  created_at timestamp not null,
+  updated_at timestamp not null,
+  primary key (share_id, photo_id)
+);
+
+create index on share_photos (photo_id);
+
+insert into share_photos (share_id, photo_id, sort_order, created_at, updated_at)
+  select id, photo_id, 0, created_at, updated_at from shares where photo_id is not null;
+
+alter table shares drop column photo_id;
@@ -0,0 +1,2 @@
+alter table shares drop column revoked_at;
+alter table shares drop column expires_at;
@@ -0,0 +1,3 @@
+-- Shares stop being served once they expire or are revoked.
+alter table shares add column expires_at timestamp;
+alter table shares add column revoked_at timestamp;
@@ -0,0 +1 @@
+alter table rendition_jobs drop column requested_at;
@@ -0,0 +1,5 @@
+-- Requests for a photo that already has a pending or running job bump requested_at, so a running job knows it has to
+-- run again once it is done.
+alter table rendition_jobs add column requested_at timestamp;
+update rendition_jobs set requested_at = created_at;
+alter table rendition_jobs alter column requested_at set not null;
@@ -0,0 +1 @@
+alter table photos drop column taken_at_offset;
@@ -0,0 +1,2 @@
+-- taken_at is the local time a photo was taken, taken_at_offset the offset of its zone from UTC in seconds, if known.
+alter table photos add column taken_at_offset integer;
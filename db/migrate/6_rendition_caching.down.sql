@@ -0,0 +1,2 @@
+alter table rendition_configurations drop column cache_control;
+alter table renditions drop column content_hash;
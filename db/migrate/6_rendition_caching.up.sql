@@ -0,0 +1,4 @@
+alter table renditions add column content_hash varchar(64) not null default '';
+
+alter table rendition_configurations add column cache_control varchar(128) not null default 'max-age=31536000, immutable';
+update rendition_configurations set cache_control = 'private, no-store' where original = true;
@@ -0,0 +1 @@
+drop table rendition_jobs;
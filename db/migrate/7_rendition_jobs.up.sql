@@ -0,0 +1,17 @@
+create table rendition_jobs (
+  id serial primary key,
+  photo_id integer not null references photos(id) on delete cascade,
+  state varchar(16) not null default 'pending',
+  attempts integer not null default 0,
+  max_attempts integer not null default 5,
+  last_error text not null default '',
+  run_after timestamp not null,
+  leased_until timestamp,
+  created_at timestamp not null,
+  updated_at timestamp not null
+);
+
+create index on rendition_jobs (state, run_after);
+create index on rendition_jobs (state, leased_until);
+-- Only one job per photo may be waiting or in progress at any time.
+create unique index rendition_jobs_active_photo_idx on rendition_jobs (photo_id) where state in ('pending', 'running');
@@ -0,0 +1,3 @@
+alter table renditions drop column rendition_configuration_version;
+
+alter table rendition_configurations drop column version;
@@ -0,0 +1,3 @@
+alter table rendition_configurations add column version integer not null default 1;
+
+alter table renditions add column rendition_configuration_version integer not null default 1;
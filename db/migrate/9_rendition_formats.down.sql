@@ -0,0 +1 @@
+alter table rendition_configurations drop column format;
@@ -0,0 +1 @@
+alter table rendition_configurations add column format varchar(32) not null default 'image/jpeg';
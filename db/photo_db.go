@@ -12,8 +12,8 @@ import (
 type PhotoDB interface {
 	FindByID(collectionID, id int64) (PhotoRecord, error)
 	Save(record PhotoRecord) (PhotoRecord, error)
-	List(collectionID int64, paginator database.Paginator) ([]PhotoRecord, error)
-	ListAlbum(collectionID int64, albumID int64, paginator database.Paginator) ([]PhotoRecord, error)
+	List(collectionID int64, paginator database.Paginator, filter PhotoFilter) ([]PhotoRecord, error)
+	ListAlbum(collectionID int64, albumID int64, paginator database.Paginator, filter PhotoFilter) ([]PhotoRecord, error)
 	Delete(collectionID, photoID int64) error
 }
 
@@ -35,8 +35,13 @@ type photoSQLDB struct {
 	sql   sq.StatementBuilderType
 }
 
+// Delete moves the photo to the trash. It is purged once it has been in the trash for the retention period.
 func (c *photoSQLDB) Delete(collectionID, photoID int64) error {
-	sql, args, _ := c.sql.Delete("photos").Where(sq.Eq{"collection_id": collectionID, "id": photoID}).ToSql()
+	sql, args, _ := c.sql.
+		Update("photos").
+		Set("deleted_at", c.clock().UTC()).
+		Where(sq.Eq{"collection_id": collectionID, "id": photoID, "deleted_at": nil}).
+		ToSql()
 	_, err := c.db.Exec(sql, args...)
 	return err
 }
@@ -46,12 +51,13 @@ func (c *photoSQLDB) photosInCollection(collectionID int64) sq.SelectBuilder {
 		Select("photos.*").
 		From("photos").
 		Where(sq.Eq{
-			"collection_id": collectionID,
+			"collection_id":     collectionID,
+			"photos.deleted_at": nil,
 		})
 }
 
-func (c *photoSQLDB) ListAlbum(collectionID int64, albumID int64, paginator database.Paginator) ([]PhotoRecord, error) {
-	q := c.photosInCollection(collectionID).
+func (c *photoSQLDB) ListAlbum(collectionID int64, albumID int64, paginator database.Paginator, filter PhotoFilter) ([]PhotoRecord, error) {
+	q := filter.Filter(c.photosInCollection(collectionID), "photos").
 		Join("album_photos on (photos.id = album_photos.photo_id)").
 		Where(
 			sq.Eq{
@@ -60,7 +66,7 @@ func (c *photoSQLDB) ListAlbum(collectionID int64, albumID int64, paginator data
 		)
 
 	paginator.ColumnPrefix = "photos"
-	q = paginator.Paginate(q)
+	q = filter.Paginate(q, "photos", paginator)
 	sql, args, _ := q.ToSql()
 
 	result := []PhotoRecord{}
@@ -68,10 +74,10 @@ func (c *photoSQLDB) ListAlbum(collectionID int64, albumID int64, paginator data
 	return result, err
 }
 
-func (c *photoSQLDB) List(collectionID int64, paginator database.Paginator) ([]PhotoRecord, error) {
+func (c *photoSQLDB) List(collectionID int64, paginator database.Paginator, filter PhotoFilter) ([]PhotoRecord, error) {
 	paginator.ColumnPrefix = "photos"
-	q := c.photosInCollection(collectionID)
-	q = paginator.Paginate(q)
+	q := filter.Filter(c.photosInCollection(collectionID), "photos")
+	q = filter.Paginate(q, "photos", paginator)
 	sql, args, err := q.ToSql()
 	if err != nil {
 		return nil, errors.Wrap(err, "could not create sql")
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/pql"
+)
+
+// PhotoFilter narrows down and orders photo listings. Empty fields do not filter.
+type PhotoFilter struct {
+	// City, Region and Country match the place names of photos, ignoring case. Country also matches country codes.
+	City    string
+	Region  string
+	Country string
+	// Tags match photos tagged with any of them, or with all of them if AllTags is set, ignoring case.
+	Tags    []string
+	AllTags bool
+	// Query matches photos with a query like tag:family -tag:private rating>=4, see package pql.
+	Query *pql.Query
+	// RatedBy is the user whose ratings MinRating, Favorites, Color and OrderByRating use. They are ignored without it.
+	// Rating terms of Query match its ratings too.
+	RatedBy   int64
+	MinRating int
+	Favorites bool
+	Color     string
+	// OrderByRating orders photos by their rating instead of by when they were updated.
+	OrderByRating bool
+}
+
+// PhotoFilterFromQuery reads a filter from the city, region, country, tags, query, minRating, favorites, color and
+// orderBy parameters. Tags are separated by commas; tagMatch=all only matches photos with all of them. orderBy=rating
+// orders photos by rating. Returns a *pql.Error if the query parameter is invalid. RatedBy is left for the caller to set.
+func PhotoFilterFromQuery(query url.Values) (PhotoFilter, error) {
+	var tags []string
+	for _, tag := range strings.Split(query.Get("tags"), ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	minRating := 0
+	if s := query.Get("minRating"); s != "" {
+		var err error
+		if minRating, err = strconv.Atoi(s); err != nil || minRating < 0 || minRating > 5 {
+			return PhotoFilter{}, fmt.Errorf("minRating must be from 0 to 5")
+		}
+	}
+
+	q, err := pql.Parse(query.Get("query"))
+	if err != nil {
+		return PhotoFilter{}, err
+	}
+
+	return PhotoFilter{
+		City:    strings.TrimSpace(query.Get("city")),
+		Region:  strings.TrimSpace(query.Get("region")),
+		Country: strings.TrimSpace(query.Get("country")),
+		Tags:    tags,
+		AllTags: query.Get("tagMatch") == "all",
+		Query:   q,
+
+		MinRating:     minRating,
+		Favorites:     query.Get("favorites") == "true",
+		Color:         strings.TrimSpace(query.Get("color")),
+		OrderByRating: query.Get("orderBy") == "rating",
+	}, nil
+}
+
+// Filter adds the conditions of this filter to the given query on the given photos table or alias. Tags are matched
+// with subqueries rather than joins so every photo is returned once, which keeps seek pagination working.
+func (f PhotoFilter) Filter(query sq.SelectBuilder, table string) sq.SelectBuilder {
+	if f.City != "" {
+		query = query.Where(fmt.Sprintf("lower(%s.city) = lower(?)", table), f.City)
+	}
+	if f.Region != "" {
+		query = query.Where(fmt.Sprintf("lower(%s.region) = lower(?)", table), f.Region)
+	}
+	if f.Country != "" {
+		query = query.Where(fmt.Sprintf("(lower(%s.country) = lower(?) or %s.country_code = upper(?))", table, table), f.Country, f.Country)
+	}
+	if tags := f.distinctTags(); len(tags) > 0 {
+		args := make([]interface{}, len(tags))
+		placeholders := make([]string, len(tags))
+		for i, tag := range tags {
+			args[i], placeholders[i] = tag, "?"
+		}
+		tagged := fmt.Sprintf("from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = %s.id and lower(t.name) in (%s)", table, strings.Join(placeholders, ","))
+		if f.AllTags {
+			query = query.Where(fmt.Sprintf("(select count(*) %s) = %d", tagged, len(tags)), args...)
+		} else {
+			query = query.Where(fmt.Sprintf("exists (select 1 %s)", tagged), args...)
+		}
+	}
+	if condition := f.Query.Condition(table, f.RatedBy); condition != nil {
+		query = query.Where(condition)
+	}
+	if f.RatedBy != 0 && (f.MinRating > 0 || f.Favorites || f.Color != "") {
+		rated := sq.And{sq.Expr(fmt.Sprintf("pr.photo_id = %s.id", table)), sq.Eq{"pr.user_id": f.RatedBy}}
+		if f.MinRating > 0 {
+			rated = append(rated, sq.GtOrEq{"pr.rating": f.MinRating})
+		}
+		if f.Favorites {
+			rated = append(rated, sq.Expr("pr.favorite"))
+		}
+		if f.Color != "" {
+			rated = append(rated, sq.Eq{"pr.color": f.Color})
+		}
+		sql, args, _ := rated.ToSql()
+		query = query.Where("exists (select 1 from photo_ratings pr where "+sql+")", args...)
+	}
+	return query
+}
+
+// Paginate orders and limits the given query on the given photos table or alias like the paginator, but by rating if
+// OrderByRating is set. Photos rated the same are ordered by id; the next page starts after the paginator's PrevID.
+func (f PhotoFilter) Paginate(query sq.SelectBuilder, table string, paginator database.Paginator) sq.SelectBuilder {
+	if !f.OrderByRating || f.RatedBy == 0 {
+		return paginator.Paginate(query)
+	}
+
+	ratingOf := func(photoID string) string {
+		return fmt.Sprintf("coalesce((select pr.rating from photo_ratings pr where pr.photo_id = %s and pr.user_id = %d), 0)", photoID, f.RatedBy)
+	}
+	rating := ratingOf(table + ".id")
+	if paginator.PrevID != 0 {
+		// Ratings can't be passed between pages like timestamps, so the previous photo's rating is looked up again.
+		query = query.Where(fmt.Sprintf("(%s, %s.id) %s (%s, ?)", rating, table, paginator.Direction.AfterRelation(), ratingOf("?")), paginator.PrevID, paginator.PrevID)
+	}
+	return query.
+		OrderBy(paginator.Direction.AddToColumn(rating), paginator.Direction.AddToColumn(table+".id")).
+		Limit(uint64(paginator.Count))
+}
+
+// distinctTags returns the lower case tags of this filter without duplicates.
+func (f PhotoFilter) distinctTags() []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range f.Tags {
+		tag = strings.ToLower(tag)
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
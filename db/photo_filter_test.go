@@ -0,0 +1,103 @@
+package db
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/pql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhotoFilterFromQuery(t *testing.T) {
+	query := url.Values{"tags": {" tram, ,Lisbon "}, "tagMatch": {"all"}, "city": {"Lisbon"}}
+
+	filter, err := PhotoFilterFromQuery(query)
+
+	assert.NoError(t, err)
+	assert.Equal(t, PhotoFilter{City: "Lisbon", Tags: []string{"tram", "Lisbon"}, AllTags: true, Query: &pql.Query{}}, filter)
+	filter, _ = PhotoFilterFromQuery(url.Values{})
+	assert.Empty(t, filter.Tags)
+}
+
+func TestPhotoFilterFromQueryWithInvalidQuery(t *testing.T) {
+	_, err := PhotoFilterFromQuery(url.Values{"query": {"tag:family rating>9"}})
+
+	assert.Equal(t, &pql.Error{Message: `expected a rating from 0 to 5 but got "9"`, Token: "9", Offset: 18, Length: 1}, err)
+}
+
+func TestPhotoFilterWithQuery(t *testing.T) {
+	filter, err := PhotoFilterFromQuery(url.Values{"query": {"is:located -tag:private"}, "city": {"Lisbon"}})
+	assert.NoError(t, err)
+
+	sql, args, err := filter.Filter(sq.Select("*").From("photos p"), "p").ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM photos p WHERE lower(p.city) = lower(?) AND (p.latitude is not null AND not (exists (select 1 from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = p.id and lower(t.name) = lower(?))))", sql)
+	assert.Equal(t, []interface{}{"Lisbon", "private"}, args)
+}
+
+func TestPhotoFilterWithAnyTag(t *testing.T) {
+	query := PhotoFilter{Tags: []string{"Tram", "lisbon", "tram"}}.Filter(sq.Select("*").From("photos"), "photos")
+
+	sql, args, err := query.ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM photos WHERE exists (select 1 from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = photos.id and lower(t.name) in (?,?))", sql)
+	assert.Equal(t, []interface{}{"tram", "lisbon"}, args)
+}
+
+func TestPhotoFilterWithAllTagsKeepsSeekPagination(t *testing.T) {
+	prev := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	paginator := database.NewPaginator()
+	paginator.ColumnPrefix = "photos"
+	paginator.PrevTimestamp = &prev
+	paginator.PrevID = 42
+	query := PhotoFilter{Tags: []string{"tram", "dusk"}, AllTags: true}.Filter(sq.Select("photos.*").From("photos").Where(sq.Eq{"collection_id": 3}), "photos")
+
+	sql, args, err := paginator.Paginate(query).ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT photos.* FROM photos WHERE collection_id = ? AND (select count(*) from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = photos.id and lower(t.name) in (?,?)) = 2 AND photos.updated_at <= ? AND (photos.updated_at < ? OR (photos.updated_at = ? AND photos.id < ?)) ORDER BY photos.updated_at DESC, photos.id DESC LIMIT 10", sql)
+	assert.Equal(t, []interface{}{3, "tram", "dusk"}, args[:3])
+	assert.Len(t, args, 7)
+}
+
+func TestPhotoFilterWithRatings(t *testing.T) {
+	filter, err := PhotoFilterFromQuery(url.Values{"minRating": {"3"}, "favorites": {"true"}, "color": {"red"}})
+	assert.NoError(t, err)
+	filter.RatedBy = 5
+
+	sql, args, err := filter.Filter(sq.Select("*").From("photos"), "photos").ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM photos WHERE exists (select 1 from photo_ratings pr where (pr.photo_id = photos.id AND pr.user_id = ? AND pr.rating >= ? AND pr.favorite AND pr.color = ?))", sql)
+	assert.Equal(t, []interface{}{int64(5), 3, "red"}, args)
+}
+
+func TestPhotoFilterIgnoresRatingsWithoutUser(t *testing.T) {
+	sql, _, err := PhotoFilter{MinRating: 3, OrderByRating: true}.Filter(sq.Select("*").From("photos"), "photos").ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM photos", sql)
+}
+
+func TestPhotoFilterFromQueryWithInvalidRating(t *testing.T) {
+	_, err := PhotoFilterFromQuery(url.Values{"minRating": {"6"}})
+
+	assert.Error(t, err)
+}
+
+func TestPhotoFilterPaginatesByRating(t *testing.T) {
+	paginator := database.NewPaginator()
+	paginator.PrevID = 42
+	filter := PhotoFilter{RatedBy: 5, OrderByRating: true}
+
+	sql, args, err := filter.Paginate(sq.Select("*").From("photos"), "photos", paginator).ToSql()
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM photos WHERE (coalesce((select pr.rating from photo_ratings pr where pr.photo_id = photos.id and pr.user_id = 5), 0), photos.id) < (coalesce((select pr.rating from photo_ratings pr where pr.photo_id = ? and pr.user_id = 5), 0), ?) ORDER BY coalesce((select pr.rating from photo_ratings pr where pr.photo_id = photos.id and pr.user_id = 5), 0) DESC, photos.id DESC LIMIT 10", sql)
+	assert.Equal(t, []interface{}{int64(42), int64(42)}, args)
+}
@@ -11,7 +11,21 @@ type PhotoRecord struct {
 	CollectionID   int64      `db:"collection_id" json:"collectionID"`
 	RenditionCount int        `db:"rendition_count" json:"renditionCount"`
 	Description    string     `db:"description" json:"description"`
+	Title          string     `db:"title" json:"title"`
+	Copyright      string     `db:"copyright" json:"copyright"`
 	Filename       string     `db:"filename" json:"filename"`
 	TakenAt        *time.Time `db:"taken_at" json:"takenAt"`
+	TakenAtOffset  *int       `db:"taken_at_offset" json:"takenAtOffset"`
 	Published      bool       `db:"published" json:"published"`
+	FocalX         *float64   `db:"focal_x" json:"focalX"`
+	FocalY         *float64   `db:"focal_y" json:"focalY"`
+	Latitude       *float64   `db:"latitude" json:"latitude"`
+	Longitude      *float64   `db:"longitude" json:"longitude"`
+	Altitude       *float64   `db:"altitude" json:"altitude"`
+	Direction      *float64   `db:"direction" json:"direction"`
+	City           string     `db:"city" json:"city"`
+	Region         string     `db:"region" json:"region"`
+	Country        string     `db:"country" json:"country"`
+	CountryCode    string     `db:"country_code" json:"countryCode"`
+	DeletedAt      *time.Time `db:"deleted_at" json:"deletedAt"`
 }
@@ -22,7 +22,7 @@ func TestListReturnsPhotos(t *testing.T) {
 		sqlmock.NewRows([]string{"id", "collection_id", "filename"}).AddRow(11, 13, "image.jpg"),
 	)
 
-	photos, err := photoDB.List(13, database.NewPaginator())
+	photos, err := photoDB.List(13, database.NewPaginator(), PhotoFilter{})
 	assert.Nil(t, err)
 
 	assert.Equal(t, 1, len(photos))
@@ -33,6 +33,27 @@ func TestListReturnsPhotos(t *testing.T) {
 	assert.Nil(t, mock.ExpectationsWereMet())
 }
 
+func TestListFiltersPhotosByPlace(t *testing.T) {
+	db, mock := NewTestDB()
+	_, clock := fixedClock()
+
+	photoDB := NewPhotoDBWithClock(db, clock)
+
+	mock.ExpectQuery(
+		"SELECT (.+) FROM photos WHERE collection_id = \\$1 AND photos.deleted_at IS NULL AND lower\\(photos.region\\) = lower\\(\\$2\\) AND \\(lower\\(photos.country\\) = lower\\(\\$3\\) or photos.country_code = upper\\(\\$4\\)\\)",
+	).WithArgs(13, "Ontario", "canada", "canada").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "collection_id", "region", "country"}).AddRow(11, 13, "Ontario", "Canada"),
+	)
+
+	photos, err := photoDB.List(13, database.NewPaginator(), PhotoFilter{Region: "Ontario", Country: "canada"})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(photos))
+	assert.Equal(t, "Canada", photos[0].Country)
+
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
 func TestSaveNewRecordWithoutCollectionIDFails(t *testing.T) {
 	db, _ := NewTestDB()
 	_, clock := fixedClock()
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/pkg/images"
 )
 
 type RenditionConfigurationRecord struct {
@@ -17,12 +18,62 @@ type RenditionConfigurationRecord struct {
 	Resize       bool   `db:"resize" json:"resize"`
 	Original     bool   `db:"original" json:"original"`
 	CollectionID *int64 `db:"collection_id" json:"collectionID"`
+	CacheControl string `db:"cache_control" json:"cacheControl"`
+	Version      int    `db:"version" json:"version"`
+	// Format is the content type renditions are encoded in.
+	Format string `db:"format" json:"format"`
+	// Mode describes how originals are fitted into Width and Height.
+	Mode images.ResizeMode `db:"mode" json:"mode"`
+	// Metadata describes which metadata of the original is kept.
+	Metadata images.MetadataPolicy `db:"metadata" json:"metadata"`
 }
 
+// DefaultCacheControl is the Cache-Control policy for rendition configurations that don't specify one. Renditions
+// never change once written, so clients may cache them forever.
+const DefaultCacheControl = "max-age=31536000, immutable"
+
+// DefaultRenditionFormat is the content type of renditions for rendition configurations that don't specify one.
+const DefaultRenditionFormat = "image/jpeg"
+
 func (r RenditionConfigurationRecord) Area() int64 {
 	return int64(r.Width * r.Height)
 }
 
+// EncodeOptions returns the options to encode renditions with.
+func (r RenditionConfigurationRecord) EncodeOptions() images.EncodeOptions {
+	return images.EncodeOptions{Quality: r.Quality}
+}
+
+// OutputFormat returns the content type renditions are encoded in.
+func (r RenditionConfigurationRecord) OutputFormat() string {
+	if r.Format == "" {
+		return DefaultRenditionFormat
+	}
+	return r.Format
+}
+
+// ResizeMode returns how originals are fitted into the configured dimensions.
+func (r RenditionConfigurationRecord) ResizeMode() images.ResizeMode {
+	if r.Mode == "" {
+		return images.DefaultResizeMode
+	}
+	return r.Mode
+}
+
+// MetadataPolicy returns which metadata of the original is kept.
+func (r RenditionConfigurationRecord) MetadataPolicy() images.MetadataPolicy {
+	if r.Metadata == "" {
+		return images.DefaultMetadataPolicy
+	}
+	return r.Metadata
+}
+
+// Shareable returns true if renditions made from this configuration may be served on share sites. Only renditions
+// without metadata are.
+func (r RenditionConfigurationRecord) Shareable() bool {
+	return r.MetadataPolicy() == images.MetadataStrip
+}
+
 type RenditionConfigurationDB interface {
 	FindByID(int64, int64) (RenditionConfigurationRecord, error)
 	FindByName(int64, string) (RenditionConfigurationRecord, error)
@@ -87,29 +138,45 @@ func (c *renditionConfigurationSQLDB) FindByName(collectionID int64, name string
 
 func (c *renditionConfigurationSQLDB) Save(record RenditionConfigurationRecord) (RenditionConfigurationRecord, error) {
 	var err error
+	if record.CacheControl == "" {
+		record.CacheControl = DefaultCacheControl
+	}
+	if record.Format == "" {
+		record.Format = DefaultRenditionFormat
+	}
+	record.Mode = record.ResizeMode()
+	record.Metadata = record.MetadataPolicy()
 
 	if record.IsPersisted() {
 		record.JustUpdated(c.clock)
-		sql := "UPDATE rendition_configurations SET width=$1, height=$2, name=$3, quality=$4, updated_at=$5 WHERE collection_id=$6 AND id=$7"
+		sql := "UPDATE rendition_configurations SET width=$1, height=$2, name=$3, quality=$4, cache_control=$5, format=$6, mode=$7, metadata=$8, updated_at=$9 WHERE collection_id=$10 AND id=$11"
 		err = checkResult(c.db.Exec(
 			sql,
 			record.Width,
 			record.Height,
 			record.Name,
 			record.Quality,
+			record.CacheControl,
+			record.Format,
+			record.Mode,
+			record.Metadata,
 			record.UpdatedAt.UTC(),
 			record.CollectionID,
 			record.ID,
 		))
 	} else {
 		record.Timestamps = JustCreated(c.clock)
-		sql := "INSERT INTO rendition_configurations (width, height, name, quality, collection_id, updated_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id"
+		sql := "INSERT INTO rendition_configurations (width, height, name, quality, cache_control, format, mode, metadata, collection_id, updated_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id"
 		err = c.db.QueryRow(
 			sql,
 			record.Width,
 			record.Height,
 			record.Name,
 			record.Quality,
+			record.CacheControl,
+			record.Format,
+			record.Mode,
+			record.Metadata,
 			record.CollectionID,
 			record.UpdatedAt.UTC(),
 			record.CreatedAt.UTC(),
@@ -43,13 +43,13 @@ type renditionSQLDB struct {
 func (c *renditionSQLDB) FindByShareAndID(shareID, id int64) (record RenditionRecord, err error) {
 	sql, args, err := c.sql.Select("r.*").
 		From("renditions AS r").
-		Join("shares AS s ON r.photo_id = s.photo_id").
 		Join("share_rendition_configurations AS src ON src.rendition_configuration_id = r.rendition_configuration_id").
+		Join("shares AS s ON s.id = src.share_id").
 		Where(sq.Eq{
-			"s.id":         shareID,
 			"src.share_id": shareID,
 			"r.id":         id,
 		}).
+		Where("r.photo_id in (select photo_id from share_photos where share_id = s.id union all select photo_id from album_photos where album_id = s.album_id)").
 		ToSql()
 	if err != nil {
 		return record, errors.Wrap(err, "could not build query")
@@ -195,7 +195,7 @@ func (c *renditionSQLDB) Save(record RenditionRecord) (RenditionRecord, error) {
 		err = checkResult(c.db.Exec(sql, record.PhotoID, record.UpdatedAt.UTC(), record.ID))
 	} else {
 		record.Timestamps = JustCreated(c.clock)
-		sql := "INSERT INTO renditions (photo_id, original, width, height, format, rendition_configuration_id, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id"
+		sql := "INSERT INTO renditions (photo_id, original, width, height, format, rendition_configuration_id, rendition_configuration_version, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, (SELECT version FROM rendition_configurations WHERE id = $6), $7, $8) RETURNING id"
 		err = c.db.QueryRow(
 			sql,
 			record.PhotoID,
@@ -15,4 +15,7 @@ type RenditionRecord struct {
 	Height                   uint   `db:"height" json:"height"`
 	Format                   string `db:"format" json:"format"`
 	RenditionConfigurationID int64  `db:"rendition_configuration_id" json:"renditionConfigurationID"`
+	// RenditionConfigurationVersion is the version of the rendition configuration this rendition was made from.
+	RenditionConfigurationVersion int    `db:"rendition_configuration_version" json:"renditionConfigurationVersion"`
+	ContentHash                   string `db:"content_hash" json:"-"`
 }
@@ -8,11 +8,14 @@ import (
 
 type ShareDB interface {
 	FindByShareSiteAndSlug(shareSiteID int64, slug string) (ShareRecord, error)
+	// FindByPhoto finds the shares the photo was picked for. Album shares are left out.
 	FindByPhoto(photoID int64) ([]ShareRecord, error)
 	Save(ShareRecord) (ShareRecord, error)
+	// SetPhotos replaces the photos of the share with the given ones, in that order.
+	SetPhotos(shareID int64, photoIDs []int64) error
 }
 
-func NewShareDB(dbx DB) ShareDB {
+func NewShareDB(dbx Queries) ShareDB {
 	return &shareSQLDB{
 		db:    dbx,
 		clock: time.Now,
@@ -21,7 +24,7 @@ func NewShareDB(dbx DB) ShareDB {
 }
 
 type shareSQLDB struct {
-	db    DB
+	db    Queries
 	clock Clock
 	sql   sq.StatementBuilderType
 }
@@ -41,9 +44,14 @@ func (c *shareSQLDB) Save(record ShareRecord) (ShareRecord, error) {
 	} else {
 		record.Timestamps = JustCreated(c.clock)
 
+		if record.ExpiresAt != nil {
+			expiresAt := record.ExpiresAt.UTC()
+			record.ExpiresAt = &expiresAt
+		}
+
 		sql, args, _ := c.sql.Insert("shares").
-			Columns("photo_id", "collection_id", "share_site_id", "slug", "created_at", "updated_at").
-			Values(record.PhotoID, record.CollectionID, record.ShareSiteID, record.Slug, record.CreatedAt.UTC(), record.UpdatedAt.UTC()).
+			Columns("collection_id", "album_id", "share_site_id", "slug", "expires_at", "created_at", "updated_at").
+			Values(record.CollectionID, record.AlbumID, record.ShareSiteID, record.Slug, record.ExpiresAt, record.CreatedAt.UTC(), record.UpdatedAt.UTC()).
 			Suffix("RETURNING id").
 			ToSql()
 
@@ -71,10 +79,31 @@ func (c *shareSQLDB) FindByShareSiteAndSlug(shareSiteID int64, slug string) (Sha
 func (c *shareSQLDB) FindByPhoto(photoID int64) ([]ShareRecord, error) {
 	sql, args, _ := c.sql.Select("shares.*").
 		From("shares").
-		Where(sq.Eq{"photo_id": photoID}).
+		Join("share_photos sp on (sp.share_id = shares.id)").
+		Where(sq.Eq{"sp.photo_id": photoID}).
+		OrderBy("shares.id").
 		ToSql()
 
 	var result []ShareRecord
 	err := c.db.Select(&result, sql, args...)
 	return result, err
 }
+
+func (c *shareSQLDB) SetPhotos(shareID int64, photoIDs []int64) error {
+	sql, args, _ := c.sql.Delete("share_photos").Where(sq.Eq{"share_id": shareID}).ToSql()
+	if _, err := c.db.Exec(sql, args...); err != nil {
+		return err
+	}
+	if len(photoIDs) == 0 {
+		return nil
+	}
+
+	now := c.clock().UTC()
+	insert := c.sql.Insert("share_photos").Columns("share_id", "photo_id", "sort_order", "created_at", "updated_at")
+	for i, photoID := range photoIDs {
+		insert = insert.Values(shareID, photoID, i, now, now)
+	}
+	sql, args, _ = insert.Suffix("on conflict do nothing").ToSql()
+	_, err := c.db.Exec(sql, args...)
+	return err
+}
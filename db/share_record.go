@@ -1,14 +1,23 @@
 package db
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type ShareRecord struct {
 	Record
 	Timestamps
-	PhotoID      int64  `db:"photo_id" json:"photoID"`
-	CollectionID int64  `db:"collection_id" json:"collectionID"`
-	ShareSiteID  int64  `db:"share_site_id" json:"shareSiteID"`
-	Slug         string `db:"slug" json:"slug"`
+	CollectionID int64 `db:"collection_id" json:"collectionID"`
+	// AlbumID is set for shares of an album, which share its photos as the album changes. Other shares share the
+	// photos in share_photos.
+	AlbumID     *int64 `db:"album_id" json:"albumID"`
+	ShareSiteID int64  `db:"share_site_id" json:"shareSiteID"`
+	Slug        string `db:"slug" json:"slug"`
+	// ExpiresAt is when the share stops being served, if ever.
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt"`
+	// RevokedAt is set while the share is revoked.
+	RevokedAt *time.Time `db:"revoked_at" json:"revokedAt"`
 }
 
 type ShareRenditionConfigurationRecord struct {
@@ -14,7 +14,7 @@ type ShareRenditionConfigurationDB interface {
 	SetForShare(shareID int64, configs []ShareRenditionConfigurationRecord) ([]ShareRenditionConfigurationRecord, error)
 }
 
-func NewShareRenditionConfigurationDB(dbx DB) ShareRenditionConfigurationDB {
+func NewShareRenditionConfigurationDB(dbx Queries) ShareRenditionConfigurationDB {
 	return &shareRenditionConfigurationSQLDB{
 		db:    dbx,
 		clock: time.Now,
@@ -23,13 +23,13 @@ func NewShareRenditionConfigurationDB(dbx DB) ShareRenditionConfigurationDB {
 }
 
 type shareRenditionConfigurationSQLDB struct {
-	db    DB
+	db    Queries
 	clock Clock
 	sql   sq.StatementBuilderType
 }
 
 func (s *shareRenditionConfigurationSQLDB) FindByShare(shareID int64) ([]ShareRenditionConfigurationRecord, error) {
-	fieldNames := []string{"rc.id", "rc.created_at", "rc.updated_at", "rc.width", "rc.height", "rc.name", "rc.quality", "rc.private", "rc.resize", "rc.original", "rc.collection_id"}
+	fieldNames := []string{"rc.id", "rc.created_at", "rc.updated_at", "rc.width", "rc.height", "rc.name", "rc.quality", "rc.private", "rc.resize", "rc.original", "rc.collection_id", "rc.metadata"}
 	var rcFields []string
 	for _, name := range fieldNames {
 		rcFields = append(rcFields, fmt.Sprintf("%s as \"%s\"", name, name))
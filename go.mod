@@ -37,7 +37,7 @@ require (
 	github.com/stretchr/testify v1.4.0
 	go.opencensus.io v0.14.0 // indirect
 	golang.org/x/crypto v0.0.0-20190513172903-22d7a77e9e5f
-	golang.org/x/image v0.0.0-20180708004352-c73c2afc3b81 // indirect
+	golang.org/x/image v0.0.0-20180708004352-c73c2afc3b81
 	golang.org/x/text v0.3.2 // indirect
 	google.golang.org/api v0.0.0-20180726000515-082d5fa4f1f0 // indirect
 	gopkg.in/DATA-DOG/go-sqlmock.v1 v1.3.0
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"database/sql"
 	"log"
 
 	"github.com/ilikeorangutans/phts/db"
@@ -60,7 +61,6 @@ type userCollectionRepoImpl struct {
 }
 
 func (r *userCollectionRepoImpl) canAccess(col *db.Collection) bool {
-	// TODO we'd call this method before accessing collections
 	return r.collections.CanAccess(r.user.ID, col.ID)
 }
 
@@ -127,16 +127,28 @@ func (r *userCollectionRepoImpl) Recent(count int) ([]*db.Collection, error) {
 	return result, nil
 }
 
+// FindByID finds the collection with the given id. Collections the user is not a member of are not found.
 func (r *userCollectionRepoImpl) FindByID(id int64) (*db.Collection, error) {
-	if record, err := r.collections.FindByID(id); err != nil {
+	record, err := r.collections.FindByID(id)
+	if err != nil {
 		return nil, err
-	} else {
-		return record, nil
 	}
+	if !r.canAccess(record) {
+		return nil, sql.ErrNoRows
+	}
+	return record, nil
 }
 
+// FindBySlug finds the collection with the given slug. Collections the user is not a member of are not found.
 func (r *userCollectionRepoImpl) FindBySlug(slug string) (*db.Collection, error) {
-	return r.collections.FindBySlug(slug)
+	record, err := r.collections.FindBySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	if !r.canAccess(record) {
+		return nil, sql.ErrNoRows
+	}
+	return record, nil
 }
 
 func (r *userCollectionRepoImpl) Create(collection *db.Collection) error {
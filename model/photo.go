@@ -7,8 +7,10 @@ import (
 
 type Photo struct {
 	db.PhotoRecord
-	Renditions Renditions `json:"renditions"`
-	Exif       []metadata.ExifTag
+	Renditions Renditions          `json:"renditions"`
+	Exif       []metadata.ExifTag  `json:"exif"`
+	Metadata   metadata.Properties `json:"metadata"`
+	Tags       []string            `json:"tags"`
 	//Collection db.Collection `json:"-"`
 }
 
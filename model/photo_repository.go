@@ -1,6 +1,7 @@
 package model
 
 import (
+	"bytes"
 	"log"
 	"time"
 
@@ -12,8 +13,8 @@ import (
 
 type PhotoRepository interface {
 	FindByID(collection *db.Collection, photoID int64) (Photo, error)
-	List(collection *db.Collection, paginator database.Paginator, configs []RenditionConfiguration) ([]Photo, database.Paginator, error)
-	ListAlbum(collection *db.Collection, album Album, paginator database.Paginator, configs []RenditionConfiguration) ([]Photo, database.Paginator, error)
+	List(collection *db.Collection, paginator database.Paginator, configs []RenditionConfiguration, filter db.PhotoFilter) ([]Photo, database.Paginator, error)
+	ListAlbum(collection *db.Collection, album Album, paginator database.Paginator, configs []RenditionConfiguration, filter db.PhotoFilter) ([]Photo, database.Paginator, error)
 	Delete(collection *db.Collection, photo Photo) error
 	// Create adds a new photo to the given collection.
 	Create(*db.Collection, string, []byte) (Photo, error)
@@ -50,11 +51,6 @@ func (r *photoRepoImpl) FindByID(collection *db.Collection, photoID int64) (Phot
 		return Photo{}, err
 	}
 
-	exifTags, err := r.exifDB.AllForPhoto(photoID)
-	if err != nil {
-		return Photo{}, err
-	}
-
 	photo := Photo{
 		PhotoRecord: record,
 		Renditions:  []Rendition{},
@@ -65,15 +61,11 @@ func (r *photoRepoImpl) FindByID(collection *db.Collection, photoID int64) (Phot
 		photo.Renditions = append(photo.Renditions, Rendition{rendition, nil})
 	}
 
-	for _, tag := range exifTags {
-		photo.Exif = append(photo.Exif, metadata.ExifTag{tag})
-	}
-
 	return photo, err
 }
 
-func (r *photoRepoImpl) List(collection *db.Collection, paginator database.Paginator, renditionConfigs []RenditionConfiguration) ([]Photo, database.Paginator, error) {
-	records, err := r.photos.List(collection.ID, paginator)
+func (r *photoRepoImpl) List(collection *db.Collection, paginator database.Paginator, renditionConfigs []RenditionConfiguration, filter db.PhotoFilter) ([]Photo, database.Paginator, error) {
+	records, err := r.photos.List(collection.ID, paginator, filter)
 	if err != nil {
 		return nil, paginator, err
 	}
@@ -121,8 +113,8 @@ func (r *photoRepoImpl) List(collection *db.Collection, paginator database.Pagin
 	return result, paginator, nil
 }
 
-func (r *photoRepoImpl) ListAlbum(collection *db.Collection, album Album, paginator database.Paginator, renditionConfigs []RenditionConfiguration) ([]Photo, database.Paginator, error) {
-	records, err := r.photos.ListAlbum(collection.ID, album.ID, paginator)
+func (r *photoRepoImpl) ListAlbum(collection *db.Collection, album Album, paginator database.Paginator, renditionConfigs []RenditionConfiguration, filter db.PhotoFilter) ([]Photo, database.Paginator, error) {
+	records, err := r.photos.ListAlbum(collection.ID, album.ID, paginator, filter)
 	if err != nil {
 		return nil, paginator, err
 	}
@@ -239,7 +231,7 @@ func (r *photoRepoImpl) Create(collection *db.Collection, filename string, data
 				return err
 			}
 
-			if err := r.backend.Store(renditionRecord.ID, rendition.data); err != nil {
+			if err := r.backend.Put(renditionRecord.ID, bytes.NewReader(rendition.data), int64(len(rendition.data)), renditionRecord.Format); err != nil {
 				return err
 			}
 		}
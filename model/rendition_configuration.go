@@ -3,14 +3,11 @@ package model
 import (
 	"bytes"
 	"fmt"
-	"image"
-	"image/jpeg"
 	"log"
 
-	"github.com/disintegration/imaging"
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/images"
 	"github.com/ilikeorangutans/phts/pkg/metadata"
-	"github.com/nfnt/resize"
 )
 
 type RenditionConfiguration struct {
@@ -32,36 +29,48 @@ func (r RenditionConfigurations) Process(filename string, data []byte, orientati
 	// TODO sort configs by size: big -> small
 	var renditions Renditions
 	for _, config := range r {
-		rawJpeg, err := jpeg.Decode(bytes.NewReader(data))
+		raw, contentType, err := images.Decode(bytes.NewReader(data))
 		if err != nil {
 			return nil, err
 		}
 
 		log.Printf("adding %s, orientation: %s", filename, orientation)
-		rawJpeg = rotate(rawJpeg, orientation.Angle())
-		width, height := uint(rawJpeg.Bounds().Dx()), uint(rawJpeg.Bounds().Dy())
-		if orientation.Angle()%180 != 0 {
-			width, height = height, width
-		}
+		raw = orientation.Normalize(raw)
+		width, height := uint(raw.Bounds().Dx()), uint(raw.Bounds().Dy())
 		binary := data
+		policy := config.MetadataPolicy()
 
-		if config.Resize {
-			// TODO instead of reading from rawJpeg we should take the previous result (which should be smaller than the original, but bigger than this version
-			resized := resize.Resize(uint(config.Width), 0, rawJpeg, resize.Lanczos3)
+		if !config.Resize && policy != images.MetadataKeep && images.CanFilterMetadata(contentType) {
+			filtered := &bytes.Buffer{}
+			if err := images.FilterMetadata(filtered, bytes.NewReader(data), contentType, policy); err != nil {
+				return nil, err
+			}
+			binary = filtered.Bytes()
+		} else if config.Resize || policy != images.MetadataKeep {
+			// Originals whose metadata can't be filtered in place are re-encoded at full size, which drops all metadata.
+			resized := raw
+			if config.Resize {
+				// TODO instead of reading from rawJpeg we should take the previous result (which should be smaller than the original, but bigger than this version
+				resized = images.Resize(raw, config.ResizeMode(), config.Width, config.Height, images.CenterFocalPoint)
+			}
 			var b = &bytes.Buffer{}
-			if err := jpeg.Encode(b, resized, &jpeg.Options{Quality: config.Quality}); err != nil {
+			if err := images.Encode(b, resized, config.OutputFormat(), config.EncodeOptions()); err != nil {
+				return nil, err
+			}
+			binary, err = images.CopyMetadata(b.Bytes(), config.OutputFormat(), bytes.NewReader(data), contentType, policy)
+			if err != nil {
 				return nil, err
 			}
 			width = uint(resized.Bounds().Dx())
 			height = uint(resized.Bounds().Dy())
-			binary = b.Bytes()
+			contentType = config.OutputFormat()
 		}
 
 		record := db.RenditionRecord{
 			Original:                 !config.Resize,
 			Width:                    width,
 			Height:                   height,
-			Format:                   "image/jpeg",
+			Format:                   contentType,
 			RenditionConfigurationID: config.ID,
 		}
 
@@ -81,19 +90,3 @@ func (r RenditionConfigurationsBySizeDescending) Swap(i, j int) {
 func (r RenditionConfigurationsBySizeDescending) Less(i, j int) bool {
 	return r.RenditionConfigurations[i].Area() > r.RenditionConfigurations[j].Area()
 }
-
-func rotate(img image.Image, angle int) image.Image {
-	//var result *image.NRGBA
-	var result image.Image = img
-	switch angle {
-	case -90:
-		// Angles are opposite as imaging uses counter clockwise angles and we use clockwise.
-		result = imaging.Rotate270(img)
-	case 90:
-		result = imaging.Rotate270(img)
-	case 180:
-		result = imaging.Rotate180(img)
-	default:
-	}
-	return result
-}
@@ -9,5 +9,7 @@ type Share struct {
 	ShareSite               ShareSite                `json:"shareSite"`
 	RenditionConfigurations []RenditionConfiguration `json:"renditionConfigurations"`
 	Photos                  []Photo                  `json:"photos"`
-	Collection              *db.Collection
+	// Album is set for shares of an album, which share its photos as the album changes.
+	Album      *Album `json:"album,omitempty"`
+	Collection *db.Collection
 }
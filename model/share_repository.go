@@ -1,7 +1,6 @@
 package model
 
 import (
-	"fmt"
 	"log"
 
 	"github.com/ilikeorangutans/phts/db"
@@ -67,22 +66,39 @@ func (r *shareRepoImpl) FindByPhoto(photo Photo, paginator database.Paginator) (
 	return shares, nil
 }
 
+// Publish saves the share together with its photos and rendition configurations in one transaction, so a share is
+// never published with only some of them.
 func (r *shareRepoImpl) Publish(share Share) (Share, error) {
-	if len(share.Photos) > 1 {
-		return Share{}, fmt.Errorf("don't know how to share more than one item yet")
-	}
-	share.ShareRecord.PhotoID = share.Photos[0].ID
 	share.ShareRecord.CollectionID = share.Collection.ID
+	if share.Album != nil {
+		share.ShareRecord.AlbumID = &share.Album.ID
+	}
 	share.ShareRecord.ShareSiteID = share.ShareSite.ID
 
 	log.Printf("Saving %v", share.ShareRecord)
 
-	shareRecord, err := r.shareDB.Save(share.ShareRecord)
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return share, err
+	}
+	shareDB := db.NewShareDB(tx)
+
+	shareRecord, err := shareDB.Save(share.ShareRecord)
 	if err != nil {
+		tx.Rollback()
 		return share, err
 	}
 	share.ShareRecord = shareRecord
 
+	var photoIDs []int64
+	for _, photo := range share.Photos {
+		photoIDs = append(photoIDs, photo.ID)
+	}
+	if err := shareDB.SetPhotos(share.ID, photoIDs); err != nil {
+		tx.Rollback()
+		return share, err
+	}
+
 	var shareRenditionConfigs []db.ShareRenditionConfigurationRecord
 	for _, config := range share.RenditionConfigurations {
 		shareRenditionConfigs = append(shareRenditionConfigs, db.ShareRenditionConfigurationRecord{
@@ -91,9 +107,12 @@ func (r *shareRepoImpl) Publish(share Share) (Share, error) {
 		})
 	}
 
-	_, err = r.shareRenditionConfigDB.SetForShare(share.ID, shareRenditionConfigs)
+	if _, err := db.NewShareRenditionConfigurationDB(tx).SetForShare(share.ID, shareRenditionConfigs); err != nil {
+		tx.Rollback()
+		return share, err
+	}
 
-	return share, err
+	return share, tx.Commit()
 }
 
 func (r *shareRepoImpl) FindByShareSiteAndSlug(shareSite ShareSite, slug string) (Share, error) {
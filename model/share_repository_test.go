@@ -0,0 +1,34 @@
+package model
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/test"
+	"github.com/stretchr/testify/assert"
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestPublishRollsBackWhenPhotosCannotBeSet(t *testing.T) {
+	dbx, mock := test.NewTestDB()
+	repository := NewShareRepository(dbx)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO shares").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(5)))
+	mock.ExpectExec("DELETE FROM share_photos WHERE share_id = \\$1").
+		WithArgs(5).
+		WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	share := Share{
+		Collection: &db.Collection{Record: db.Record{ID: 3}},
+		ShareSite:  ShareSite{},
+		Photos:     []Photo{{PhotoRecord: db.PhotoRecord{Record: db.Record{ID: 7}, CollectionID: 3}}},
+	}
+	_, err := repository.Publish(share)
+
+	assert.Error(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
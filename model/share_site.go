@@ -3,6 +3,8 @@ package model
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
+	"time"
 
 	"github.com/ilikeorangutans/phts/db"
 )
@@ -22,6 +24,8 @@ type ShareBuilder struct {
 	collection *db.Collection
 	slug       string
 	photos     []Photo
+	album      *Album
+	expiresAt  *time.Time
 	errors     []error
 	configs    RenditionConfigurations
 }
@@ -32,11 +36,49 @@ func (b ShareBuilder) FromCollection(collection *db.Collection) ShareBuilder {
 }
 
 func (b ShareBuilder) AddPhoto(photo Photo) ShareBuilder {
-	b.photos = append(b.photos, photo)
+	return b.AddPhotos(photo)
+}
+
+// AddPhotos adds the given photos to the share, after the ones added so far. Photos cannot be added to album shares.
+func (b ShareBuilder) AddPhotos(photos ...Photo) ShareBuilder {
+	for _, photo := range photos {
+		if b.hasPhoto(photo) {
+			continue
+		}
+		b.photos = append(b.photos, photo)
+	}
+	return b
+}
+
+// FromAlbum shares the photos of the given album. The share follows the album as photos are added or removed.
+func (b ShareBuilder) FromAlbum(album Album) ShareBuilder {
+	b.album = &album
+	return b
+}
+
+// ExpiresAt sets when the share stops being served; nil means never.
+func (b ShareBuilder) ExpiresAt(expiresAt *time.Time) ShareBuilder {
+	b.expiresAt = expiresAt
 	return b
 }
 
+func (b ShareBuilder) hasPhoto(photo Photo) bool {
+	for _, p := range b.photos {
+		if p.ID == photo.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowRenditions sets the rendition configurations that may be served for the share. Configurations that keep
+// metadata cannot be shared.
 func (b ShareBuilder) AllowRenditions(configs RenditionConfigurations) ShareBuilder {
+	for _, config := range configs {
+		if !config.Shareable() {
+			b.errors = append(b.errors, fmt.Errorf("rendition configuration %q keeps metadata and cannot be shared", config.Name))
+		}
+	}
 	b.configs = configs
 	return b
 }
@@ -61,13 +103,26 @@ func (b ShareBuilder) WithRandomSlug() ShareBuilder {
 }
 
 func (b ShareBuilder) Build() (Share, []error) {
+	if b.album != nil && len(b.photos) > 0 {
+		b.errors = append(b.errors, fmt.Errorf("a share is either of an album or of photos, not both"))
+	} else if b.album == nil && len(b.photos) == 0 {
+		b.errors = append(b.errors, fmt.Errorf("nothing to share"))
+	}
+	if b.collection == nil {
+		b.errors = append(b.errors, fmt.Errorf("no collection to share from"))
+	} else if b.album != nil && b.album.CollectionID != b.collection.ID {
+		b.errors = append(b.errors, fmt.Errorf("album is not in the collection"))
+	}
+
 	return Share{
 		ShareSite:               b.shareSite,
 		Photos:                  b.photos,
+		Album:                   b.album,
 		Collection:              b.collection,
 		RenditionConfigurations: b.configs,
 		ShareRecord: db.ShareRecord{
-			Slug: b.slug,
+			Slug:      b.slug,
+			ExpiresAt: b.expiresAt,
 		},
 	}, b.errors
 }
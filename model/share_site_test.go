@@ -0,0 +1,49 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareBuilderKeepsPhotoOrder(t *testing.T) {
+	collection := &db.Collection{Record: db.Record{ID: 3}}
+	photo := func(id int64) Photo {
+		return Photo{PhotoRecord: db.PhotoRecord{Record: db.Record{ID: id}, CollectionID: 3}}
+	}
+
+	share, errs := ShareSite{}.Builder().
+		FromCollection(collection).
+		AddPhotos(photo(7), photo(5)).
+		AddPhoto(photo(7)).
+		AddPhoto(photo(9)).
+		WithSlug("holidays").
+		Build()
+
+	assert.Empty(t, errs)
+	assert.Len(t, share.Photos, 3)
+	assert.Equal(t, int64(7), share.Photos[0].ID)
+	assert.Equal(t, int64(5), share.Photos[1].ID)
+	assert.Equal(t, int64(9), share.Photos[2].ID)
+}
+
+func TestShareBuilderSharesAlbumOrPhotos(t *testing.T) {
+	collection := &db.Collection{Record: db.Record{ID: 3}}
+	album := Album{db.AlbumRecord{Record: db.Record{ID: 11}, CollectionID: 3}}
+	photo := Photo{PhotoRecord: db.PhotoRecord{Record: db.Record{ID: 7}, CollectionID: 3}}
+
+	share, errs := ShareSite{}.Builder().FromCollection(collection).FromAlbum(album).WithSlug("holidays").Build()
+	assert.Empty(t, errs)
+	assert.Equal(t, int64(11), share.Album.ID)
+
+	_, errs = ShareSite{}.Builder().FromCollection(collection).FromAlbum(album).AddPhoto(photo).WithSlug("holidays").Build()
+	assert.NotEmpty(t, errs)
+
+	_, errs = ShareSite{}.Builder().FromCollection(collection).WithSlug("holidays").Build()
+	assert.NotEmpty(t, errs)
+
+	otherAlbum := Album{db.AlbumRecord{Record: db.Record{ID: 12}, CollectionID: 4}}
+	_, errs = ShareSite{}.Builder().FromCollection(collection).FromAlbum(otherAlbum).WithSlug("holidays").Build()
+	assert.NotEmpty(t, errs)
+}
@@ -70,11 +70,11 @@ func (o OffsetPaginatorOpts) Order(desired string) string {
 }
 
 type OffsetPaginator struct {
-	Offset  uint64
-	Limit   uint64
-	OrderBy string
-	Order   string
-	Count   uint64
+	Offset  uint64 `json:"offset"`
+	Limit   uint64 `json:"limit"`
+	OrderBy string `json:"orderBy"`
+	Order   string `json:"order"`
+	Count   uint64 `json:"count"`
 }
 
 func (o OffsetPaginator) WithCount(count uint64) OffsetPaginator {
@@ -107,7 +107,7 @@ func (p Paginator) Paginate(input sq.SelectBuilder) sq.SelectBuilder {
 	return query.
 		OrderBy(
 			p.Direction.AddToColumn(p.prefixedColumn(p.Column)),
-			p.Direction.AddToColumn("id"),
+			p.Direction.AddToColumn(prefixedPrimary),
 		).
 		Limit(uint64(p.Count))
 }
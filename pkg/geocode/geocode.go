@@ -0,0 +1,162 @@
+// Package geocode finds the place closest to a location without calling out to external services. Places are loaded
+// from an offline dataset like the GeoNames cities files and kept in memory in a k-d tree.
+package geocode
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// earthRadius is the mean radius of the earth in kilometers.
+	earthRadius = 6371.0
+	// DefaultMaxDistance is how far in kilometers a location may be from the closest place and still be considered
+	// to be in that place.
+	DefaultMaxDistance = 50.0
+)
+
+// Place is a named populated place.
+type Place struct {
+	// City is the name of the place.
+	City string `json:"city"`
+	// Region is the name of the first level administrative division the place is in, e.g. a state or province.
+	Region string `json:"region"`
+	// Country is the name of the country the place is in.
+	Country string `json:"country"`
+	// CountryCode is the ISO 3166-1 alpha-2 code of the country.
+	CountryCode string `json:"countryCode"`
+
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// Geocoder finds the place closest to a location.
+type Geocoder interface {
+	// ReverseGeocode returns the place closest to the given location in decimal degrees. Returns false if no place is
+	// close enough.
+	ReverseGeocode(latitude, longitude float64) (Place, bool)
+}
+
+// None is a Geocoder that never finds a place. It is used when no place dataset is configured.
+var None Geocoder = none{}
+
+type none struct{}
+
+func (none) ReverseGeocode(latitude, longitude float64) (Place, bool) {
+	return Place{}, false
+}
+
+// Index is an in-memory Geocoder. Places are stored as points on the unit sphere in a k-d tree, where the straight
+// line distance between two points grows with their distance on the surface.
+type Index struct {
+	places []Place
+	root   *node
+	// maxChord is the maximum distance in kilometers converted to a straight line distance on the unit sphere.
+	maxChord float64
+}
+
+type node struct {
+	point       [3]float64
+	place       int
+	axis        int
+	left, right *node
+}
+
+// NewIndex creates an index of the given places. Locations further than maxDistance kilometers from the closest place
+// are not geocoded.
+func NewIndex(places []Place, maxDistance float64) *Index {
+	points := make([]node, len(places))
+	for i, place := range places {
+		points[i] = node{point: toPoint(place.Latitude, place.Longitude), place: i}
+	}
+
+	return &Index{
+		places:   places,
+		root:     build(points, 0),
+		maxChord: 2 * math.Sin(math.Min(maxDistance/earthRadius, math.Pi)/2),
+	}
+}
+
+// Len returns the number of places in the index.
+func (i *Index) Len() int {
+	return len(i.places)
+}
+
+// ReverseGeocode returns the place closest to the given location.
+func (i *Index) ReverseGeocode(latitude, longitude float64) (Place, bool) {
+	if i.root == nil {
+		return Place{}, false
+	}
+
+	target := toPoint(latitude, longitude)
+	best := -1
+	bestDistance := i.maxChord * i.maxChord
+	i.root.nearest(target, &best, &bestDistance)
+	if best < 0 {
+		return Place{}, false
+	}
+	return i.places[best], true
+}
+
+// Distance returns the great circle distance between two locations in kilometers.
+func Distance(latitude1, longitude1, latitude2, longitude2 float64) float64 {
+	chord := math.Sqrt(squaredDistance(toPoint(latitude1, longitude1), toPoint(latitude2, longitude2)))
+	return 2 * earthRadius * math.Asin(math.Min(chord/2, 1))
+}
+
+// build creates a balanced tree by splitting the points at their median along alternating axes.
+func build(points []node, depth int) *node {
+	if len(points) == 0 {
+		return nil
+	}
+
+	axis := depth % 3
+	sort.Slice(points, func(a, b int) bool {
+		return points[a].point[axis] < points[b].point[axis]
+	})
+	median := len(points) / 2
+
+	n := points[median]
+	n.axis = axis
+	n.left = build(points[:median], depth+1)
+	n.right = build(points[median+1:], depth+1)
+	return &n
+}
+
+// nearest searches the subtree for a point closer to target than bestDistance, which is squared.
+func (n *node) nearest(target [3]float64, best *int, bestDistance *float64) {
+	if n == nil {
+		return
+	}
+
+	if d := squaredDistance(n.point, target); d <= *bestDistance {
+		*best = n.place
+		*bestDistance = d
+	}
+
+	delta := target[n.axis] - n.point[n.axis]
+	near, far := n.left, n.right
+	if delta > 0 {
+		near, far = n.right, n.left
+	}
+	near.nearest(target, best, bestDistance)
+	// The other side can only hold a closer point if the splitting plane is closer than the best match so far.
+	if delta*delta <= *bestDistance {
+		far.nearest(target, best, bestDistance)
+	}
+}
+
+func toPoint(latitude, longitude float64) [3]float64 {
+	lat := latitude * math.Pi / 180
+	lon := longitude * math.Pi / 180
+	return [3]float64{
+		math.Cos(lat) * math.Cos(lon),
+		math.Cos(lat) * math.Sin(lon),
+		math.Sin(lat),
+	}
+}
+
+func squaredDistance(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
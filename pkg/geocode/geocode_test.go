@@ -0,0 +1,109 @@
+package geocode
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGeoNames(t *testing.T) {
+	index, err := LoadGeoNames("testdata", DefaultMaxDistance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 7, index.Len())
+
+	tests := []struct {
+		name                string
+		latitude, longitude float64
+		expected            Place
+		found               bool
+	}{
+		{"near lisbon", 38.7, -9.14, Place{City: "Lisbon", Region: "Lisbon", Country: "Portugal", CountryCode: "PT"}, true},
+		{"toronto", 43.65, -79.38, Place{City: "Toronto", Region: "Ontario", Country: "Canada", CountryCode: "CA"}, true},
+		{"sydney", -33.85875, 151.21, Place{City: "Sydney", Region: "New South Wales", Country: "Australia", CountryCode: "AU"}, true},
+		{"missing names fall back to codes", -21.1, -175.2, Place{City: "Nuku'alofa", Region: "04", Country: "TO", CountryCode: "TO"}, true},
+		{"middle of the atlantic", 30, -40, Place{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			place, found := index.ReverseGeocode(test.latitude, test.longitude)
+
+			assert.Equal(t, test.found, found)
+			place.Latitude, place.Longitude = 0, 0
+			assert.Equal(t, test.expected, place)
+		})
+	}
+}
+
+func TestLoadGeoNamesWithoutCities(t *testing.T) {
+	_, err := LoadGeoNames("does-not-exist", DefaultMaxDistance)
+
+	assert.Error(t, err)
+}
+
+func TestReadGeoNamesCitiesRejectsInvalidLines(t *testing.T) {
+	_, err := ReadGeoNamesCities(strings.NewReader("1\tSomewhere\tSomewhere\t\tnorth\t0\tP\tPPL\tXX\t\t01\n"), nil, nil)
+
+	assert.Error(t, err)
+}
+
+func TestReverseGeocodeAcrossAntimeridian(t *testing.T) {
+	index := NewIndex([]Place{
+		{City: "East", Latitude: 0, Longitude: 179.9},
+		{City: "Far west", Latitude: 0, Longitude: -170},
+	}, 100)
+
+	place, found := index.ReverseGeocode(0, -179.9)
+
+	assert.True(t, found)
+	assert.Equal(t, "East", place.City)
+}
+
+func TestReverseGeocodeMatchesBruteForce(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	randomLocation := func() (float64, float64) {
+		return random.Float64()*180 - 90, random.Float64()*360 - 180
+	}
+
+	places := make([]Place, 2000)
+	for i := range places {
+		places[i].Latitude, places[i].Longitude = randomLocation()
+	}
+	index := NewIndex(append([]Place{}, places...), 20000)
+
+	for i := 0; i < 500; i++ {
+		latitude, longitude := randomLocation()
+		expected := places[0]
+		for _, place := range places {
+			if Distance(latitude, longitude, place.Latitude, place.Longitude) < Distance(latitude, longitude, expected.Latitude, expected.Longitude) {
+				expected = place
+			}
+		}
+
+		place, found := index.ReverseGeocode(latitude, longitude)
+
+		assert.True(t, found)
+		assert.Equal(t, expected, place)
+	}
+}
+
+func TestEmptyIndex(t *testing.T) {
+	_, found := NewIndex(nil, DefaultMaxDistance).ReverseGeocode(0, 0)
+
+	assert.False(t, found)
+}
+
+func TestNone(t *testing.T) {
+	_, found := None.ReverseGeocode(38.7, -9.14)
+
+	assert.False(t, found)
+}
+
+func TestDistance(t *testing.T) {
+	// Lisbon to Porto is about 274km.
+	assert.InDelta(t, 274, Distance(38.71667, -9.13333, 41.14961, -8.61099), 2)
+}
@@ -0,0 +1,151 @@
+package geocode
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// GeoNamesCityFiles are the GeoNames cities files LoadGeoNames looks for, most detailed first. See
+// https://download.geonames.org/export/dump/
+var GeoNamesCityFiles = []string{"cities500.txt", "cities1000.txt", "cities5000.txt", "cities15000.txt"}
+
+const (
+	// geoNamesAdmin1File maps region codes to names.
+	geoNamesAdmin1File = "admin1CodesASCII.txt"
+	// geoNamesCountryFile maps country codes to names.
+	geoNamesCountryFile = "countryInfo.txt"
+)
+
+// LoadGeoNames creates an index from the GeoNames files in the given directory. It needs one of the cities files, the
+// region and country name files are optional; without them places are named by their codes.
+func LoadGeoNames(dir string, maxDistance float64) (*Index, error) {
+	regions := map[string]string{}
+	if f, err := os.Open(filepath.Join(dir, geoNamesAdmin1File)); err == nil {
+		regions, err = ReadGeoNamesAdmin1Codes(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", geoNamesAdmin1File)
+		}
+	}
+
+	countries := map[string]string{}
+	if f, err := os.Open(filepath.Join(dir, geoNamesCountryFile)); err == nil {
+		countries, err = ReadGeoNamesCountryInfo(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", geoNamesCountryFile)
+		}
+	}
+
+	for _, name := range GeoNamesCityFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "could not open %s", name)
+		}
+		defer f.Close()
+
+		places, err := ReadGeoNamesCities(f, regions, countries)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read %s", name)
+		}
+		return NewIndex(places, maxDistance), nil
+	}
+
+	return nil, fmt.Errorf("none of %s found in %s", strings.Join(GeoNamesCityFiles, ", "), dir)
+}
+
+// ReadGeoNamesCities reads places from a GeoNames cities file. Region names are looked up in regions by
+// "<country code>.<admin1 code>", country names in countries by country code.
+func ReadGeoNamesCities(r io.Reader, regions, countries map[string]string) ([]Place, error) {
+	var places []Place
+	err := readGeoNames(r, func(line int, fields []string) error {
+		// geonameid, name, asciiname, alternatenames, latitude, longitude, feature class, feature code, country code,
+		// cc2, admin1 code, ...
+		if len(fields) < 11 {
+			return fmt.Errorf("line %d: expected at least 11 fields, got %d", line, len(fields))
+		}
+		latitude, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid latitude %q", line, fields[4])
+		}
+		longitude, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid longitude %q", line, fields[5])
+		}
+
+		countryCode := fields[8]
+		region, ok := regions[countryCode+"."+fields[10]]
+		if !ok {
+			region = fields[10]
+		}
+		country, ok := countries[countryCode]
+		if !ok {
+			country = countryCode
+		}
+
+		places = append(places, Place{
+			City:        fields[1],
+			Region:      region,
+			Country:     country,
+			CountryCode: countryCode,
+			Latitude:    latitude,
+			Longitude:   longitude,
+		})
+		return nil
+	})
+	return places, err
+}
+
+// ReadGeoNamesAdmin1Codes reads the GeoNames admin1CodesASCII.txt file. Returns region names by
+// "<country code>.<admin1 code>".
+func ReadGeoNamesAdmin1Codes(r io.Reader) (map[string]string, error) {
+	regions := map[string]string{}
+	err := readGeoNames(r, func(line int, fields []string) error {
+		if len(fields) < 2 {
+			return fmt.Errorf("line %d: expected at least 2 fields, got %d", line, len(fields))
+		}
+		regions[fields[0]] = fields[1]
+		return nil
+	})
+	return regions, err
+}
+
+// ReadGeoNamesCountryInfo reads the GeoNames countryInfo.txt file. Returns country names by country code.
+func ReadGeoNamesCountryInfo(r io.Reader) (map[string]string, error) {
+	countries := map[string]string{}
+	err := readGeoNames(r, func(line int, fields []string) error {
+		if len(fields) < 5 {
+			return fmt.Errorf("line %d: expected at least 5 fields, got %d", line, len(fields))
+		}
+		countries[fields[0]] = fields[4]
+		return nil
+	})
+	return countries, err
+}
+
+// readGeoNames calls f with the tab separated fields of each line in r, skipping empty lines and comments.
+func readGeoNames(r io.Reader, f func(line int, fields []string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := f(line, strings.Split(text, "\t")); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,69 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+)
+
+// EncodeOptions holds the settings for encoding a rendition. Encoders of lossless formats ignore the quality.
+type EncodeOptions struct {
+	Quality int
+}
+
+// Encoder encodes images in a single format.
+type Encoder interface {
+	Encode(w io.Writer, img image.Image, opts EncodeOptions) error
+}
+
+// UnsupportedOptionError is returned when an image cannot be processed with an option.
+type UnsupportedOptionError struct {
+	ContentType string
+	Option      string
+}
+
+func (e UnsupportedOptionError) Error() string {
+	return fmt.Sprintf("%s is not supported for %s", e.Option, e.ContentType)
+}
+
+// encoders are the formats renditions can be encoded in. JPEGs are always baseline with 4:2:0 chroma subsampling, the
+// standard library can't write progressive JPEGs or other subsampling, and there is no WebP encoder.
+var encoders = map[string]Encoder{
+	"image/jpeg": jpegEncoder{},
+	"image/png":  pngEncoder{},
+}
+
+// CanEncode returns nil if images can be encoded in the given content type, or an UnsupportedFormatError.
+func CanEncode(contentType string) error {
+	if _, ok := encoders[contentType]; !ok {
+		return UnsupportedFormatError{ContentType: contentType}
+	}
+	return nil
+}
+
+// Encode writes the given image in the given content type.
+func Encode(w io.Writer, img image.Image, contentType string, opts EncodeOptions) error {
+	if err := CanEncode(contentType); err != nil {
+		return err
+	}
+	return encoders[contentType].Encode(w, img, opts)
+}
+
+type jpegEncoder struct{}
+
+func (jpegEncoder) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	quality := opts.Quality
+	if quality == 0 {
+		quality = jpeg.DefaultQuality
+	}
+	return jpeg.Encode(w, Flatten(img), &jpeg.Options{Quality: quality})
+}
+
+type pngEncoder struct{}
+
+// Encode ignores the quality, PNG is always lossless.
+func (pngEncoder) Encode(w io.Writer, img image.Image, opts EncodeOptions) error {
+	return png.Encode(w, img)
+}
@@ -0,0 +1,50 @@
+package images
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		contentType string
+		opts        EncodeOptions
+	}{
+		{"image/jpeg", EncodeOptions{Quality: 80}},
+		{"image/jpeg", EncodeOptions{}},
+		{"image/png", EncodeOptions{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.contentType, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			err := Encode(b, testImage(), test.contentType, test.opts)
+			assert.NoError(t, err)
+
+			img, contentType, err := Decode(b)
+			assert.NoError(t, err)
+			assert.Equal(t, test.contentType, contentType)
+			assert.Equal(t, 4, img.Bounds().Dx())
+		})
+	}
+}
+
+func TestCanEncode(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		err         error
+	}{
+		{"jpeg", "image/jpeg", nil},
+		{"png", "image/png", nil},
+		{"webp", "image/webp", UnsupportedFormatError{"image/webp"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.err, CanEncode(test.contentType))
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Package images decodes the image formats phts accepts as originals.
+package images
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+
+	// Register decoders for all supported formats with the image package.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// contentTypes maps the format names reported by the image package to content types.
+var contentTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"tiff": "image/tiff",
+}
+
+// UnsupportedFormatError is returned for images in a format that cannot be decoded.
+type UnsupportedFormatError struct {
+	ContentType string
+}
+
+func (e UnsupportedFormatError) Error() string {
+	if e.ContentType == "" {
+		return "unsupported image format"
+	}
+	return fmt.Sprintf("unsupported image format %q", e.ContentType)
+}
+
+// IsUnsupportedFormat returns whether the given error is an UnsupportedFormatError.
+func IsUnsupportedFormat(err error) bool {
+	_, ok := err.(UnsupportedFormatError)
+	return ok
+}
+
+// Supported returns whether images of the given content type can be decoded.
+func Supported(contentType string) bool {
+	for _, supported := range contentTypes {
+		if supported == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode decodes the image in the given reader and returns it together with its content type. Animated GIFs are
+// decoded as their first frame.
+func Decode(reader io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(reader)
+	if err == image.ErrFormat {
+		return nil, "", UnsupportedFormatError{}
+	} else if err != nil {
+		return nil, "", err
+	}
+
+	return img, contentTypes[format], nil
+}
+
+// DecodeConfig decodes only the dimensions of the image in the given reader and returns them together with the
+// content type.
+func DecodeConfig(reader io.Reader) (image.Config, string, error) {
+	config, format, err := image.DecodeConfig(reader)
+	if err == image.ErrFormat {
+		return config, "", UnsupportedFormatError{}
+	} else if err != nil {
+		return config, "", err
+	}
+
+	return config, contentTypes[format], nil
+}
+
+// Flatten draws the given image on a white background, so transparent areas don't turn black when encoded in a
+// format without alpha channel.
+func Flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	flat := image.NewRGBA(bounds)
+	draw.Draw(flat, bounds, image.NewUniform(color.White), image.ZP, draw.Src)
+	draw.Draw(flat, bounds, img, bounds.Min, draw.Over)
+	return flat
+}
@@ -0,0 +1,104 @@
+package images
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/tiff"
+)
+
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 3))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 3; y++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	return img
+}
+
+func TestDecode(t *testing.T) {
+	webp, err := ioutil.ReadFile("testdata/gopher.webp")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		encode      func(io.Writer, image.Image) error
+		data        []byte
+		contentType string
+		width       int
+		height      int
+	}{
+		{"jpeg", func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) }, nil, "image/jpeg", 4, 3},
+		{"png", png.Encode, nil, "image/png", 4, 3},
+		{"gif", func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) }, nil, "image/gif", 4, 3},
+		{"tiff", func(w io.Writer, img image.Image) error { return tiff.Encode(w, img, nil) }, nil, "image/tiff", 4, 3},
+		{"webp", nil, webp, "image/webp", 75, 100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data
+			if test.encode != nil {
+				b := &bytes.Buffer{}
+				assert.NoError(t, test.encode(b, testImage()))
+				data = b.Bytes()
+			}
+
+			config, contentType, err := DecodeConfig(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, test.contentType, contentType)
+			assert.Equal(t, test.width, config.Width)
+			assert.Equal(t, test.height, config.Height)
+
+			img, contentType, err := Decode(bytes.NewReader(data))
+			assert.NoError(t, err)
+			assert.Equal(t, test.contentType, contentType)
+			assert.Equal(t, test.width, img.Bounds().Dx())
+			assert.Equal(t, test.height, img.Bounds().Dy())
+			assert.True(t, Supported(contentType))
+		})
+	}
+}
+
+func TestDecodeAnimatedGIFUsesFirstFrame(t *testing.T) {
+	palette := color.Palette{color.White, color.Black}
+	first := image.NewPaletted(image.Rect(0, 0, 2, 2), palette)
+	second := image.NewPaletted(image.Rect(0, 0, 2, 2), palette)
+	second.SetColorIndex(0, 0, 1)
+	b := &bytes.Buffer{}
+	assert.NoError(t, gif.EncodeAll(b, &gif.GIF{Image: []*image.Paletted{first, second}, Delay: []int{10, 10}}))
+
+	img, _, err := Decode(b)
+
+	assert.NoError(t, err)
+	r, g, bl, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0xffff}, []uint32{r, g, bl})
+}
+
+func TestDecodeUnsupportedFormat(t *testing.T) {
+	_, _, err := Decode(bytes.NewReader([]byte("BM not really a bitmap")))
+	assert.True(t, IsUnsupportedFormat(err))
+
+	_, _, err = DecodeConfig(bytes.NewReader([]byte("BM not really a bitmap")))
+	assert.True(t, IsUnsupportedFormat(err))
+
+	assert.False(t, Supported("image/bmp"))
+}
+
+func TestFlatten(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+
+	flat := Flatten(img)
+
+	r, g, b, a := flat.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0xffff, 0xffff, 0xffff}, []uint32{r, g, b, a})
+}
@@ -0,0 +1,538 @@
+package images
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// MetadataPolicy describes which metadata of an original is kept in its renditions.
+type MetadataPolicy string
+
+const (
+	// MetadataStrip removes all metadata. Renditions that are not re-encoded keep only the exif orientation so they
+	// are still displayed upright.
+	MetadataStrip MetadataPolicy = "strip"
+	// MetadataSafe keeps the orientation, capture time, camera and lens. Location, serial numbers, owner names and
+	// everything else are removed.
+	MetadataSafe MetadataPolicy = "safe"
+	// MetadataKeep keeps all metadata, including the location the photo was taken at.
+	MetadataKeep MetadataPolicy = "keep"
+)
+
+// DefaultMetadataPolicy is the policy for rendition configurations that don't specify one.
+const DefaultMetadataPolicy = MetadataStrip
+
+// Validate returns an error if the policy is unknown.
+func (p MetadataPolicy) Validate() error {
+	switch p {
+	case MetadataStrip, MetadataSafe, MetadataKeep:
+		return nil
+	default:
+		return fmt.Errorf("unknown metadata policy %q", p)
+	}
+}
+
+const (
+	tagOrientation     = 0x0112
+	tagExifIFDPointer  = 0x8769
+	jpegMarkerSOI      = 0xd8
+	jpegMarkerSOS      = 0xda
+	jpegMarkerAPP0     = 0xe0
+	jpegMarkerAPP1     = 0xe1
+	jpegMarkerAPP2     = 0xe2
+	jpegMarkerAPP14    = 0xee
+	exifHeader         = "Exif\x00\x00"
+	iccProfileHeader   = "ICC_PROFILE\x00"
+	tiffLittleEndian   = "II"
+	tiffBigEndian      = "MM"
+	tiffMagic          = 42
+	tiffHeaderLength   = 8
+	tiffEntryLength    = 12
+	tiffMaxInlineValue = 4
+)
+
+// safeIFD0Tags and safeExifTags are the tags kept by MetadataSafe: orientation, capture time, camera and lens.
+var (
+	safeIFD0Tags = map[uint16]bool{
+		tagOrientation: true,
+		0x010f:         true, // Make
+		0x0110:         true, // Model
+		0x0132:         true, // DateTime
+	}
+	safeExifTags = map[uint16]bool{
+		0x9003: true, // DateTimeOriginal
+		0x9004: true, // DateTimeDigitized
+		0x9010: true, // OffsetTime
+		0x9011: true, // OffsetTimeOriginal
+		0x9012: true, // OffsetTimeDigitized
+		0x9290: true, // SubSecTime
+		0x9291: true, // SubSecTimeOriginal
+		0x9292: true, // SubSecTimeDigitized
+		0xa433: true, // LensMake
+		0xa434: true, // LensModel
+	}
+)
+
+// CanFilterMetadata returns true if FilterMetadata can remove metadata from images of the given content type without
+// re-encoding them.
+func CanFilterMetadata(contentType string) bool {
+	return contentType == "image/jpeg" || contentType == "image/png"
+}
+
+// FilterMetadata writes the given image to w without the metadata the policy doesn't allow, without re-encoding it.
+// The image data is streamed, only its metadata is held in memory. The orientation is always kept because the pixels
+// are not rotated. Returns an UnsupportedOptionError for content types CanFilterMetadata doesn't support.
+func FilterMetadata(w io.Writer, original io.Reader, contentType string, policy MetadataPolicy) error {
+	if policy == MetadataKeep {
+		_, err := io.Copy(w, original)
+		return err
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		segments, rest, err := readJPEGSegments(original)
+		if err != nil {
+			return err
+		}
+		allowed := safeIFD0Tags
+		if policy == MetadataStrip {
+			allowed = map[uint16]bool{tagOrientation: true}
+		}
+		exif, err := filteredExif(segments, allowed, safeExifTags, policy == MetadataSafe, false)
+		if err != nil {
+			return err
+		}
+		return writeJPEG(w, withoutMetadata(segments), exif, rest)
+	case "image/png":
+		// PNG orientation is rarely used and browsers ignore it, so there is nothing worth keeping.
+		return stripPNG(w, original)
+	default:
+		return UnsupportedOptionError{ContentType: contentType, Option: fmt.Sprintf("metadata policy %q", policy)}
+	}
+}
+
+// CopyMetadata copies the metadata the policy allows from the original into the rendition, which must have been
+// re-encoded upright and without metadata. Only the metadata of the original is read, not its image data. The
+// orientation is never copied. Metadata is only copied between JPEGs, other renditions are returned as they are.
+func CopyMetadata(rendition []byte, renditionType string, original io.Reader, originalType string, policy MetadataPolicy) ([]byte, error) {
+	if policy == MetadataStrip || renditionType != "image/jpeg" || originalType != "image/jpeg" {
+		return rendition, nil
+	}
+
+	originalSegments, _, err := readJPEGSegments(original)
+	if err != nil {
+		return nil, err
+	}
+	segments, rest, err := readJPEGSegments(bytes.NewReader(rendition))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	if policy == MetadataSafe {
+		exif, err := filteredExif(originalSegments, safeIFD0Tags, safeExifTags, true, true)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeJPEG(b, segments, exif, rest); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+
+	var metadata []jpegSegment
+	for _, segment := range originalSegments {
+		if !isMetadata(segment) {
+			continue
+		}
+		if isExif(segment) {
+			segment = jpegSegment{marker: segment.marker, data: withUprightOrientation(segment.data)}
+		}
+		metadata = append(metadata, segment)
+	}
+	if err := writeJPEG(b, segments, metadata, rest); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+type jpegSegment struct {
+	marker byte
+	// data is the payload without the marker and length.
+	data []byte
+}
+
+// readJPEGSegments reads the segments of a JPEG up to the start of its image data. Returns the segments and a reader of
+// the rest of the JPEG, starting with the start of scan marker.
+func readJPEGSegments(r io.Reader) ([]jpegSegment, io.Reader, error) {
+	reader := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(reader, soi[:]); err != nil || soi[0] != 0xff || soi[1] != jpegMarkerSOI {
+		return nil, nil, fmt.Errorf("not a jpeg")
+	}
+
+	var segments []jpegSegment
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("jpeg has no image data")
+		}
+		if b != 0xff {
+			return nil, nil, fmt.Errorf("invalid jpeg marker 0x%x", b)
+		}
+		marker := byte(0xff)
+		// Markers may be preceded by any number of fill bytes.
+		for marker == 0xff {
+			if marker, err = reader.ReadByte(); err != nil {
+				return nil, nil, fmt.Errorf("jpeg has no image data")
+			}
+		}
+		if marker == jpegMarkerSOS {
+			return segments, io.MultiReader(bytes.NewReader([]byte{0xff, jpegMarkerSOS}), reader), nil
+		}
+
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, nil, fmt.Errorf("invalid jpeg segment length")
+		}
+		data := make([]byte, length-2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, nil, fmt.Errorf("invalid jpeg segment length %d", length)
+		}
+		segments = append(segments, jpegSegment{marker: marker, data: data})
+	}
+}
+
+// writeJPEG writes a JPEG to w. The inserted segments are placed after a leading JFIF segment.
+func writeJPEG(w io.Writer, segments []jpegSegment, inserted []jpegSegment, rest io.Reader) error {
+	b := &bytes.Buffer{}
+	b.Write([]byte{0xff, jpegMarkerSOI})
+	write := func(segment jpegSegment) {
+		b.Write([]byte{0xff, segment.marker})
+		binary.Write(b, binary.BigEndian, uint16(len(segment.data)+2))
+		b.Write(segment.data)
+	}
+
+	i := 0
+	if len(segments) > 0 && segments[0].marker == jpegMarkerAPP0 {
+		write(segments[0])
+		i = 1
+	}
+	for _, segment := range inserted {
+		write(segment)
+	}
+	for _, segment := range segments[i:] {
+		write(segment)
+	}
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, rest)
+	return err
+}
+
+// isMetadata returns true for the application and comment segments that hold metadata. JFIF, ICC profiles and the
+// Adobe color transform are needed to display the image correctly.
+func isMetadata(segment jpegSegment) bool {
+	switch {
+	case segment.marker == jpegMarkerAPP0 || segment.marker == jpegMarkerAPP14:
+		return false
+	case segment.marker == jpegMarkerAPP2:
+		return !bytes.HasPrefix(segment.data, []byte(iccProfileHeader))
+	case segment.marker > jpegMarkerAPP0 && segment.marker <= 0xef:
+		return true
+	case segment.marker == 0xfe:
+		// Comment.
+		return true
+	default:
+		return false
+	}
+}
+
+func isExif(segment jpegSegment) bool {
+	return segment.marker == jpegMarkerAPP1 && bytes.HasPrefix(segment.data, []byte(exifHeader))
+}
+
+func withoutMetadata(segments []jpegSegment) []jpegSegment {
+	var result []jpegSegment
+	for _, segment := range segments {
+		if !isMetadata(segment) {
+			result = append(result, segment)
+		}
+	}
+	return result
+}
+
+// filteredExif rebuilds the exif segment of the given segments with only the allowed tags. Returns no segments if
+// there is no exif data or none of it is allowed.
+func filteredExif(segments []jpegSegment, ifd0Tags, exifTags map[uint16]bool, withExifIFD, upright bool) ([]jpegSegment, error) {
+	for _, segment := range segments {
+		if !isExif(segment) {
+			continue
+		}
+
+		t, err := readTIFF(segment.data[len(exifHeader):])
+		if err != nil {
+			// Broken exif data is dropped rather than failing the rendition.
+			return nil, nil
+		}
+
+		var ifd0, exifIFD []tiffEntry
+		for _, entry := range t.ifd0 {
+			if ifd0Tags[entry.tag] && !(upright && entry.tag == tagOrientation) {
+				ifd0 = append(ifd0, entry)
+			}
+		}
+		if withExifIFD {
+			for _, entry := range t.exif {
+				if exifTags[entry.tag] {
+					exifIFD = append(exifIFD, entry)
+				}
+			}
+		}
+		if len(ifd0) == 0 && len(exifIFD) == 0 {
+			return nil, nil
+		}
+
+		data := append([]byte(exifHeader), writeTIFF(t.order, ifd0, exifIFD)...)
+		return []jpegSegment{{marker: jpegMarkerAPP1, data: data}}, nil
+	}
+	return nil, nil
+}
+
+// withUprightOrientation returns a copy of the given exif segment payload with the orientation set to 1. The payload
+// is returned unchanged if it cannot be parsed.
+func withUprightOrientation(data []byte) []byte {
+	data = append([]byte{}, data...)
+	raw := data[len(exifHeader):]
+	order, ifd0Offset, err := tiffHeader(raw)
+	if err != nil || ifd0Offset+2 > len(raw) {
+		return data
+	}
+
+	count := int(order.Uint16(raw[ifd0Offset:]))
+	for i := 0; i < count; i++ {
+		entry := ifd0Offset + 2 + i*tiffEntryLength
+		if entry+tiffEntryLength > len(raw) {
+			break
+		}
+		if order.Uint16(raw[entry:]) == tagOrientation {
+			order.PutUint16(raw[entry+8:], 1)
+		}
+	}
+	return data
+}
+
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+type tiffData struct {
+	order binary.ByteOrder
+	ifd0  []tiffEntry
+	exif  []tiffEntry
+}
+
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+func tiffHeader(data []byte) (binary.ByteOrder, int, error) {
+	if len(data) < tiffHeaderLength {
+		return nil, 0, fmt.Errorf("tiff header too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case tiffLittleEndian:
+		order = binary.LittleEndian
+	case tiffBigEndian:
+		order = binary.BigEndian
+	default:
+		return nil, 0, fmt.Errorf("invalid tiff byte order")
+	}
+	if order.Uint16(data[2:]) != tiffMagic {
+		return nil, 0, fmt.Errorf("invalid tiff magic number")
+	}
+
+	return order, int(order.Uint32(data[4:])), nil
+}
+
+// readTIFF reads IFD0 and the exif IFD of the given tiff structure.
+func readTIFF(data []byte) (tiffData, error) {
+	order, offset, err := tiffHeader(data)
+	if err != nil {
+		return tiffData{}, err
+	}
+
+	t := tiffData{order: order}
+	t.ifd0, err = readIFD(data, order, offset)
+	if err != nil {
+		return tiffData{}, err
+	}
+	for _, entry := range t.ifd0 {
+		if entry.tag == tagExifIFDPointer && len(entry.value) == 4 {
+			t.exif, err = readIFD(data, order, int(order.Uint32(entry.value)))
+			if err != nil {
+				return tiffData{}, err
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func readIFD(data []byte, order binary.ByteOrder, offset int) ([]tiffEntry, error) {
+	if offset < 0 || offset+2 > len(data) {
+		return nil, fmt.Errorf("ifd offset %d out of range", offset)
+	}
+
+	count := int(order.Uint16(data[offset:]))
+	var entries []tiffEntry
+	for i := 0; i < count; i++ {
+		pos := offset + 2 + i*tiffEntryLength
+		if pos+tiffEntryLength > len(data) {
+			return nil, fmt.Errorf("ifd entry %d out of range", i)
+		}
+
+		entry := tiffEntry{
+			tag:   order.Uint16(data[pos:]),
+			typ:   order.Uint16(data[pos+2:]),
+			count: order.Uint32(data[pos+4:]),
+		}
+		size, ok := tiffTypeSizes[entry.typ]
+		if !ok {
+			continue
+		}
+		length := size * int(entry.count)
+		valueOffset := pos + 8
+		if length > tiffMaxInlineValue {
+			valueOffset = int(order.Uint32(data[pos+8:]))
+		}
+		if length < 0 || valueOffset+length > len(data) {
+			return nil, fmt.Errorf("value of tag %#x out of range", entry.tag)
+		}
+		entry.value = data[valueOffset : valueOffset+length]
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// writeTIFF writes a tiff structure with the given IFD0 entries and, if there are any, an exif IFD.
+func writeTIFF(order binary.ByteOrder, ifd0, exifIFD []tiffEntry) []byte {
+	b := &bytes.Buffer{}
+	if order == binary.LittleEndian {
+		b.WriteString(tiffLittleEndian)
+	} else {
+		b.WriteString(tiffBigEndian)
+	}
+	binary.Write(b, order, uint16(tiffMagic))
+	binary.Write(b, order, uint32(tiffHeaderLength))
+
+	if len(exifIFD) > 0 {
+		// The pointer is patched once the position of the exif IFD is known.
+		ifd0 = append(ifd0, tiffEntry{tag: tagExifIFDPointer, typ: 4, count: 1, value: make([]byte, 4)})
+	}
+	pointer := writeIFD(b, order, ifd0)
+	if len(exifIFD) > 0 {
+		order.PutUint32(b.Bytes()[pointer:], uint32(b.Len()))
+		writeIFD(b, order, exifIFD)
+	}
+
+	return b.Bytes()
+}
+
+// writeIFD appends an IFD with the given entries, followed by the values that don't fit into the entries. Returns
+// the position of the value of the exif IFD pointer entry, if any.
+func writeIFD(b *bytes.Buffer, order binary.ByteOrder, entries []tiffEntry) int {
+	start := b.Len()
+	dataOffset := start + 2 + len(entries)*tiffEntryLength + 4
+	pointer := 0
+
+	binary.Write(b, order, uint16(len(entries)))
+	var data []byte
+	for _, entry := range entries {
+		binary.Write(b, order, entry.tag)
+		binary.Write(b, order, entry.typ)
+		binary.Write(b, order, entry.count)
+		if entry.tag == tagExifIFDPointer {
+			pointer = b.Len()
+		}
+		if len(entry.value) > tiffMaxInlineValue {
+			binary.Write(b, order, uint32(dataOffset+len(data)))
+			data = append(data, entry.value...)
+			if len(data)%2 == 1 {
+				// Values start on word boundaries.
+				data = append(data, 0)
+			}
+		} else {
+			value := make([]byte, tiffMaxInlineValue)
+			copy(value, entry.value)
+			b.Write(value)
+		}
+	}
+	// No next IFD.
+	binary.Write(b, order, uint32(0))
+	b.Write(data)
+
+	return pointer
+}
+
+// pngMetadataChunks are the ancillary PNG chunks that hold metadata.
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true}
+
+// stripPNG writes the given PNG to w without its metadata chunks.
+func stripPNG(w io.Writer, r io.Reader) error {
+	const signature = "\x89PNG\r\n\x1a\n"
+	reader := bufio.NewReader(r)
+	header := make([]byte, len(signature))
+	if _, err := io.ReadFull(reader, header); err != nil || string(header) != signature {
+		return fmt.Errorf("not a png")
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for {
+		// The length and type of the chunk, followed by its data and the checksum of type and data.
+		var chunk [8]byte
+		if _, err := io.ReadFull(reader, chunk[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid png chunk")
+		}
+		length := int64(binary.BigEndian.Uint32(chunk[:]))
+		typ := string(chunk[4:])
+
+		checksum := crc32.NewIEEE()
+		checksum.Write(chunk[4:])
+		out := io.Writer(checksum)
+		if !pngMetadataChunks[typ] {
+			if _, err := w.Write(chunk[:]); err != nil {
+				return err
+			}
+			out = io.MultiWriter(w, checksum)
+		}
+		if _, err := io.CopyN(out, reader, length); err != nil {
+			return fmt.Errorf("invalid png chunk length of %s", typ)
+		}
+		var crc [4]byte
+		if _, err := io.ReadFull(reader, crc[:]); err != nil {
+			return fmt.Errorf("invalid png chunk length of %s", typ)
+		}
+		if checksum.Sum32() != binary.BigEndian.Uint32(crc[:]) {
+			return fmt.Errorf("invalid checksum of png chunk %s", typ)
+		}
+		if !pngMetadataChunks[typ] {
+			if _, err := w.Write(crc[:]); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/gps.jpg has exif data with a location, camera, lens, serial number and artist, an XMP packet with the
+// location and a comment with the owner's name.
+func loadGPSFixture(t *testing.T) []byte {
+	data, err := ioutil.ReadFile("testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// filterMetadata returns the given image filtered by FilterMetadata.
+func filterMetadata(data []byte, contentType string, policy MetadataPolicy) ([]byte, error) {
+	b := &bytes.Buffer{}
+	err := FilterMetadata(b, bytes.NewReader(data), contentType, policy)
+	return b.Bytes(), err
+}
+
+func assertNoPrivateMetadata(t *testing.T, data []byte) {
+	assert.NotContains(t, string(data), "Jane Doe")
+	assert.NotContains(t, string(data), "SN123456")
+	assert.NotContains(t, string(data), "xmpmeta")
+
+	if e, err := exif.Decode(bytes.NewReader(data)); err == nil {
+		_, _, err := e.LatLong()
+		assert.Error(t, err)
+		_, err = e.Get(exif.GPSInfoIFDPointer)
+		assert.Error(t, err)
+	}
+
+	_, _, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+}
+
+func TestFilterMetadataStrip(t *testing.T) {
+	filtered, err := filterMetadata(loadGPSFixture(t), "image/jpeg", MetadataStrip)
+
+	assert.NoError(t, err)
+	assertNoPrivateMetadata(t, filtered)
+	e, err := exif.Decode(bytes.NewReader(filtered))
+	assert.NoError(t, err)
+	orientation, err := e.Get(exif.Orientation)
+	assert.NoError(t, err)
+	assert.Equal(t, "6", orientation.String())
+	_, err = e.Get(exif.Model)
+	assert.Error(t, err)
+}
+
+func TestFilterMetadataSafe(t *testing.T) {
+	filtered, err := filterMetadata(loadGPSFixture(t), "image/jpeg", MetadataSafe)
+
+	assert.NoError(t, err)
+	assertNoPrivateMetadata(t, filtered)
+	e, err := exif.Decode(bytes.NewReader(filtered))
+	assert.NoError(t, err)
+	for field, expected := range map[exif.FieldName]string{
+		exif.Orientation:      "6",
+		exif.Make:             `"TestCorp"`,
+		exif.Model:            `"Cam 1"`,
+		exif.DateTimeOriginal: `"2015:08:01 19:50:05"`,
+		exif.LensModel:        `"Test 50mm"`,
+	} {
+		tag, err := e.Get(field)
+		if assert.NoError(t, err, string(field)) {
+			assert.Equal(t, expected, tag.String(), string(field))
+		}
+	}
+}
+
+func TestFilterMetadataKeep(t *testing.T) {
+	original := loadGPSFixture(t)
+
+	filtered, err := filterMetadata(original, "image/jpeg", MetadataKeep)
+
+	assert.NoError(t, err)
+	assert.Equal(t, original, filtered)
+}
+
+func TestFilterMetadataPNG(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(b, testImage()))
+	data := b.Bytes()
+	// Insert a text chunk after the header chunk, which is 25 bytes long including the signature.
+	text := []byte("tEXtAuthor\x00Jane Doe")
+	chunk := make([]byte, 4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = append(chunk, make([]byte, 4)...)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(text))
+	withText := append(append(append([]byte{}, data[:33]...), chunk...), data[33:]...)
+	_, err := png.Decode(bytes.NewReader(withText))
+	assert.NoError(t, err)
+
+	filtered, err := filterMetadata(withText, "image/png", MetadataStrip)
+
+	assert.NoError(t, err)
+	assert.Equal(t, data, filtered)
+}
+
+func TestFilterMetadataUnsupportedFormat(t *testing.T) {
+	_, err := filterMetadata([]byte("GIF89a"), "image/gif", MetadataStrip)
+
+	assert.Equal(t, UnsupportedOptionError{ContentType: "image/gif", Option: `metadata policy "strip"`}, err)
+	assert.False(t, CanFilterMetadata("image/gif"))
+}
+
+func TestCopyMetadata(t *testing.T) {
+	original := loadGPSFixture(t)
+	b := &bytes.Buffer{}
+	assert.NoError(t, jpeg.Encode(b, testImage(), nil))
+	rendition := b.Bytes()
+
+	t.Run("strip", func(t *testing.T) {
+		copied, err := CopyMetadata(rendition, "image/jpeg", bytes.NewReader(original), "image/jpeg", MetadataStrip)
+
+		assert.NoError(t, err)
+		assert.Equal(t, rendition, copied)
+	})
+
+	t.Run("safe", func(t *testing.T) {
+		copied, err := CopyMetadata(rendition, "image/jpeg", bytes.NewReader(original), "image/jpeg", MetadataSafe)
+
+		assert.NoError(t, err)
+		assertNoPrivateMetadata(t, copied)
+		e, err := exif.Decode(bytes.NewReader(copied))
+		assert.NoError(t, err)
+		_, err = e.Get(exif.Model)
+		assert.NoError(t, err)
+		// The rendition is already upright.
+		_, err = e.Get(exif.Orientation)
+		assert.Error(t, err)
+	})
+
+	t.Run("keep", func(t *testing.T) {
+		copied, err := CopyMetadata(rendition, "image/jpeg", bytes.NewReader(original), "image/jpeg", MetadataKeep)
+
+		assert.NoError(t, err)
+		e, err := exif.Decode(bytes.NewReader(copied))
+		assert.NoError(t, err)
+		lat, _, err := e.LatLong()
+		assert.NoError(t, err)
+		assert.InDelta(t, 43.65, lat, 0.01)
+		orientation, err := e.Get(exif.Orientation)
+		assert.NoError(t, err)
+		assert.Equal(t, "1", orientation.String())
+		assert.Contains(t, string(copied), "xmpmeta")
+		_, _, err = Decode(bytes.NewReader(copied))
+		assert.NoError(t, err)
+	})
+
+	t.Run("other formats", func(t *testing.T) {
+		copied, err := CopyMetadata([]byte("png"), "image/png", bytes.NewReader(original), "image/jpeg", MetadataKeep)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("png"), copied)
+	})
+}
+
+func TestMetadataPolicyValidate(t *testing.T) {
+	assert.NoError(t, MetadataStrip.Validate())
+	assert.NoError(t, MetadataSafe.Validate())
+	assert.NoError(t, MetadataKeep.Validate())
+	assert.Error(t, MetadataPolicy("some").Validate())
+}
@@ -0,0 +1,109 @@
+package images
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+	"github.com/nfnt/resize"
+)
+
+// ResizeMode describes how an image is fitted into the width and height of a rendition configuration.
+type ResizeMode string
+
+const (
+	// ResizeFitWidth scales the image to the given width, ignoring the height. This is how renditions were made before
+	// modes existed.
+	ResizeFitWidth ResizeMode = "fit-width"
+	// ResizeFitHeight scales the image to the given height, ignoring the width.
+	ResizeFitHeight ResizeMode = "fit-height"
+	// ResizeFit scales the image to fit within the given width and height, keeping the aspect ratio.
+	ResizeFit ResizeMode = "fit"
+	// ResizeFill scales the image to cover the given width and height and crops the excess around the focal point.
+	ResizeFill ResizeMode = "fill"
+)
+
+// DefaultResizeMode is the mode for rendition configurations that don't specify one.
+const DefaultResizeMode = ResizeFitWidth
+
+// Validate returns an error if the mode is unknown or lacks the dimensions it needs.
+func (m ResizeMode) Validate(width, height int) error {
+	switch m {
+	case ResizeFitWidth:
+		if width < 1 {
+			return fmt.Errorf("resize mode %q needs a width", m)
+		}
+	case ResizeFitHeight:
+		if height < 1 {
+			return fmt.Errorf("resize mode %q needs a height", m)
+		}
+	case ResizeFit, ResizeFill:
+		if width < 1 || height < 1 {
+			return fmt.Errorf("resize mode %q needs a width and a height", m)
+		}
+	default:
+		return fmt.Errorf("unknown resize mode %q", m)
+	}
+	return nil
+}
+
+// FocalPoint is the point of interest in an image, as fractions of its width and height. Crops keep it as close to the
+// center as possible.
+type FocalPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+// CenterFocalPoint is used for photos without a focal point.
+var CenterFocalPoint = FocalPoint{X: 0.5, Y: 0.5}
+
+// Validate returns an error if the focal point lies outside of the image.
+func (f FocalPoint) Validate() error {
+	if f.X < 0 || f.X > 1 || f.Y < 0 || f.Y > 1 {
+		return fmt.Errorf("focal point %gx%g must be between 0 and 1", f.X, f.Y)
+	}
+	return nil
+}
+
+// Resize scales the given image according to the mode. The focal point is only used by ResizeFill.
+func Resize(img image.Image, mode ResizeMode, width, height int, focus FocalPoint) image.Image {
+	switch mode {
+	case ResizeFitHeight:
+		return resize.Resize(0, uint(height), img, resize.Lanczos3)
+	case ResizeFit:
+		return resize.Thumbnail(uint(width), uint(height), img, resize.Lanczos3)
+	case ResizeFill:
+		return fill(img, width, height, focus)
+	default:
+		return resize.Resize(uint(width), 0, img, resize.Lanczos3)
+	}
+}
+
+// fill scales the image so it covers width by height and crops it to exactly that size, centered on the focal point
+// as far as the image bounds allow.
+func fill(img image.Image, width, height int, focus FocalPoint) image.Image {
+	bounds := img.Bounds()
+	scale := math.Max(float64(width)/float64(bounds.Dx()), float64(height)/float64(bounds.Dy()))
+	scaledWidth := int(math.Max(float64(width), math.Round(float64(bounds.Dx())*scale)))
+	scaledHeight := int(math.Max(float64(height), math.Round(float64(bounds.Dy())*scale)))
+	scaled := resize.Resize(uint(scaledWidth), uint(scaledHeight), img, resize.Lanczos3)
+
+	x := cropOffset(scaledWidth, width, focus.X)
+	y := cropOffset(scaledHeight, height, focus.Y)
+	origin := scaled.Bounds().Min
+	return imaging.Crop(scaled, image.Rect(x, y, x+width, y+height).Add(origin))
+}
+
+// cropOffset returns where a crop of the given size starts so that the focal fraction ends up in its middle, clamped
+// to the image.
+func cropOffset(size, crop int, focus float64) int {
+	offset := int(math.Round(float64(size)*focus - float64(crop)/2))
+	if offset < 0 {
+		return 0
+	}
+	if offset > size-crop {
+		return size - crop
+	}
+	return offset
+}
@@ -0,0 +1,87 @@
+package images
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResize(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 400, 200))
+
+	tests := []struct {
+		mode   ResizeMode
+		width  int
+		height int
+		dx, dy int
+	}{
+		{ResizeFitWidth, 100, 0, 100, 50},
+		{ResizeFitWidth, 100, 100, 100, 50},
+		{ResizeFitHeight, 0, 100, 200, 100},
+		{ResizeFit, 100, 100, 100, 50},
+		{ResizeFit, 800, 100, 200, 100},
+		{ResizeFill, 100, 100, 100, 100},
+		{ResizeFill, 150, 30, 150, 30},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			resized := Resize(img, test.mode, test.width, test.height, CenterFocalPoint)
+			assert.Equal(t, test.dx, resized.Bounds().Dx())
+			assert.Equal(t, test.dy, resized.Bounds().Dy())
+		})
+	}
+}
+
+func TestResizeFillCropsAroundFocalPoint(t *testing.T) {
+	// Left half red, right half blue.
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	for x := 0; x < 200; x++ {
+		for y := 0; y < 100; y++ {
+			c := color.NRGBA{R: 255, A: 255}
+			if x >= 100 {
+				c = color.NRGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		focus FocalPoint
+		red   bool
+	}{
+		{"left", FocalPoint{X: 0.1, Y: 0.5}, true},
+		{"right", FocalPoint{X: 0.9, Y: 0.5}, false},
+		{"beyond the right edge is clamped", FocalPoint{X: 1, Y: 1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resized := Resize(img, ResizeFill, 50, 50, test.focus)
+
+			assert.Equal(t, image.Rect(0, 0, 50, 50), resized.Bounds())
+			r, _, b, _ := resized.At(25, 25).RGBA()
+			assert.Equal(t, test.red, r > b)
+		})
+	}
+}
+
+func TestResizeModeValidate(t *testing.T) {
+	assert.NoError(t, ResizeFitWidth.Validate(100, 0))
+	assert.NoError(t, ResizeFitHeight.Validate(0, 100))
+	assert.NoError(t, ResizeFill.Validate(100, 100))
+	assert.Error(t, ResizeFill.Validate(100, 0))
+	assert.Error(t, ResizeFit.Validate(0, 100))
+	assert.Error(t, ResizeFitHeight.Validate(100, 0))
+	assert.Error(t, ResizeMode("stretch").Validate(100, 100))
+}
+
+func TestFocalPointValidate(t *testing.T) {
+	assert.NoError(t, CenterFocalPoint.Validate())
+	assert.NoError(t, FocalPoint{X: 0, Y: 1}.Validate())
+	assert.Error(t, FocalPoint{X: -0.1, Y: 0.5}.Validate())
+	assert.Error(t, FocalPoint{X: 0.5, Y: 1.5}.Validate())
+}
@@ -2,12 +2,15 @@ package metadata
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	"github.com/ilikeorangutans/phts/db"
 	"github.com/rwcarlsen/goexif/exif"
@@ -15,7 +18,17 @@ import (
 )
 
 const (
-	exifTimeLayout = "2006:01:02 15:04:5"
+	exifTimeLayout = "2006:01:02 15:04:05"
+	// exifDateLayout is used by GPSDateStamp.
+	exifDateLayout = "2006:01:02"
+	// exifOffsetLayout is used by the OffsetTime tags.
+	exifOffsetLayout = "-07:00"
+	// maxUTCOffset is the largest UTC offset in use, in seconds.
+	maxUTCOffset = 14 * 60 * 60
+	// maxExifValues is how many values of a tag are kept. Some maker note tags are large tables.
+	maxExifValues = 256
+	// maxUndefinedValues is the size of the largest undefined tag whose bytes are kept.
+	maxUndefinedValues = 32
 )
 
 // ExifTags is a set of exif tags.
@@ -50,15 +63,23 @@ func ExifTagsFromPhotoReader(reader io.Reader) (ExifTags, error) {
 		return nil, err
 	}
 
+	return ExifTagsFromExif(e), nil
+}
+
+// ExifTagsFromExif extracts the tags from already decoded exif data.
+func ExifTagsFromExif(e *exif.Exif) ExifTags {
 	extractor := &ExifExtractor{}
 	e.Walk(extractor)
 
+	applyExifOffsets(extractor.tags)
+	sort.Slice(extractor.tags, func(i, j int) bool { return extractor.tags[i].Tag < extractor.tags[j].Tag })
+
 	result := []ExifTag{}
 	for _, t := range extractor.tags {
 		result = append(result, ExifTag{t})
 	}
 
-	return result, nil
+	return result
 }
 
 type ExifExtractor struct {
@@ -75,22 +96,29 @@ func (extractor *ExifExtractor) Walk(name exif.FieldName, tag *tiff.Tag) error {
 	return nil
 }
 
+// ExifRecordFromTiffTag decodes all values of the given tag. Tags with more than one value keep all of them in
+// Values and the first one in Num, Denominator and Floating. Tags people look at, like the exposure time, also get a
+// formatted Display value.
 func ExifRecordFromTiffTag(name string, tag *tiff.Tag) (db.ExifRecord, error) {
 	record := db.ExifRecord{
 		Type: uint16(tag.Type),
 		Tag:  strings.TrimRight(string(name), "\x00"),
 	}
 
-	if tag.Count > 1 {
-		log.Printf("More than 1 value for %s of type %d: %d", name, tag.Type, tag.Count)
+	count := int(tag.Count)
+	if count > maxExifValues {
+		log.Printf("keeping %d of %d values for %s", maxExifValues, count, name)
+		count = maxExifValues
 	}
+
 	switch tag.Type {
-	case tiff.DTByte, tiff.DTShort, tiff.DTLong, tiff.DTSShort, tiff.DTSLong:
-		if num, err := tag.Int(0); err != nil {
-			log.Printf("error extracting integer value for tag %s: %s", name, err.Error())
-			return record, nil
-		} else {
-			record.Num = int64(num)
+	case tiff.DTByte, tiff.DTShort, tiff.DTLong, tiff.DTSByte, tiff.DTSShort, tiff.DTSLong:
+		for i := 0; i < count; i++ {
+			num, err := tag.Int64(i)
+			if err != nil {
+				return record, err
+			}
+			record.Values = append(record.Values, db.ExifValue{Num: num})
 		}
 	case tiff.DTAscii:
 		s, err := tag.StringVal()
@@ -106,10 +134,12 @@ func ExifRecordFromTiffTag(name string, tag *tiff.Tag) (db.ExifRecord, error) {
 			}
 
 			if strings.Contains(name, "Date") {
-				datetime, err := time.Parse(exifTimeLayout, record.StringValue)
-				if err == nil {
-					record.DateTime = &datetime
-					return record, nil
+				for _, layout := range []string{exifTimeLayout, exifDateLayout} {
+					datetime, err := time.Parse(layout, record.StringValue)
+					if err == nil {
+						record.DateTime = &datetime
+						return record, nil
+					}
 				}
 			}
 
@@ -118,33 +148,209 @@ func ExifRecordFromTiffTag(name string, tag *tiff.Tag) (db.ExifRecord, error) {
 			}
 		}
 	case tiff.DTRational, tiff.DTSRational:
-		if num, den, err := tag.Rat2(0); err != nil {
-			return record, err
-		} else {
-			record.Num = num
-			record.Denominator = den
+		for i := 0; i < count; i++ {
+			num, den, err := tag.Rat2(i)
+			if err != nil {
+				return record, err
+			}
+			value := db.ExifValue{Num: num, Denominator: den}
+			if den != 0 {
+				value.Floating = float64(num) / float64(den)
+			}
+			record.Values = append(record.Values, value)
 		}
-	case tiff.DTSByte:
 	case tiff.DTUndefined:
-		log.Printf("undefined tag %s", name)
+		if err := decodeUndefined(&record, tag); err != nil {
+			return record, err
+		}
 	case tiff.DTFloat, tiff.DTDouble:
-		f, err := tag.Float(0)
-		if err != nil {
-			return record, nil
+		for i := 0; i < count; i++ {
+			f, err := tag.Float(i)
+			if err != nil {
+				return record, err
+			}
+			record.Values = append(record.Values, db.ExifValue{Floating: f})
 		}
-
-		record.Floating = f
 	default:
 		log.Printf("ignoring tag %s with unknown type %v", name, tag.Type)
 	}
 
+	if len(record.Values) > 0 {
+		first := record.Values[0]
+		record.Num, record.Denominator, record.Floating = first.Num, first.Denominator, first.Floating
+		if len(record.Values) == 1 {
+			record.Values = nil
+		}
+	}
+	if gpsCoordinates[name] {
+		// Coordinates are degrees, minutes and seconds, keep them as decimal degrees.
+		if degrees, err := GPSDegrees(tag); err == nil {
+			record.Floating = degrees
+		}
+	}
+	record.Display = formatExif(record)
+
 	return record, nil
 }
 
+// decodeUndefined decodes tags of undefined type. The user comment and text like the exif version are kept as
+// strings, other short tags as byte values. Long binary tags, like maker notes, are skipped.
+func decodeUndefined(record *db.ExifRecord, tag *tiff.Tag) error {
+	if record.Tag == string(exif.UserComment) {
+		record.StringValue = UserComment(tag.Val)
+		if record.StringValue == "" {
+			return fmt.Errorf("Skipping empty tag")
+		}
+		return nil
+	}
+
+	if text := strings.TrimRight(string(tag.Val), "\x00"); isPrintable(text) {
+		record.StringValue = text
+		return nil
+	}
+
+	if len(tag.Val) > maxUndefinedValues {
+		return fmt.Errorf("Skipping undefined tag with %d bytes", len(tag.Val))
+	}
+	for _, b := range tag.Val {
+		record.Values = append(record.Values, db.ExifValue{Num: int64(b)})
+	}
+	return nil
+}
+
+// isPrintable returns whether s is non-empty printable ASCII.
+func isPrintable(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// UserComment decodes the value of the UserComment tag. It starts with an 8 byte character code; ASCII, UNICODE and
+// undefined are supported, other codes are read as bytes. Cameras pad the comment with NUL bytes or spaces, those are
+// trimmed.
+func UserComment(data []byte) string {
+	if len(data) < 8 {
+		return ""
+	}
+
+	code, text := strings.TrimRight(string(data[:8]), "\x00"), data[8:]
+	comment := string(text)
+	if code == "UNICODE" {
+		comment = decodeUCS2(text)
+	}
+	return strings.TrimSpace(strings.Replace(comment, "\x00", "", -1))
+}
+
+// decodeUCS2 decodes UCS-2 text. The byte order of the text is the byte order of the exif data, which isn't
+// available here, so it is guessed from where the zero bytes of ASCII characters are.
+func decodeUCS2(data []byte) string {
+	var order binary.ByteOrder = binary.BigEndian
+	evenZeros, oddZeros := 0, 0
+	for i, b := range data {
+		if b == 0 && i%2 == 0 {
+			evenZeros++
+		} else if b == 0 {
+			oddZeros++
+		}
+	}
+	if oddZeros > evenZeros {
+		order = binary.LittleEndian
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// exifDateOffsets are the tags holding the UTC offsets of the date tags.
+var exifDateOffsets = map[string]string{
+	string(exif.DateTime):          string(OffsetTime),
+	string(exif.DateTimeOriginal):  string(OffsetTimeOriginal),
+	string(exif.DateTimeDigitized): string(OffsetTimeDigitized),
+}
+
+// applyExifOffsets moves the date tags into the time zones given by their offset tags.
+func applyExifOffsets(tags []db.ExifRecord) {
+	offsets := map[string]string{}
+	for _, tag := range tags {
+		offsets[tag.Tag] = tag.StringValue
+	}
+
+	for i, tag := range tags {
+		if tag.DateTime == nil {
+			continue
+		}
+		if location, ok := exifOffset(offsets[exifDateOffsets[tag.Tag]]); ok {
+			datetime := inLocation(*tag.DateTime, location)
+			tags[i].DateTime = &datetime
+		}
+	}
+}
+
+// exifOffset parses the value of an offset tag like "+02:00".
+func exifOffset(s string) (*time.Location, bool) {
+	offset, err := time.Parse(exifOffsetLayout, strings.TrimSpace(s))
+	if err != nil {
+		return nil, false
+	}
+	_, seconds := offset.Zone()
+	return time.FixedZone("", seconds), true
+}
+
+// inLocation returns the time with the same wall clock as t in the given location.
+func inLocation(t time.Time, location *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+}
+
+// DateTimeFromExif returns when the photo was taken, like exif.DateTime, but in the time zone of the OffsetTime tags
+// if there are any.
+func DateTimeFromExif(e *exif.Exif) (time.Time, error) {
+	datetime, err := e.DateTime()
+	if err != nil {
+		return datetime, err
+	}
+	if _, offset := datetime.Zone(); offset%60 == 0 && (offset > maxUTCOffset || offset < -maxUTCOffset) {
+		// goexif reads the zone from Canon.TimeInfo, which holds negative offsets in minutes as unsigned numbers.
+		datetime = inLocation(datetime, time.FixedZone("", int(int32(offset/60))*60))
+	}
+
+	offsetTag := OffsetTimeOriginal
+	if _, err := e.Get(exif.DateTimeOriginal); err != nil {
+		offsetTag = OffsetTime
+	}
+	if tag, err := e.Get(offsetTag); err == nil {
+		if s, err := tag.StringVal(); err == nil {
+			if location, ok := exifOffset(strings.TrimRight(s, "\x00")); ok {
+				return inLocation(datetime, location), nil
+			}
+		}
+	}
+	return datetime, nil
+}
+
+// gpsCoordinates are the names of the GPS tags that hold coordinates.
+var gpsCoordinates = map[string]bool{
+	string(exif.GPSLatitude):      true,
+	string(exif.GPSLongitude):     true,
+	string(exif.GPSDestLatitude):  true,
+	string(exif.GPSDestLongitude): true,
+}
+
 type ExifOrientation int
 
 func ExifOrientationFromTag(tag ExifTag) ExifOrientation {
-	return ExifOrientation(tag.Num)
+	if o := ExifOrientation(tag.Num); o.Valid() {
+		return o
+	}
+	return Horizontal
 }
 
 func (o ExifOrientation) String() string {
@@ -0,0 +1,68 @@
+package metadata
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/mknote"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Exif 2.31 fields goexif does not know about.
+const (
+	OffsetTime          exif.FieldName = "OffsetTime"
+	OffsetTimeOriginal  exif.FieldName = "OffsetTimeOriginal"
+	OffsetTimeDigitized exif.FieldName = "OffsetTimeDigitized"
+	CameraOwnerName     exif.FieldName = "CameraOwnerName"
+	BodySerialNumber    exif.FieldName = "BodySerialNumber"
+	LensSpecification   exif.FieldName = "LensSpecification"
+	LensSerialNumber    exif.FieldName = "LensSerialNumber"
+)
+
+var exif231Fields = map[uint16]exif.FieldName{
+	0x9010: OffsetTime,
+	0x9011: OffsetTimeOriginal,
+	0x9012: OffsetTimeDigitized,
+	0xA430: CameraOwnerName,
+	0xA431: BodySerialNumber,
+	0xA432: LensSpecification,
+	0xA435: LensSerialNumber,
+}
+
+// exif231Parser loads the exif231Fields from the exif sub-IFD.
+type exif231Parser struct{}
+
+func (exif231Parser) Parse(x *exif.Exif) error {
+	pointer, err := x.Get(exif.ExifIFDPointer)
+	if err != nil {
+		return nil
+	}
+	offset, err := pointer.Int64(0)
+	if err != nil {
+		return nil
+	}
+
+	r := bytes.NewReader(x.Raw)
+	if _, err := r.Seek(offset, 0); err != nil {
+		return fmt.Errorf("exif: seek to exif sub-IFD failed: %v", err)
+	}
+	dir, _, err := tiff.DecodeDir(r, x.Tiff.Order)
+	if err != nil {
+		return fmt.Errorf("exif: exif sub-IFD decode failed: %v", err)
+	}
+	x.LoadTags(dir, exif231Fields, false)
+	return nil
+}
+
+var registerParsers sync.Once
+
+// RegisterParsers registers the exif parsers for maker notes and the fields goexif does not know about. It is safe to
+// call more than once.
+func RegisterParsers() {
+	registerParsers.Do(func() {
+		exif.RegisterParsers(mknote.All...)
+		exif.RegisterParsers(exif231Parser{})
+	})
+}
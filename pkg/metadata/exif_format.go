@@ -0,0 +1,149 @@
+package metadata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/mknote"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// exifFormatters format the values of the tags people look at, like exposure and lens, for display.
+var exifFormatters = map[string]func(tiff.DataType, []db.ExifValue) string{
+	string(exif.ExposureTime):          formatExposureTime,
+	string(exif.ExposureBiasValue):     formatExposureBias,
+	string(exif.FNumber):               formatFNumber,
+	string(exif.FocalLength):           formatFocalLength,
+	string(exif.FocalLengthIn35mmFilm): formatFocalLength,
+	string(exif.ISOSpeedRatings):       formatISO,
+	string(mknote.ISOSpeed):            formatISO,
+	string(LensSpecification):          formatLens,
+	string(mknote.Lens):                formatLens,
+}
+
+// formatExif formats the value of the given record for display, or returns an empty string if there is no formatter
+// for the tag or its value is unknown.
+func formatExif(record db.ExifRecord) string {
+	format, ok := exifFormatters[record.Tag]
+	if !ok {
+		return ""
+	}
+
+	values := record.Values
+	if values == nil {
+		values = []db.ExifValue{{Num: record.Num, Denominator: record.Denominator, Floating: record.Floating}}
+	}
+	return format(tiff.DataType(record.Type), values)
+}
+
+// exifNumber returns the given value as a number. Returns false for rationals with a zero denominator, which is how
+// exif marks unknown values.
+func exifNumber(dataType tiff.DataType, value db.ExifValue) (float64, bool) {
+	switch dataType {
+	case tiff.DTRational, tiff.DTSRational:
+		if value.Denominator == 0 {
+			return 0, false
+		}
+		return float64(value.Num) / float64(value.Denominator), true
+	case tiff.DTFloat, tiff.DTDouble:
+		return value.Floating, true
+	}
+	return float64(value.Num), true
+}
+
+// formatDecimal formats f with at most the given number of decimal places and without trailing zeros.
+func formatDecimal(f float64, places int) string {
+	scale := math.Pow(10, float64(places))
+	return strconv.FormatFloat(math.Round(f*scale)/scale, 'f', -1, 64)
+}
+
+// formatExposureTime formats exposure times shorter than a second as fractions, e.g. "1/250 s", and longer ones as
+// seconds, e.g. "2.5 s".
+func formatExposureTime(dataType tiff.DataType, values []db.ExifValue) string {
+	seconds, ok := exifNumber(dataType, values[0])
+	if !ok || seconds <= 0 {
+		return ""
+	}
+	if seconds < 1 {
+		if fraction := 1 / seconds; math.Abs(fraction-math.Round(fraction)) < 0.05 {
+			return fmt.Sprintf("1/%.0f s", math.Round(fraction))
+		}
+	}
+	return formatDecimal(seconds, 1) + " s"
+}
+
+// formatExposureBias formats exposure compensation in EV with a sign, e.g. "-0.7 EV".
+func formatExposureBias(dataType tiff.DataType, values []db.ExifValue) string {
+	bias, ok := exifNumber(dataType, values[0])
+	if !ok {
+		return ""
+	}
+	s := formatDecimal(bias, 1)
+	if s != "0" && bias > 0 {
+		s = "+" + s
+	}
+	return s + " EV"
+}
+
+// formatFNumber formats apertures as f-numbers, e.g. "f/2.8".
+func formatFNumber(dataType tiff.DataType, values []db.ExifValue) string {
+	fNumber, ok := exifNumber(dataType, values[0])
+	if !ok || fNumber <= 0 {
+		return ""
+	}
+	return "f/" + formatDecimal(fNumber, 1)
+}
+
+// formatFocalLength formats focal lengths in millimetres, e.g. "4.28 mm".
+func formatFocalLength(dataType tiff.DataType, values []db.ExifValue) string {
+	length, ok := exifNumber(dataType, values[0])
+	if !ok || length <= 0 {
+		return ""
+	}
+	return formatDecimal(length, 2) + " mm"
+}
+
+// formatISO formats the first non-zero value as a sensitivity, e.g. "ISO 100". Some maker notes pad it with zeros.
+func formatISO(dataType tiff.DataType, values []db.ExifValue) string {
+	for _, value := range values {
+		if iso, ok := exifNumber(dataType, value); ok && iso > 0 {
+			return "ISO " + formatDecimal(iso, 0)
+		}
+	}
+	return ""
+}
+
+// formatLens formats the minimum and maximum focal length and the apertures at both of them, e.g.
+// "18-135 mm f/3.5-5.6". Unknown values are left out.
+func formatLens(dataType tiff.DataType, values []db.ExifValue) string {
+	if len(values) != 4 {
+		return ""
+	}
+
+	formatRange := func(min, max db.ExifValue, places int) string {
+		minimum, minOK := exifNumber(dataType, min)
+		maximum, maxOK := exifNumber(dataType, max)
+		switch {
+		case !minOK || minimum <= 0:
+			return ""
+		case !maxOK || maximum <= 0 || formatDecimal(minimum, places) == formatDecimal(maximum, places):
+			return formatDecimal(minimum, places)
+		}
+		return formatDecimal(minimum, places) + "-" + formatDecimal(maximum, places)
+	}
+
+	lens := ""
+	if focalLength := formatRange(values[0], values[1], 2); focalLength != "" {
+		lens = focalLength + " mm"
+	}
+	if aperture := formatRange(values[2], values[3], 1); aperture != "" {
+		if lens != "" {
+			lens += " "
+		}
+		lens += "f/" + aperture
+	}
+	return lens
+}
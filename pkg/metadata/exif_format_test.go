@@ -0,0 +1,45 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/rwcarlsen/goexif/tiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatExif(t *testing.T) {
+	rational := func(tag string, values ...int64) db.ExifRecord {
+		record := db.ExifRecord{Type: uint16(tiff.DTRational), Tag: tag, Num: values[0], Denominator: values[1]}
+		if len(values) > 2 {
+			for i := 0; i < len(values); i += 2 {
+				record.Values = append(record.Values, db.ExifValue{Num: values[i], Denominator: values[i+1]})
+			}
+		}
+		return record
+	}
+
+	tests := []struct {
+		name     string
+		record   db.ExifRecord
+		expected string
+	}{
+		{"fraction of a second", rational("ExposureTime", 10, 2500), "1/250 s"},
+		{"seconds", rational("ExposureTime", 5, 2), "2.5 s"},
+		{"fraction that isn't 1/n", rational("ExposureTime", 3, 10), "0.3 s"},
+		{"unknown exposure", rational("ExposureTime", 0, 0), ""},
+		{"whole f-number", rational("FNumber", 8, 1), "f/8"},
+		{"positive bias", rational("ExposureBiasValue", 1, 3), "+0.3 EV"},
+		{"prime lens", rational("LensSpecification", 50, 1, 50, 1, 18, 10, 18, 10), "50 mm f/1.8"},
+		{"lens with unknown aperture", rational("LensSpecification", 18, 1, 55, 1, 0, 0, 0, 0), "18-55 mm"},
+		{"lens with wrong number of values", rational("LensSpecification", 18, 1, 55, 1), ""},
+		{"no formatter", rational("XResolution", 72, 1), ""},
+		{"iso padded with zeros", db.ExifRecord{Type: uint16(tiff.DTShort), Tag: "ISOSpeed", Values: db.ExifValues{{Num: 0}, {Num: 400}}}, "ISO 400"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, formatExif(test.record))
+		})
+	}
+}
@@ -2,9 +2,13 @@ package metadata
 
 import (
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/rwcarlsen/goexif/exif"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,3 +33,190 @@ func TestExifTagsFromPhotoWithoutExif(t *testing.T) {
 
 	assert.Empty(t, tags)
 }
+
+func exifTagsFromFile(t *testing.T, name string) ExifTags {
+	RegisterParsers()
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "exif", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err := ExifTagsFromPhoto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tags
+}
+
+func TestExifTagsFromSampleFiles(t *testing.T) {
+	tests := []struct {
+		file     string
+		tag      string
+		expected string
+	}{
+		{"iphone-4s.jpg", "ExposureTime", "1/1284 s"},
+		{"iphone-4s.jpg", "FNumber", "f/2.4"},
+		{"iphone-4s.jpg", "FocalLength", "4.28 mm"},
+		{"iphone-4s.jpg", "FocalLengthIn35mmFilm", "35 mm"},
+		{"iphone-4s.jpg", "ISOSpeedRatings", "ISO 50"},
+		{"iphone-4s.jpg", "LensSpecification", "4.28 mm f/2.4"},
+		{"iphone-4s.jpg", "LensModel", "iPhone 4S back camera 4.28mm f/2.4"},
+		{"iphone-4s.jpg", "SubjectArea", "1631, 1223, 881, 881"},
+		{"iphone-4s.jpg", "GPSTimeStamp", "13/1, 3/1, 4279/100"},
+		{"iphone-4s.jpg", "ComponentsConfiguration", "1, 2, 3, 0"},
+		{"iphone-4s.jpg", "ExifVersion", "0221"},
+		{"nikon-d80.jpg", "ExposureTime", "1/60 s"},
+		{"nikon-d80.jpg", "FNumber", "f/5.6"},
+		{"nikon-d80.jpg", "ExposureBiasValue", "0 EV"},
+		{"nikon-d80.jpg", "Lens", "18-135 mm f/3.5-5.6"},
+		{"nikon-d80.jpg", "ISOSpeed", "ISO 1250"},
+		{"nikon-d80.jpg", "WB_RBLevels", "449/256, 370/256, 256/256, 256/256"},
+		{"nikon-d2h.jpg", "UserComment", "taken at basilica of chinese"},
+		{"nikon-d2h.jpg", "FocalLength", "23.33 mm"},
+		{"canon-eos-rebel-t4i.jpg", "LensSpecification", "18-55 mm"},
+		{"canon-eos-rebel-t4i.jpg", "LensModel", "EF-S18-55mm f/3.5-5.6 IS II"},
+		{"canon-eos-rebel-t4i.jpg", "BodySerialNumber", "082033000088"},
+		{"offsets.jpg", "ExposureTime", "1/250 s"},
+		{"offsets.jpg", "ExposureBiasValue", "-0.7 EV"},
+		{"offsets.jpg", "LensSpecification", "24-70 mm f/2.8"},
+		{"offsets.jpg", "OffsetTimeOriginal", "+02:00"},
+		{"offsets.jpg", "UserComment", "Grüße aus Lissabon"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file+" "+test.tag, func(t *testing.T) {
+			tag, err := exifTagsFromFile(t, test.file).ByName(test.tag)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, tag.String())
+		})
+	}
+}
+
+func TestExifTagsFromSampleFilesSkipEmptyAndBinaryTags(t *testing.T) {
+	tests := []struct {
+		file string
+		tag  string
+	}{
+		// Canon pads the user comment with NUL bytes, Nikon with spaces.
+		{"canon-eos-rebel-t4i.jpg", "UserComment"},
+		{"nikon-d80.jpg", "UserComment"},
+		{"iphone-4s.jpg", "MakerNote"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file+" "+test.tag, func(t *testing.T) {
+			_, err := exifTagsFromFile(t, test.file).ByName(test.tag)
+
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExifTagsFromPhotoKeepsAllValues(t *testing.T) {
+	tag, err := exifTagsFromFile(t, "offsets.jpg").ByName("LensSpecification")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(24), tag.Num)
+	assert.Equal(t, int64(1), tag.Denominator)
+	assert.Equal(t, db.ExifValues{
+		{Num: 24, Denominator: 1, Floating: 24},
+		{Num: 70, Denominator: 1, Floating: 70},
+		{Num: 28, Denominator: 10, Floating: 2.8},
+		{Num: 28, Denominator: 10, Floating: 2.8},
+	}, tag.Values)
+}
+
+func TestExifTagsFromPhotoAppliesOffsets(t *testing.T) {
+	tags := exifTagsFromFile(t, "offsets.jpg")
+
+	tests := []struct {
+		tag    string
+		offset int
+	}{
+		{"DateTimeOriginal", 2 * 60 * 60},
+		{"DateTime", -4 * 60 * 60},
+	}
+	for _, test := range tests {
+		t.Run(test.tag, func(t *testing.T) {
+			tag, err := tags.ByName(test.tag)
+
+			assert.NoError(t, err)
+			expected := time.Date(2019, time.May, 4, 13, 14, 15, 0, time.FixedZone("", test.offset))
+			assert.True(t, expected.Equal(*tag.DateTime), "expected %s, got %s", expected, tag.DateTime)
+		})
+	}
+}
+
+func TestDateTimeFromExif(t *testing.T) {
+	RegisterParsers()
+	tests := []struct {
+		file     string
+		expected time.Time
+	}{
+		{"offsets.jpg", time.Date(2019, time.May, 4, 13, 14, 15, 0, time.FixedZone("", 2*60*60))},
+		// Canon.TimeInfo holds -420 minutes.
+		{"canon-eos-rebel-t4i.jpg", time.Date(2012, time.December, 21, 11, 15, 19, 0, time.FixedZone("", -7*60*60))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", "exif", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			e, err := exif.Decode(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			datetime, err := DateTimeFromExif(e)
+
+			assert.NoError(t, err)
+			assert.True(t, test.expected.Equal(datetime), "expected %s, got %s", test.expected, datetime)
+			_, offset := datetime.Zone()
+			_, expectedOffset := test.expected.Zone()
+			assert.Equal(t, expectedOffset, offset)
+		})
+	}
+}
+
+func TestExifTimeLayout(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"2019:05:04 13:14:15", time.Date(2019, time.May, 4, 13, 14, 15, 0, time.UTC)},
+		{"2019:05:04 13:14:05", time.Date(2019, time.May, 4, 13, 14, 5, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			datetime, err := time.Parse(exifTimeLayout, test.value)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, datetime)
+		})
+	}
+}
+
+func TestUserComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"ascii", []byte("ASCII\x00\x00\x00a comment\x00\x00"), "a comment"},
+		{"undefined", []byte("\x00\x00\x00\x00\x00\x00\x00\x00a comment"), "a comment"},
+		{"big endian unicode", []byte("UNICODE\x00\x00h\x00\xe9"), "hé"},
+		{"little endian unicode", []byte("UNICODE\x00h\x00\xe9\x00"), "hé"},
+		{"only padding", []byte("ASCII\x00\x00\x00      "), ""},
+		{"too short", []byte("ASCII"), ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, UserComment(test.data))
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Location is where a photo was taken.
+type Location struct {
+	// Latitude and Longitude are in decimal degrees, south and west are negative.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Altitude is in meters, negative values are below sea level.
+	Altitude *float64 `json:"altitude"`
+	// Direction is the direction the camera was pointing in degrees clockwise from north, in [0, 360).
+	Direction *float64 `json:"direction"`
+}
+
+// Validate checks that the coordinates are on the globe.
+func (l Location) Validate() error {
+	if l.Latitude < -90 || l.Latitude > 90 {
+		return fmt.Errorf("latitude %f is outside [-90, 90]", l.Latitude)
+	}
+	if l.Longitude < -180 || l.Longitude > 180 {
+		return fmt.Errorf("longitude %f is outside [-180, 180]", l.Longitude)
+	}
+	if l.Direction != nil && (*l.Direction < 0 || *l.Direction >= 360) {
+		return fmt.Errorf("direction %f is outside [0, 360)", *l.Direction)
+	}
+	return nil
+}
+
+// LocationFromExif decodes the GPS tags of the given exif data. Returns nil if there are no coordinates. Altitude and
+// direction are optional and left nil if missing or unreadable.
+func LocationFromExif(e *exif.Exif) (*Location, error) {
+	if e == nil {
+		return nil, nil
+	}
+
+	latitudeTag, err := e.Get(exif.GPSLatitude)
+	if err != nil {
+		return nil, nil
+	}
+	longitudeTag, err := e.Get(exif.GPSLongitude)
+	if err != nil {
+		return nil, nil
+	}
+
+	location := Location{}
+	if location.Latitude, err = GPSDegrees(latitudeTag); err != nil {
+		return nil, fmt.Errorf("could not decode latitude: %s", err.Error())
+	}
+	if location.Longitude, err = GPSDegrees(longitudeTag); err != nil {
+		return nil, fmt.Errorf("could not decode longitude: %s", err.Error())
+	}
+	if gpsRef(e, exif.GPSLatitudeRef) == "S" {
+		location.Latitude = -location.Latitude
+	}
+	if gpsRef(e, exif.GPSLongitudeRef) == "W" {
+		location.Longitude = -location.Longitude
+	}
+
+	if tag, err := e.Get(exif.GPSAltitude); err == nil {
+		if altitude, err := rational(tag, 0); err == nil {
+			// An altitude reference of 1 means below sea level.
+			if ref, err := e.Get(exif.GPSAltitudeRef); err == nil {
+				if below, err := ref.Int(0); err == nil && below == 1 {
+					altitude = -altitude
+				}
+			}
+			location.Altitude = &altitude
+		}
+	}
+
+	if tag, err := e.Get(exif.GPSImgDirection); err == nil {
+		if direction, err := rational(tag, 0); err == nil && direction >= 0 && direction < 360 {
+			location.Direction = &direction
+		}
+	}
+
+	if err := location.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &location, nil
+}
+
+// GPSDegrees converts a GPS coordinate tag to decimal degrees. Coordinates are stored as up to three rationals for
+// degrees, minutes and seconds; the reference tag decides the sign.
+func GPSDegrees(tag *tiff.Tag) (float64, error) {
+	if tag.Type != tiff.DTRational && tag.Type != tiff.DTSRational {
+		return 0, fmt.Errorf("unexpected type %d for coordinate", tag.Type)
+	}
+	if tag.Count < 1 || tag.Count > 3 {
+		return 0, fmt.Errorf("unexpected number of values %d for coordinate", tag.Count)
+	}
+
+	degrees := 0.0
+	divisor := 1.0
+	for i := 0; i < int(tag.Count); i++ {
+		value, err := rational(tag, i)
+		if err != nil {
+			return 0, err
+		}
+		degrees += value / divisor
+		divisor *= 60
+	}
+	return degrees, nil
+}
+
+// rational returns the i-th value of a rational tag as a float.
+func rational(tag *tiff.Tag, i int) (float64, error) {
+	num, denom, err := tag.Rat2(i)
+	if err != nil {
+		return 0, err
+	}
+	if denom == 0 {
+		return 0, fmt.Errorf("zero denominator in value %d", i)
+	}
+	return float64(num) / float64(denom), nil
+}
+
+// gpsRef returns the value of a GPS reference tag like GPSLatitudeRef, or an empty string if it is missing.
+func gpsRef(e *exif.Exif, name exif.FieldName) string {
+	tag, err := e.Get(name)
+	if err != nil {
+		return ""
+	}
+	s, err := tag.StringVal()
+	if err != nil {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimRight(s, "\x00 "))
+}
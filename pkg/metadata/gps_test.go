@@ -0,0 +1,86 @@
+package metadata
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/gps.jpg is tagged with 33°51'31.5"S 151°12'36"E, 12.5m below sea level, facing 270.5°.
+
+func decodeExif(t *testing.T, name string) *exif.Exif {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	e, err := exif.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestLocationFromExif(t *testing.T) {
+	location, err := LocationFromExif(decodeExif(t, "testdata/gps.jpg"))
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, location) {
+		assert.InDelta(t, -33.85875, location.Latitude, 0.000001)
+		assert.InDelta(t, 151.21, location.Longitude, 0.000001)
+		if assert.NotNil(t, location.Altitude) {
+			assert.Equal(t, -12.5, *location.Altitude)
+		}
+		if assert.NotNil(t, location.Direction) {
+			assert.Equal(t, 270.5, *location.Direction)
+		}
+	}
+}
+
+func TestLocationFromExifWithoutAltitude(t *testing.T) {
+	location, err := LocationFromExif(decodeExif(t, "../images/testdata/gps.jpg"))
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, location) {
+		assert.InDelta(t, 43.65, location.Latitude, 0.01)
+		assert.InDelta(t, -79.38, location.Longitude, 0.01)
+		assert.Nil(t, location.Altitude)
+		assert.Nil(t, location.Direction)
+	}
+}
+
+func TestLocationFromExifWithoutGPS(t *testing.T) {
+	location, err := LocationFromExif(decodeExif(t, "testdata/orientation/6.jpg"))
+
+	assert.NoError(t, err)
+	assert.Nil(t, location)
+}
+
+func TestExifTagsKeepGPSCoordinates(t *testing.T) {
+	f, err := os.Open("testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tags, err := ExifTagsFromPhotoReader(f)
+	assert.NoError(t, err)
+
+	latitude, err := tags.ByName("GPSLatitude")
+	assert.NoError(t, err)
+	assert.InDelta(t, 33.85875, latitude.Floating, 0.000001)
+	longitude, err := tags.ByName("GPSLongitude")
+	assert.NoError(t, err)
+	assert.InDelta(t, 151.21, longitude.Floating, 0.000001)
+}
+
+func TestLocationValidate(t *testing.T) {
+	direction := 360.0
+	assert.NoError(t, Location{Latitude: -90, Longitude: 180}.Validate())
+	assert.Error(t, Location{Latitude: 91}.Validate())
+	assert.Error(t, Location{Longitude: -181}.Validate())
+	assert.Error(t, Location{Direction: &direction}.Validate())
+}
@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf8"
+)
+
+// iptcProperties maps the IPTC-IIM application record (record 2) datasets phts imports to property names.
+var iptcProperties = map[byte]string{
+	5:   PropertyTitle, // Object Name
+	25:  PropertyKeyword,
+	116: PropertyCopyright,   // Copyright Notice
+	120: PropertyDescription, // Caption/Abstract
+}
+
+const (
+	iptcTagMarker = 0x1c
+	// iptcUTF8 is the value of the Coded Character Set dataset (1:90) for UTF-8.
+	iptcUTF8 = "\x1b%G"
+	// photoshopIPTCResource is the id of the Photoshop image resource holding the IPTC-IIM data.
+	photoshopIPTCResource = 0x0404
+)
+
+// ParseIPTC reads the title, description, keywords and copyright from IPTC-IIM data. Text is UTF-8 if the data says
+// so or is valid UTF-8, otherwise it is read as Latin-1.
+func ParseIPTC(data []byte) (Properties, error) {
+	type dataset struct {
+		record, number byte
+		value          []byte
+	}
+	var datasets []dataset
+	utf8Declared := false
+
+	for len(data) > 0 {
+		if data[0] != iptcTagMarker {
+			// Some writers pad the data with zeros.
+			if bytes.Count(data, []byte{0}) == len(data) {
+				break
+			}
+			return nil, fmt.Errorf("invalid iptc tag marker 0x%x", data[0])
+		}
+		if len(data) < 5 {
+			return nil, fmt.Errorf("truncated iptc dataset")
+		}
+		record, number := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		if size&0x8000 != 0 {
+			return nil, fmt.Errorf("extended iptc datasets are not supported")
+		}
+		if len(data) < 5+size {
+			return nil, fmt.Errorf("truncated iptc dataset %d:%d", record, number)
+		}
+		value := data[5 : 5+size]
+		data = data[5+size:]
+
+		if record == 1 && number == 90 {
+			utf8Declared = string(value) == iptcUTF8
+		}
+		datasets = append(datasets, dataset{record, number, value})
+	}
+
+	var properties Properties
+	for _, dataset := range datasets {
+		name, ok := iptcProperties[dataset.number]
+		if dataset.record != 2 || !ok {
+			continue
+		}
+		properties.add(name, iptcString(dataset.value, utf8Declared), SourceIPTC)
+	}
+	return properties, nil
+}
+
+func iptcString(value []byte, utf8Declared bool) string {
+	if utf8Declared || utf8.Valid(value) {
+		return string(bytes.ToValidUTF8(value, nil))
+	}
+
+	runes := make([]rune, len(value))
+	for i, b := range value {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// iptcFromPhotoshop finds the IPTC-IIM data in Photoshop image resources, as stored in a JPEG APP13 segment after the
+// "Photoshop 3.0" header. Returns nil if there is none.
+func iptcFromPhotoshop(data []byte) []byte {
+	for len(data) >= 12 && string(data[:4]) == "8BIM" {
+		id := binary.BigEndian.Uint16(data[4:6])
+		// The name is a pascal string padded to an even length, including the length byte.
+		nameLength := int(data[6]) + 1
+		nameLength += nameLength % 2
+		if len(data) < 6+nameLength+4 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint32(data[6+nameLength:]))
+		start := 6 + nameLength + 4
+		if size < 0 || len(data) < start+size {
+			return nil
+		}
+		if id == photoshopIPTCResource {
+			return data[start : start+size]
+		}
+		next := start + size + size%2
+		if next > len(data) {
+			return nil
+		}
+		data = data[next:]
+	}
+	return nil
+}
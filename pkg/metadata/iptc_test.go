@@ -0,0 +1,57 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func iptcDataset(record, number byte, value string) []byte {
+	return append([]byte{iptcTagMarker, record, number, byte(len(value) >> 8), byte(len(value))}, value...)
+}
+
+func TestParseIPTC(t *testing.T) {
+	var data []byte
+	data = append(data, iptcDataset(2, 5, "Tram 28")...)
+	data = append(data, iptcDataset(2, 25, "tram")...)
+	data = append(data, iptcDataset(2, 25, "Lisbon")...)
+	data = append(data, iptcDataset(2, 80, "Jane Doe")...)
+	data = append(data, iptcDataset(2, 120, "Caf\xe9")...)
+	data = append(data, 0, 0)
+
+	properties, err := ParseIPTC(data)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Properties{
+		{Name: PropertyTitle, Value: "Tram 28", Source: SourceIPTC},
+		{Name: PropertyKeyword, Value: "tram", Source: SourceIPTC},
+		{Name: PropertyKeyword, Value: "Lisbon", Source: SourceIPTC},
+		{Name: PropertyDescription, Value: "Café", Source: SourceIPTC},
+	}, properties)
+}
+
+func TestParseIPTCWithDeclaredUTF8(t *testing.T) {
+	data := append(iptcDataset(1, 90, iptcUTF8), iptcDataset(2, 116, "© Jane\xff")...)
+
+	properties, err := ParseIPTC(data)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Properties{{Name: PropertyCopyright, Value: "© Jane", Source: SourceIPTC}}, properties)
+}
+
+func TestParseIPTCRejectsInvalidData(t *testing.T) {
+	tests := map[string][]byte{
+		"invalid marker":    {0x1d, 2, 5, 0, 0},
+		"truncated header":  {iptcTagMarker, 2, 5},
+		"truncated dataset": {iptcTagMarker, 2, 5, 0, 10, 'a'},
+		"extended dataset":  {iptcTagMarker, 2, 5, 0x80, 4, 0, 0, 0, 1, 'a'},
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseIPTC(data)
+
+			assert.Error(t, err)
+		})
+	}
+}
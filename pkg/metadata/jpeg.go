@@ -0,0 +1,102 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	jpegSOI   = 0xd8
+	jpegEOI   = 0xd9
+	jpegSOS   = 0xda
+	jpegAPP1  = 0xe1
+	jpegAPP13 = 0xed
+)
+
+var (
+	jpegXMPHeader       = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	jpegPhotoshopHeader = []byte("Photoshop 3.0\x00")
+)
+
+// PropertiesFromJPEG reads the properties in the XMP packet and the IPTC-IIM data embedded in a JPEG. Only the
+// segments before the image data are read.
+func PropertiesFromJPEG(r io.Reader) (Properties, error) {
+	var properties Properties
+	err := jpegSegments(r, func(marker byte, data []byte) error {
+		switch {
+		case marker == jpegAPP1 && bytes.HasPrefix(data, jpegXMPHeader):
+			xmp, err := ParseXMP(bytes.NewReader(data[len(jpegXMPHeader):]), SourceXMP)
+			if err != nil {
+				return err
+			}
+			properties = append(properties, xmp...)
+		case marker == jpegAPP13 && bytes.HasPrefix(data, jpegPhotoshopHeader):
+			if iptc := iptcFromPhotoshop(data[len(jpegPhotoshopHeader):]); iptc != nil {
+				parsed, err := ParseIPTC(iptc)
+				if err != nil {
+					return err
+				}
+				properties = append(properties, parsed...)
+			}
+		}
+		return nil
+	})
+	return properties, err
+}
+
+// jpegSegments calls f with the marker and data of each segment of a JPEG up to the start of the image data.
+func jpegSegments(r io.Reader, f func(marker byte, data []byte) error) error {
+	reader := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(reader, soi[:]); err != nil {
+		return errors.Wrap(err, "could not read jpeg header")
+	}
+	if soi[0] != 0xff || soi[1] != jpegSOI {
+		return fmt.Errorf("not a jpeg")
+	}
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return errors.Wrap(err, "could not read jpeg marker")
+		}
+		if b != 0xff {
+			return fmt.Errorf("invalid jpeg marker 0x%x", b)
+		}
+		marker := byte(0xff)
+		// Markers may be preceded by any number of fill bytes.
+		for marker == 0xff {
+			if marker, err = reader.ReadByte(); err != nil {
+				return errors.Wrap(err, "could not read jpeg marker")
+			}
+		}
+
+		switch {
+		case marker == jpegSOS || marker == jpegEOI:
+			return nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers without data.
+			continue
+		}
+
+		var length uint16
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return errors.Wrap(err, "could not read jpeg segment length")
+		}
+		if length < 2 {
+			return fmt.Errorf("invalid jpeg segment length %d", length)
+		}
+		data := make([]byte, length-2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return errors.Wrap(err, "could not read jpeg segment")
+		}
+		if err := f(marker, data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package metadata
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertiesFromJPEG(t *testing.T) {
+	f, err := os.Open("testdata/xmp/lightroom.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	properties, err := PropertiesFromJPEG(f)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Properties{
+		{Name: PropertyRating, Value: "4", Source: SourceXMP},
+		{Name: PropertyTitle, Value: "Tram 28", Source: SourceXMP},
+		{Name: PropertyDescription, Value: "Tram in Lisbon", Source: SourceXMP},
+		{Name: PropertyKeyword, Value: "tram", Source: SourceXMP},
+		{Name: PropertyKeyword, Value: "Lisbon", Source: SourceXMP},
+		{Name: PropertyCopyright, Value: "© 2019 Jane Doe", Source: SourceXMP},
+		{Name: PropertyTitle, Value: "Tram 28", Source: SourceIPTC},
+		{Name: PropertyKeyword, Value: "tram", Source: SourceIPTC},
+		{Name: PropertyKeyword, Value: "Portugal", Source: SourceIPTC},
+		{Name: PropertyDescription, Value: "Tram in Lisbon", Source: SourceIPTC},
+		{Name: PropertyCopyright, Value: "© Jane Doe", Source: SourceIPTC},
+	}, properties)
+}
+
+func TestPropertiesFromJPEGWithoutMetadata(t *testing.T) {
+	f, err := os.Open("../../test/integration/files/100x75-with-exif.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	properties, err := PropertiesFromJPEG(f)
+
+	assert.NoError(t, err)
+	assert.Empty(t, properties)
+}
+
+func TestPropertiesFromJPEGRejectsOtherFormats(t *testing.T) {
+	_, err := PropertiesFromJPEG(strings.NewReader("\x89PNG\r\n\x1a\n"))
+
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package metadata
+
+import (
+	"image"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ExifOrientationFromExif returns the orientation stored in the given exif data, or Horizontal if there is none or
+// it is not one of the eight defined orientations.
+func ExifOrientationFromExif(e *exif.Exif) ExifOrientation {
+	if e == nil {
+		return Horizontal
+	}
+	tag, err := e.Get(exif.Orientation)
+	if err != nil {
+		return Horizontal
+	}
+	value, err := tag.Int(0)
+	if err != nil {
+		return Horizontal
+	}
+	if o := ExifOrientation(value); o.Valid() {
+		return o
+	}
+	return Horizontal
+}
+
+// Valid returns true for the eight orientations defined by the exif spec.
+func (o ExifOrientation) Valid() bool {
+	return o >= Horizontal && o <= Rotate270Clockwise
+}
+
+// SwapsDimensions returns true if displaying an image with this orientation swaps its width and height.
+func (o ExifOrientation) SwapsDimensions() bool {
+	return o.Angle()%180 != 0
+}
+
+// Dimensions returns the width and height of an image with the given stored width and height once it is displayed
+// upright.
+func (o ExifOrientation) Dimensions(width, height int) (int, int) {
+	if o.SwapsDimensions() {
+		return height, width
+	}
+	return width, height
+}
+
+// Normalize applies the rotation and mirroring of this orientation to the given image so it is upright and no longer
+// depends on the orientation tag.
+func (o ExifOrientation) Normalize(img image.Image) image.Image {
+	// imaging rotates counter clockwise, the exif orientations are named clockwise.
+	switch o {
+	case MirrorHorizontal:
+		return imaging.FlipH(img)
+	case Rotate180:
+		return imaging.Rotate180(img)
+	case MirrorVertical:
+		return imaging.FlipV(img)
+	case MirrorHorizontalRotate270Clockwise:
+		return imaging.Transpose(img)
+	case Rotate90Clockwise:
+		return imaging.Rotate270(img)
+	case MirrorHorizontalRotate90Clockwise:
+		return imaging.Transverse(img)
+	case Rotate270Clockwise:
+		return imaging.Rotate90(img)
+	default:
+		return img
+	}
+}
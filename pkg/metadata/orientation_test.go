@@ -0,0 +1,81 @@
+package metadata
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"testing"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/stretchr/testify/assert"
+)
+
+// The files in testdata/orientation hold the same upright image as it would be stored with each of the eight exif
+// orientations. N.png has no exif data, N.jpg is an 8x upscaled copy tagged with orientation N.
+
+func loadPNG(t *testing.T, name string) image.Image {
+	f, err := os.Open("testdata/orientation/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestNormalizeGolden(t *testing.T) {
+	upright := loadPNG(t, "upright.png")
+
+	for o := Horizontal; o <= Rotate270Clockwise; o++ {
+		t.Run(fmt.Sprintf("orientation %d", o), func(t *testing.T) {
+			normalized := o.Normalize(loadPNG(t, fmt.Sprintf("%d.png", o)))
+
+			assert.Equal(t, upright.Bounds().Size(), normalized.Bounds().Size())
+			for x := 0; x < upright.Bounds().Dx(); x++ {
+				for y := 0; y < upright.Bounds().Dy(); y++ {
+					expected := upright.At(x, y)
+					actual := normalized.At(normalized.Bounds().Min.X+x, normalized.Bounds().Min.Y+y)
+					er, eg, eb, ea := expected.RGBA()
+					ar, ag, ab, aa := actual.RGBA()
+					assert.Equal(t, []uint32{er, eg, eb, ea}, []uint32{ar, ag, ab, aa}, "pixel %dx%d", x, y)
+				}
+			}
+		})
+	}
+}
+
+func TestDimensions(t *testing.T) {
+	for o := Horizontal; o <= Rotate270Clockwise; o++ {
+		stored := loadPNG(t, fmt.Sprintf("%d.png", o)).Bounds()
+
+		width, height := o.Dimensions(stored.Dx(), stored.Dy())
+
+		assert.Equal(t, []int{5, 3}, []int{width, height}, "orientation %d", o)
+	}
+}
+
+func TestExifOrientationFromExif(t *testing.T) {
+	for o := Horizontal; o <= Rotate270Clockwise; o++ {
+		f, err := os.Open(fmt.Sprintf("testdata/orientation/%d.jpg", o))
+		assert.NoError(t, err)
+		e, err := exif.Decode(f)
+		f.Close()
+		assert.NoError(t, err)
+
+		assert.Equal(t, o, ExifOrientationFromExif(e))
+	}
+
+	assert.Equal(t, ExifOrientation(Horizontal), ExifOrientationFromExif(nil))
+}
+
+func TestExifOrientationValid(t *testing.T) {
+	assert.False(t, ExifOrientation(0).Valid())
+	assert.True(t, ExifOrientation(Horizontal).Valid())
+	assert.True(t, ExifOrientation(Rotate270Clockwise).Valid())
+	assert.False(t, ExifOrientation(9).Valid())
+}
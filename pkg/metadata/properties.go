@@ -0,0 +1,105 @@
+package metadata
+
+import (
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// Source is where a property was imported from.
+type Source string
+
+const (
+	SourceExif    Source = "exif"
+	SourceIPTC    Source = "iptc"
+	SourceXMP     Source = "xmp"
+	SourceSidecar Source = "xmp-sidecar"
+)
+
+// precedence returns how much a source is trusted, higher is better. Sidecars are written by editing software after
+// the fact, so they win over anything embedded in the file.
+func (s Source) precedence() int {
+	switch s {
+	case SourceSidecar:
+		return 3
+	case SourceXMP:
+		return 2
+	case SourceIPTC:
+		return 1
+	}
+	return 0
+}
+
+// Names of the descriptive properties.
+const (
+	PropertyTitle       = "title"
+	PropertyDescription = "description"
+	PropertyKeyword     = "keyword"
+	PropertyRating      = "rating"
+	PropertyCopyright   = "copyright"
+)
+
+// Property is a descriptive value of a photo, like its title or one of its keywords, and where it came from.
+type Property struct {
+	Name   string `db:"name" json:"name"`
+	Value  string `db:"value" json:"value"`
+	Source Source `db:"source" json:"source"`
+}
+
+// Properties are the descriptive values imported for a photo, possibly from several sources.
+type Properties []Property
+
+// add adds a property unless its value is blank.
+func (p *Properties) add(name, value string, source Source) {
+	if value = strings.TrimSpace(value); value != "" {
+		*p = append(*p, Property{Name: name, Value: value, Source: source})
+	}
+}
+
+// Value returns the value of the named property from the most trusted source, or an empty string if there is none.
+func (p Properties) Value(name string) string {
+	var best *Property
+	for i, property := range p {
+		if property.Name != name {
+			continue
+		}
+		if best == nil || property.Source.precedence() > best.Source.precedence() {
+			best = &p[i]
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Value
+}
+
+// Values returns the distinct values of the named property from all sources, ignoring case, in order.
+func (p Properties) Values(name string) []string {
+	var values []string
+	seen := map[string]bool{}
+	for _, property := range p {
+		if property.Name != name || seen[strings.ToLower(property.Value)] {
+			continue
+		}
+		seen[strings.ToLower(property.Value)] = true
+		values = append(values, property.Value)
+	}
+	return values
+}
+
+// PropertiesFromExifTags returns the description and copyright exif tags as properties.
+func PropertiesFromExifTags(tags ExifTags) Properties {
+	var properties Properties
+	for _, field := range []struct {
+		tag  exif.FieldName
+		name string
+	}{
+		{exif.ImageDescription, PropertyDescription},
+		{exif.Copyright, PropertyCopyright},
+	} {
+		if tag, err := tags.ByName(string(field.tag)); err == nil {
+			properties.add(field.name, tag.StringValue, SourceExif)
+		}
+	}
+	return properties
+}
@@ -0,0 +1,41 @@
+package metadata
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropertiesValue(t *testing.T) {
+	properties := Properties{
+		{Name: PropertyDescription, Value: "from exif", Source: SourceExif},
+		{Name: PropertyDescription, Value: "from sidecar", Source: SourceSidecar},
+		{Name: PropertyDescription, Value: "from xmp", Source: SourceXMP},
+		{Name: PropertyTitle, Value: "from iptc", Source: SourceIPTC},
+	}
+
+	assert.Equal(t, "from sidecar", properties.Value(PropertyDescription))
+	assert.Equal(t, "from iptc", properties.Value(PropertyTitle))
+	assert.Equal(t, "", properties.Value(PropertyCopyright))
+}
+
+func TestPropertiesValues(t *testing.T) {
+	properties := Properties{
+		{Name: PropertyKeyword, Value: "tram", Source: SourceXMP},
+		{Name: PropertyKeyword, Value: "Lisbon", Source: SourceXMP},
+		{Name: PropertyTitle, Value: "Tram 28", Source: SourceXMP},
+		{Name: PropertyKeyword, Value: "Tram", Source: SourceIPTC},
+		{Name: PropertyKeyword, Value: "dusk", Source: SourceSidecar},
+	}
+
+	assert.Equal(t, []string{"tram", "Lisbon", "dusk"}, properties.Values(PropertyKeyword))
+	assert.Empty(t, properties.Values(PropertyRating))
+}
+
+func TestPropertiesFromExifTags(t *testing.T) {
+	tags := exifTagsFromFile(t, "nikon-d2h.jpg")
+
+	properties := PropertiesFromExifTags(tags)
+
+	assert.Empty(t, properties)
+}
@@ -0,0 +1,159 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaxXMPSize is the size of the largest XMP packet or sidecar ParseXMP reads.
+const MaxXMPSize = 1 << 20
+
+const (
+	xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+	rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	dcNamespace  = "http://purl.org/dc/elements/1.1/"
+	xmpNamespace = "http://ns.adobe.com/xap/1.0/"
+)
+
+// xmpProperties maps the XMP properties phts imports to property names.
+var xmpProperties = map[xml.Name]string{
+	{Space: dcNamespace, Local: "title"}:       PropertyTitle,
+	{Space: dcNamespace, Local: "description"}: PropertyDescription,
+	{Space: dcNamespace, Local: "subject"}:     PropertyKeyword,
+	{Space: dcNamespace, Local: "rights"}:      PropertyCopyright,
+	{Space: xmpNamespace, Local: "Rating"}:     PropertyRating,
+}
+
+// ParseXMP reads the title, description, keywords, rating and copyright from an XMP packet or sidecar, like the ones
+// written by Lightroom and darktable. Language alternatives are reduced to the default language. Ratings must be
+// between -1, rejected, and 5.
+func ParseXMP(r io.Reader, source Source) (Properties, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxXMPSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read xmp")
+	}
+	if len(data) > MaxXMPSize {
+		return nil, fmt.Errorf("xmp is larger than %d bytes", MaxXMPSize)
+	}
+
+	parser := xmpParser{source: source}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrap(err, "could not parse xmp")
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			parser.start(token)
+		case xml.EndElement:
+			parser.end(token)
+		case xml.CharData:
+			parser.text.Write(token)
+		}
+	}
+	return parser.properties, nil
+}
+
+// xmpParser collects properties from the tokens of an XMP packet. Properties are either attributes of
+// rdf:Description, elements with text, or elements with an rdf:Bag, rdf:Seq or rdf:Alt of rdf:li items.
+type xmpParser struct {
+	source     Source
+	properties Properties
+
+	// property is the name of the property element the parser is in, empty outside of one.
+	property string
+	// items are the rdf:li values of the current property, defaults are language alternatives for x-default.
+	items, defaults []string
+	language        string
+	text            bytes.Buffer
+}
+
+func (p *xmpParser) start(element xml.StartElement) {
+	p.text.Reset()
+	if element.Name.Space == rdfNamespace && element.Name.Local == "Description" {
+		for _, attr := range element.Attr {
+			if name, ok := xmpProperties[attr.Name]; ok {
+				p.add(name, attr.Value)
+			}
+		}
+		return
+	}
+
+	if name, ok := xmpProperties[element.Name]; ok && p.property == "" {
+		p.property, p.items, p.defaults = name, nil, nil
+		return
+	}
+
+	if element.Name.Space == rdfNamespace && element.Name.Local == "li" {
+		p.language = ""
+		for _, attr := range element.Attr {
+			if attr.Name.Space == xmlNamespace && attr.Name.Local == "lang" {
+				p.language = attr.Value
+			}
+		}
+	}
+}
+
+func (p *xmpParser) end(element xml.EndElement) {
+	if p.property == "" {
+		return
+	}
+
+	if element.Name.Space == rdfNamespace && element.Name.Local == "li" {
+		p.items = append(p.items, p.text.String())
+		if p.language == "x-default" {
+			p.defaults = append(p.defaults, p.text.String())
+		}
+		p.text.Reset()
+		return
+	}
+
+	if name, ok := xmpProperties[element.Name]; !ok || name != p.property {
+		return
+	}
+	switch {
+	case p.items == nil:
+		p.add(p.property, p.text.String())
+	case p.property == PropertyKeyword:
+		for _, item := range p.items {
+			p.add(p.property, item)
+		}
+	case len(p.defaults) > 0:
+		p.add(p.property, p.defaults[0])
+	default:
+		p.add(p.property, p.items[0])
+	}
+	p.property = ""
+}
+
+func (p *xmpParser) add(name, value string) {
+	if name == PropertyRating {
+		rating, ok := parseRating(value)
+		if !ok {
+			return
+		}
+		value = strconv.Itoa(rating)
+	}
+	p.properties.add(name, value, p.source)
+}
+
+// parseRating parses an XMP rating. Some software writes them as decimals.
+func parseRating(s string) (int, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || f < -1 || f > 5 {
+		return 0, false
+	}
+	return int(math.Round(f)), true
+}
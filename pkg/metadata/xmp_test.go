@@ -0,0 +1,96 @@
+package metadata
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseXMPSidecar(t *testing.T) {
+	f, err := os.Open("testdata/xmp/darktable.jpg.xmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	properties, err := ParseXMP(f, SourceSidecar)
+
+	assert.NoError(t, err)
+	assert.Equal(t, Properties{
+		{Name: PropertyRating, Value: "3", Source: SourceSidecar},
+		{Name: PropertyTitle, Value: "Tram 28 at dusk", Source: SourceSidecar},
+		{Name: PropertyKeyword, Value: "tram", Source: SourceSidecar},
+		{Name: PropertyKeyword, Value: "dusk", Source: SourceSidecar},
+	}, properties)
+}
+
+func TestParseXMP(t *testing.T) {
+	packet := func(description string) string {
+		return `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+			`<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/"` +
+			description + `</rdf:Description></rdf:RDF></x:xmpmeta>`
+	}
+
+	tests := []struct {
+		name     string
+		xmp      string
+		expected Properties
+	}{
+		{
+			name:     "rating as element",
+			xmp:      packet(`><xmp:Rating>5</xmp:Rating>`),
+			expected: Properties{{Name: PropertyRating, Value: "5", Source: SourceXMP}},
+		},
+		{
+			name:     "rejected",
+			xmp:      packet(` xmp:Rating="-1">`),
+			expected: Properties{{Name: PropertyRating, Value: "-1", Source: SourceXMP}},
+		},
+		{
+			name:     "decimal rating",
+			xmp:      packet(` xmp:Rating="2.0">`),
+			expected: Properties{{Name: PropertyRating, Value: "2", Source: SourceXMP}},
+		},
+		{
+			name: "invalid ratings are skipped",
+			xmp:  packet(` xmp:Rating="7">`),
+		},
+		{
+			name:     "first alternative without a default language",
+			xmp:      packet(`><dc:title><rdf:Alt><rdf:li xml:lang="pt">Elétrico</rdf:li><rdf:li xml:lang="en">Tram</rdf:li></rdf:Alt></dc:title>`),
+			expected: Properties{{Name: PropertyTitle, Value: "Elétrico", Source: SourceXMP}},
+		},
+		{
+			name:     "ordered keywords",
+			xmp:      packet(`><dc:subject><rdf:Seq><rdf:li>b</rdf:li><rdf:li> </rdf:li><rdf:li>a</rdf:li></rdf:Seq></dc:subject>`),
+			expected: Properties{{Name: PropertyKeyword, Value: "b", Source: SourceXMP}, {Name: PropertyKeyword, Value: "a", Source: SourceXMP}},
+		},
+		{
+			name: "empty",
+			xmp:  packet(`>`),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			properties, err := ParseXMP(strings.NewReader(test.xmp), SourceXMP)
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, properties)
+		})
+	}
+}
+
+func TestParseXMPRejectsInvalidXML(t *testing.T) {
+	_, err := ParseXMP(strings.NewReader(`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF>`), SourceSidecar)
+
+	assert.Error(t, err)
+}
+
+func TestParseXMPRejectsLargeFiles(t *testing.T) {
+	_, err := ParseXMP(strings.NewReader(strings.Repeat(" ", MaxXMPSize+1)), SourceSidecar)
+
+	assert.Error(t, err)
+}
@@ -1,6 +1,10 @@
 package model
 
-import "github.com/ilikeorangutans/phts/db"
+import (
+	"time"
+
+	"github.com/ilikeorangutans/phts/db"
+)
 
 // Collection is a single database level record of a collection.
 type Collection struct {
@@ -9,4 +13,8 @@ type Collection struct {
 	db.Sluggable
 	Name       string `db:"name" json:"name"`
 	PhotoCount int    `db:"photo_count" json:"photoCount"`
+	// DeletedAt is when the collection was moved to the trash, nil unless it is trashed.
+	DeletedAt *time.Time `db:"deleted_at" json:"deletedAt"`
+	// Role is the role of the user the collection was looked up for, empty if it was not looked up for a user.
+	Role Role `db:"role" json:"role,omitempty"`
 }
@@ -0,0 +1,226 @@
+package model
+
+import (
+	"context"
+	godb "database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Role is what a member of a collection may do with it.
+type Role string
+
+const (
+	// RoleViewer may look at everything in the collection.
+	RoleViewer Role = "viewer"
+	// RoleEditor may also upload, change and delete photos, edit albums and share photos.
+	RoleEditor Role = "editor"
+	// RoleOwner may also change and delete the collection, its rendition configurations and its members.
+	RoleOwner Role = "owner"
+)
+
+// roleRanks orders roles by what they allow.
+var roleRanks = map[Role]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Valid returns whether this is one of the known roles.
+func (r Role) Valid() bool {
+	_, ok := roleRanks[r]
+	return ok
+}
+
+// Allows returns whether this role may do everything the given role may.
+func (r Role) Allows(required Role) bool {
+	return r.Valid() && roleRanks[r] >= roleRanks[required]
+}
+
+var (
+	// ErrAlreadyMember is returned when adding a user that is already a member of the collection.
+	ErrAlreadyMember = errors.New("user is already a member of the collection")
+	// ErrNotMember is returned when changing or removing a user that is not a member of the collection.
+	ErrNotMember = errors.New("user is not a member of the collection")
+	// ErrLastOwner is returned when a change would leave the collection without an owner.
+	ErrLastOwner = errors.New("collection must keep at least one owner")
+)
+
+// CollectionMember is a user with access to a collection.
+type CollectionMember struct {
+	db.Timestamps
+	UserID int64  `db:"user_id" json:"userID"`
+	Email  string `db:"email" json:"email"`
+	Name   string `db:"name" json:"name"`
+	Role   Role   `db:"role" json:"role"`
+}
+
+func NewCollectionMemberRepo() *CollectionMemberRepo {
+	return &CollectionMemberRepo{
+		clock: time.Now,
+		stmt:  sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// CollectionMemberRepo manages who has access to collections and in which role.
+type CollectionMemberRepo struct {
+	clock func() time.Time
+	stmt  sq.StatementBuilderType
+}
+
+// List lists the members of the collection, owners first.
+func (c *CollectionMemberRepo) List(ctx context.Context, tx sqlx.QueryerContext, collection Collection) ([]CollectionMember, error) {
+	sql, args, err := c.stmt.
+		Select("uc.user_id", "u.email", "u.name", "uc.role", "uc.created_at", "uc.updated_at").
+		From("users_collections uc").
+		Join("users u on (u.id = uc.user_id)").
+		Where(sq.Eq{"uc.collection_id": collection.ID}).
+		OrderBy("case uc.role when 'owner' then 0 when 'editor' then 1 else 2 end", "lower(u.email)").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	members := []CollectionMember{}
+	if err := sqlx.SelectContext(ctx, tx, &members, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return members, nil
+}
+
+// Add makes the user a member of the collection with the given role. Returns ErrAlreadyMember if they already are.
+func (c *CollectionMemberRepo) Add(ctx context.Context, tx sqlx.QueryerContext, collection Collection, user User, role Role) (CollectionMember, error) {
+	if !role.Valid() {
+		return CollectionMember{}, errors.Errorf("unknown role %q", role)
+	}
+	member := CollectionMember{
+		Timestamps: db.JustCreated(c.clock),
+		UserID:     user.ID,
+		Email:      user.Email,
+		Name:       user.Name,
+		Role:       role,
+	}
+
+	sql, args, err := c.stmt.
+		Insert("users_collections").
+		Columns("user_id", "collection_id", "role", "created_at", "updated_at").
+		Values(member.UserID, collection.ID, member.Role, member.CreatedAt, member.UpdatedAt).
+		Suffix("on conflict do nothing returning user_id").
+		ToSql()
+	if err != nil {
+		return member, errors.Wrap(err, "could not build query")
+	}
+
+	var userID int64
+	err = tx.QueryRowxContext(ctx, sql, args...).Scan(&userID)
+	if err == godb.ErrNoRows {
+		return member, ErrAlreadyMember
+	} else if err != nil {
+		return member, errors.Wrap(err, "could not add member")
+	}
+	return member, nil
+}
+
+// ChangeRole changes the role of the member with the given user id. Returns ErrNotMember if the user is not a member
+// of the collection, or ErrLastOwner if they are its only owner.
+func (c *CollectionMemberRepo) ChangeRole(ctx context.Context, tx sqlx.ExtContext, collection Collection, userID int64, role Role) (CollectionMember, error) {
+	if !role.Valid() {
+		return CollectionMember{}, errors.Errorf("unknown role %q", role)
+	}
+	if role != RoleOwner {
+		if err := c.checkOtherOwner(ctx, tx, collection, userID); err != nil {
+			return CollectionMember{}, err
+		}
+	}
+
+	sql, args, err := c.stmt.
+		Update("users_collections").
+		Set("role", role).
+		Set("updated_at", c.clock().UTC()).
+		Where(sq.Eq{"collection_id": collection.ID, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		return CollectionMember{}, errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return CollectionMember{}, errors.Wrap(err, "could not change role")
+	}
+	if err := expectRowsAffected(result, 1, ErrNotMember); err != nil {
+		return CollectionMember{}, err
+	}
+	return c.find(ctx, tx, collection, userID)
+}
+
+// Remove takes access to the collection away from the user with the given id. Returns ErrNotMember if the user is
+// not a member of the collection, or ErrLastOwner if they are its only owner.
+func (c *CollectionMemberRepo) Remove(ctx context.Context, tx sqlx.ExtContext, collection Collection, userID int64) error {
+	if err := c.checkOtherOwner(ctx, tx, collection, userID); err != nil {
+		return err
+	}
+
+	sql, args, err := c.stmt.
+		Delete("users_collections").
+		Where(sq.Eq{"collection_id": collection.ID, "user_id": userID}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not remove member")
+	}
+	return expectRowsAffected(result, 1, ErrNotMember)
+}
+
+// checkOtherOwner returns ErrLastOwner unless the collection has an owner besides the user with the given id. The
+// owners are locked so concurrent changes cannot demote all of them.
+func (c *CollectionMemberRepo) checkOtherOwner(ctx context.Context, tx sqlx.QueryerContext, collection Collection, userID int64) error {
+	sql, args, err := c.stmt.
+		Select("user_id").
+		From("users_collections").
+		Where(sq.Eq{"collection_id": collection.ID, "role": RoleOwner}).
+		Suffix("for update").
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+
+	var owners []int64
+	if err := sqlx.SelectContext(ctx, tx, &owners, sql, args...); err != nil {
+		return errors.Wrap(err, "could not select owners")
+	}
+	isOwner := false
+	for _, owner := range owners {
+		if owner != userID {
+			return nil
+		}
+		isOwner = true
+	}
+	if isOwner {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func (c *CollectionMemberRepo) find(ctx context.Context, tx sqlx.QueryerContext, collection Collection, userID int64) (CollectionMember, error) {
+	sql, args, err := c.stmt.
+		Select("uc.user_id", "u.email", "u.name", "uc.role", "uc.created_at", "uc.updated_at").
+		From("users_collections uc").
+		Join("users u on (u.id = uc.user_id)").
+		Where(sq.Eq{"uc.collection_id": collection.ID, "uc.user_id": userID}).
+		ToSql()
+	if err != nil {
+		return CollectionMember{}, errors.Wrap(err, "could not build query")
+	}
+
+	var member CollectionMember
+	if err := sqlx.GetContext(ctx, tx, &member, sql, args...); err != nil {
+		return member, errors.Wrap(err, "could not select member")
+	}
+	return member, nil
+}
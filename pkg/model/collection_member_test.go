@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, RoleOwner.Allows(RoleEditor))
+	assert.True(t, RoleEditor.Allows(RoleEditor))
+	assert.True(t, RoleViewer.Allows(RoleViewer))
+	assert.False(t, RoleViewer.Allows(RoleEditor))
+	assert.False(t, RoleEditor.Allows(RoleOwner))
+	assert.False(t, Role("").Allows(RoleViewer))
+}
+
+func TestAddMemberTwice(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		repo := NewCollectionMemberRepo()
+		repo.clock = func() time.Time { return now }
+
+		mock.ExpectQuery("INSERT INTO users_collections \\(user_id,collection_id,role,created_at,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5\\) on conflict do nothing returning user_id").
+			WithArgs(5, 3, "editor", now, now).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+
+		_, err := repo.Add(ctx, dbx, Collection{Record: db.Record{ID: 3}}, User{Record: db.Record{ID: 5}}, RoleEditor)
+
+		assert.Equal(t, ErrAlreadyMember, err)
+	})
+}
+
+func TestRemoveLastOwner(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT user_id FROM users_collections WHERE collection_id = \\$1 AND role = \\$2 for update").
+			WithArgs(3, "owner").
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5))
+
+		err := NewCollectionMemberRepo().Remove(ctx, dbx, Collection{Record: db.Record{ID: 3}}, 5)
+
+		assert.Equal(t, ErrLastOwner, err)
+	})
+}
+
+func TestChangeRoleWithAnotherOwner(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		repo := NewCollectionMemberRepo()
+		repo.clock = func() time.Time { return now }
+
+		mock.ExpectQuery("SELECT user_id FROM users_collections WHERE collection_id = \\$1 AND role = \\$2 for update").
+			WithArgs(3, "owner").
+			WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5).AddRow(6))
+		mock.ExpectExec("UPDATE users_collections SET role = \\$1, updated_at = \\$2 WHERE collection_id = \\$3 AND user_id = \\$4").
+			WithArgs("viewer", now.UTC(), 3, 5).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT uc.user_id, u.email, u.name, uc.role, uc.created_at, uc.updated_at FROM users_collections uc JOIN users u").
+			WithArgs(3, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"user_id", "email", "name", "role"}).AddRow(5, "jane@example.com", "Jane", "viewer"))
+
+		member, err := repo.ChangeRole(ctx, dbx, Collection{Record: db.Record{ID: 3}}, 5, RoleViewer)
+
+		assert.NoError(t, err)
+		assert.Equal(t, RoleViewer, member.Role)
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
 	"github.com/ilikeorangutans/phts/storage"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -26,15 +27,17 @@ type CollectionRepo struct {
 	stmt  sq.StatementBuilderType
 }
 
-// FindBySlugAndUser finds a collection with the given slug for the given user.
+// FindBySlugAndUser finds a collection with the given slug for the given user. The collection carries the role of the
+// user.
 func (c *CollectionRepo) FindBySlugAndUser(ctx context.Context, db sqlx.QueryerContext, slug string, user User) (Collection, error) {
 	var collection Collection
-	sql, args, err := c.stmt.Select("collections.*").
+	sql, args, err := c.stmt.Select("collections.*", "users_collections.role").
 		From("collections").
 		Join("users_collections on (users_collections.collection_id = collections.id)").
 		Where(sq.Eq{
 			"users_collections.user_id": user.ID,
 			"collections.slug":          slug,
+			"collections.deleted_at":    nil,
 		}).
 		Limit(1).
 		ToSql()
@@ -45,15 +48,17 @@ func (c *CollectionRepo) FindBySlugAndUser(ctx context.Context, db sqlx.QueryerC
 	return c.getCollection(ctx, db, sql, args...)
 }
 
-// FindByIDAndUser finds the collection with the given id for the specified user.
+// FindByIDAndUser finds the collection with the given id for the specified user. The collection carries the role of
+// the user.
 func (c *CollectionRepo) FindByIDAndUser(ctx context.Context, db sqlx.QueryerContext, id int64, user User) (Collection, error) {
 	var collection Collection
-	sql, args, err := c.stmt.Select("collections.*").
+	sql, args, err := c.stmt.Select("collections.*", "users_collections.role").
 		From("collections").
 		Join("users_collections on (users_collections.collection_id = collections.id)").
 		Where(sq.Eq{
 			"users_collections.user_id": user.ID,
 			"collections.id":            id,
+			"collections.deleted_at":    nil,
 		}).
 		Limit(1).
 		ToSql()
@@ -81,7 +86,8 @@ func (c *CollectionRepo) FindByID(ctx context.Context, db sqlx.QueryerContext, i
 		From("collections").
 		Join("users_collections on (users_collections.collection_id = collections.id)").
 		Where(sq.Eq{
-			"collections.id": id,
+			"collections.id":         id,
+			"collections.deleted_at": nil,
 		}).
 		Limit(1).
 		ToSql()
@@ -123,6 +129,7 @@ func (c *CollectionRepo) NewCollection(ctx context.Context, name, slug string, o
 		return collection, errors.Wrap(err, "could not commit transaction")
 	}
 
+	collection.Role = RoleOwner
 	return collection, nil
 }
 
@@ -130,8 +137,8 @@ func (c *CollectionRepo) NewCollection(ctx context.Context, name, slug string, o
 func (c *CollectionRepo) createOwner(ctx context.Context, tx sqlx.Ext, user User, collection Collection) error {
 	result, err := c.stmt.
 		Insert("users_collections").
-		Columns("user_id", "collection_id", "created_at", "updated_at").
-		Values(user.ID, collection.ID, collection.CreatedAt, collection.UpdatedAt).
+		Columns("user_id", "collection_id", "role", "created_at", "updated_at").
+		Values(user.ID, collection.ID, RoleOwner, collection.CreatedAt, collection.UpdatedAt).
 		RunWith(c.db).
 		ExecContext(ctx)
 	if err != nil {
@@ -168,7 +175,7 @@ func (c *CollectionRepo) Update(ctx context.Context, tx sqlx.Ext, collection Col
 	var photoCount = 0
 	c.stmt.Select("count(*)").
 		From("photos").
-		Where(sq.Eq{"collection_id": collection.ID}).
+		Where(sq.Eq{"collection_id": collection.ID, "deleted_at": nil}).
 		RunWith(tx).
 		ScanContext(ctx, &photoCount)
 
@@ -196,17 +203,20 @@ func (c *CollectionRepo) Update(ctx context.Context, tx sqlx.Ext, collection Col
 }
 
 // AddPhotos adds the given photos by adding entries for each photo and storing the binaries in the given backend.
-func (c *CollectionRepo) AddPhotos(ctx context.Context, dbx *sqlx.DB, storage storage.Backend, collection Collection, queue chan RenditionUpdateRequest, photoUploads ...PhotoUpload) (Collection, []Photo, error) {
+// Photos with a location are named using the given geocoder. A rendition job is enqueued for every photo in the same
+// transaction.
+func (c *CollectionRepo) AddPhotos(ctx context.Context, dbx *sqlx.DB, storage storage.Backend, geocoder geocode.Geocoder, collection Collection, photoUploads ...PhotoUpload) (Collection, []Photo, error) {
 	tx, err := dbx.BeginTxx(ctx, &sql.TxOptions{})
 	if err != nil {
 		return collection, nil, errors.Wrap(err, "could not start transaction")
 	}
 	photoRepo := NewPhotoRepo()
+	jobRepo := NewRenditionJobRepo()
 
 	var photos []Photo
 	var renditions []Rendition
 	for i, upload := range photoUploads {
-		photo, rendition, err := photoRepo.AddPhoto(ctx, tx, storage, collection, upload)
+		photo, rendition, err := photoRepo.AddPhoto(ctx, tx, storage, geocoder, collection, upload)
 		if err != nil {
 			tx.Rollback()
 			for _, rendition := range renditions {
@@ -215,6 +225,14 @@ func (c *CollectionRepo) AddPhotos(ctx context.Context, dbx *sqlx.DB, storage st
 			return collection, nil, errors.Wrapf(err, "could not add photo %d/%d", i+1, len(photoUploads))
 		}
 
+		if err := jobRepo.Enqueue(ctx, tx, photo.ID); err != nil {
+			tx.Rollback()
+			for _, rendition := range append(renditions, rendition) {
+				storage.Delete(rendition.ID)
+			}
+			return collection, nil, errors.Wrapf(err, "could not enqueue renditions for photo %d/%d", i+1, len(photoUploads))
+		}
+
 		photos = append(photos, photo)
 		renditions = append(renditions, rendition)
 	}
@@ -236,13 +254,24 @@ func (c *CollectionRepo) AddPhotos(ctx context.Context, dbx *sqlx.DB, storage st
 		return collection, nil, errors.Wrap(err, "could not commit transaction")
 	}
 
-	for _, photo := range photos {
-		// TODO this can block so this should probably go into a separate go routine.
-		queue <- RenditionUpdateRequest{
-			Photo: photo,
-			// TODO get return channel
-		}
+	return collection, photos, nil
+}
+
+// updatePhotoCounts recounts the photos of the collection and its albums, leaving out trashed photos.
+func updatePhotoCounts(ctx context.Context, tx sqlx.ExecerContext, collection Collection) error {
+	sql := "update collections set photo_count = (select count(*) from photos where collection_id = $1 and deleted_at is null) where id = $1"
+	if _, err := tx.ExecContext(ctx, sql, collection.ID); err != nil {
+		return errors.Wrap(err, "could not update photo count of collection")
 	}
 
-	return collection, photos, nil
+	sql = `
+	  update albums set photo_count = (
+	    select count(*) from album_photos ap join photos p on (p.id = ap.photo_id)
+	    where ap.album_id = albums.id and p.deleted_at is null
+	  ) where collection_id = $1
+	`
+	if _, err := tx.ExecContext(ctx, sql, collection.ID); err != nil {
+		return errors.Wrap(err, "could not update photo count of albums")
+	}
+	return nil
 }
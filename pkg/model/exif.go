@@ -0,0 +1,184 @@
+package model
+
+import (
+	"context"
+	"log"
+	"math"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+const (
+	// exifTagLength and exifStringLength are the lengths of the exif.tag, and the exif.string and exif.display
+	// columns.
+	exifTagLength    = 128
+	exifStringLength = 256
+)
+
+// InsertExifTags stores the given exif tags for the given photo. Values that do not fit the exif table are truncated.
+func (p *PhotoRepo) InsertExifTags(ctx context.Context, tx sqlx.ExecerContext, photo Photo, tags metadata.ExifTags) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	stmt := p.stmt.
+		Insert("exif").
+		Columns("photo_id", "value_type", "tag", "string", "num", "denom", "datetime", "floating", "value_list", "display", "created_at", "updated_at")
+	timestamps := db.JustCreated(p.clock)
+	for _, tag := range tags {
+		denominator := tag.Denominator
+		if denominator > math.MaxInt32 || denominator < math.MinInt32 {
+			// The denominator column is an integer; unsigned rationals can exceed it.
+			denominator = 0
+		}
+		stmt = stmt.Values(
+			photo.ID,
+			tag.Type,
+			sanitizeExifString(tag.Tag, exifTagLength),
+			sanitizeExifString(tag.StringValue, exifStringLength),
+			tag.Num,
+			denominator,
+			tag.DateTime,
+			tag.Floating,
+			tag.Values,
+			sanitizeExifString(tag.Display, exifStringLength),
+			timestamps.CreatedAt,
+			timestamps.UpdatedAt,
+		)
+	}
+
+	sql, args, err := stmt.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not insert exif tags")
+	}
+
+	return nil
+}
+
+// sanitizeExifString makes s safe to store in a varchar column of the given length. Exif strings are not guaranteed
+// to be valid UTF-8 and may contain NUL bytes, both of which postgres rejects.
+func sanitizeExifString(s string, length int) string {
+	s = strings.ToValidUTF8(strings.Replace(s, "\x00", "", -1), "")
+	if runes := []rune(s); len(runes) > length {
+		s = string(runes[:length])
+	}
+	return s
+}
+
+// FindExifForPhoto returns all exif tags stored for the given photo.
+func FindExifForPhoto(ctx context.Context, tx sqlx.QueryerContext, photo Photo) (metadata.ExifTags, error) {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("*").
+		From("exif").
+		Where(sq.Eq{"photo_id": photo.ID}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	var records []db.ExifRecord
+	if err := sqlx.SelectContext(ctx, tx, &records, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+
+	tags := metadata.ExifTags{}
+	for _, record := range records {
+		tags = append(tags, metadata.ExifTag{ExifRecord: record.ForDisplay()})
+	}
+	return tags, nil
+}
+
+// DeleteExifForPhoto deletes all exif tags stored for the given photo.
+func DeleteExifForPhoto(ctx context.Context, tx sqlx.ExecerContext, photo Photo) error {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete("exif").
+		Where(sq.Eq{"photo_id": photo.ID}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not delete exif tags")
+	}
+	return nil
+}
+
+// FindPhotosWithoutExif finds up to n photos with an id greater than afterID that have no exif tags stored, ordered
+// by id.
+func (p *PhotoRepo) FindPhotosWithoutExif(ctx context.Context, tx sqlx.QueryerContext, afterID int64, n uint64) ([]Photo, error) {
+	sql, args, err := p.stmt.
+		Select("photos.*").
+		From("photos").
+		Where(sq.Gt{"photos.id": afterID}).
+		Where("not exists (select 1 from exif where exif.photo_id = photos.id)").
+		OrderBy("photos.id").
+		Limit(n).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	var photos []Photo
+	if err := sqlx.SelectContext(ctx, tx, &photos, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return photos, nil
+}
+
+// BackfillExif extracts the exif tags from the original rendition of the given photo and stores them, replacing any
+// tags already stored. The photo's location is set and named with the given geocoder if the tags have one. Returns the
+// number of tags stored.
+func (p *PhotoRepo) BackfillExif(ctx context.Context, tx sqlx.ExtContext, backend storage.Backend, geocoder geocode.Geocoder, photo Photo) (int, error) {
+	original, err := FindOriginalRenditionByPhoto(ctx, tx, photo)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not find original rendition")
+	}
+
+	data, _, err := backend.Open(original.ID)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not open original binary")
+	}
+	defer data.Close()
+
+	var tags metadata.ExifTags
+	var location *metadata.Location
+	if e, err := exif.Decode(data); err != nil && exif.IsCriticalError(err) {
+		log.Printf("no exif tags for photo %d: %v", photo.ID, err)
+	} else {
+		tags = metadata.ExifTagsFromExif(e)
+		if location, err = metadata.LocationFromExif(e); err != nil {
+			log.Printf("could not get location of photo %d: %v", photo.ID, err)
+		}
+	}
+
+	if err := DeleteExifForPhoto(ctx, tx, photo); err != nil {
+		return 0, err
+	}
+	if err := p.InsertExifTags(ctx, tx, photo, tags); err != nil {
+		return 0, err
+	}
+
+	if location != nil {
+		photo.SetLocation(location)
+		photo.Geocode(geocoder)
+		if _, err := p.Update(ctx, tx, photo); err != nil {
+			return 0, errors.Wrap(err, "could not update location")
+		}
+	}
+
+	return len(tags), nil
+}
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/rwcarlsen/goexif/tiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertExifTags(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		repo.clock = func() time.Time { return now }
+		tags := metadata.ExifTags{
+			{ExifRecord: db.ExifRecord{Type: uint16(tiff.DTAscii), Tag: "Model", StringValue: "Cam\x00 1"}},
+			{ExifRecord: db.ExifRecord{Type: uint16(tiff.DTRational), Tag: "FNumber", Num: 28, Denominator: 10, Floating: 2.8, Display: "f/2.8"}},
+			{ExifRecord: db.ExifRecord{Type: uint16(tiff.DTRational), Tag: "ExposureTime", Num: 1, Denominator: 1 << 32}},
+			{ExifRecord: db.ExifRecord{Type: uint16(tiff.DTShort), Tag: "SubjectArea", Num: 10, Values: db.ExifValues{{Num: 10}, {Num: 20}}}},
+		}
+
+		mock.ExpectExec("INSERT INTO exif \\(photo_id,value_type,tag,string,num,denom,datetime,floating,value_list,display,created_at,updated_at\\) VALUES").
+			WithArgs(
+				13, uint16(tiff.DTAscii), "Model", "Cam 1", 0, 0, nil, 0.0, nil, "", now, now,
+				13, uint16(tiff.DTRational), "FNumber", "", 28, 10, nil, 2.8, nil, "f/2.8", now, now,
+				13, uint16(tiff.DTRational), "ExposureTime", "", 1, 0, nil, 0.0, nil, "", now, now,
+				13, uint16(tiff.DTShort), "SubjectArea", "", 10, 0, nil, 0.0, `[{"number":10},{"number":20}]`, "", now, now,
+			).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+
+		err := repo.InsertExifTags(context.Background(), dbx, Photo{Record: db.Record{ID: 13}}, tags)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestInsertExifTagsWithoutTags(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		err := repo.InsertExifTags(context.Background(), dbx, Photo{Record: db.Record{ID: 13}}, nil)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestSanitizeExifString(t *testing.T) {
+	assert.Equal(t, "Cam 1", sanitizeExifString("Cam\x00 1\xff", 10))
+	assert.Equal(t, "Ünïcode", sanitizeExifString("Ünïcode and more", 7))
+	assert.Equal(t, exifStringLength, len(sanitizeExifString(strings.Repeat("a", 300), exifStringLength)))
+}
+
+func TestFindExifForPhoto(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT \\* FROM exif WHERE photo_id = \\$1 ORDER BY id").
+			WithArgs(13).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "photo_id", "value_type", "tag", "string", "num", "denom", "value_list", "display"}).
+				AddRow(1, 13, tiff.DTAscii, "Model", "Cam 1", 0, 0, nil, "").
+				AddRow(2, 13, tiff.DTRational, "FNumber", "", 28, 10, nil, "").
+				AddRow(3, 13, tiff.DTRational, "ExposureTime", "", 1, 250, nil, "1/250 s").
+				AddRow(4, 13, tiff.DTShort, "SubjectArea", "", 10, 0, []byte(`[{"number":10},{"number":20}]`), ""))
+
+		tags, err := FindExifForPhoto(ctx, dbx, Photo{Record: db.Record{ID: 13}})
+
+		assert.NoError(t, err)
+		assert.Len(t, tags, 4)
+		assert.Equal(t, "Cam 1", tags[0].StringValue)
+		assert.Equal(t, "ascii", tags[0].TypeName)
+		assert.Equal(t, "28/10", tags[1].StringValue)
+		assert.Equal(t, "rational", tags[1].TypeName)
+		assert.Equal(t, "1/250 s", tags[2].StringValue)
+		assert.Equal(t, db.ExifValues{{Num: 10}, {Num: 20}}, tags[3].Values)
+		assert.Equal(t, "10, 20", tags[3].StringValue)
+	})
+}
+
+func TestBackfillExif(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		data, err := ioutil.ReadFile("../images/testdata/gps.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir, err := ioutil.TempDir("", "phts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		backend := storage.NewFileBackend(dir)
+		if err := backend.Put(101, strings.NewReader(string(data)), int64(len(data)), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectQuery("SELECT \\* FROM renditions WHERE original = \\$1 AND photo_id = \\$2").
+			WithArgs(true, 13).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "photo_id", "original"}).AddRow(101, 13, true))
+		mock.ExpectExec("DELETE FROM exif WHERE photo_id = \\$1").
+			WithArgs(13).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO exif .* VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5,\\$6,\\$7,\\$8,\\$9,\\$10,\\$11,\\$12\\),").
+			WillReturnResult(sqlmock.NewResult(0, 10))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM renditions WHERE photo_id = \\$1").
+			WithArgs(13).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectExec("UPDATE photos SET .* latitude = \\$11, longitude = \\$12, altitude = \\$13, direction = \\$14, .* WHERE id = \\$19").
+			WithArgs(sqlmock.AnyArg(), 0, 1, "", "", "", nil, false, nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil, "", "", "", "", 13).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		count, err := repo.BackfillExif(context.Background(), dbx, backend, geocode.None, Photo{Record: db.Record{ID: 13}})
+
+		assert.NoError(t, err)
+		assert.True(t, count > 5, "expected tags from the fixture, got %d", count)
+	})
+}
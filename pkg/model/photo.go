@@ -4,6 +4,9 @@ import (
 	"time"
 
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
 )
 
 type Photo struct {
@@ -13,7 +16,88 @@ type Photo struct {
 	CollectionID   int64      `db:"collection_id" json:"collectionID"`
 	RenditionCount int        `db:"rendition_count" json:"renditionCount"`
 	Description    string     `db:"description" json:"description"`
+	Title          string     `db:"title" json:"title"`
+	Copyright      string     `db:"copyright" json:"copyright"`
 	Filename       string     `db:"filename" json:"filename"`
 	TakenAt        *time.Time `db:"taken_at" json:"takenAt"`
-	Published      bool       `db:"published" json:"published"`
+	// TakenAtOffset is the offset from UTC in seconds of the zone TakenAt is the local time in, nil if it is unknown.
+	TakenAtOffset *int `db:"taken_at_offset" json:"takenAtOffset"`
+	Published     bool `db:"published" json:"published"`
+	// FocalX and FocalY are the point of interest as fractions of the photo's width and height. Fill renditions are
+	// cropped around it.
+	FocalX *float64 `db:"focal_x" json:"focalX"`
+	FocalY *float64 `db:"focal_y" json:"focalY"`
+	// Latitude and Longitude are where the photo was taken in decimal degrees, taken from its GPS exif tags.
+	Latitude  *float64 `db:"latitude" json:"latitude"`
+	Longitude *float64 `db:"longitude" json:"longitude"`
+	// Altitude is in meters above sea level.
+	Altitude *float64 `db:"altitude" json:"altitude"`
+	// Direction is the direction the camera was pointing in degrees clockwise from north.
+	Direction *float64 `db:"direction" json:"direction"`
+	// City, Region, Country and CountryCode name the place closest to the photo's location.
+	City        string `db:"city" json:"city"`
+	Region      string `db:"region" json:"region"`
+	Country     string `db:"country" json:"country"`
+	CountryCode string `db:"country_code" json:"countryCode"`
+	// DeletedAt is when the photo was moved to the trash, nil unless it is trashed.
+	DeletedAt *time.Time `db:"deleted_at" json:"deletedAt"`
+}
+
+// SetLocation sets the photo's location, given nil it clears it.
+func (p *Photo) SetLocation(location *metadata.Location) {
+	p.Latitude, p.Longitude, p.Altitude, p.Direction = nil, nil, nil, nil
+	if location == nil {
+		return
+	}
+	latitude, longitude := location.Latitude, location.Longitude
+	p.Latitude, p.Longitude = &latitude, &longitude
+	p.Altitude, p.Direction = location.Altitude, location.Direction
+}
+
+// SetPlace sets the names of the place the photo was taken in, given nil it clears them.
+func (p *Photo) SetPlace(place *geocode.Place) {
+	p.City, p.Region, p.Country, p.CountryCode = "", "", "", ""
+	if place == nil {
+		return
+	}
+	p.City, p.Region, p.Country, p.CountryCode = place.City, place.Region, place.Country, place.CountryCode
+}
+
+// Geocode sets the names of the place closest to the photo's location, or clears them if the photo has no location or
+// there's no place close to it. Returns whether a place was found.
+func (p *Photo) Geocode(geocoder geocode.Geocoder) bool {
+	if p.Latitude == nil || p.Longitude == nil {
+		p.SetPlace(nil)
+		return false
+	}
+
+	place, found := geocoder.ReverseGeocode(*p.Latitude, *p.Longitude)
+	if !found {
+		p.SetPlace(nil)
+		return false
+	}
+	p.SetPlace(&place)
+	return true
+}
+
+// ApplyProperties sets the photo's title, description and copyright to the values from the most trusted source. Values
+// missing from all sources are left alone.
+func (p *Photo) ApplyProperties(properties metadata.Properties) {
+	if title := properties.Value(metadata.PropertyTitle); title != "" {
+		p.Title = title
+	}
+	if description := properties.Value(metadata.PropertyDescription); description != "" {
+		p.Description = description
+	}
+	if copyright := properties.Value(metadata.PropertyCopyright); copyright != "" {
+		p.Copyright = copyright
+	}
+}
+
+// FocalPoint returns the photo's focal point, or the center if it has none.
+func (p Photo) FocalPoint() images.FocalPoint {
+	if p.FocalX == nil || p.FocalY == nil {
+		return images.CenterFocalPoint
+	}
+	return images.FocalPoint{X: *p.FocalX, Y: *p.FocalY}
 }
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"context"
+	godb "database/sql"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// MaxDescriptionLength is the length of the longest photo description in characters.
+const MaxDescriptionLength = 10000
+
+// ErrPhotoModified is returned when a photo was updated since the client read it.
+var ErrPhotoModified = errors.New("photo was modified")
+
+// PhotoChange is a change to the editable fields of a photo. Nil fields are left as they are.
+type PhotoChange struct {
+	Description *string
+	// TakenAt overrides when the photo was taken. Like times read from exif tags it is stored as the local time in its
+	// zone, the offset of the zone is stored next to it.
+	TakenAt   *time.Time
+	Published *bool
+}
+
+// Empty returns whether this change leaves photos as they are.
+func (c PhotoChange) Empty() bool {
+	return c.Description == nil && c.TakenAt == nil && c.Published == nil
+}
+
+// Validate checks the values of this change.
+func (c PhotoChange) Validate() error {
+	if c.Description != nil && len([]rune(*c.Description)) > MaxDescriptionLength {
+		return fmt.Errorf("description is longer than %d characters", MaxDescriptionLength)
+	}
+	return nil
+}
+
+// localTime returns the local time of t as a time in UTC, and the offset of its zone in seconds. Postgres keeps the
+// local time without its zone, the time clients get back must be the one they read later.
+func localTime(t time.Time) (time.Time, int) {
+	_, offset := t.Zone()
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).
+		Truncate(time.Microsecond), offset
+}
+
+func (c PhotoChange) apply(photo *Photo) {
+	if c.Description != nil {
+		photo.Description = *c.Description
+	}
+	if c.TakenAt != nil {
+		takenAt, offset := localTime(*c.TakenAt)
+		photo.TakenAt, photo.TakenAtOffset = &takenAt, &offset
+	}
+	if c.Published != nil {
+		photo.Published = *c.Published
+	}
+}
+
+// Change applies the change to the photo with the given id in the collection, if the photo was last updated at
+// updatedAt. Otherwise returns ErrPhotoModified and the photo as it is now, so clients can show what changed. Returns
+// ErrPhotoNotInCollection if there is no such photo.
+func (p *PhotoRepo) Change(ctx context.Context, tx sqlx.ExtContext, collection Collection, id int64, updatedAt time.Time, change PhotoChange) (Photo, error) {
+	photo, err := p.FindInCollection(ctx, tx, collection, id)
+	if errors.Is(err, godb.ErrNoRows) {
+		return photo, ErrPhotoNotInCollection
+	} else if err != nil {
+		return photo, err
+	}
+	if !photo.UpdatedAt.Equal(updatedAt) {
+		return photo, ErrPhotoModified
+	}
+
+	previous := photo.UpdatedAt
+	change.apply(&photo)
+	// Postgres keeps microseconds, the time clients get back must be the one they can send again.
+	photo.UpdatedAt = p.clock().UTC().Truncate(time.Microsecond)
+
+	sql, args, err := p.stmt.Update("photos").
+		Set("updated_at", photo.UpdatedAt).
+		Set("description", photo.Description).
+		Set("taken_at", photo.TakenAt).
+		Set("taken_at_offset", photo.TakenAtOffset).
+		Set("published", photo.Published).
+		Where(sq.Eq{"id": photo.ID, "updated_at": previous}).
+		ToSql()
+	if err != nil {
+		return photo, errors.Wrap(err, "could not build query")
+	}
+
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return photo, errors.Wrap(err, "could not update photo")
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return photo, errors.Wrap(err, "could not get number of affected rows")
+	} else if rowsAffected == 0 {
+		// Someone else updated the photo between reading and writing it.
+		current, err := p.FindInCollection(ctx, tx, collection, id)
+		if err != nil {
+			return photo, err
+		}
+		return current, ErrPhotoModified
+	}
+	return photo, nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"context"
+	godb "database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangePhoto(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		repo.clock = func() time.Time { return now }
+		updatedAt := time.Date(2020, 3, 1, 10, 0, 0, 123456000, time.UTC)
+		takenAt := time.Date(2019, 7, 14, 18, 30, 0, 0, time.FixedZone("", 2*60*60))
+		// Stored as the local time, the offset goes into its own column.
+		localTakenAt := time.Date(2019, 7, 14, 18, 30, 0, 0, time.UTC)
+		description := "Sunset over the river"
+		published := true
+
+		mock.ExpectQuery("SELECT \\* FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND id = \\$2 LIMIT 1").
+			WithArgs(3, 42).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "description", "published", "updated_at"}).AddRow(42, 3, "", false, updatedAt))
+		mock.ExpectExec("UPDATE photos SET updated_at = \\$1, description = \\$2, taken_at = \\$3, taken_at_offset = \\$4, published = \\$5 WHERE id = \\$6 AND updated_at = \\$7").
+			WithArgs(now.UTC().Truncate(time.Microsecond), description, localTakenAt, 2*60*60, true, 42, updatedAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photo, err := repo.Change(context.Background(), dbx, Collection{Record: db.Record{ID: 3}}, 42, updatedAt, PhotoChange{Description: &description, TakenAt: &takenAt, Published: &published})
+
+		assert.NoError(t, err)
+		assert.Equal(t, description, photo.Description)
+		assert.Equal(t, localTakenAt, *photo.TakenAt)
+		assert.Equal(t, 2*60*60, *photo.TakenAtOffset)
+		assert.True(t, photo.Published)
+		assert.Equal(t, now.UTC().Truncate(time.Microsecond), photo.UpdatedAt)
+	})
+}
+
+func TestChangePhotoKeepsFieldsNotChanged(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		updatedAt := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+		published := false
+
+		mock.ExpectQuery("SELECT \\* FROM photos").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "description", "published", "updated_at"}).AddRow(42, 3, "old", true, updatedAt))
+		mock.ExpectExec("UPDATE photos").
+			WithArgs(sqlmock.AnyArg(), "old", nil, nil, false, 42, updatedAt).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photo, err := repo.Change(context.Background(), dbx, Collection{Record: db.Record{ID: 3}}, 42, updatedAt, PhotoChange{Published: &published})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "old", photo.Description)
+		assert.False(t, photo.Published)
+	})
+}
+
+func TestChangePhotoModifiedSinceRead(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		updatedAt := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+		description := "mine"
+
+		mock.ExpectQuery("SELECT \\* FROM photos").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "description", "updated_at"}).AddRow(42, 3, "theirs", updatedAt.Add(time.Second)))
+
+		photo, err := repo.Change(context.Background(), dbx, Collection{Record: db.Record{ID: 3}}, 42, updatedAt, PhotoChange{Description: &description})
+
+		assert.Equal(t, ErrPhotoModified, err)
+		assert.Equal(t, "theirs", photo.Description)
+	})
+}
+
+func TestChangePhotoModifiedWhileWriting(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		updatedAt := time.Date(2020, 3, 1, 10, 0, 0, 0, time.UTC)
+		description := "mine"
+
+		mock.ExpectQuery("SELECT \\* FROM photos").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "description", "updated_at"}).AddRow(42, 3, "", updatedAt))
+		mock.ExpectExec("UPDATE photos").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT \\* FROM photos").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "description", "updated_at"}).AddRow(42, 3, "theirs", updatedAt.Add(time.Second)))
+
+		photo, err := repo.Change(context.Background(), dbx, Collection{Record: db.Record{ID: 3}}, 42, updatedAt, PhotoChange{Description: &description})
+
+		assert.Equal(t, ErrPhotoModified, err)
+		assert.Equal(t, "theirs", photo.Description)
+	})
+}
+
+func TestChangePhotoNotInCollection(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		mock.ExpectQuery("SELECT \\* FROM photos").WillReturnError(godb.ErrNoRows)
+
+		_, err := repo.Change(context.Background(), dbx, Collection{Record: db.Record{ID: 3}}, 42, now, PhotoChange{})
+
+		assert.Equal(t, ErrPhotoNotInCollection, err)
+	})
+}
+
+func TestPhotoChangeValidate(t *testing.T) {
+	long := strings.Repeat("ä", MaxDescriptionLength+1)
+	short := strings.Repeat("ä", MaxDescriptionLength)
+
+	assert.Error(t, PhotoChange{Description: &long}.Validate())
+	assert.NoError(t, PhotoChange{Description: &short}.Validate())
+	assert.True(t, PhotoChange{}.Empty())
+	assert.False(t, PhotoChange{Description: &short}.Empty())
+}
@@ -0,0 +1,212 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MaxClusterZoom is the highest zoom level photos are clustered at, at that level cells are a few meters wide.
+	MaxClusterZoom = 22
+	// clusterCellsPerTile is how many cells a map tile is split into along each axis when clustering.
+	clusterCellsPerTile = 4
+)
+
+// BoundingBox is an area on the globe in decimal degrees. If West is greater than East the box crosses the
+// antimeridian.
+type BoundingBox struct {
+	North float64 `json:"north"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	West  float64 `json:"west"`
+}
+
+// Validate checks that the box is on the globe and its north edge is not below its south edge.
+func (b BoundingBox) Validate() error {
+	for _, latitude := range []float64{b.North, b.South} {
+		if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+			return fmt.Errorf("latitude %f is outside [-90, 90]", latitude)
+		}
+	}
+	for _, longitude := range []float64{b.East, b.West} {
+		if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+			return fmt.Errorf("longitude %f is outside [-180, 180]", longitude)
+		}
+	}
+	if b.South > b.North {
+		return fmt.Errorf("south %f is north of north %f", b.South, b.North)
+	}
+	return nil
+}
+
+// where returns the condition for photos inside the box.
+func (b BoundingBox) where() sq.Sqlizer {
+	longitude := sq.Sqlizer(sq.And{sq.GtOrEq{"longitude": b.West}, sq.LtOrEq{"longitude": b.East}})
+	if b.West > b.East {
+		longitude = sq.Or{sq.GtOrEq{"longitude": b.West}, sq.LtOrEq{"longitude": b.East}}
+	}
+	return sq.And{
+		sq.GtOrEq{"latitude": b.South},
+		sq.LtOrEq{"latitude": b.North},
+		longitude,
+	}
+}
+
+// LocationCluster is a group of photos taken close to each other.
+type LocationCluster struct {
+	// Count is the number of photos in the cluster.
+	Count int `json:"count"`
+	// Latitude and Longitude are the average location of the photos in the cluster.
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	// Bounds is the smallest box containing all photos in the cluster.
+	Bounds BoundingBox `json:"bounds"`
+	// PhotoID is one of the photos in the cluster, e.g. to show as a thumbnail.
+	PhotoID int64 `json:"photoID"`
+}
+
+// ClusterCellSize returns the width and height in degrees of the grid cells photos are clustered into at the given
+// zoom level. At zoom 0 the globe is a single map tile, every zoom level halves the size of tiles.
+func ClusterCellSize(zoom int) float64 {
+	return 360 / (math.Pow(2, float64(zoom)) * clusterCellsPerTile)
+}
+
+// ListInBoundingBox lists the photos in the given collection taken inside the given box.
+func (p *PhotoRepo) ListInBoundingBox(ctx context.Context, dbx sqlx.QueryerContext, collection Collection, box BoundingBox, filter db.PhotoFilter, paginator database.Paginator) ([]Photo, database.Paginator, error) {
+	if err := box.Validate(); err != nil {
+		return nil, paginator, err
+	}
+
+	stmt := p.stmt.
+		Select("*").
+		From("photos").
+		Where(sq.Eq{"collection_id": collection.ID, "deleted_at": nil}).
+		Where(box.where())
+	stmt = filter.Filter(stmt, "photos")
+
+	sql, args, err := filter.Paginate(stmt, "photos", paginator).ToSql()
+	if err != nil {
+		return nil, paginator, errors.Wrap(err, "could not build query")
+	}
+
+	photos := []Photo{}
+	if err := sqlx.SelectContext(ctx, dbx, &photos, sql, args...); err != nil {
+		return nil, paginator, errors.Wrap(err, "could not select rows")
+	}
+
+	return photos, paginator, nil
+}
+
+// ClusterInBoundingBox groups the photos in the given collection taken inside the given box into grid cells sized
+// for the given zoom level. Cells are squares in degrees, so they get narrower towards the poles on a map. Returns the
+// clusters, largest first.
+func (p *PhotoRepo) ClusterInBoundingBox(ctx context.Context, dbx sqlx.QueryerContext, collection Collection, box BoundingBox, filter db.PhotoFilter, zoom int) ([]LocationCluster, error) {
+	if err := box.Validate(); err != nil {
+		return nil, err
+	}
+	if zoom < 0 || zoom > MaxClusterZoom {
+		return nil, fmt.Errorf("zoom %d is outside [0, %d]", zoom, MaxClusterZoom)
+	}
+	cellSize := ClusterCellSize(zoom)
+
+	stmt := p.stmt.
+		Select().
+		Column(sq.Expr("floor(longitude / ?) as cell_x", cellSize)).
+		Column(sq.Expr("floor(latitude / ?) as cell_y", cellSize)).
+		Column("count(*) as count").
+		Column("avg(latitude) as latitude").
+		Column("avg(longitude) as longitude").
+		Column("max(latitude) as north").
+		Column("min(latitude) as south").
+		Column("max(longitude) as east").
+		Column("min(longitude) as west").
+		Column("min(id) as photo_id").
+		From("photos").
+		Where(sq.Eq{"collection_id": collection.ID, "deleted_at": nil}).
+		Where(box.where())
+	sql, args, err := filter.Filter(stmt, "photos").
+		GroupBy("cell_x", "cell_y").
+		OrderBy("count desc", "cell_x", "cell_y").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	rows, err := dbx.QueryxContext(ctx, sql, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not run query")
+	}
+	defer rows.Close()
+
+	clusters := []LocationCluster{}
+	for rows.Next() {
+		var cellX, cellY float64
+		var cluster LocationCluster
+		err := rows.Scan(
+			&cellX,
+			&cellY,
+			&cluster.Count,
+			&cluster.Latitude,
+			&cluster.Longitude,
+			&cluster.Bounds.North,
+			&cluster.Bounds.South,
+			&cluster.Bounds.East,
+			&cluster.Bounds.West,
+			&cluster.PhotoID,
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not scan row")
+		}
+		clusters = append(clusters, cluster)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "could not read rows")
+	}
+
+	return clusters, nil
+}
+
+// FindPhotosWithoutPlace finds up to n photos with an id greater than afterID that have a location but no place names,
+// ordered by id.
+func (p *PhotoRepo) FindPhotosWithoutPlace(ctx context.Context, dbx sqlx.QueryerContext, afterID int64, n uint64) ([]Photo, error) {
+	sql, args, err := p.stmt.
+		Select("*").
+		From("photos").
+		Where(sq.Gt{"id": afterID}).
+		Where(sq.NotEq{"latitude": nil, "longitude": nil}).
+		Where(sq.Eq{"country_code": ""}).
+		OrderBy("id").
+		Limit(n).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	var photos []Photo
+	if err := sqlx.SelectContext(ctx, dbx, &photos, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return photos, nil
+}
+
+// GeocodePhoto names the place the given photo was taken in using the given geocoder. Returns whether a place was
+// found; the photo is only updated if one was.
+func (p *PhotoRepo) GeocodePhoto(ctx context.Context, tx sqlx.ExtContext, geocoder geocode.Geocoder, photo Photo) (Photo, bool, error) {
+	if !photo.Geocode(geocoder) {
+		return photo, false, nil
+	}
+
+	photo, err := p.Update(ctx, tx, photo)
+	if err != nil {
+		return photo, false, errors.Wrap(err, "could not update photo")
+	}
+	return photo, true, nil
+}
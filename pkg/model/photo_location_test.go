@@ -0,0 +1,96 @@
+package model
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundingBoxValidate(t *testing.T) {
+	assert.NoError(t, BoundingBox{North: 90, South: -90, East: 180, West: -180}.Validate())
+	assert.NoError(t, BoundingBox{North: 1, South: 0, East: -170, West: 170}.Validate())
+	assert.Error(t, BoundingBox{North: 0, South: 1}.Validate())
+	assert.Error(t, BoundingBox{North: 91}.Validate())
+	assert.Error(t, BoundingBox{East: 181}.Validate())
+	assert.Error(t, BoundingBox{West: math.NaN()}.Validate())
+}
+
+func TestListInBoundingBox(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT \\* FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND \\(latitude >= \\$2 AND latitude <= \\$3 AND \\(longitude >= \\$4 AND longitude <= \\$5\\)\\) ORDER BY updated_at DESC, id DESC LIMIT 10").
+			WithArgs(3, 43.0, 44.0, -80.0, -79.0).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "latitude", "longitude"}).AddRow(13, 3, 43.65, -79.38))
+
+		photos, _, err := NewPhotoRepo().ListInBoundingBox(ctx, dbx, Collection{Record: db.Record{ID: 3}}, BoundingBox{North: 44, South: 43, East: -79, West: -80}, db.PhotoFilter{}, database.NewPaginator())
+
+		assert.NoError(t, err)
+		if assert.Len(t, photos, 1) {
+			assert.Equal(t, 43.65, *photos[0].Latitude)
+		}
+	})
+}
+
+func TestListInBoundingBoxAcrossAntimeridian(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT \\* FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND \\(latitude >= \\$2 AND latitude <= \\$3 AND \\(longitude >= \\$4 OR longitude <= \\$5\\)\\)").
+			WithArgs(3, -20.0, -10.0, 170.0, -170.0).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		photos, _, err := NewPhotoRepo().ListInBoundingBox(ctx, dbx, Collection{Record: db.Record{ID: 3}}, BoundingBox{North: -10, South: -20, East: -170, West: 170}, db.PhotoFilter{}, database.NewPaginator())
+
+		assert.NoError(t, err)
+		assert.Empty(t, photos)
+	})
+}
+
+func TestListInBoundingBoxFilteredByPlace(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT \\* FROM photos WHERE .* AND lower\\(photos.city\\) = lower\\(\\$6\\) AND \\(lower\\(photos.country\\) = lower\\(\\$7\\) or photos.country_code = upper\\(\\$8\\)\\) ORDER BY").
+			WithArgs(3, 38.0, 39.0, -10.0, -9.0, "Lisbon", "pt", "pt").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "city", "country", "country_code"}).AddRow(13, "Lisbon", "Portugal", "PT"))
+
+		photos, _, err := NewPhotoRepo().ListInBoundingBox(ctx, dbx, Collection{Record: db.Record{ID: 3}}, BoundingBox{North: 39, South: 38, East: -9, West: -10}, db.PhotoFilter{City: "Lisbon", Country: "pt"}, database.NewPaginator())
+
+		assert.NoError(t, err)
+		if assert.Len(t, photos, 1) {
+			assert.Equal(t, "Portugal", photos[0].Country)
+		}
+	})
+}
+
+func TestClusterInBoundingBox(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT floor\\(longitude / \\$1\\) as cell_x, floor\\(latitude / \\$2\\) as cell_y, count\\(\\*\\) as count, .* FROM photos WHERE collection_id = \\$3 AND deleted_at IS NULL AND .* GROUP BY cell_x, cell_y ORDER BY count desc").
+			WithArgs(ClusterCellSize(4), ClusterCellSize(4), 3, -90.0, 90.0, -180.0, 180.0).
+			WillReturnRows(sqlmock.NewRows([]string{"cell_x", "cell_y", "count", "latitude", "longitude", "north", "south", "east", "west", "photo_id"}).
+				AddRow(-14, 7, 2, 43.6, -79.4, 43.7, 43.5, -79.3, -79.5, 13).
+				AddRow(25, -6, 1, -33.85, 151.2, -33.85, -33.85, 151.2, 151.2, 14))
+
+		clusters, err := NewPhotoRepo().ClusterInBoundingBox(ctx, dbx, Collection{Record: db.Record{ID: 3}}, BoundingBox{North: 90, South: -90, East: 180, West: -180}, db.PhotoFilter{}, 4)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []LocationCluster{
+			{Count: 2, Latitude: 43.6, Longitude: -79.4, Bounds: BoundingBox{North: 43.7, South: 43.5, East: -79.3, West: -79.5}, PhotoID: 13},
+			{Count: 1, Latitude: -33.85, Longitude: 151.2, Bounds: BoundingBox{North: -33.85, South: -33.85, East: 151.2, West: 151.2}, PhotoID: 14},
+		}, clusters)
+	})
+}
+
+func TestClusterInBoundingBoxRejectsInvalidZoom(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		_, err := NewPhotoRepo().ClusterInBoundingBox(ctx, dbx, Collection{}, BoundingBox{}, db.PhotoFilter{}, MaxClusterZoom+1)
+
+		assert.Error(t, err)
+	})
+}
+
+func TestClusterCellSize(t *testing.T) {
+	assert.Equal(t, 90.0, ClusterCellSize(0))
+	assert.Equal(t, 45.0, ClusterCellSize(1))
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// metadataValueLength is the length longer property values, like descriptions, are truncated to.
+const metadataValueLength = 4096
+
+// InsertPhotoMetadata stores the given properties for the given photo.
+func (p *PhotoRepo) InsertPhotoMetadata(ctx context.Context, tx sqlx.ExecerContext, photo Photo, properties metadata.Properties) error {
+	if len(properties) == 0 {
+		return nil
+	}
+
+	stmt := p.stmt.
+		Insert("photo_metadata").
+		Columns("photo_id", "name", "value", "source", "created_at", "updated_at")
+	timestamps := db.JustCreated(p.clock)
+	for _, property := range properties {
+		stmt = stmt.Values(
+			photo.ID,
+			property.Name,
+			sanitizeExifString(property.Value, metadataValueLength),
+			property.Source,
+			timestamps.CreatedAt,
+			timestamps.UpdatedAt,
+		)
+	}
+
+	sql, args, err := stmt.ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not insert photo metadata")
+	}
+
+	return nil
+}
+
+// FindMetadataForPhoto returns all properties stored for the given photo.
+func FindMetadataForPhoto(ctx context.Context, tx sqlx.QueryerContext, photo Photo) (metadata.Properties, error) {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("name", "value", "source").
+		From("photo_metadata").
+		Where(sq.Eq{"photo_id": photo.ID}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	properties := metadata.Properties{}
+	if err := sqlx.SelectContext(ctx, tx, &properties, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return properties, nil
+}
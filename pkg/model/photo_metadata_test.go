@@ -0,0 +1,49 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInsertPhotoMetadata(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		repo.clock = func() time.Time { return now }
+		properties := metadata.Properties{
+			{Name: metadata.PropertyTitle, Value: "Tram 28", Source: metadata.SourceXMP},
+			{Name: metadata.PropertyDescription, Value: "Caf\xe9\x00", Source: metadata.SourceExif},
+		}
+
+		mock.ExpectExec("INSERT INTO photo_metadata \\(photo_id,name,value,source,created_at,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5,\\$6\\),\\(\\$7,\\$8,\\$9,\\$10,\\$11,\\$12\\)").
+			WithArgs(13, "title", "Tram 28", "xmp", now, now, 13, "description", "Caf", "exif", now, now).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		err := repo.InsertPhotoMetadata(context.Background(), dbx, Photo{Record: db.Record{ID: 13}}, properties)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestFindMetadataForPhoto(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT name, value, source FROM photo_metadata WHERE photo_id = \\$1 ORDER BY id").
+			WithArgs(13).
+			WillReturnRows(sqlmock.NewRows([]string{"name", "value", "source"}).
+				AddRow("keyword", "tram", "xmp").
+				AddRow("rating", "3", "xmp-sidecar"))
+
+		properties, err := FindMetadataForPhoto(ctx, dbx, Photo{Record: db.Record{ID: 13}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, metadata.Properties{
+			{Name: metadata.PropertyKeyword, Value: "tram", Source: metadata.SourceXMP},
+			{Name: metadata.PropertyRating, Value: "3", Source: metadata.SourceSidecar},
+		}, properties)
+	})
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// MaxRating is the highest number of stars a photo can be rated with.
+const MaxRating = 5
+
+// ColorLabels are the colors photos can be labeled with, like in Lightroom and darktable.
+var ColorLabels = []string{"red", "yellow", "green", "blue", "purple"}
+
+// IsColorLabel returns whether color is one of the ColorLabels or empty, which means no label.
+func IsColorLabel(color string) bool {
+	if color == "" {
+		return true
+	}
+	for _, label := range ColorLabels {
+		if color == label {
+			return true
+		}
+	}
+	return false
+}
+
+// PhotoRating is how a user rated a photo while culling. Each user has their own ratings.
+type PhotoRating struct {
+	db.Timestamps
+
+	PhotoID int64 `db:"photo_id" json:"photoID"`
+	UserID  int64 `db:"user_id" json:"userID"`
+	// Rating is the number of stars from 1 to MaxRating, 0 if the photo is not rated.
+	Rating   int    `db:"rating" json:"rating"`
+	Favorite bool   `db:"favorite" json:"favorite"`
+	Color    string `db:"color" json:"color"`
+}
+
+// RatingChange changes how a user rated photos. Nil fields are left as they are.
+type RatingChange struct {
+	Rating   *int    `json:"rating"`
+	Favorite *bool   `json:"favorite"`
+	Color    *string `json:"color"`
+}
+
+// Empty returns whether this change leaves ratings as they are.
+func (c RatingChange) Empty() bool {
+	return c.Rating == nil && c.Favorite == nil && c.Color == nil
+}
+
+// Validate checks the values of this change.
+func (c RatingChange) Validate() error {
+	if c.Rating != nil && (*c.Rating < 0 || *c.Rating > MaxRating) {
+		return errors.Errorf("rating must be from 0 to %d", MaxRating)
+	}
+	if c.Color != nil && !IsColorLabel(*c.Color) {
+		return errors.Errorf("color must be empty or one of %s", strings.Join(ColorLabels, ", "))
+	}
+	return nil
+}
+
+func NewRatingRepo() *RatingRepo {
+	return &RatingRepo{
+		clock: time.Now,
+		stmt:  sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// RatingRepo stores the ratings, favorites and color labels users give photos.
+type RatingRepo struct {
+	clock func() time.Time
+	stmt  sq.StatementBuilderType
+}
+
+// Rate applies the change to how the user rated the photos with the given ids. All photos must be in the collection,
+// otherwise returns ErrPhotoNotInCollection. Returns the ratings of the photos after the change.
+func (r *RatingRepo) Rate(ctx context.Context, tx sqlx.ExtContext, user User, collection Collection, photoIDs []int64, change RatingChange) ([]PhotoRating, error) {
+	if len(photoIDs) == 0 {
+		return []PhotoRating{}, nil
+	}
+	if err := checkPhotosInCollection(ctx, tx, r.stmt, collection, photoIDs); err != nil {
+		return nil, err
+	}
+	return r.ratePhotos(ctx, tx, user, photoIDs, change)
+}
+
+// ratePhotos applies the change to how the user rated the photos with the given ids.
+func (r *RatingRepo) ratePhotos(ctx context.Context, tx sqlx.QueryerContext, user User, photoIDs []int64, change RatingChange) ([]PhotoRating, error) {
+	rating := PhotoRating{Timestamps: db.JustCreated(r.clock), UserID: user.ID}
+	// Only the changed fields are updated when the user rated a photo before.
+	updates := []string{"updated_at = excluded.updated_at"}
+	if change.Rating != nil {
+		rating.Rating = *change.Rating
+		updates = append(updates, "rating = excluded.rating")
+	}
+	if change.Favorite != nil {
+		rating.Favorite = *change.Favorite
+		updates = append(updates, "favorite = excluded.favorite")
+	}
+	if change.Color != nil {
+		rating.Color = *change.Color
+		updates = append(updates, "color = excluded.color")
+	}
+
+	insert := r.stmt.
+		Insert("photo_ratings").
+		Columns("photo_id", "user_id", "rating", "favorite", "color", "created_at", "updated_at")
+	distinct := map[int64]bool{}
+	for _, photoID := range photoIDs {
+		if !distinct[photoID] {
+			distinct[photoID] = true
+			insert = insert.Values(photoID, rating.UserID, rating.Rating, rating.Favorite, rating.Color, rating.CreatedAt, rating.UpdatedAt)
+		}
+	}
+	sql, args, err := insert.
+		Suffix("on conflict (photo_id, user_id) do update set " + strings.Join(updates, ", ") + " returning *").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	ratings := []PhotoRating{}
+	if err := sqlx.SelectContext(ctx, tx, &ratings, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not rate photos")
+	}
+	return ratings, nil
+}
+
+// ForPhoto returns how the user rated the given photo. Photos the user did not rate have a zero rating.
+func (r *RatingRepo) ForPhoto(ctx context.Context, tx sqlx.QueryerContext, user User, photo Photo) (PhotoRating, error) {
+	sql, args, err := r.stmt.
+		Select("*").
+		From("photo_ratings").
+		Where(sq.Eq{"photo_id": photo.ID, "user_id": user.ID}).
+		ToSql()
+	if err != nil {
+		return PhotoRating{}, errors.Wrap(err, "could not build query")
+	}
+
+	ratings := []PhotoRating{}
+	if err := sqlx.SelectContext(ctx, tx, &ratings, sql, args...); err != nil {
+		return PhotoRating{}, errors.Wrap(err, "could not select rows")
+	}
+	if len(ratings) == 0 {
+		return PhotoRating{PhotoID: photo.ID, UserID: user.ID}, nil
+	}
+	return ratings[0], nil
+}
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRatePhotos(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		repo := NewRatingRepo()
+		repo.clock = func() time.Time { return now }
+		favorite, color := true, "red"
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND id IN \\(\\$2,\\$3,\\$4\\)").
+			WithArgs(3, 42, 43, 42).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectQuery("INSERT INTO photo_ratings \\(photo_id,user_id,rating,favorite,color,created_at,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5,\\$6,\\$7\\),\\(\\$8,\\$9,\\$10,\\$11,\\$12,\\$13,\\$14\\) on conflict \\(photo_id, user_id\\) do update set updated_at = excluded.updated_at, favorite = excluded.favorite, color = excluded.color returning \\*").
+			WithArgs(42, 5, 0, true, "red", now, now, 43, 5, 0, true, "red", now, now).
+			WillReturnRows(sqlmock.NewRows([]string{"photo_id", "user_id", "rating", "favorite", "color"}).AddRow(42, 5, 4, true, "red").AddRow(43, 5, 0, true, "red"))
+
+		ratings, err := repo.Rate(ctx, dbx, User{Record: db.Record{ID: 5}}, Collection{Record: db.Record{ID: 3}}, []int64{42, 43, 42}, RatingChange{Favorite: &favorite, Color: &color})
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Len(t, ratings, 2)
+		assert.Equal(t, 4, ratings[0].Rating)
+	})
+}
+
+func TestRatePhotosNotInCollection(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		rating := 5
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		_, err := NewRatingRepo().Rate(ctx, dbx, User{Record: db.Record{ID: 5}}, Collection{Record: db.Record{ID: 3}}, []int64{42, 43}, RatingChange{Rating: &rating})
+
+		assert.Equal(t, ErrPhotoNotInCollection, err)
+	})
+}
+
+func TestRatingForUnratedPhoto(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT \\* FROM photo_ratings WHERE photo_id = \\$1 AND user_id = \\$2").
+			WithArgs(42, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"photo_id", "user_id", "rating"}))
+
+		rating, err := NewRatingRepo().ForPhoto(ctx, dbx, User{Record: db.Record{ID: 5}}, Photo{Record: db.Record{ID: 42}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, PhotoRating{PhotoID: 42, UserID: 5}, rating)
+	})
+}
+
+func TestRatingChangeValidate(t *testing.T) {
+	tooHigh, negative, ok := 6, -1, 5
+	unknown, none := "orange", ""
+
+	assert.Error(t, RatingChange{Rating: &tooHigh}.Validate())
+	assert.Error(t, RatingChange{Rating: &negative}.Validate())
+	assert.Error(t, RatingChange{Color: &unknown}.Validate())
+	assert.NoError(t, RatingChange{Rating: &ok, Color: &none}.Validate())
+	assert.True(t, RatingChange{}.Empty())
+}
@@ -2,15 +2,17 @@ package model
 
 import (
 	"context"
-	"image/jpeg"
 	"io"
-	"io/ioutil"
 	"log"
+	"strconv"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/ilikeorangutans/phts/db"
 	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
 	"github.com/ilikeorangutans/phts/storage"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -29,6 +31,26 @@ type PhotoRepo struct {
 	stmt  sq.StatementBuilderType
 }
 
+// FindInCollection finds the photo with the given id in the given collection.
+func (p *PhotoRepo) FindInCollection(ctx context.Context, db sqlx.QueryerContext, collection Collection, id int64) (Photo, error) {
+	sql, args, err := p.stmt.
+		Select("*").
+		From("photos").
+		Where(sq.Eq{"id": id, "collection_id": collection.ID, "deleted_at": nil}).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return Photo{}, errors.Wrap(err, "could not build query")
+	}
+
+	var photo Photo
+	err = sqlx.GetContext(ctx, db, &photo, sql, args...)
+	if err != nil {
+		return Photo{}, errors.Wrap(err, "could not get row")
+	}
+	return photo, nil
+}
+
 // FindByID finds a photo record by id.
 func (p *PhotoRepo) FindByID(ctx context.Context, db sqlx.QueryerContext, id int64) (Photo, error) {
 	sql, args, err := p.stmt.
@@ -49,21 +71,22 @@ func (p *PhotoRepo) FindByID(ctx context.Context, db sqlx.QueryerContext, id int
 	return photo, nil
 }
 
-func (p *PhotoRepo) List(ctx context.Context, db *sqlx.DB, user User, paginator database.Paginator) ([]Photo, database.Paginator, error) {
+func (p *PhotoRepo) List(ctx context.Context, dbx *sqlx.DB, user User, paginator database.Paginator, filter db.PhotoFilter) ([]Photo, database.Paginator, error) {
 	stmt := p.stmt.
 		Select("photos.*").
 		From("photos").
 		Join("collections c on (photos.collection_id = c.id)").
 		Join("users_collections uc on (uc.collection_id = c.id)").
-		Where(sq.Eq{"uc.user_id": user.ID})
+		Where(sq.Eq{"uc.user_id": user.ID, "photos.deleted_at": nil, "c.deleted_at": nil})
+	stmt = filter.Filter(stmt, "photos")
 
-	sql, args, err := paginator.Paginate(stmt).ToSql()
+	sql, args, err := filter.Paginate(stmt, "photos", paginator).ToSql()
 	if err != nil {
 		return nil, paginator, errors.Wrap(err, "could not build query")
 	}
 
 	var photos []Photo
-	err = db.SelectContext(ctx, &photos, sql, args...)
+	err = dbx.SelectContext(ctx, &photos, sql, args...)
 	if err != nil {
 		return nil, paginator, errors.Wrap(err, "could not select rows")
 	}
@@ -72,17 +95,32 @@ func (p *PhotoRepo) List(ctx context.Context, db *sqlx.DB, user User, paginator
 }
 
 // AddPhoto creates a new photo, original rendition, and if applicable, exif records from the given
-// reader. Returns the photo instance, the original rendition, or an error.
-func (p *PhotoRepo) AddPhoto(ctx context.Context, tx sqlx.ExtContext, storage storage.Backend, collection Collection, upload PhotoUpload) (Photo, Rendition, error) {
+// reader. If the photo has a location it is named using the given geocoder. Descriptive metadata is imported from the
+// exif tags, the XMP and IPTC embedded in JPEGs, and the upload's sidecar, which takes precedence. Keywords become
+// tags. Returns the photo instance, the original rendition, or an error.
+func (p *PhotoRepo) AddPhoto(ctx context.Context, tx sqlx.ExtContext, backend storage.Backend, geocoder geocode.Geocoder, collection Collection, upload PhotoUpload) (Photo, Rendition, error) {
 	var takenAt *time.Time
+	var takenAtOffset *int
+	var exifTags metadata.ExifTags
+	var location *metadata.Location
+	orientation := metadata.Horizontal
 	e, err := exif.Decode(upload.Reader)
 	if err != nil && exif.IsCriticalError(err) {
 		log.Printf("error getting exif tags: %v", err)
 	} else {
-		if dateTime, err := e.DateTime(); err != nil {
+		exifTags = metadata.ExifTagsFromExif(e)
+		if dateTime, err := metadata.DateTimeFromExif(e); err != nil {
 			log.Printf("error getting exif datetime tags: %v", err)
-		} else {
+		} else if dateTime.Location() == time.Local {
+			// Without an offset in the exif tags the zone the photo was taken in is unknown.
 			takenAt = &dateTime
+		} else {
+			local, offset := localTime(dateTime)
+			takenAt, takenAtOffset = &local, &offset
+		}
+		orientation = metadata.ExifOrientationFromExif(e)
+		if location, err = metadata.LocationFromExif(e); err != nil {
+			log.Printf("error getting exif location: %v", err)
 		}
 	}
 
@@ -90,6 +128,41 @@ func (p *PhotoRepo) AddPhoto(ctx context.Context, tx sqlx.ExtContext, storage st
 		return Photo{}, Rendition{}, errors.Wrap(err, "could not rewind")
 	}
 
+	// Only decode the header, there's no need to hold the full image in memory to find its dimensions. This also
+	// rejects unsupported formats before anything is written.
+	imageConfig, contentType, err := images.DecodeConfig(upload.Reader)
+	if images.IsUnsupportedFormat(err) {
+		return Photo{}, Rendition{}, images.UnsupportedFormatError{ContentType: upload.ContentType}
+	} else if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not decode image")
+	}
+	// Store the dimensions of the photo as it is displayed, not as it is stored.
+	orientedWidth, orientedHeight := orientation.Dimensions(imageConfig.Width, imageConfig.Height)
+	width, height := uint(orientedWidth), uint(orientedHeight)
+
+	if _, err := upload.Reader.Seek(0, io.SeekStart); err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not rewind")
+	}
+
+	properties := metadata.PropertiesFromExifTags(exifTags)
+	if contentType == "image/jpeg" {
+		if embedded, err := metadata.PropertiesFromJPEG(upload.Reader); err != nil {
+			log.Printf("error getting embedded metadata: %v", err)
+		} else {
+			properties = append(properties, embedded...)
+		}
+		if _, err := upload.Reader.Seek(0, io.SeekStart); err != nil {
+			return Photo{}, Rendition{}, errors.Wrap(err, "could not rewind")
+		}
+	}
+	if upload.Sidecar != nil {
+		sidecar, err := metadata.ParseXMP(upload.Sidecar, metadata.SourceSidecar)
+		if err != nil {
+			return Photo{}, Rendition{}, errors.Wrap(err, "could not read sidecar")
+		}
+		properties = append(properties, sidecar...)
+	}
+
 	photo := Photo{
 		Timestamps:     db.JustCreated(p.clock),
 		CollectionID:   collection.ID,
@@ -97,48 +170,78 @@ func (p *PhotoRepo) AddPhoto(ctx context.Context, tx sqlx.ExtContext, storage st
 		Description:    "",
 		Filename:       upload.Filename,
 		TakenAt:        takenAt,
+		TakenAtOffset:  takenAtOffset,
 		Published:      false,
 	}
+	photo.SetLocation(location)
+	photo.Geocode(geocoder)
+	photo.ApplyProperties(properties)
 
 	photo, err = p.Create(ctx, tx, photo)
 	if err != nil {
 		return Photo{}, Rendition{}, errors.Wrap(err, "could not insert photo")
 	}
 
+	if err := p.InsertExifTags(ctx, tx, photo, exifTags); err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not store exif tags")
+	}
+
+	if err := p.InsertPhotoMetadata(ctx, tx, photo, properties); err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not store photo metadata")
+	}
+
+	var keywords []string
+	for _, keyword := range properties.Values(metadata.PropertyKeyword) {
+		if name, err := NormalizeTagName(keyword); err != nil {
+			log.Printf("skipping keyword: %v", err)
+		} else {
+			keywords = append(keywords, name)
+		}
+	}
+	if keywords, err = NormalizeTagNames(keywords); err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not normalize keywords")
+	}
+	if len(keywords) > 0 {
+		if _, err := (&TagRepo{clock: p.clock, stmt: p.stmt}).tagPhotos(ctx, tx, collection, []int64{photo.ID}, keywords); err != nil {
+			return Photo{}, Rendition{}, errors.Wrap(err, "could not tag photo with keywords")
+		}
+	}
+
+	// Rejected photos have a rating of -1, they are left unrated.
+	if rating, err := strconv.Atoi(properties.Value(metadata.PropertyRating)); err == nil && rating > 0 && rating <= MaxRating && upload.UserID != 0 {
+		uploader := User{Record: db.Record{ID: upload.UserID}}
+		if _, err := (&RatingRepo{clock: p.clock, stmt: p.stmt}).ratePhotos(ctx, tx, uploader, []int64{photo.ID}, RatingChange{Rating: &rating}); err != nil {
+			return Photo{}, Rendition{}, errors.Wrap(err, "could not rate photo")
+		}
+	}
+
 	renditionConfig, err := FindOriginalRenditionConfiguration(ctx, tx)
 	if err != nil {
 		return Photo{}, Rendition{}, errors.Wrap(err, "could not find rendition config for original")
 	}
 
-	rawJpeg, err := jpeg.Decode(upload.Reader)
-	if err != nil {
-		return Photo{}, Rendition{}, errors.Wrap(err, "could not decode jpeg")
-	}
-	width, height := uint(rawJpeg.Bounds().Dx()), uint(rawJpeg.Bounds().Dy())
 	rendition := Rendition{
-		Format:                   upload.ContentType,
-		Height:                   height,
-		Original:                 true,
-		PhotoID:                  photo.ID,
-		RenditionConfigurationID: renditionConfig.ID,
-		Timestamps:               db.JustCreated(p.clock),
-		Width:                    width,
+		Format:                        contentType,
+		Height:                        height,
+		Original:                      true,
+		PhotoID:                       photo.ID,
+		RenditionConfigurationID:      renditionConfig.ID,
+		RenditionConfigurationVersion: renditionConfig.Version,
+		Timestamps:                    db.JustCreated(p.clock),
+		Width:                         width,
 	}
 	rendition, err = InsertRendition(ctx, tx, rendition)
 	if err != nil {
 		return Photo{}, Rendition{}, errors.Wrap(err, "could not insert rendition")
 	}
 
-	if _, err := upload.Reader.Seek(0, io.SeekStart); err != nil {
-		return Photo{}, Rendition{}, errors.Wrap(err, "could not rewind")
-	}
-
-	buf, err := ioutil.ReadAll(upload.Reader)
+	size, err := storage.Size(upload.Reader)
 	if err != nil {
-		return Photo{}, Rendition{}, errors.Wrap(err, "could not read all bytes")
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not determine upload size")
 	}
 
-	if err := storage.Store(rendition.ID, buf); err != nil {
+	rendition, err = PutRenditionBinary(ctx, tx, backend, rendition, upload.Reader, size)
+	if err != nil {
 		return Photo{}, Rendition{}, errors.Wrap(err, "could not store rendition")
 	}
 
@@ -178,8 +281,20 @@ func (p *PhotoRepo) Update(ctx context.Context, tx sqlx.ExtContext, photo Photo)
 		Set("collection_id", photo.CollectionID).
 		Set("rendition_count", photo.RenditionCount).
 		Set("description", photo.Description).
+		Set("title", photo.Title).
+		Set("copyright", photo.Copyright).
 		Set("taken_at", photo.TakenAt).
 		Set("published", photo.Published).
+		Set("focal_x", photo.FocalX).
+		Set("focal_y", photo.FocalY).
+		Set("latitude", photo.Latitude).
+		Set("longitude", photo.Longitude).
+		Set("altitude", photo.Altitude).
+		Set("direction", photo.Direction).
+		Set("city", photo.City).
+		Set("region", photo.Region).
+		Set("country", photo.Country).
+		Set("country_code", photo.CountryCode).
 		Where(sq.Eq{"id": photo.ID}).
 		ToSql()
 	if err != nil {
@@ -198,11 +313,46 @@ func (p *PhotoRepo) Update(ctx context.Context, tx sqlx.ExtContext, photo Photo)
 	return photo, nil
 }
 
+// SetFocalPoint sets or, given nil, clears the focal point of the given photo. Its fill renditions are marked as
+// outdated so they get cropped around the new focal point, but are served until they are replaced. Returns the number
+// of outdated renditions.
+func (p *PhotoRepo) SetFocalPoint(ctx context.Context, tx sqlx.ExtContext, photo Photo, focus *images.FocalPoint) (Photo, int64, error) {
+	photo.FocalX, photo.FocalY = nil, nil
+	if focus != nil {
+		if err := focus.Validate(); err != nil {
+			return photo, 0, err
+		}
+		x, y := focus.X, focus.Y
+		photo.FocalX, photo.FocalY = &x, &y
+	}
+
+	outdated, err := OutdateRenditionsForPhotoInMode(ctx, tx, photo, images.ResizeFill)
+	if err != nil {
+		return photo, 0, errors.Wrap(err, "could not outdate fill renditions")
+	}
+
+	photo.UpdatedAt = p.clock()
+	sql, args, err := p.stmt.Update("photos").
+		Set("focal_x", photo.FocalX).
+		Set("focal_y", photo.FocalY).
+		Set("updated_at", photo.UpdatedAt).
+		Where(sq.Eq{"id": photo.ID}).
+		ToSql()
+	if err != nil {
+		return photo, 0, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return photo, 0, errors.Wrap(err, "could not update photo")
+	}
+
+	return photo, outdated, nil
+}
+
 // Create stores a new photo in the database.
 func (p *PhotoRepo) Create(ctx context.Context, tx sqlx.ExtContext, photo Photo) (Photo, error) {
 	sql, args, err := p.stmt.Insert("photos").
-		Columns("updated_at", "created_at", "collection_id", "rendition_count", "description", "filename", "taken_at", "published").
-		Values(photo.UpdatedAt, photo.CreatedAt, photo.CollectionID, photo.RenditionCount, photo.Description, photo.Filename, photo.TakenAt, photo.Published).
+		Columns("updated_at", "created_at", "collection_id", "rendition_count", "description", "title", "copyright", "filename", "taken_at", "taken_at_offset", "published", "focal_x", "focal_y", "latitude", "longitude", "altitude", "direction", "city", "region", "country", "country_code").
+		Values(photo.UpdatedAt, photo.CreatedAt, photo.CollectionID, photo.RenditionCount, photo.Description, photo.Title, photo.Copyright, photo.Filename, photo.TakenAt, photo.TakenAtOffset, photo.Published, photo.FocalX, photo.FocalY, photo.Latitude, photo.Longitude, photo.Altitude, photo.Direction, photo.City, photo.Region, photo.Country, photo.CountryCode).
 		Suffix("returning id").
 		ToSql()
 	if err != nil {
@@ -210,10 +360,10 @@ func (p *PhotoRepo) Create(ctx context.Context, tx sqlx.ExtContext, photo Photo)
 	}
 
 	rows, err := tx.QueryxContext(ctx, sql, args...)
-	defer rows.Close()
 	if err != nil {
 		return photo, errors.Wrap(err, "could not insert")
 	}
+	defer rows.Close()
 
 	if !rows.Next() {
 		return photo, errors.Wrap(err, "no id returned")
@@ -227,7 +377,8 @@ func (p *PhotoRepo) Create(ctx context.Context, tx sqlx.ExtContext, photo Photo)
 	return photo, nil
 }
 
-// AddRendition adds a new rendition to the given photo.
+// AddRendition adds a new rendition to the given photo. Only the rendition count of the photo is updated, so a photo
+// loaded before the rendition was made does not overwrite changes made since.
 func (p *PhotoRepo) AddRendition(ctx context.Context, tx sqlx.ExtContext, photo Photo, rendition Rendition) (Photo, Rendition, error) {
 	rendition.PhotoID = photo.ID
 	rendition.Timestamps = db.JustCreated(p.clock)
@@ -236,23 +387,42 @@ func (p *PhotoRepo) AddRendition(ctx context.Context, tx sqlx.ExtContext, photo
 		return photo, rendition, errors.Wrap(err, "could not insert rendition")
 	}
 
-	photo, err = p.Update(ctx, tx, photo)
+	sql, args, err := p.stmt.Update("photos").
+		Set("rendition_count", sq.Expr("(select count(*) from renditions where renditions.photo_id = photos.id)")).
+		Where(sq.Eq{"id": photo.ID}).
+		Suffix("returning rendition_count").
+		ToSql()
 	if err != nil {
-		return photo, rendition, errors.Wrap(err, "could not update photo")
+		return photo, rendition, errors.Wrap(err, "could not create query")
+	}
+	if err := tx.QueryRowxContext(ctx, sql, args...).Scan(&photo.RenditionCount); err != nil {
+		return photo, rendition, errors.Wrap(err, "could not update rendition count")
 	}
 
 	return photo, rendition, nil
 }
 
-// FindPhotosWithMissingRenditions finds
+// FindPhotosWithMissingRenditions finds up to n photos that are missing a rendition for an applicable rendition
+// configuration, or only have one made from an older version of the configuration. Photos that already have a
+// pending, running, failed or cancelled rendition job are skipped.
 func (p *PhotoRepo) FindPhotosWithMissingRenditions(ctx context.Context, tx sqlx.ExtContext, n uint64) ([]Photo, error) {
 	sql, args, err := p.stmt.
 		Select("photos.*").
 		From("photos").
-		Join("renditions on photos.id = renditions.photo_id").
-		GroupBy("photos.id").
-		Having("count(renditions.id) < (select count(*) from rendition_configurations where collection_id = photos.collection_id or collection_id is null)").
-		OrderBy("created_at").
+		Where(sq.Eq{"photos.deleted_at": nil}).
+		Where("exists (select 1 from renditions where renditions.photo_id = photos.id and renditions.original)").
+		Where(`exists (
+			select 1 from rendition_configurations rc
+			where (rc.collection_id = photos.collection_id or rc.collection_id is null)
+			and not exists (
+				select 1 from renditions
+				where renditions.photo_id = photos.id
+				and renditions.rendition_configuration_id = rc.id
+				and renditions.rendition_configuration_version = rc.version
+			)
+		)`).
+		Where("not exists (select 1 from rendition_jobs where rendition_jobs.photo_id = photos.id and rendition_jobs.state in ('pending', 'running', 'failed', 'cancelled'))").
+		OrderBy("photos.created_at").
 		Limit(n).
 		ToSql()
 	if err != nil {
@@ -1,13 +1,21 @@
 package model
 
 import (
+	"bytes"
 	"context"
+	"io/ioutil"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ilikeorangutans/phts/db"
 	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/ilikeorangutans/phts/storage"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 )
@@ -45,7 +53,7 @@ func TestList(t *testing.T) {
 					AddRow(42, 3, "description", nil, "foobar.jpg", 0, true, now, now),
 			)
 
-		photos, _, err := repo.List(ctx, dbx, user, database.NewPaginator())
+		photos, _, err := repo.List(ctx, dbx, user, database.NewPaginator(), db.PhotoFilter{})
 
 		assert.NoError(t, err)
 		assert.Len(t, photos, 1)
@@ -73,3 +81,196 @@ func TestCreatePhoto(t *testing.T) {
 		assert.Equal(t, int64(13), photo.ID)
 	})
 }
+
+func TestAddPhotoRejectsUnsupportedFormatBeforeWriting(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		upload := PhotoUpload{
+			Filename:    "drawing.bmp",
+			Reader:      bytes.NewReader([]byte("BM not really a bitmap")),
+			ContentType: "image/bmp",
+		}
+
+		_, _, err := repo.AddPhoto(context.Background(), dbx, nil, geocode.None, Collection{}, upload)
+
+		assert.Equal(t, images.UnsupportedFormatError{ContentType: "image/bmp"}, err)
+	})
+}
+
+func TestSetFocalPointOutdatesFillRenditions(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		ctx := context.Background()
+		photo := Photo{Record: db.Record{ID: 42}, CollectionID: 3}
+
+		mock.ExpectExec("update renditions as r set rendition_configuration_version = \\$1 from rendition_configurations as rc where .* and rc.mode = \\$3").
+			WithArgs(0, 42, "fill").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("UPDATE photos SET focal_x = \\$1, focal_y = \\$2, updated_at = \\$3 WHERE id = \\$4").
+			WithArgs(0.25, 0.75, sqlmock.AnyArg(), 42).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photo, outdated, err := repo.SetFocalPoint(ctx, dbx, photo, &images.FocalPoint{X: 0.25, Y: 0.75})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), outdated)
+		assert.Equal(t, images.FocalPoint{X: 0.25, Y: 0.75}, photo.FocalPoint())
+	})
+}
+
+func TestSetFocalPointRejectsPointOutsideOfPhoto(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		_, _, err := repo.SetFocalPoint(context.Background(), dbx, Photo{}, &images.FocalPoint{X: 1.5, Y: 0.5})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestAddRenditionOnlyUpdatesRenditionCount(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		// A stale title must not overwrite one changed while the rendition was made.
+		photo := Photo{Record: db.Record{ID: 42}, Title: "stale", RenditionCount: 1}
+
+		mock.ExpectQuery("INSERT INTO renditions").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101))
+		mock.ExpectQuery("UPDATE photos SET rendition_count = \\(select count\\(\\*\\) from renditions where renditions.photo_id = photos.id\\) WHERE id = \\$1 returning rendition_count").
+			WithArgs(42).
+			WillReturnRows(sqlmock.NewRows([]string{"rendition_count"}).AddRow(2))
+
+		photo, rendition, err := repo.AddRendition(context.Background(), dbx, photo, Rendition{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(101), rendition.ID)
+		assert.Equal(t, 2, photo.RenditionCount)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAddPhotoStoresUprightDimensions(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		// Stored as 24x40 and tagged to be rotated by 90 degrees.
+		f, err := os.Open("../metadata/testdata/orientation/6.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		dir, err := ioutil.TempDir("", "phts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		mock.ExpectQuery("INSERT INTO photos").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(13)).RowsWillBeClosed()
+		mock.ExpectExec("INSERT INTO exif").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT \\* FROM rendition_configurations").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "original", "version"}).AddRow(1, true, 1))
+		mock.ExpectQuery("INSERT INTO renditions").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 13, true, 40, 24, "image/jpeg", 1, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101))
+		mock.ExpectExec("UPDATE renditions SET content_hash").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, rendition, err := repo.AddPhoto(context.Background(), dbx, storage.NewFileBackend(dir), geocode.None, Collection{}, PhotoUpload{Filename: "6.jpg", Reader: f, ContentType: "image/jpeg"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{40, 24}, []uint{rendition.Width, rendition.Height})
+	})
+}
+
+func TestAddPhotoStoresTakenAtOffset(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		metadata.RegisterParsers()
+		// Taken at 13:14:15 in +02:00.
+		f, err := os.Open("../metadata/testdata/exif/offsets.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		dir, err := ioutil.TempDir("", "phts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		takenAt := time.Date(2019, time.May, 4, 13, 14, 15, 0, time.UTC)
+		mock.ExpectQuery("INSERT INTO photos \\(.*taken_at,taken_at_offset,").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 0, 1, "", "", "", "offsets.jpg", sqlmock.AnyArg(), 2*60*60, false, nil, nil, nil, nil, nil, nil, "", "", "", "").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(13)).RowsWillBeClosed()
+		mock.ExpectExec("INSERT INTO exif").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT \\* FROM rendition_configurations").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "original", "version"}).AddRow(1, true, 1))
+		mock.ExpectQuery("INSERT INTO renditions").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101))
+		mock.ExpectExec("UPDATE renditions SET content_hash").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photo, _, err := repo.AddPhoto(context.Background(), dbx, storage.NewFileBackend(dir), geocode.None, Collection{}, PhotoUpload{Filename: "offsets.jpg", Reader: f, ContentType: "image/jpeg"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, takenAt, *photo.TakenAt)
+		assert.Equal(t, 2*60*60, *photo.TakenAtOffset)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAddPhotoImportsMetadata(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		f, err := os.Open("../metadata/testdata/xmp/lightroom.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		sidecar, err := os.Open("../metadata/testdata/xmp/darktable.jpg.xmp")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sidecar.Close()
+		dir, err := ioutil.TempDir("", "phts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		// The title comes from the sidecar, everything else from the embedded XMP.
+		mock.ExpectQuery("INSERT INTO photos \\(updated_at,created_at,collection_id,rendition_count,description,title,copyright,filename,").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 0, 1, "Tram in Lisbon", "Tram 28 at dusk", "© 2019 Jane Doe", "tram.jpg", sqlmock.AnyArg(), sqlmock.AnyArg(), false, nil, nil, nil, nil, nil, nil, "", "", "", "").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(13)).RowsWillBeClosed()
+		mock.ExpectExec("INSERT INTO photo_metadata \\(photo_id,name,value,source,created_at,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5,\\$6\\),").
+			WillReturnResult(sqlmock.NewResult(0, 15))
+		// Keywords from all sources become tags.
+		mock.ExpectExec("INSERT INTO tags").
+			WithArgs(0, "tram", sqlmock.AnyArg(), sqlmock.AnyArg(), 0, "Lisbon", sqlmock.AnyArg(), sqlmock.AnyArg(), 0, "Portugal", sqlmock.AnyArg(), sqlmock.AnyArg(), 0, "dusk", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectQuery("SELECT \\* FROM tags WHERE collection_id = \\$1 AND lower\\(name\\) IN \\(\\$2,\\$3,\\$4,\\$5\\)").
+			WithArgs(0, "tram", "lisbon", "portugal", "dusk").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "tram").AddRow(2, "Lisbon").AddRow(3, "Portugal").AddRow(4, "dusk"))
+		mock.ExpectExec("INSERT INTO photo_tags \\(photo_id,tag_id,created_at\\) VALUES .* on conflict do nothing").
+			WithArgs(13, 1, sqlmock.AnyArg(), 13, 2, sqlmock.AnyArg(), 13, 3, sqlmock.AnyArg(), 13, 4, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+		// The rating of the sidecar becomes the uploader's.
+		mock.ExpectQuery("INSERT INTO photo_ratings \\(photo_id,user_id,rating,favorite,color,created_at,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4,\\$5,\\$6,\\$7\\) on conflict \\(photo_id, user_id\\) do update set updated_at = excluded.updated_at, rating = excluded.rating returning \\*").
+			WithArgs(13, 7, 3, false, "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"photo_id", "user_id", "rating"}).AddRow(13, 7, 3))
+		mock.ExpectQuery("SELECT \\* FROM rendition_configurations").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "original", "version"}).AddRow(1, true, 1))
+		mock.ExpectQuery("INSERT INTO renditions").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101))
+		mock.ExpectExec("UPDATE renditions SET content_hash").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photo, _, err := repo.AddPhoto(context.Background(), dbx, storage.NewFileBackend(dir), geocode.None, Collection{}, PhotoUpload{Filename: "tram.jpg", Reader: f, ContentType: "image/jpeg", Sidecar: sidecar, UserID: 7})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "Tram 28 at dusk", photo.Title)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestAddPhotoRejectsInvalidSidecar(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		f, err := os.Open("../metadata/testdata/xmp/lightroom.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		_, _, err = repo.AddPhoto(context.Background(), dbx, nil, geocode.None, Collection{}, PhotoUpload{Filename: "tram.jpg", Reader: f, ContentType: "image/jpeg", Sidecar: strings.NewReader("<x:xmpmeta>")})
+
+		assert.Error(t, err)
+	})
+}
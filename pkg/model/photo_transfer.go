@@ -0,0 +1,421 @@
+package model
+
+import (
+	"context"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	// TransferDrop drops album memberships or shares of transferred photos.
+	TransferDrop = "drop"
+	// TransferRelink re-links album memberships to the albums with the same slug in the target collection, and moves
+	// shares along with the photo.
+	TransferRelink = "relink"
+)
+
+// ErrSameCollection is returned when moving or copying photos to the collection they are in.
+var ErrSameCollection = errors.New("photos are already in that collection")
+
+// TransferOptions decide what happens to the album memberships and shares of photos moved or copied to another
+// collection. Albums belong to a collection, so memberships are either re-linked to the albums with the same slug in
+// the target collection or dropped. Shares stay with the original when copying.
+type TransferOptions struct {
+	Albums string `json:"albums"`
+	Shares string `json:"shares"`
+}
+
+// Validate checks that the options are given. Shares only need to be given when moving photos.
+func (o TransferOptions) Validate(move bool) error {
+	if o.Albums != TransferDrop && o.Albums != TransferRelink {
+		return errors.Errorf("albums must be %s or %s", TransferDrop, TransferRelink)
+	}
+	if move && o.Shares != TransferDrop && o.Shares != TransferRelink {
+		return errors.Errorf("shares must be %s or %s", TransferDrop, TransferRelink)
+	}
+	return nil
+}
+
+// MovePhotos moves the photos with the given ids from one collection to another. All photos must be in the source
+// collection, otherwise returns ErrPhotoNotInCollection. Their tags are re-created in the target collection, album
+// memberships and shares are handled according to the options. Renditions made from rendition configurations of the
+// source collection are deleted and a rendition job is enqueued for every photo, so the renditions of the target
+// collection get made. Returns the moved photos and the ids of the deleted renditions so their binaries can be removed
+// once the transaction is committed.
+func (p *PhotoRepo) MovePhotos(ctx context.Context, tx sqlx.ExtContext, from, to Collection, photoIDs []int64, options TransferOptions) ([]Photo, []int64, error) {
+	if from.ID == to.ID {
+		return nil, nil, ErrSameCollection
+	}
+	if err := options.Validate(true); err != nil {
+		return nil, nil, err
+	}
+	if len(photoIDs) == 0 {
+		return []Photo{}, nil, nil
+	}
+	tagRepo := &TagRepo{clock: p.clock, stmt: p.stmt}
+	if err := checkPhotosInCollection(ctx, tx, p.stmt, from, photoIDs); err != nil {
+		return nil, nil, err
+	}
+
+	tagNames, err := p.tagNames(ctx, tx, photoIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	sql, args, err := p.stmt.Delete("photo_tags").Where(sq.Eq{"photo_id": photoIDs}).ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "could not untag photos")
+	}
+	// Like removing tags, tags no photo is tagged with anymore are deleted.
+	sql, args, err = p.stmt.
+		Delete("tags").
+		Where(sq.Eq{"collection_id": from.ID}).
+		Where("not exists (select 1 from photo_tags pt where pt.tag_id = tags.id)").
+		ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "could not delete unused tags")
+	}
+
+	if options.Albums == TransferRelink {
+		if err := p.relinkAlbums(ctx, tx, from, to, photoIDs, photoIDs); err != nil {
+			return nil, nil, err
+		}
+	}
+	sql, args, err = p.stmt.
+		Delete("album_photos").
+		Where(sq.Eq{"photo_id": photoIDs}).
+		Where("album_id in (select id from albums where collection_id = ?)", from.ID).
+		ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "could not remove photos from albums")
+	}
+	sql, args, err = p.stmt.
+		Update("albums").
+		Set("cover_photo_id", nil).
+		Where(sq.Eq{"collection_id": from.ID, "cover_photo_id": photoIDs}).
+		ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "could not clear album covers")
+	}
+
+	if err := p.moveShares(ctx, tx, from, to, photoIDs, options.Shares); err != nil {
+		return nil, nil, err
+	}
+
+	sql, args, err = p.stmt.
+		Delete("renditions").
+		Where(sq.Eq{"photo_id": photoIDs}).
+		Where("rendition_configuration_id in (select id from rendition_configurations where collection_id = ?)", from.ID).
+		Suffix("returning id").
+		ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not build query")
+	}
+	deleted := []int64{}
+	if err := sqlx.SelectContext(ctx, tx, &deleted, sql, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "could not delete renditions")
+	}
+
+	sql, args, err = p.stmt.
+		Update("photos").
+		Set("collection_id", to.ID).
+		Set("updated_at", p.clock()).
+		Set("rendition_count", sq.Expr("(select count(*) from renditions where renditions.photo_id = photos.id)")).
+		Where(sq.Eq{"id": photoIDs}).
+		Suffix("returning *").
+		ToSql()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "could not build query")
+	}
+	photos := []Photo{}
+	if err := sqlx.SelectContext(ctx, tx, &photos, sql, args...); err != nil {
+		return nil, nil, errors.Wrap(err, "could not move photos")
+	}
+
+	jobRepo := NewRenditionJobRepo()
+	for _, photo := range photos {
+		if names := tagNames[photo.ID]; len(names) > 0 {
+			if _, err := tagRepo.tagPhotos(ctx, tx, to, []int64{photo.ID}, names); err != nil {
+				return nil, nil, errors.Wrapf(err, "could not tag photo %d", photo.ID)
+			}
+		}
+		if err := jobRepo.Enqueue(ctx, tx, photo.ID); err != nil {
+			return nil, nil, errors.Wrapf(err, "could not enqueue renditions for photo %d", photo.ID)
+		}
+	}
+
+	if err := updatePhotoCounts(ctx, tx, from); err != nil {
+		return nil, nil, err
+	}
+	if err := updatePhotoCounts(ctx, tx, to); err != nil {
+		return nil, nil, err
+	}
+	return photos, deleted, nil
+}
+
+// CopyPhotos copies the photos with the given ids from one collection to another. All photos must be in the source
+// collection, otherwise returns ErrPhotoNotInCollection. Copies get a copy of the original binary, the exif tags,
+// imported metadata and tags of the photo; album memberships are handled according to the options. Ratings and
+// shares stay with the original. A rendition job is enqueued for every copy. Returns the copies and the ids of their
+// original renditions, whose binaries have to be removed if the transaction is rolled back.
+func (p *PhotoRepo) CopyPhotos(ctx context.Context, tx sqlx.ExtContext, backend storage.Backend, from, to Collection, photoIDs []int64, options TransferOptions) ([]Photo, []int64, error) {
+	if from.ID == to.ID {
+		return nil, nil, ErrSameCollection
+	}
+	if err := options.Validate(false); err != nil {
+		return nil, nil, err
+	}
+	if len(photoIDs) == 0 {
+		return []Photo{}, nil, nil
+	}
+	tagRepo := &TagRepo{clock: p.clock, stmt: p.stmt}
+	if err := checkPhotosInCollection(ctx, tx, p.stmt, from, photoIDs); err != nil {
+		return nil, nil, err
+	}
+
+	tagNames, err := p.tagNames(ctx, tx, photoIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jobRepo := NewRenditionJobRepo()
+	copies := []Photo{}
+	renditionIDs := []int64{}
+	distinct := map[int64]bool{}
+	for _, id := range photoIDs {
+		if distinct[id] {
+			continue
+		}
+		distinct[id] = true
+
+		photo, rendition, err := p.copyPhoto(ctx, tx, backend, from, to, id)
+		if rendition.ID != 0 {
+			renditionIDs = append(renditionIDs, rendition.ID)
+		}
+		if err != nil {
+			return nil, renditionIDs, errors.Wrapf(err, "could not copy photo %d", id)
+		}
+
+		if names := tagNames[id]; len(names) > 0 {
+			if _, err := tagRepo.tagPhotos(ctx, tx, to, []int64{photo.ID}, names); err != nil {
+				return nil, renditionIDs, errors.Wrapf(err, "could not tag copy of photo %d", id)
+			}
+		}
+		if options.Albums == TransferRelink {
+			if err := p.relinkAlbums(ctx, tx, from, to, []int64{id}, []int64{photo.ID}); err != nil {
+				return nil, renditionIDs, err
+			}
+		}
+		if err := jobRepo.Enqueue(ctx, tx, photo.ID); err != nil {
+			return nil, renditionIDs, errors.Wrapf(err, "could not enqueue renditions for copy of photo %d", id)
+		}
+		copies = append(copies, photo)
+	}
+
+	if err := updatePhotoCounts(ctx, tx, to); err != nil {
+		return nil, renditionIDs, err
+	}
+	return copies, renditionIDs, nil
+}
+
+// copyPhoto copies the photo with the given id, its original rendition and binary, exif tags and metadata to the
+// target collection. Returns the copy and its original rendition, which is set once its binary may have been stored.
+func (p *PhotoRepo) copyPhoto(ctx context.Context, tx sqlx.ExtContext, backend storage.Backend, from, to Collection, id int64) (Photo, Rendition, error) {
+	photo, err := p.FindInCollection(ctx, tx, from, id)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not find photo")
+	}
+	original, err := FindOriginalRenditionByPhoto(ctx, tx, photo)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not find original rendition")
+	}
+	exifTags, err := FindExifForPhoto(ctx, tx, photo)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not find exif tags")
+	}
+	properties, err := FindMetadataForPhoto(ctx, tx, photo)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not find metadata")
+	}
+
+	copied := photo
+	copied.ID = 0
+	copied.CollectionID = to.ID
+	copied.Timestamps = db.JustCreated(p.clock)
+	copied.RenditionCount = 0
+	copied, err = p.Create(ctx, tx, copied)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not create copy")
+	}
+
+	rendition := original
+	rendition.ID = 0
+	copied, rendition, err = p.AddRendition(ctx, tx, copied, rendition)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not add original rendition")
+	}
+
+	binary, info, err := backend.Open(original.ID)
+	if err != nil {
+		return Photo{}, Rendition{}, errors.Wrap(err, "could not open original binary")
+	}
+	defer binary.Close()
+	if rendition, err = PutRenditionBinary(ctx, tx, backend, rendition, binary, info.Size); err != nil {
+		return Photo{}, rendition, errors.Wrap(err, "could not copy original binary")
+	}
+
+	if err := p.InsertExifTags(ctx, tx, copied, exifTags); err != nil {
+		return Photo{}, rendition, errors.Wrap(err, "could not copy exif tags")
+	}
+	if err := p.InsertPhotoMetadata(ctx, tx, copied, properties); err != nil {
+		return Photo{}, rendition, errors.Wrap(err, "could not copy metadata")
+	}
+
+	return copied, rendition, nil
+}
+
+// tagNames returns the names of the tags of the photos with the given ids by photo id.
+func (p *PhotoRepo) tagNames(ctx context.Context, tx sqlx.QueryerContext, photoIDs []int64) (map[int64][]string, error) {
+	sql, args, err := p.stmt.
+		Select("pt.photo_id", "t.name").
+		From("photo_tags pt").
+		Join("tags t on (t.id = pt.tag_id)").
+		Where(sq.Eq{"pt.photo_id": photoIDs}).
+		OrderBy("pt.photo_id", "lower(t.name)").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	rows := []struct {
+		PhotoID int64  `db:"photo_id"`
+		Name    string `db:"name"`
+	}{}
+	if err := sqlx.SelectContext(ctx, tx, &rows, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select tags")
+	}
+
+	names := map[int64][]string{}
+	for _, row := range rows {
+		names[row.PhotoID] = append(names[row.PhotoID], row.Name)
+	}
+	return names, nil
+}
+
+// relinkAlbums adds the target photos to the albums of the target collection that have the same slug as the albums
+// of the source collection the source photos are in. Photos are matched by their position in the given slices.
+// Memberships in albums without a match are not re-linked.
+func (p *PhotoRepo) relinkAlbums(ctx context.Context, tx sqlx.ExecerContext, from, to Collection, sourceIDs, targetIDs []int64) error {
+	now := p.clock()
+	for i, sourceID := range sourceIDs {
+		sql := `
+		  insert into album_photos (photo_id, album_id, sort_order, created_at, updated_at)
+		  select $1, target.id, ap.sort_order, $2, $2 from album_photos ap
+		  join albums source on (source.id = ap.album_id)
+		  join albums target on (target.slug = source.slug and target.collection_id = $3 and target.deleted_at is null)
+		  where ap.photo_id = $4 and source.collection_id = $5
+		  on conflict do nothing
+		`
+		if _, err := tx.ExecContext(ctx, sql, targetIDs[i], now, to.ID, sourceID, from.ID); err != nil {
+			return errors.Wrapf(err, "could not re-link albums of photo %d", sourceID)
+		}
+	}
+	return nil
+}
+
+// moveShares handles the shares of the photos with the given ids that are moved to the target collection. Shares of
+// the source collection that only share these photos are moved along with them, or deleted if mode is TransferDrop.
+// Moved shares no longer use rendition configurations of the source collection. The photos are taken out of all other
+// shares of the source collection; album shares follow the album memberships.
+func (p *PhotoRepo) moveShares(ctx context.Context, tx sqlx.ExecerContext, from, to Collection, photoIDs []int64, mode string) error {
+	only, err := sharesOnlyOf(from, photoIDs)
+	if err != nil {
+		return err
+	}
+
+	if mode == TransferDrop {
+		sql, args, err := p.stmt.Delete("shares").Where(only).ToSql()
+		if err != nil {
+			return errors.Wrap(err, "could not build query")
+		}
+		if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+			return errors.Wrap(err, "could not delete shares")
+		}
+	} else {
+		onlySQL, onlyArgs, err := only.ToSql()
+		if err != nil {
+			return errors.Wrap(err, "could not build query")
+		}
+		sql, args, err := p.stmt.
+			Delete("share_rendition_configurations").
+			Where(sq.Expr("share_id in (select id from shares where "+onlySQL+")", onlyArgs...)).
+			Where("rendition_configuration_id in (select id from rendition_configurations where collection_id = ?)", from.ID).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "could not build query")
+		}
+		if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+			return errors.Wrap(err, "could not remove rendition configurations from shares")
+		}
+
+		sql, args, err = p.stmt.
+			Update("shares").
+			Set("collection_id", to.ID).
+			Set("updated_at", p.clock()).
+			Where(only).
+			ToSql()
+		if err != nil {
+			return errors.Wrap(err, "could not build query")
+		}
+		if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+			return errors.Wrap(err, "could not move shares")
+		}
+	}
+
+	sql, args, err := p.stmt.
+		Delete("share_photos").
+		Where(sq.Eq{"photo_id": photoIDs}).
+		Where("share_id in (select id from shares where collection_id = ?)", from.ID).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not take photos out of shares")
+	}
+	return nil
+}
+
+// sharesOnlyOf is a condition on shares that matches the shares of the collection that share photos with the given
+// ids and no others.
+func sharesOnlyOf(collection Collection, photoIDs []int64) (sq.Sqlizer, error) {
+	picked, pickedArgs, err := sq.Eq{"sp.photo_id": photoIDs}.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+	others, othersArgs, err := sq.NotEq{"sp.photo_id": photoIDs}.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	return sq.And{
+		sq.Eq{"shares.collection_id": collection.ID, "shares.album_id": nil},
+		sq.Expr("exists (select 1 from share_photos sp where sp.share_id = shares.id and "+picked+")", pickedArgs...),
+		sq.Expr("not exists (select 1 from share_photos sp where sp.share_id = shares.id and "+others+")", othersArgs...),
+	}, nil
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMovePhotos(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		repo.clock = func() time.Time { return now }
+		from, to := Collection{Record: db.Record{ID: 3}}, Collection{Record: db.Record{ID: 4}}
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND id IN \\(\\$2\\)").
+			WithArgs(3, 42).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT pt.photo_id, t.name FROM photo_tags pt JOIN tags t on \\(t.id = pt.tag_id\\) WHERE pt.photo_id IN \\(\\$1\\)").
+			WithArgs(42).
+			WillReturnRows(sqlmock.NewRows([]string{"photo_id", "name"}).AddRow(42, "sunset"))
+		mock.ExpectExec("DELETE FROM photo_tags WHERE photo_id IN \\(\\$1\\)").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM tags WHERE collection_id = \\$1 AND not exists").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("insert into album_photos .* select \\$1, target.id, ap.sort_order, \\$2, \\$2 from album_photos ap").
+			WithArgs(42, now, 4, 42, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM album_photos WHERE photo_id IN \\(\\$1\\) AND album_id in \\(select id from albums where collection_id = \\$2\\)").
+			WithArgs(42, 3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE albums SET cover_photo_id = \\$1 WHERE collection_id = \\$2 AND cover_photo_id IN \\(\\$3\\)").
+			WithArgs(nil, 3, 42).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM shares WHERE \\(shares.album_id IS NULL AND shares.collection_id = \\$1 AND exists \\(select 1 from share_photos sp where sp.share_id = shares.id and sp.photo_id IN \\(\\$2\\)\\) AND not exists \\(select 1 from share_photos sp where sp.share_id = shares.id and sp.photo_id NOT IN \\(\\$3\\)\\)\\)").
+			WithArgs(3, 42, 42).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM share_photos WHERE photo_id IN \\(\\$1\\) AND share_id in \\(select id from shares where collection_id = \\$2\\)").
+			WithArgs(42, 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("DELETE FROM renditions WHERE photo_id IN \\(\\$1\\) AND rendition_configuration_id in \\(select id from rendition_configurations where collection_id = \\$2\\) returning id").
+			WithArgs(42, 3).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(102))
+		mock.ExpectQuery("UPDATE photos SET collection_id = \\$1, updated_at = \\$2, rendition_count = \\(select count\\(\\*\\) from renditions where renditions.photo_id = photos.id\\) WHERE id IN \\(\\$3\\) returning \\*").
+			WithArgs(4, now, 42).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id"}).AddRow(42, 4))
+		mock.ExpectExec("INSERT INTO tags").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT \\* FROM tags WHERE collection_id = \\$1").
+			WithArgs(4, "sunset").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "name"}).AddRow(9, 4, "sunset"))
+		mock.ExpectExec("INSERT INTO photo_tags").
+			WithArgs(42, 9, now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO rendition_jobs").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("update collections set photo_count").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("update albums set photo_count").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("update collections set photo_count").
+			WithArgs(4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("update albums set photo_count").
+			WithArgs(4).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photos, deleted, err := repo.MovePhotos(context.Background(), dbx, from, to, []int64{42}, TransferOptions{Albums: TransferRelink, Shares: TransferDrop})
+
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []int64{102}, deleted)
+		assert.Len(t, photos, 1)
+		assert.Equal(t, int64(4), photos[0].CollectionID)
+	})
+}
+
+func TestCopyPhotoKeepsFocalPointAndTakenAtOffset(t *testing.T) {
+	withPhotoRepo(t, func(mock sqlmock.Sqlmock, dbx *sqlx.DB, repo *PhotoRepo, now time.Time) {
+		from, to := Collection{Record: db.Record{ID: 3}}, Collection{Record: db.Record{ID: 4}}
+		dir, err := ioutil.TempDir("", "phts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		backend := storage.NewFileBackend(dir)
+		if err := backend.Put(101, strings.NewReader("jpeg"), 4, "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+
+		mock.ExpectQuery("SELECT \\* FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND id = \\$2 LIMIT 1").
+			WithArgs(3, 42).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "filename", "taken_at_offset", "focal_x", "focal_y"}).AddRow(42, 3, "tram.jpg", 7200, 0.25, 0.75))
+		mock.ExpectQuery("SELECT \\* FROM renditions WHERE original = \\$1 AND photo_id = \\$2 LIMIT 1").
+			WithArgs(true, 42).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "photo_id", "original", "format"}).AddRow(101, 42, true, "image/jpeg"))
+		mock.ExpectQuery("SELECT \\* FROM exif").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT name, value, source FROM photo_metadata").
+			WillReturnRows(sqlmock.NewRows([]string{"name", "value", "source"}))
+		mock.ExpectQuery("INSERT INTO photos \\(.*taken_at,taken_at_offset,published,focal_x,focal_y,").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 4, 0, "", "", "", "tram.jpg", nil, 7200, false, 0.25, 0.75, nil, nil, nil, nil, "", "", "", "").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(43)).RowsWillBeClosed()
+		mock.ExpectQuery("INSERT INTO renditions").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(102))
+		mock.ExpectQuery("UPDATE photos SET rendition_count").
+			WithArgs(43).
+			WillReturnRows(sqlmock.NewRows([]string{"rendition_count"}).AddRow(1))
+		mock.ExpectExec("UPDATE renditions SET content_hash").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		photo, rendition, err := repo.copyPhoto(context.Background(), dbx, backend, from, to, 42)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(102), rendition.ID)
+		assert.Equal(t, int64(43), photo.ID)
+		assert.Equal(t, 7200, *photo.TakenAtOffset)
+		assert.Equal(t, images.FocalPoint{X: 0.25, Y: 0.75}, photo.FocalPoint())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMovePhotosToSameCollection(t *testing.T) {
+	collection := Collection{Record: db.Record{ID: 3}}
+
+	_, _, err := NewPhotoRepo().MovePhotos(context.Background(), nil, collection, collection, []int64{42}, TransferOptions{Albums: TransferDrop, Shares: TransferDrop})
+
+	assert.Equal(t, ErrSameCollection, err)
+}
+
+func TestTransferOptionsValidate(t *testing.T) {
+	assert.Error(t, TransferOptions{}.Validate(false))
+	assert.Error(t, TransferOptions{Albums: TransferDrop}.Validate(true))
+	assert.Error(t, TransferOptions{Albums: "keep", Shares: TransferDrop}.Validate(true))
+	assert.NoError(t, TransferOptions{Albums: TransferRelink}.Validate(false))
+	assert.NoError(t, TransferOptions{Albums: TransferDrop, Shares: TransferRelink}.Validate(true))
+}
@@ -5,11 +5,14 @@ import (
 	"strings"
 
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/ilikeorangutans/phts/pkg/images"
 	"github.com/pkg/errors"
 )
 
 var ErrInvalidFiletype = errors.New("invalid file type")
 
+// FromReader creates a PhotoUpload from the given reader. Returns ErrInvalidFiletype if the reader doesn't contain an
+// image, and an images.UnsupportedFormatError if it contains an image in a format that can't be decoded.
 func FromReader(reader io.ReadSeeker, filename string) (PhotoUpload, error) {
 	mime, err := mimetype.DetectReader(reader)
 	if err != nil {
@@ -18,6 +21,9 @@ func FromReader(reader io.ReadSeeker, filename string) (PhotoUpload, error) {
 	if !strings.HasPrefix(mime.String(), "image/") {
 		return PhotoUpload{}, ErrInvalidFiletype
 	}
+	if !images.Supported(mime.String()) {
+		return PhotoUpload{}, images.UnsupportedFormatError{ContentType: mime.String()}
+	}
 
 	_, err = reader.Seek(0, io.SeekStart)
 	if err != nil {
@@ -35,4 +41,8 @@ type PhotoUpload struct {
 	Filename    string
 	Reader      io.ReadSeeker
 	ContentType string
+	// Sidecar is an optional .xmp sidecar with the photo's title, description, keywords, rating and copyright.
+	Sidecar io.Reader
+	// UserID is the user uploading the photo. The rating in the photo's metadata becomes their rating.
+	UserID int64
 }
@@ -3,10 +3,13 @@ package model
 import (
 	"bytes"
 	"errors"
+	"image"
+	"image/png"
 	"log"
 	"os"
 	"testing"
 
+	"github.com/ilikeorangutans/phts/pkg/images"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,3 +31,22 @@ func TestUploadWithJpeg(t *testing.T) {
 	assert.Equal(t, "image/jpeg", pu.ContentType)
 	assert.Equal(t, "some.jpg", pu.Filename)
 }
+
+func TestUploadWithPng(t *testing.T) {
+	b := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(b, image.NewGray(image.Rect(0, 0, 2, 2))))
+
+	pu, err := FromReader(bytes.NewReader(b.Bytes()), "some.png")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", pu.ContentType)
+}
+
+func TestUploadWithUnsupportedImageFormat(t *testing.T) {
+	// A minimal BMP header is enough for mime type detection.
+	bmp := append([]byte("BM"), make([]byte, 52)...)
+
+	_, err := FromReader(bytes.NewReader(bmp), "some.bmp")
+
+	assert.True(t, images.IsUnsupportedFormat(err))
+}
@@ -2,9 +2,14 @@ package model
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"log"
 
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/images"
+	"github.com/ilikeorangutans/phts/storage"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
@@ -20,7 +25,16 @@ type Rendition struct {
 	Original                 bool   `db:"original" json:"original"`
 	PhotoID                  int64  `db:"photo_id" json:"photoID"`
 	RenditionConfigurationID int64  `db:"rendition_configuration_id" json:"renditionConfigurationID"`
-	Width                    uint   `db:"width" json:"width"`
+	// RenditionConfigurationVersion is the version of the rendition configuration this rendition was made from.
+	RenditionConfigurationVersion int    `db:"rendition_configuration_version" json:"renditionConfigurationVersion"`
+	Width                         uint   `db:"width" json:"width"`
+	ContentHash                   string `db:"content_hash" json:"-"`
+}
+
+// ServableRendition is a rendition together with what's needed to serve its binary over HTTP.
+type ServableRendition struct {
+	Rendition
+	CacheControl string `db:"cache_control"`
 }
 
 // FindOriginalRenditionByPhoto finds the original rendition for a photo
@@ -57,6 +71,7 @@ func InsertRendition(ctx context.Context, tx sqlx.ExtContext, rendition Renditio
 			"height",
 			"format",
 			"rendition_configuration_id",
+			"rendition_configuration_version",
 		).
 		Values(
 			rendition.CreatedAt,
@@ -67,6 +82,7 @@ func InsertRendition(ctx context.Context, tx sqlx.ExtContext, rendition Renditio
 			rendition.Height,
 			rendition.Format,
 			rendition.RenditionConfigurationID,
+			rendition.RenditionConfigurationVersion,
 		).
 		Suffix("returning id").
 		ToSql()
@@ -111,3 +127,232 @@ func FindRenditionsForPhoto(ctx context.Context, tx sqlx.QueryerContext, photo P
 	}
 	return renditions, nil
 }
+
+// FindServableRenditionInCollection finds the rendition with the given id if it belongs to a photo in the given collection.
+func FindServableRenditionInCollection(ctx context.Context, tx sqlx.QueryerContext, collection Collection, id int64) (ServableRendition, error) {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("r.*", "rc.cache_control").
+		From("renditions AS r").
+		Join("photos AS p ON p.id = r.photo_id").
+		Join("rendition_configurations AS rc ON rc.id = r.rendition_configuration_id").
+		Where(sq.Eq{
+			"r.id":            id,
+			"p.collection_id": collection.ID,
+		}).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return ServableRendition{}, errors.Wrap(err, "could not create query")
+	}
+
+	var rendition ServableRendition
+	err = sqlx.GetContext(ctx, tx, &rendition, sql, args...)
+	if err != nil {
+		return ServableRendition{}, errors.Wrap(err, "could not get rendition")
+	}
+
+	return rendition, nil
+}
+
+// FindServableRenditionInShare finds the rendition with the given id if it belongs to one of the photos of the given
+// share and was made from one of the share's rendition configurations. Renditions that may carry metadata are never served
+// on share sites.
+func FindServableRenditionInShare(ctx context.Context, tx sqlx.QueryerContext, share Share, id int64) (ServableRendition, error) {
+	inShare, err := photoInShare("r.photo_id", share)
+	if err != nil {
+		return ServableRendition{}, err
+	}
+
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("r.*", "rc.cache_control").
+		From("renditions AS r").
+		Join("share_rendition_configurations AS src ON src.rendition_configuration_id = r.rendition_configuration_id").
+		Join("rendition_configurations AS rc ON rc.id = r.rendition_configuration_id").
+		Where(inShare).
+		Where(sq.Eq{
+			"src.share_id": share.ID,
+			"r.id":         id,
+			"rc.metadata":  images.MetadataStrip,
+		}).
+		Limit(1).
+		ToSql()
+	if err != nil {
+		return ServableRendition{}, errors.Wrap(err, "could not create query")
+	}
+
+	var rendition ServableRendition
+	err = sqlx.GetContext(ctx, tx, &rendition, sql, args...)
+	if err != nil {
+		return ServableRendition{}, errors.Wrap(err, "could not get rendition")
+	}
+
+	return rendition, nil
+}
+
+// DeleteRenditionsForPhotoAndConfiguration deletes the renditions of the given photo that were made from any version
+// of the given configuration. Returns the ids of the deleted renditions so their binaries can be removed once the
+// transaction is committed.
+func DeleteRenditionsForPhotoAndConfiguration(ctx context.Context, tx sqlx.QueryerContext, photo Photo, config RenditionConfiguration) ([]int64, error) {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete("renditions").
+		Where(sq.Eq{
+			"photo_id":                   photo.ID,
+			"rendition_configuration_id": config.ID,
+		}).
+		Suffix("returning id").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create query")
+	}
+
+	var ids []int64
+	if err := sqlx.SelectContext(ctx, tx, &ids, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not delete renditions")
+	}
+
+	return ids, nil
+}
+
+// outdatedRenditionVersion is a rendition configuration version that is never current, configurations start at
+// version 1.
+const outdatedRenditionVersion = 0
+
+// OutdateRenditionsForPhotoInMode marks the renditions of the given photo that were made by rendition configurations
+// with the given resize mode as made from an older version of their configuration. They are served until the worker
+// replaces them, like renditions of a changed configuration. Returns the number of outdated renditions.
+func OutdateRenditionsForPhotoInMode(ctx context.Context, tx sqlx.ExecerContext, photo Photo, mode images.ResizeMode) (int64, error) {
+	sql := `
+	  update renditions as r
+	  set rendition_configuration_version = $1
+	  from rendition_configurations as rc
+	  where rc.id = r.rendition_configuration_id and r.photo_id = $2 and rc.resize and rc.mode = $3
+	`
+	result, err := tx.ExecContext(ctx, sql, outdatedRenditionVersion, photo.ID, mode)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not outdate renditions")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not count outdated renditions")
+	}
+	return n, nil
+}
+
+// sameConfigurationFamily is a condition that the rendition configuration rc renders like the configuration of the
+// given rendition apart from the format, so their renditions can stand in for each other.
+func sameConfigurationFamily(rendition ServableRendition) sq.Sqlizer {
+	return sq.Expr(
+		"(rc.width, rc.height, rc.resize, rc.original, rc.mode, rc.quality, rc.metadata) = (select width, height, resize, original, mode, quality, metadata from rendition_configurations where id = ?)",
+		rendition.RenditionConfigurationID,
+	)
+}
+
+// FindServableVariantsInCollection finds the renditions of the same photo with the same dimensions as the given
+// rendition whose configurations only differ from its configuration in the format, including the rendition itself.
+func FindServableVariantsInCollection(ctx context.Context, tx sqlx.QueryerContext, collection Collection, rendition ServableRendition) ([]ServableRendition, error) {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("r.*", "rc.cache_control").
+		From("renditions AS r").
+		Join("photos AS p ON p.id = r.photo_id").
+		Join("rendition_configurations AS rc ON rc.id = r.rendition_configuration_id").
+		Where(sq.Eq{
+			"r.photo_id":      rendition.PhotoID,
+			"r.width":         rendition.Width,
+			"r.height":        rendition.Height,
+			"p.collection_id": collection.ID,
+		}).
+		Where(sameConfigurationFamily(rendition)).
+		OrderBy("r.id").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create query")
+	}
+
+	var variants []ServableRendition
+	if err := sqlx.SelectContext(ctx, tx, &variants, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select variants")
+	}
+
+	return variants, nil
+}
+
+// FindServableVariantsInShare finds the renditions of the same photo with the same dimensions as the given rendition
+// that were made from one of the share's rendition configurations, including the rendition itself. Like in
+// FindServableVariantsInCollection, the configurations may only differ in the format.
+func FindServableVariantsInShare(ctx context.Context, tx sqlx.QueryerContext, share Share, rendition ServableRendition) ([]ServableRendition, error) {
+	inShare, err := photoInShare("r.photo_id", share)
+	if err != nil {
+		return nil, err
+	}
+
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("r.*", "rc.cache_control").
+		From("renditions AS r").
+		Join("share_rendition_configurations AS src ON src.rendition_configuration_id = r.rendition_configuration_id").
+		Join("rendition_configurations AS rc ON rc.id = r.rendition_configuration_id").
+		Where(inShare).
+		Where(sq.Eq{
+			"src.share_id": share.ID,
+			"r.photo_id":   rendition.PhotoID,
+			"r.width":      rendition.Width,
+			"r.height":     rendition.Height,
+			"rc.metadata":  images.MetadataStrip,
+		}).
+		Where(sameConfigurationFamily(rendition)).
+		OrderBy("r.id").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create query")
+	}
+
+	var variants []ServableRendition
+	if err := sqlx.SelectContext(ctx, tx, &variants, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select variants")
+	}
+
+	return variants, nil
+}
+
+// UpdateRenditionContentHash persists the content hash of the given rendition.
+func UpdateRenditionContentHash(ctx context.Context, tx sqlx.ExecerContext, rendition Rendition) error {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update("renditions").
+		Set("content_hash", rendition.ContentHash).
+		Where(sq.Eq{"id": rendition.ID}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not create query")
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not update content hash")
+	}
+
+	return nil
+}
+
+// PutRenditionBinary streams size bytes from the reader into the backend as the binary of the given rendition and
+// records the content hash.
+func PutRenditionBinary(ctx context.Context, tx sqlx.ExecerContext, backend storage.Backend, rendition Rendition, reader io.Reader, size int64) (Rendition, error) {
+	hash := sha256.New()
+	if err := backend.Put(rendition.ID, io.TeeReader(reader, hash), size, rendition.Format); err != nil {
+		return rendition, errors.Wrap(err, "could not store binary")
+	}
+
+	rendition.ContentHash = hex.EncodeToString(hash.Sum(nil))
+	if err := UpdateRenditionContentHash(ctx, tx, rendition); err != nil {
+		return rendition, errors.Wrap(err, "could not record content hash")
+	}
+
+	return rendition, nil
+}
+
+// ContentHash computes the content hash of the given reader the same way PutRenditionBinary does.
+func ContentHash(reader io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, reader); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -3,15 +3,16 @@ package model
 import (
 	"bytes"
 	"context"
-	"image"
-	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"os"
 	"time"
 
-	"github.com/disintegration/imaging"
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/images"
 	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/ilikeorangutans/phts/storage"
 	"github.com/jmoiron/sqlx"
-	"github.com/nfnt/resize"
 	"github.com/pkg/errors"
 	"github.com/rwcarlsen/goexif/exif"
 
@@ -31,60 +32,190 @@ type RenditionConfiguration struct {
 	Quality      int    `db:"quality" json:"quality"`
 	Resize       bool   `db:"resize" json:"resize"`
 	Width        int    `db:"width" json:"width"`
+	CacheControl string `db:"cache_control" json:"cacheControl"`
+	// Version is incremented whenever a change to the configuration makes existing renditions outdated.
+	Version int `db:"version" json:"version"`
+	// Format is the content type renditions are encoded in.
+	Format string `db:"format" json:"format"`
+	// Mode describes how originals are fitted into Width and Height.
+	Mode images.ResizeMode `db:"mode" json:"mode"`
+	// Metadata describes which metadata of the original is kept.
+	Metadata images.MetadataPolicy `db:"metadata" json:"metadata"`
 }
 
-func (r RenditionConfiguration) Process(ctx context.Context, data []byte) (Rendition, []byte, error) {
-	orientation := metadata.Horizontal
+// EncodeOptions returns the options to encode renditions with.
+func (r RenditionConfiguration) EncodeOptions() images.EncodeOptions {
+	return images.EncodeOptions{Quality: r.Quality}
+}
 
-	reader := bytes.NewReader(data)
-	e, err := exif.Decode(reader)
-	if err != nil && exif.IsCriticalError(err) {
-	} else {
-		if orientationTag, err := e.Get(exif.Orientation); err == nil {
-			if orientationValue, err := orientationTag.Int(0); err == nil {
-				orientation = metadata.ExifOrientation(orientationValue)
-			}
+// OutputFormat returns the content type renditions are encoded in.
+func (r RenditionConfiguration) OutputFormat() string {
+	if r.Format == "" {
+		return db.DefaultRenditionFormat
+	}
+	return r.Format
+}
+
+// ResizeMode returns how originals are fitted into the configured dimensions.
+func (r RenditionConfiguration) ResizeMode() images.ResizeMode {
+	if r.Mode == "" {
+		return images.DefaultResizeMode
+	}
+	return r.Mode
+}
+
+// MetadataPolicy returns which metadata of the original is kept.
+func (r RenditionConfiguration) MetadataPolicy() images.MetadataPolicy {
+	if r.Metadata == "" {
+		return images.DefaultMetadataPolicy
+	}
+	return r.Metadata
+}
+
+// Shareable returns true if renditions made from this configuration may be served on share sites. Only renditions
+// without metadata are.
+func (r RenditionConfiguration) Shareable() bool {
+	return r.MetadataPolicy() == images.MetadataStrip
+}
+
+// Validate returns an error if renditions cannot be produced with this configuration.
+func (r RenditionConfiguration) Validate() error {
+	if err := r.MetadataPolicy().Validate(); err != nil {
+		return err
+	}
+	if r.Resize {
+		if err := r.ResizeMode().Validate(r.Width, r.Height); err != nil {
+			return err
 		}
 	}
+	return images.CanEncode(r.OutputFormat())
+}
+
+// Process produces a rendition of the given original. Fill renditions are cropped around the given focal point and
+// metadata is kept or removed according to the metadata policy. The returned binary must be closed; if the
+// configuration neither resizes nor removes metadata it is the original itself, rewound to the start, and closing it
+// leaves the original open. Originals that are not resized are not decoded and their metadata is filtered into a
+// temporary file, so they are never held in memory.
+func (r RenditionConfiguration) Process(ctx context.Context, original io.ReadSeeker, focus images.FocalPoint) (Rendition, storage.ReadSeekCloser, error) {
+	orientation := metadata.Horizontal
+	if e, err := exif.Decode(original); err == nil || !exif.IsCriticalError(err) {
+		orientation = metadata.ExifOrientationFromExif(e)
+	}
 
 	var rendition Rendition
-	// TODO move most of this into the rendition
-	rawJpeg, err := jpeg.Decode(bytes.NewReader(data))
-	if err != nil {
-		return rendition, nil, errors.Wrap(err, "error decoding jpeg")
+	if _, err := original.Seek(0, io.SeekStart); err != nil {
+		return rendition, nil, errors.Wrap(err, "could not rewind")
 	}
 
-	rawJpeg = rotate(rawJpeg, orientation.Angle())
+	policy := r.MetadataPolicy()
+	if !r.Resize {
+		config, contentType, err := images.DecodeConfig(original)
+		if images.IsUnsupportedFormat(err) {
+			return rendition, nil, err
+		} else if err != nil {
+			return rendition, nil, errors.Wrap(err, "error decoding image size")
+		}
+		if _, err := original.Seek(0, io.SeekStart); err != nil {
+			return rendition, nil, errors.Wrap(err, "could not rewind")
+		}
+
+		width, height := orientation.Dimensions(config.Width, config.Height)
+		rendition := r.rendition(uint(width), uint(height), contentType)
+		if policy == images.MetadataKeep {
+			return rendition, nopCloser{original}, nil
+		}
+		if images.CanFilterMetadata(contentType) {
+			binary, err := filterMetadata(original, contentType, policy)
+			if err != nil {
+				return Rendition{}, nil, errors.Wrap(err, "could not filter metadata")
+			}
+			return rendition, binary, nil
+		}
+	}
 
-	width, height := uint(rawJpeg.Bounds().Dx()), uint(rawJpeg.Bounds().Dy())
-	if orientation.Angle()%180 != 0 {
-		width, height = height, width
+	// TODO move most of this into the rendition
+	raw, contentType, err := images.Decode(original)
+	if images.IsUnsupportedFormat(err) {
+		return rendition, nil, err
+	} else if err != nil {
+		return rendition, nil, errors.Wrap(err, "error decoding image")
 	}
+	raw = orientation.Normalize(raw)
 
-	binary := data
+	if _, err := original.Seek(0, io.SeekStart); err != nil {
+		return rendition, nil, errors.Wrap(err, "could not rewind")
+	}
 
+	// Originals whose metadata can't be filtered in place are re-encoded at full size, which drops all metadata.
+	resized := raw
 	if r.Resize {
 		// TODO instead of reading from rawJpeg we should take the previous result (which should be smaller than the original, but bigger than this version
-		resized := resize.Resize(uint(r.Width), 0, rawJpeg, resize.Lanczos3)
-		var b = &bytes.Buffer{}
-		if err := jpeg.Encode(b, resized, &jpeg.Options{Quality: r.Quality}); err != nil {
-			return rendition, nil, errors.Wrap(err, "could not encode jpeg")
-		}
-		width = uint(resized.Bounds().Dx())
-		height = uint(resized.Bounds().Dy())
-		binary = b.Bytes()
+		resized = images.Resize(raw, r.ResizeMode(), r.Width, r.Height, focus)
+	}
+	var b = &bytes.Buffer{}
+	if err := images.Encode(b, resized, r.OutputFormat(), r.EncodeOptions()); err != nil {
+		return rendition, nil, errors.Wrap(err, "could not encode rendition")
+	}
+	encoded, err := images.CopyMetadata(b.Bytes(), r.OutputFormat(), original, contentType, policy)
+	if err != nil {
+		return rendition, nil, errors.Wrap(err, "could not copy metadata")
 	}
 
-	rendition = Rendition{
-		Timestamps:               db.JustCreated(time.Now),
-		Width:                    width,
-		Height:                   height,
-		Format:                   "image/jpeg",
-		Original:                 false,
-		RenditionConfigurationID: r.ID,
+	return r.rendition(uint(resized.Bounds().Dx()), uint(resized.Bounds().Dy()), r.OutputFormat()), nopCloser{bytes.NewReader(encoded)}, nil
+}
+
+// filterMetadata writes the original without the metadata the policy doesn't allow into a temporary file, which is
+// removed once it is closed.
+func filterMetadata(original io.Reader, contentType string, policy images.MetadataPolicy) (storage.ReadSeekCloser, error) {
+	f, err := ioutil.TempFile("", "phts-rendition-*")
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create temporary file")
 	}
+	binary := tempFile{f}
+	if err := images.FilterMetadata(f, original, contentType, policy); err != nil {
+		binary.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		binary.Close()
+		return nil, errors.Wrap(err, "could not rewind")
+	}
+	return binary, nil
+}
 
-	return rendition, binary, nil
+// tempFile is a temporary file that is removed when it is closed.
+type tempFile struct {
+	*os.File
+}
+
+func (f tempFile) Close() error {
+	err := f.File.Close()
+	if removeErr := os.Remove(f.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// nopCloser is a binary whose reader is closed by someone else, or needs no closing.
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// rendition returns a new rendition made from this configuration.
+func (r RenditionConfiguration) rendition(width, height uint, contentType string) Rendition {
+	return Rendition{
+		Timestamps:                    db.JustCreated(time.Now),
+		Width:                         width,
+		Height:                        height,
+		Format:                        contentType,
+		Original:                      false,
+		RenditionConfigurationID:      r.ID,
+		RenditionConfigurationVersion: r.Version,
+	}
 }
 
 // FindOriginalRenditionConfiguration finds the single rendition configuration for original renditions.
@@ -109,7 +240,7 @@ func FindOriginalRenditionConfiguration(ctx context.Context, dbx sqlx.ExtContext
 }
 
 // FindMissingRenditionConfigurations finds all rendition configurations for which the given photo doesn't have
-// a rendition.
+// a rendition, or only has one made from an older version of the configuration.
 func FindMissingRenditionConfigurations(ctx context.Context, dbx sqlx.QueryerContext, photo Photo) ([]RenditionConfiguration, error) {
 	sql := `
 	  select
@@ -123,13 +254,17 @@ func FindMissingRenditionConfigurations(ctx context.Context, dbx sqlx.QueryerCon
 		  collection_id = $1
 		)
 		and
-		id not in (
+		not exists (
 		  select
-			rendition_configuration_id
+			1
 		  from
 			renditions
 		  where
 			photo_id = $2
+			and
+			rendition_configuration_id = rendition_configurations.id
+			and
+			rendition_configuration_version = rendition_configurations.version
 		)
 	`
 
@@ -187,18 +322,159 @@ func FindApplicableRenditionConfigurations(ctx context.Context, dbx sqlx.Queryer
 	return configs, nil
 }
 
-func rotate(img image.Image, angle int) image.Image {
-	//var result *image.NRGBA
-	var result image.Image = img
-	switch angle {
-	case -90:
-		// Angles are opposite as imaging uses counter clockwise angles and we use clockwise.
-		result = imaging.Rotate270(img)
-	case 90:
-		result = imaging.Rotate270(img)
-	case 180:
-		result = imaging.Rotate180(img)
-	default:
-	}
-	return result
+// ErrSystemRenditionConfiguration is returned when trying to change a rendition configuration that is shared by all
+// collections.
+var ErrSystemRenditionConfiguration = errors.New("cannot change system rendition configuration")
+
+// FindRenditionConfigurationInCollection finds the rendition configuration with the given id that is applicable to
+// the given collection.
+func FindRenditionConfigurationInCollection(ctx context.Context, dbx sqlx.QueryerContext, collection Collection, id int64) (RenditionConfiguration, error) {
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select("*").
+		From("rendition_configurations").
+		Where(sq.Eq{"id": id}).
+		Where(sq.Or{
+			sq.Eq{"collection_id": collection.ID},
+			sq.Eq{"collection_id": nil},
+		}).
+		ToSql()
+	if err != nil {
+		return RenditionConfiguration{}, errors.Wrap(err, "could not create query")
+	}
+
+	var config RenditionConfiguration
+	if err := sqlx.GetContext(ctx, dbx, &config, sql, args...); err != nil {
+		return RenditionConfiguration{}, errors.Wrap(err, "could not get rendition configuration")
+	}
+
+	return config, nil
+}
+
+// UpdateRenditionConfiguration persists the given rendition configuration. If any setting that affects the rendered
+// image changed the version is incremented, making all renditions of the previous version outdated.
+func UpdateRenditionConfiguration(ctx context.Context, dbx sqlx.QueryerContext, config RenditionConfiguration) (RenditionConfiguration, error) {
+	if config.CollectionID == nil {
+		return config, ErrSystemRenditionConfiguration
+	}
+	if config.CacheControl == "" {
+		config.CacheControl = db.DefaultCacheControl
+	}
+	if config.Format == "" {
+		config.Format = db.DefaultRenditionFormat
+	}
+	config.Mode = config.ResizeMode()
+	config.Metadata = config.MetadataPolicy()
+
+	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Update("rendition_configurations").
+		// The right hand side sees the values from before the update.
+		Set("version", sq.Expr(
+			"case when (width, height, quality, resize, format, mode, metadata) is distinct from (?, ?, ?, ?, ?, ?, ?) then version + 1 else version end",
+			config.Width, config.Height, config.Quality, config.Resize, config.Format, config.Mode, config.Metadata,
+		)).
+		Set("width", config.Width).
+		Set("height", config.Height).
+		Set("quality", config.Quality).
+		Set("resize", config.Resize).
+		Set("format", config.Format).
+		Set("mode", config.Mode).
+		Set("metadata", config.Metadata).
+		Set("name", config.Name).
+		Set("cache_control", config.CacheControl).
+		Set("updated_at", time.Now()).
+		Where(sq.Eq{"id": config.ID, "collection_id": *config.CollectionID}).
+		Suffix("returning *").
+		ToSql()
+	if err != nil {
+		return config, errors.Wrap(err, "could not create query")
+	}
+
+	var updated RenditionConfiguration
+	if err := sqlx.GetContext(ctx, dbx, &updated, sql, args...); err != nil {
+		return config, errors.Wrap(err, "could not update rendition configuration")
+	}
+
+	return updated, nil
+}
+
+// IsRenditionConfigurationShared returns true if the given rendition configuration is attached to any share.
+func IsRenditionConfigurationShared(ctx context.Context, dbx sqlx.QueryerContext, config RenditionConfiguration) (bool, error) {
+	var shared bool
+	sql := "select exists (select 1 from share_rendition_configurations where rendition_configuration_id = $1)"
+	if err := dbx.QueryRowxContext(ctx, sql, config.ID).Scan(&shared); err != nil {
+		return false, errors.Wrap(err, "could not query shares")
+	}
+
+	return shared, nil
+}
+
+// DeleteRenditionConfiguration deletes the given rendition configuration together with all its renditions. Returns
+// the ids of the deleted renditions so their binaries can be removed once the transaction is committed.
+func DeleteRenditionConfiguration(ctx context.Context, tx sqlx.ExtContext, config RenditionConfiguration) ([]int64, error) {
+	if config.CollectionID == nil {
+		return nil, ErrSystemRenditionConfiguration
+	}
+
+	sql := `
+	  with deleted as (
+		delete from renditions where rendition_configuration_id = $1 returning id, photo_id
+	  ), counted as (
+		update photos set rendition_count = rendition_count - 1 where id in (select photo_id from deleted)
+	  )
+	  select id from deleted
+	`
+	var renditionIDs []int64
+	if err := sqlx.SelectContext(ctx, tx, &renditionIDs, sql, config.ID); err != nil {
+		return nil, errors.Wrap(err, "could not delete renditions")
+	}
+
+	_, err := tx.ExecContext(ctx, "delete from rendition_configurations where id = $1 and collection_id = $2", config.ID, *config.CollectionID)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not delete rendition configuration")
+	}
+
+	return renditionIDs, nil
+}
+
+// RenditionConfigurationProgress describes how many photos in a collection have a rendition made from the current
+// version of a rendition configuration.
+type RenditionConfigurationProgress struct {
+	Version   int `db:"version" json:"version"`
+	Photos    int `db:"photos" json:"photos"`
+	Current   int `db:"current" json:"current"`
+	Remaining int `db:"remaining" json:"remaining"`
+}
+
+// Done returns whether all photos have an up to date rendition.
+func (p RenditionConfigurationProgress) Done() bool {
+	return p.Remaining == 0
+}
+
+// FindRenditionConfigurationProgress counts the photos in the given collection that are, and are not yet, rendered
+// with the current version of the given rendition configuration.
+func FindRenditionConfigurationProgress(ctx context.Context, dbx sqlx.QueryerContext, collection Collection, config RenditionConfiguration) (RenditionConfigurationProgress, error) {
+	sql := `
+	  select
+		count(photos.id) as photos,
+		count(renditions.id) as current
+	  from
+		photos
+		left join renditions on (
+		  renditions.photo_id = photos.id
+		  and
+		  renditions.rendition_configuration_id = $1
+		  and
+		  renditions.rendition_configuration_version = $2
+		)
+	  where
+		photos.collection_id = $3
+	`
+
+	progress := RenditionConfigurationProgress{Version: config.Version}
+	if err := dbx.QueryRowxContext(ctx, sql, config.ID, config.Version, collection.ID).StructScan(&progress); err != nil {
+		return progress, errors.Wrap(err, "could not count renditions")
+	}
+	progress.Remaining = progress.Photos - progress.Current
+
+	return progress, nil
 }
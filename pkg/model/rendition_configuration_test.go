@@ -2,11 +2,18 @@ package model
 
 import (
 	"context"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/images"
 	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestFindMissingrenditionConfigurations(t *testing.T) {
@@ -15,3 +22,140 @@ func TestFindMissingrenditionConfigurations(t *testing.T) {
 		// TODO finish me
 	})
 }
+
+func TestUpdateRenditionConfigurationBumpsVersionOnChange(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		collectionID := int64(7)
+		now := time.Now()
+		mock.ExpectQuery("UPDATE rendition_configurations SET version = case when \\(width, height, quality, resize, format, mode, metadata\\) is distinct from \\(\\$1, \\$2, \\$3, \\$4, \\$5, \\$6, \\$7\\) then version \\+ 1 else version end, .* WHERE collection_id = \\$18 AND id = \\$19 returning \\*").
+			WithArgs(
+				800, 0, 90, true, "image/png", "fit-width", "strip",
+				800, 0, 90, true, "image/png", "fit-width", "strip",
+				"large", db.DefaultCacheControl, sqlmock.AnyArg(), collectionID, 13,
+			).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "collection_id", "name", "width", "height", "quality", "resize", "cache_control", "version", "created_at", "updated_at"}).
+					AddRow(13, collectionID, "large", 800, 0, 90, true, db.DefaultCacheControl, 2, now, now),
+			)
+
+		config, err := UpdateRenditionConfiguration(ctx, dbx, RenditionConfiguration{
+			Record:       db.Record{ID: 13},
+			CollectionID: &collectionID,
+			Name:         "large",
+			Width:        800,
+			Quality:      90,
+			Resize:       true,
+			Format:       "image/png",
+			Version:      1,
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, config.Version)
+	})
+}
+
+func TestUpdateRenditionConfigurationRejectsSystemConfiguration(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		_, err := UpdateRenditionConfiguration(ctx, dbx, RenditionConfiguration{Record: db.Record{ID: 2}})
+
+		assert.Equal(t, ErrSystemRenditionConfiguration, err)
+	})
+}
+
+func TestDeleteRenditionConfiguration(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		collectionID := int64(7)
+		mock.ExpectQuery("delete from renditions where rendition_configuration_id = \\$1 returning id, photo_id").
+			WithArgs(13).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101).AddRow(102))
+		mock.ExpectExec("delete from rendition_configurations where id = \\$1 and collection_id = \\$2").
+			WithArgs(13, collectionID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		ids, err := DeleteRenditionConfiguration(ctx, dbx, RenditionConfiguration{Record: db.Record{ID: 13}, CollectionID: &collectionID})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []int64{101, 102}, ids)
+	})
+}
+
+func TestFindRenditionConfigurationProgress(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("select .* from photos left join renditions").
+			WithArgs(13, 3, 7).
+			WillReturnRows(sqlmock.NewRows([]string{"photos", "current"}).AddRow(10, 4))
+
+		progress, err := FindRenditionConfigurationProgress(ctx, dbx, Collection{Record: db.Record{ID: 7}}, RenditionConfiguration{Record: db.Record{ID: 13}, Version: 3})
+
+		assert.NoError(t, err)
+		assert.Equal(t, RenditionConfigurationProgress{Version: 3, Photos: 10, Current: 4, Remaining: 6}, progress)
+		assert.False(t, progress.Done())
+	})
+}
+
+// assertUpright checks that the given image shows the 5x3 upright test pattern from pkg/metadata/testdata/orientation,
+// scaled by the given block size.
+func assertUpright(t *testing.T, img image.Image, block int) {
+	assert.Equal(t, image.Pt(5*block, 3*block), img.Bounds().Size())
+	for x := 0; x < 5; x++ {
+		for y := 0; y < 3; y++ {
+			r, g, b, _ := img.At(img.Bounds().Min.X+x*block+block/2, img.Bounds().Min.Y+y*block+block/2).RGBA()
+			assert.InDelta(t, x*50, int(r>>8), 24, "red of block %dx%d", x, y)
+			assert.InDelta(t, y*100, int(g>>8), 24, "green of block %dx%d", x, y)
+			assert.InDelta(t, 200, int(b>>8), 24, "blue of block %dx%d", x, y)
+		}
+	}
+}
+
+func TestProcessNormalizesOrientation(t *testing.T) {
+	resized := RenditionConfiguration{Width: 20, Resize: true, Quality: 100}
+	original := RenditionConfiguration{Original: true}
+
+	for o := 1; o <= 8; o++ {
+		t.Run(fmt.Sprintf("orientation %d", o), func(t *testing.T) {
+			f, err := os.Open(fmt.Sprintf("../metadata/testdata/orientation/%d.jpg", o))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			rendition, binary, err := resized.Process(context.Background(), f, images.CenterFocalPoint)
+			assert.NoError(t, err)
+			defer binary.Close()
+			assert.Equal(t, []uint{20, 12}, []uint{rendition.Width, rendition.Height})
+			img, _, err := images.Decode(binary)
+			assert.NoError(t, err)
+			assertUpright(t, img, 4)
+
+			if _, err := f.Seek(0, 0); err != nil {
+				t.Fatal(err)
+			}
+			rendition, filtered, err := original.Process(context.Background(), f, images.CenterFocalPoint)
+			assert.NoError(t, err)
+			defer filtered.Close()
+			assert.Equal(t, []uint{40, 24}, []uint{rendition.Width, rendition.Height})
+		})
+	}
+}
+
+func TestProcessFiltersOriginalIntoTemporaryFile(t *testing.T) {
+	f, err := os.Open("../images/testdata/gps.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, binary, err := RenditionConfiguration{Original: true}.Process(context.Background(), f, images.CenterFocalPoint)
+	assert.NoError(t, err)
+	file, ok := binary.(tempFile)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	data, err := ioutil.ReadAll(binary)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "Jane Doe")
+
+	assert.NoError(t, binary.Close())
+	_, err = os.Stat(file.Name())
+	assert.True(t, os.IsNotExist(err))
+}
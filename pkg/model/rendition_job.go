@@ -0,0 +1,428 @@
+package model
+
+import (
+	"context"
+	godb "database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// RenditionJobState is the state of a rendition job.
+type RenditionJobState string
+
+const (
+	// RenditionJobPending jobs are waiting to be claimed by a worker.
+	RenditionJobPending RenditionJobState = "pending"
+	// RenditionJobRunning jobs are claimed by a worker. If the worker does not finish before the lease runs out the
+	// job can be claimed again.
+	RenditionJobRunning RenditionJobState = "running"
+	// RenditionJobFailed jobs have used up all their attempts and will not be retried automatically.
+	RenditionJobFailed RenditionJobState = "failed"
+	// RenditionJobDone jobs finished successfully.
+	RenditionJobDone RenditionJobState = "done"
+	// RenditionJobCancelled jobs were cancelled by an admin and will not be retried automatically.
+	RenditionJobCancelled RenditionJobState = "cancelled"
+)
+
+// RenditionJobStates lists all valid job states.
+var RenditionJobStates = []RenditionJobState{
+	RenditionJobPending,
+	RenditionJobRunning,
+	RenditionJobFailed,
+	RenditionJobDone,
+	RenditionJobCancelled,
+}
+
+// ParseRenditionJobState returns the job state with the given name.
+func ParseRenditionJobState(s string) (RenditionJobState, error) {
+	for _, state := range RenditionJobStates {
+		if string(state) == s {
+			return state, nil
+		}
+	}
+	return "", errors.Errorf("unknown rendition job state %q", s)
+}
+
+const (
+	// DefaultRenditionJobMaxAttempts is the number of times a job is tried before it is marked as failed.
+	DefaultRenditionJobMaxAttempts = 5
+	renditionJobBaseBackoff        = 30 * time.Second
+	renditionJobMaxBackoff         = time.Hour
+)
+
+// ErrNoRenditionJob is returned when there is no job ready to be claimed.
+var ErrNoRenditionJob = errors.New("no rendition job ready")
+
+// ErrRenditionJobStateConflict is returned when a job cannot be retried or cancelled because of its current state.
+var ErrRenditionJobStateConflict = errors.New("rendition job state does not allow this")
+
+// activeJobForSamePhoto matches rendition_jobs rows whose photo already has a pending or running job.
+const activeJobForSamePhoto = "not exists (select 1 from rendition_jobs active where active.photo_id = rendition_jobs.photo_id and active.state in ('pending', 'running'))"
+
+// RenditionJob is a request to bring the renditions of a photo up to date.
+type RenditionJob struct {
+	db.Record
+	db.Timestamps
+
+	PhotoID     int64             `db:"photo_id" json:"photoID"`
+	State       RenditionJobState `db:"state" json:"state"`
+	Attempts    int               `db:"attempts" json:"attempts"`
+	MaxAttempts int               `db:"max_attempts" json:"maxAttempts"`
+	LastError   string            `db:"last_error" json:"lastError"`
+	RunAfter    time.Time         `db:"run_after" json:"runAfter"`
+	LeasedUntil *time.Time        `db:"leased_until" json:"leasedUntil"`
+	// RequestedAt is when renditions of the photo were last requested. A running job whose row was requested again
+	// after it was claimed goes back to pending when it completes.
+	RequestedAt time.Time `db:"requested_at" json:"requestedAt"`
+}
+
+func NewRenditionJobRepo() *RenditionJobRepo {
+	return &RenditionJobRepo{
+		clock: time.Now,
+		stmt:  sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// RenditionJobRepo persists rendition jobs in the rendition_jobs table so they survive restarts.
+type RenditionJobRepo struct {
+	clock func() time.Time
+	stmt  sq.StatementBuilderType
+}
+
+// Enqueue adds a pending job for the given photo. If the photo already has a pending or running job no new job is
+// added, but the job is requested again so a running job makes another pass once it is done.
+func (r *RenditionJobRepo) Enqueue(ctx context.Context, tx sqlx.ExecerContext, photoID int64) error {
+	now := r.clock()
+	sql, args, err := r.stmt.
+		Insert("rendition_jobs").
+		Columns("photo_id", "state", "attempts", "max_attempts", "last_error", "run_after", "requested_at", "created_at", "updated_at").
+		Values(photoID, RenditionJobPending, 0, DefaultRenditionJobMaxAttempts, "", now, now, now, now).
+		Suffix("ON CONFLICT (photo_id) WHERE state IN ('pending', 'running') DO UPDATE SET requested_at = excluded.requested_at").
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not insert job")
+	}
+
+	return nil
+}
+
+// EnqueueCollection adds a pending job for every photo in the given collection, or requests the pending or running job
+// of the photo again like Enqueue. Returns the number of enqueued or requested jobs.
+func (r *RenditionJobRepo) EnqueueCollection(ctx context.Context, tx sqlx.ExecerContext, collection Collection) (int64, error) {
+	now := r.clock()
+	sql := `
+	  insert into rendition_jobs (photo_id, state, attempts, max_attempts, last_error, run_after, requested_at, created_at, updated_at)
+	  select id, $1, 0, $2, '', $3, $3, $3, $3 from photos where collection_id = $4 and deleted_at is null
+	  on conflict (photo_id) where state in ('pending', 'running') do update set requested_at = excluded.requested_at
+	`
+	result, err := tx.ExecContext(ctx, sql, RenditionJobPending, DefaultRenditionJobMaxAttempts, now, collection.ID)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not insert jobs")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not count enqueued jobs")
+	}
+
+	return n, nil
+}
+
+// Claim leases the next job that is ready to run for the given duration. Pending jobs whose run_after has passed and
+// running jobs whose lease has expired are eligible. Concurrent workers never claim the same job. Returns
+// ErrNoRenditionJob if there is nothing to do.
+func (r *RenditionJobRepo) Claim(ctx context.Context, tx sqlx.QueryerContext, lease time.Duration) (RenditionJob, error) {
+	now := r.clock()
+	// The subquery uses the default placeholder format; the outer statement numbers all placeholders.
+	next := sq.
+		Select("id").
+		From("rendition_jobs").
+		Where(sq.Or{
+			sq.And{
+				sq.Eq{"state": RenditionJobPending},
+				sq.LtOrEq{"run_after": now},
+			},
+			sq.And{
+				sq.Eq{"state": RenditionJobRunning},
+				sq.Lt{"leased_until": now},
+			},
+		}).
+		OrderBy("run_after", "id").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	nextSQL, nextArgs, err := next.ToSql()
+	if err != nil {
+		return RenditionJob{}, errors.Wrap(err, "could not build query")
+	}
+
+	sql, args, err := r.stmt.
+		Update("rendition_jobs").
+		Set("state", RenditionJobRunning).
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("leased_until", now.Add(lease)).
+		Set("updated_at", now).
+		Where(sq.Expr("id = ("+nextSQL+")", nextArgs...)).
+		Suffix("RETURNING *").
+		ToSql()
+	if err != nil {
+		return RenditionJob{}, errors.Wrap(err, "could not build query")
+	}
+
+	var job RenditionJob
+	err = sqlx.GetContext(ctx, tx, &job, sql, args...)
+	if errors.Is(err, godb.ErrNoRows) {
+		return RenditionJob{}, ErrNoRenditionJob
+	} else if err != nil {
+		return RenditionJob{}, errors.Wrap(err, "could not claim job")
+	}
+
+	return job, nil
+}
+
+// Complete marks the given job as done. If renditions of the photo were requested again while the job was running, it
+// goes back to pending with a fresh set of attempts instead, so the request is not lost. A job that was cancelled or
+// claimed again in the meantime is left alone.
+func (r *RenditionJobRepo) Complete(ctx context.Context, tx sqlx.QueryerContext, job RenditionJob) (RenditionJob, error) {
+	now := r.clock()
+	requestedAgain := sq.Expr("requested_at > ?", job.RequestedAt)
+	requestedAgainSQL, requestedAgainArgs, err := requestedAgain.ToSql()
+	if err != nil {
+		return job, errors.Wrap(err, "could not build query")
+	}
+	sql, args, err := r.stmt.
+		Update("rendition_jobs").
+		Set("state", sq.Expr("case when "+requestedAgainSQL+" then ? else ? end", append(requestedAgainArgs, RenditionJobPending, RenditionJobDone)...)).
+		Set("attempts", sq.Expr("case when "+requestedAgainSQL+" then 0 else attempts end", requestedAgainArgs...)).
+		Set("last_error", "").
+		Set("run_after", now).
+		Set("leased_until", nil).
+		Set("updated_at", now).
+		Where(sq.Eq{"id": job.ID, "attempts": job.Attempts, "state": RenditionJobRunning}).
+		Suffix("RETURNING *").
+		ToSql()
+	if err != nil {
+		return job, errors.Wrap(err, "could not build query")
+	}
+
+	var completed RenditionJob
+	err = sqlx.GetContext(ctx, tx, &completed, sql, args...)
+	if errors.Is(err, godb.ErrNoRows) {
+		return job, nil
+	} else if err != nil {
+		return job, errors.Wrap(err, "could not complete job")
+	}
+
+	return completed, nil
+}
+
+// Fail records the error for the given job. The job is scheduled for another attempt with exponential backoff, or
+// marked as failed once it has used up its attempts.
+func (r *RenditionJobRepo) Fail(ctx context.Context, tx sqlx.ExecerContext, job RenditionJob, cause error) (RenditionJob, error) {
+	job.LastError = cause.Error()
+	job.LeasedUntil = nil
+	if job.Attempts >= job.MaxAttempts {
+		job.State = RenditionJobFailed
+	} else {
+		job.State = RenditionJobPending
+		job.RunAfter = r.clock().Add(RenditionJobBackoff(job.Attempts))
+	}
+	return r.update(ctx, tx, job)
+}
+
+// FindInCollection finds the job with the given id for a photo in the given collection.
+func (r *RenditionJobRepo) FindInCollection(ctx context.Context, tx sqlx.QueryerContext, collection Collection, id int64) (RenditionJob, error) {
+	sql, args, err := r.stmt.
+		Select("rendition_jobs.*").
+		From("rendition_jobs").
+		Join("photos on photos.id = rendition_jobs.photo_id").
+		Where(sq.Eq{
+			"rendition_jobs.id":    id,
+			"photos.collection_id": collection.ID,
+		}).
+		ToSql()
+	if err != nil {
+		return RenditionJob{}, errors.Wrap(err, "could not build query")
+	}
+
+	var job RenditionJob
+	if err := sqlx.GetContext(ctx, tx, &job, sql, args...); err != nil {
+		return RenditionJob{}, errors.Wrap(err, "could not get job")
+	}
+
+	return job, nil
+}
+
+// ListInCollection lists the jobs in the given states for all photos in the given collection.
+func (r *RenditionJobRepo) ListInCollection(ctx context.Context, tx sqlx.QueryerContext, collection Collection, states []RenditionJobState, paginator database.Paginator) ([]RenditionJob, database.Paginator, error) {
+	return r.list(ctx, tx, sq.Eq{"photos.collection_id": collection.ID, "rendition_jobs.state": states}, paginator)
+}
+
+// ListForPhoto lists the jobs in the given states for the photo with the given id in the given collection.
+func (r *RenditionJobRepo) ListForPhoto(ctx context.Context, tx sqlx.QueryerContext, collection Collection, photoID int64, states []RenditionJobState, paginator database.Paginator) ([]RenditionJob, database.Paginator, error) {
+	return r.list(ctx, tx, sq.Eq{"photos.collection_id": collection.ID, "photos.id": photoID, "rendition_jobs.state": states}, paginator)
+}
+
+func (r *RenditionJobRepo) list(ctx context.Context, tx sqlx.QueryerContext, where sq.Eq, paginator database.Paginator) ([]RenditionJob, database.Paginator, error) {
+	paginator.ColumnPrefix = "rendition_jobs"
+	stmt := r.stmt.
+		Select("rendition_jobs.*").
+		From("rendition_jobs").
+		Join("photos on photos.id = rendition_jobs.photo_id").
+		Where(where)
+
+	sql, args, err := paginator.Paginate(stmt).ToSql()
+	if err != nil {
+		return nil, paginator, errors.Wrap(err, "could not build query")
+	}
+
+	jobs := []RenditionJob{}
+	if err := sqlx.SelectContext(ctx, tx, &jobs, sql, args...); err != nil {
+		return nil, paginator, errors.Wrap(err, "could not select jobs")
+	}
+
+	return jobs, paginator, nil
+}
+
+// Retry puts a failed or cancelled job back into the queue with a fresh set of attempts. Returns
+// ErrRenditionJobStateConflict if the job is in another state or its photo already has a pending or running job.
+func (r *RenditionJobRepo) Retry(ctx context.Context, tx sqlx.QueryerContext, job RenditionJob) (RenditionJob, error) {
+	now := r.clock()
+	sql, args, err := r.stmt.
+		Update("rendition_jobs").
+		Set("state", RenditionJobPending).
+		Set("attempts", 0).
+		Set("run_after", now).
+		Set("leased_until", nil).
+		Set("updated_at", now).
+		Where(sq.Eq{"id": job.ID, "state": []RenditionJobState{RenditionJobFailed, RenditionJobCancelled}}).
+		Where(activeJobForSamePhoto).
+		Suffix("RETURNING *").
+		ToSql()
+	if err != nil {
+		return job, errors.Wrap(err, "could not build query")
+	}
+
+	return r.transition(ctx, tx, job, sql, args...)
+}
+
+// Cancel stops a pending, running or failed job from being processed. A worker that is currently processing the job
+// finishes its work, but will not change the job's state.
+func (r *RenditionJobRepo) Cancel(ctx context.Context, tx sqlx.QueryerContext, job RenditionJob) (RenditionJob, error) {
+	now := r.clock()
+	sql, args, err := r.stmt.
+		Update("rendition_jobs").
+		Set("state", RenditionJobCancelled).
+		Set("leased_until", nil).
+		Set("updated_at", now).
+		Where(sq.Eq{"id": job.ID, "state": []RenditionJobState{RenditionJobPending, RenditionJobRunning, RenditionJobFailed}}).
+		Suffix("RETURNING *").
+		ToSql()
+	if err != nil {
+		return job, errors.Wrap(err, "could not build query")
+	}
+
+	return r.transition(ctx, tx, job, sql, args...)
+}
+
+func (r *RenditionJobRepo) transition(ctx context.Context, tx sqlx.QueryerContext, job RenditionJob, sql string, args ...interface{}) (RenditionJob, error) {
+	var updated RenditionJob
+	err := sqlx.GetContext(ctx, tx, &updated, sql, args...)
+	if errors.Is(err, godb.ErrNoRows) {
+		return job, ErrRenditionJobStateConflict
+	} else if err != nil {
+		return job, errors.Wrap(err, "could not update job")
+	}
+
+	return updated, nil
+}
+
+// RequeueFailedInCollection retries the most recent failed job of every photo in the given collection that does not
+// already have a pending or running job. Returns the number of requeued jobs.
+func (r *RenditionJobRepo) RequeueFailedInCollection(ctx context.Context, tx sqlx.ExecerContext, collection Collection) (int64, error) {
+	now := r.clock()
+	// The subquery uses the default placeholder format; the outer statement numbers all placeholders.
+	latestFailed, latestFailedArgs, err := sq.
+		Select("distinct on (rendition_jobs.photo_id) rendition_jobs.id").
+		From("rendition_jobs").
+		Join("photos on photos.id = rendition_jobs.photo_id").
+		Where(sq.Eq{"photos.collection_id": collection.ID, "rendition_jobs.state": RenditionJobFailed}).
+		OrderBy("rendition_jobs.photo_id", "rendition_jobs.id desc").
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build query")
+	}
+
+	sql, args, err := r.stmt.
+		Update("rendition_jobs").
+		Set("state", RenditionJobPending).
+		Set("attempts", 0).
+		Set("run_after", now).
+		Set("leased_until", nil).
+		Set("updated_at", now).
+		Where(sq.Expr("id in ("+latestFailed+")", latestFailedArgs...)).
+		Where(activeJobForSamePhoto).
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build query")
+	}
+
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not requeue jobs")
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not count requeued jobs")
+	}
+
+	return n, nil
+}
+
+func (r *RenditionJobRepo) update(ctx context.Context, tx sqlx.ExecerContext, job RenditionJob) (RenditionJob, error) {
+	job.UpdatedAt = r.clock()
+	sql, args, err := r.stmt.
+		Update("rendition_jobs").
+		Set("state", job.State).
+		Set("attempts", job.Attempts).
+		Set("max_attempts", job.MaxAttempts).
+		Set("last_error", job.LastError).
+		Set("run_after", job.RunAfter).
+		Set("leased_until", job.LeasedUntil).
+		Set("updated_at", job.UpdatedAt).
+		// Guard against overwriting a job that was claimed again after our lease ran out or was cancelled in the
+		// meantime.
+		Where(sq.Eq{"id": job.ID, "attempts": job.Attempts, "state": RenditionJobRunning}).
+		ToSql()
+	if err != nil {
+		return job, errors.Wrap(err, "could not build query")
+	}
+
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return job, errors.Wrap(err, "could not update job")
+	}
+
+	return job, nil
+}
+
+// RenditionJobBackoff returns how long to wait before retrying a job that failed on the given attempt.
+func RenditionJobBackoff(attempt int) time.Duration {
+	backoff := renditionJobBaseBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= renditionJobMaxBackoff {
+			return renditionJobMaxBackoff
+		}
+	}
+	return backoff
+}
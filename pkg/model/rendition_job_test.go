@@ -0,0 +1,234 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/pkg/errors"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func withRenditionJobRepo(now time.Time) *RenditionJobRepo {
+	repo := NewRenditionJobRepo()
+	repo.clock = func() time.Time { return now }
+	return repo
+}
+
+func TestRenditionJobRepoEnqueue(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		mock.ExpectExec("INSERT INTO rendition_jobs .* ON CONFLICT \\(photo_id\\) WHERE state IN \\('pending', 'running'\\) DO UPDATE SET requested_at = excluded.requested_at").
+			WithArgs(42, RenditionJobPending, 0, DefaultRenditionJobMaxAttempts, "", now, now, now, now).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := withRenditionJobRepo(now).Enqueue(ctx, dbx, 42)
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestRenditionJobRepoClaim(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		leasedUntil := now.Add(5 * time.Minute)
+		mock.ExpectQuery("UPDATE rendition_jobs SET .* WHERE id = \\(SELECT id FROM rendition_jobs .* FOR UPDATE SKIP LOCKED\\) RETURNING \\*").
+			WithArgs(RenditionJobRunning, leasedUntil, now, RenditionJobPending, now, RenditionJobRunning, now).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "photo_id", "state", "attempts", "max_attempts", "last_error", "run_after", "leased_until", "created_at", "updated_at"}).
+					AddRow(13, 42, "running", 1, 5, "", now, leasedUntil, now, now),
+			)
+
+		job, err := withRenditionJobRepo(now).Claim(ctx, dbx, 5*time.Minute)
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(13), job.ID)
+		assert.Equal(t, int64(42), job.PhotoID)
+		assert.Equal(t, RenditionJobRunning, job.State)
+		assert.Equal(t, 1, job.Attempts)
+	})
+}
+
+func TestRenditionJobRepoClaimNothingReady(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("UPDATE rendition_jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := NewRenditionJobRepo().Claim(ctx, dbx, time.Minute)
+
+		assert.Equal(t, ErrNoRenditionJob, err)
+	})
+}
+
+func TestRenditionJobRepoCompleteRequestedAgain(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		claimed := RenditionJob{Record: db.Record{ID: 13}, PhotoID: 42, State: RenditionJobRunning, Attempts: 1, RequestedAt: now.Add(-time.Minute)}
+		mock.ExpectQuery("UPDATE rendition_jobs SET state = case when requested_at > \\$1 then \\$2 else \\$3 end, attempts = case when requested_at > \\$4 then 0 else attempts end, .* WHERE attempts = \\$9 AND id = \\$10 AND state = \\$11 RETURNING \\*").
+			WithArgs(claimed.RequestedAt, RenditionJobPending, RenditionJobDone, claimed.RequestedAt, "", now, nil, now, 1, 13, RenditionJobRunning).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "photo_id", "state", "attempts", "requested_at"}).
+					AddRow(13, 42, "pending", 0, now),
+			)
+
+		job, err := withRenditionJobRepo(now).Complete(ctx, dbx, claimed)
+
+		assert.NoError(t, err)
+		assert.Equal(t, RenditionJobPending, job.State)
+		assert.Equal(t, 0, job.Attempts)
+	})
+}
+
+func TestRenditionJobRepoFail(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		attempts int
+		state    RenditionJobState
+		runAfter time.Time
+	}{
+		{"retries with backoff", 2, RenditionJobPending, now.Add(time.Minute)},
+		{"gives up after max attempts", 5, RenditionJobFailed, now},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+				job := RenditionJob{
+					Record:      db.Record{ID: 13},
+					PhotoID:     42,
+					State:       RenditionJobRunning,
+					Attempts:    test.attempts,
+					MaxAttempts: 5,
+					RunAfter:    now,
+				}
+				mock.ExpectExec("UPDATE rendition_jobs SET").
+					WithArgs(test.state, test.attempts, 5, "boom", test.runAfter, nil, now, test.attempts, 13, RenditionJobRunning).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+
+				job, err := withRenditionJobRepo(now).Fail(ctx, dbx, job, errors.New("boom"))
+
+				assert.NoError(t, err)
+				assert.Equal(t, test.state, job.State)
+				assert.Equal(t, "boom", job.LastError)
+			})
+		})
+	}
+}
+
+func TestRenditionJobBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		backoff time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.backoff, RenditionJobBackoff(test.attempt), "attempt %d", test.attempt)
+	}
+}
+
+func TestRenditionJobRepoListInCollection(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		mock.ExpectQuery("SELECT rendition_jobs.\\* FROM rendition_jobs JOIN photos on photos.id = rendition_jobs.photo_id WHERE photos.collection_id = \\$1 AND rendition_jobs.state IN \\(\\$2\\) ORDER BY rendition_jobs.updated_at DESC, rendition_jobs.id DESC LIMIT 10").
+			WithArgs(7, RenditionJobFailed).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "photo_id", "state", "attempts", "max_attempts", "last_error", "run_after", "leased_until", "created_at", "updated_at"}).
+					AddRow(13, 42, "failed", 5, 5, "could not decode image", now, nil, now, now),
+			)
+
+		collection := Collection{Record: db.Record{ID: 7}}
+		jobs, _, err := NewRenditionJobRepo().ListInCollection(ctx, dbx, collection, []RenditionJobState{RenditionJobFailed}, database.NewPaginator())
+
+		assert.NoError(t, err)
+		assert.Len(t, jobs, 1)
+		assert.Equal(t, "could not decode image", jobs[0].LastError)
+		assert.Equal(t, 5, jobs[0].Attempts)
+	})
+}
+
+func TestRenditionJobRepoRetry(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		mock.ExpectQuery("UPDATE rendition_jobs SET state = \\$1, attempts = \\$2, run_after = \\$3, leased_until = \\$4, updated_at = \\$5 WHERE id = \\$6 AND state IN \\(\\$7,\\$8\\) AND not exists .* RETURNING \\*").
+			WithArgs(RenditionJobPending, 0, now, nil, now, 13, RenditionJobFailed, RenditionJobCancelled).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "photo_id", "state", "attempts", "max_attempts", "last_error", "run_after", "leased_until", "created_at", "updated_at"}).
+					AddRow(13, 42, "pending", 0, 5, "could not decode image", now, nil, now, now),
+			)
+
+		job, err := withRenditionJobRepo(now).Retry(ctx, dbx, RenditionJob{Record: db.Record{ID: 13}, State: RenditionJobFailed})
+
+		assert.NoError(t, err)
+		assert.Equal(t, RenditionJobPending, job.State)
+		assert.Equal(t, 0, job.Attempts)
+	})
+}
+
+func TestRenditionJobRepoRetryConflict(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("UPDATE rendition_jobs").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := NewRenditionJobRepo().Retry(ctx, dbx, RenditionJob{Record: db.Record{ID: 13}, State: RenditionJobDone})
+
+		assert.Equal(t, ErrRenditionJobStateConflict, err)
+	})
+}
+
+func TestRenditionJobRepoCancel(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		mock.ExpectQuery("UPDATE rendition_jobs SET state = \\$1, leased_until = \\$2, updated_at = \\$3 WHERE id = \\$4 AND state IN \\(\\$5,\\$6,\\$7\\) RETURNING \\*").
+			WithArgs(RenditionJobCancelled, nil, now, 13, RenditionJobPending, RenditionJobRunning, RenditionJobFailed).
+			WillReturnRows(
+				sqlmock.NewRows([]string{"id", "photo_id", "state", "attempts", "max_attempts", "last_error", "run_after", "leased_until", "created_at", "updated_at"}).
+					AddRow(13, 42, "cancelled", 1, 5, "", now, nil, now, now),
+			)
+
+		job, err := withRenditionJobRepo(now).Cancel(ctx, dbx, RenditionJob{Record: db.Record{ID: 13}, State: RenditionJobRunning})
+
+		assert.NoError(t, err)
+		assert.Equal(t, RenditionJobCancelled, job.State)
+	})
+}
+
+func TestRenditionJobRepoRequeueFailedInCollection(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		mock.ExpectExec("UPDATE rendition_jobs SET .* WHERE id in \\(SELECT distinct on \\(rendition_jobs.photo_id\\) rendition_jobs.id FROM rendition_jobs JOIN photos .* WHERE photos.collection_id = \\$6 AND rendition_jobs.state = \\$7 .*\\) AND not exists").
+			WithArgs(RenditionJobPending, 0, now, nil, now, 7, RenditionJobFailed).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		n, err := withRenditionJobRepo(now).RequeueFailedInCollection(ctx, dbx, Collection{Record: db.Record{ID: 7}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), n)
+	})
+}
+
+func TestRenditionJobRepoEnqueueCollection(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		mock.ExpectExec("insert into rendition_jobs .* select id, .* from photos where collection_id = \\$4 and deleted_at is null on conflict .* do update set requested_at = excluded.requested_at").
+			WithArgs(RenditionJobPending, DefaultRenditionJobMaxAttempts, now, 7).
+			WillReturnResult(sqlmock.NewResult(0, 12))
+
+		n, err := withRenditionJobRepo(now).EnqueueCollection(ctx, dbx, Collection{Record: db.Record{ID: 7}})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(12), n)
+	})
+}
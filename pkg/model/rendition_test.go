@@ -16,7 +16,7 @@ func TestInsertRendition(t *testing.T) {
 	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
 		now := time.Now()
 		mock.ExpectQuery("INSERT INTO renditions").
-			WithArgs(now, now, 42, true, 1024, 768, "image/jpeg", 17).
+			WithArgs(now, now, 42, true, 1024, 768, "image/jpeg", 17, 2).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(13)).
 			RowsWillBeClosed()
 		rendition := Rendition{
@@ -24,12 +24,13 @@ func TestInsertRendition(t *testing.T) {
 				CreatedAt: now,
 				UpdatedAt: now,
 			},
-			Format:                   "image/jpeg",
-			Height:                   768,
-			Original:                 true,
-			PhotoID:                  42,
-			RenditionConfigurationID: 17,
-			Width:                    1024,
+			Format:                        "image/jpeg",
+			Height:                        768,
+			Original:                      true,
+			PhotoID:                       42,
+			RenditionConfigurationID:      17,
+			RenditionConfigurationVersion: 2,
+			Width:                         1024,
 		}
 
 		rendition, err := InsertRendition(ctx, dbx, rendition)
@@ -1,6 +0,0 @@
-package model
-
-type RenditionUpdateRequest struct {
-	Photo Photo
-	// TODO add return channel for updates
-}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"context"
+	"html"
+	"strings"
+	"unicode"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// SearchPaginator are the paginator settings for search results. Results are ordered by rank by default.
+var SearchPaginator = database.OffsetPaginatorOpts{
+	MinLimit:           1,
+	DefaultLimit:       20,
+	MaxLimit:           100,
+	ValidOrderColumns:  []string{"rank", "taken_at", "updated_at"},
+	DefaultOrderColumn: "rank",
+	DefaultOrder:       "desc",
+}
+
+// searchOrderColumns are the columns search results are ordered by for each of the valid order columns. Photos are
+// joined with tables that have the same columns, so they have to be qualified.
+var searchOrderColumns = map[string]string{
+	"rank":       "rank",
+	"taken_at":   "photos.taken_at",
+	"updated_at": "photos.updated_at",
+}
+
+const (
+	// maxSearchTerms is the number of words of a search query that are used, the rest is ignored.
+	maxSearchTerms = 16
+	// highlightStart and highlightStop mark matches in headlines until they are turned into HTML.
+	highlightStart  = "[[["
+	highlightStop   = "]]]"
+	headlineOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", MaxFragments=2, MaxWords=20, MinWords=5"
+)
+
+// SearchResult is a photo matching a search query.
+type SearchResult struct {
+	Photo
+	Rank float64 `db:"rank" json:"rank"`
+	// Highlight are the parts of the photo's searchable text that match the query as HTML, matches are wrapped in mark
+	// elements.
+	Highlight string `db:"highlight" json:"highlight"`
+}
+
+// SearchQuery turns what a user typed into a tsquery that matches photos containing all words, the last word only by
+// prefix so results show up while typing. Returns an empty string if there are no words.
+func SearchQuery(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		// Words only contain letters and digits, so quoting them is safe.
+		terms[i] = "'" + word + "'"
+		if i == len(words)-1 {
+			terms[i] += ":*"
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// highlightHTML escapes the given headline and turns its highlight markers into mark elements.
+func highlightHTML(headline string) string {
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(html.EscapeString(headline))
+}
+
+// Search finds the photos matching the given query in the collections the given user has access to, best matches
+// first. Their titles, descriptions, filenames, tags, albums, cameras and lenses are searched. The filter narrows the
+// results down further.
+func (p *PhotoRepo) Search(ctx context.Context, tx sqlx.QueryerContext, user User, query string, filter db.PhotoFilter, paginator database.OffsetPaginator) ([]SearchResult, database.OffsetPaginator, error) {
+	results := []SearchResult{}
+	tsquery := SearchQuery(query)
+	if tsquery == "" {
+		return results, paginator.WithCount(0), nil
+	}
+
+	matching := func(stmt sq.SelectBuilder) sq.SelectBuilder {
+		stmt = stmt.
+			From("photos").
+			Join("photo_search s on (s.photo_id = photos.id)").
+			Join("users_collections uc on (uc.collection_id = photos.collection_id)").
+			Join("collections c on (c.id = photos.collection_id)").
+			JoinClause("cross join to_tsquery('simple', ?) as q(query)", tsquery).
+			Where(sq.Eq{"uc.user_id": user.ID, "photos.deleted_at": nil, "c.deleted_at": nil}).
+			Where("s.search_vector @@ q.query")
+		return filter.Filter(stmt, "photos")
+	}
+
+	sql, args, err := matching(p.stmt.Select("count(*)")).ToSql()
+	if err != nil {
+		return results, paginator, errors.Wrap(err, "could not build query")
+	}
+	var count uint64
+	if err := sqlx.GetContext(ctx, tx, &count, sql, args...); err != nil {
+		return results, paginator, errors.Wrap(err, "could not count results")
+	}
+	paginator = paginator.WithCount(count)
+
+	stmt := matching(p.stmt.Select(
+		"photos.*",
+		"ts_rank_cd(s.search_vector, q.query) as rank",
+		"ts_headline('simple', s.document, q.query, '"+headlineOptions+"') as highlight",
+	))
+	ordered := paginator
+	if column, ok := searchOrderColumns[paginator.OrderBy]; ok {
+		ordered.OrderBy = column
+	} else {
+		ordered.OrderBy = SearchPaginator.DefaultOrderColumn
+	}
+	sql, args, err = ordered.Paginate(stmt).OrderBy("photos.id desc").ToSql()
+	if err != nil {
+		return results, paginator, errors.Wrap(err, "could not build query")
+	}
+	if err := sqlx.SelectContext(ctx, tx, &results, sql, args...); err != nil {
+		return results, paginator, errors.Wrap(err, "could not select rows")
+	}
+
+	for i := range results {
+		results[i].Highlight = highlightHTML(results[i].Highlight)
+	}
+	return results, paginator, nil
+}
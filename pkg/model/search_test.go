@@ -0,0 +1,84 @@
+package model
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchQuery(t *testing.T) {
+	tests := map[string]string{
+		"tram":                "'tram':*",
+		"  Tram, LISBON ":     "'tram' & 'lisbon':*",
+		"IMG_1234.jpg":        "'img' & '1234' & 'jpg':*",
+		"straßenbahn 28":      "'straßenbahn' & '28':*",
+		"it's & (a) | !trick": "'it' & 's' & 'a' & 'trick':*",
+		"  &|!  ":             "",
+	}
+
+	for input, expected := range tests {
+		assert.Equal(t, expected, SearchQuery(input), "query for %q", input)
+	}
+	assert.Len(t, strings.Split(SearchQuery(strings.Repeat("a ", 50)), " & "), maxSearchTerms)
+}
+
+func TestHighlightHTML(t *testing.T) {
+	assert.Equal(t, "<mark>Tram</mark> &lt;28&gt; &amp; <mark>tram</mark>s", highlightHTML("[[[Tram]]] <28> & [[[tram]]]s"))
+}
+
+func TestSearch(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		user := User{Record: db.Record{ID: 5}}
+		paginator := SearchPaginator.PaginatorFromQuery(url.Values{"limit": {"2"}, "offset": {"2"}})
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos JOIN photo_search s on \\(s.photo_id = photos.id\\) JOIN users_collections uc on \\(uc.collection_id = photos.collection_id\\) JOIN collections c on \\(c.id = photos.collection_id\\) cross join to_tsquery\\('simple', \\$1\\) as q\\(query\\) WHERE c.deleted_at IS NULL AND photos.deleted_at IS NULL AND uc.user_id = \\$2 AND s.search_vector @@ q.query AND lower\\(photos.city\\) = lower\\(\\$3\\)").
+			WithArgs("'tram' & 'lis':*", 5, "Lisbon").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery("SELECT photos.\\*, ts_rank_cd\\(s.search_vector, q.query\\) as rank, ts_headline\\('simple', s.document, q.query, '.*'\\) as highlight FROM photos .* ORDER BY rank desc, photos.id desc LIMIT 2 OFFSET 2").
+			WithArgs("'tram' & 'lis':*", 5, "Lisbon").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "filename", "rank", "highlight"}).AddRow(11, "tram.jpg", 0.5, "[[[Tram]]] in [[[Lisbon]]]"))
+
+		results, paginator, err := NewPhotoRepo().Search(ctx, dbx, user, "tram lis", db.PhotoFilter{City: "Lisbon"}, paginator)
+
+		assert.NoError(t, err)
+		assert.Equal(t, uint64(3), paginator.Count)
+		assert.Len(t, results, 1)
+		assert.Equal(t, int64(11), results[0].ID)
+		assert.Equal(t, 0.5, results[0].Rank)
+		assert.Equal(t, "<mark>Tram</mark> in <mark>Lisbon</mark>", results[0].Highlight)
+	})
+}
+
+func TestSearchOrderedByUpdatedAt(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		paginator := SearchPaginator.PaginatorFromQuery(url.Values{"orderBy": {"updated_at"}, "order": {"asc"}})
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos").
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT photos.\\*, .* ORDER BY photos.updated_at asc, photos.id desc LIMIT 20 OFFSET 0").
+			WithArgs("'tram':*", 5).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+
+		results, paginator, err := NewPhotoRepo().Search(ctx, dbx, User{Record: db.Record{ID: 5}}, "tram", db.PhotoFilter{}, paginator)
+
+		assert.NoError(t, err)
+		assert.Len(t, results, 1)
+		assert.Equal(t, "updated_at", paginator.OrderBy)
+	})
+}
+
+func TestSearchWithoutWords(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		results, paginator, err := NewPhotoRepo().Search(ctx, dbx, User{}, " !? ", db.PhotoFilter{}, SearchPaginator.PaginatorFromQuery(url.Values{}))
+
+		assert.NoError(t, err)
+		assert.Empty(t, results)
+		assert.Equal(t, uint64(0), paginator.Count)
+	})
+}
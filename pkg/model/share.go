@@ -3,9 +3,12 @@ package model
 import (
 	"context"
 	"log"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/pkg/images"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 )
@@ -13,38 +16,117 @@ import (
 type Share struct {
 	db.Record
 	db.Timestamps
-	PhotoID      int64  `db:"photo_id" json:"photoID"`
-	CollectionID int64  `db:"collection_id" json:"collectionID"`
-	ShareSiteID  int64  `db:"share_site_id" json:"shareSiteID"`
-	Slug         string `db:"slug" json:"slug"`
+	CollectionID int64 `db:"collection_id" json:"collectionID"`
+	// AlbumID is set for shares of an album, which share its photos as the album changes. Other shares share a
+	// hand-picked set of photos.
+	AlbumID     *int64 `db:"album_id" json:"albumID"`
+	ShareSiteID int64  `db:"share_site_id" json:"shareSiteID"`
+	Slug        string `db:"slug" json:"slug"`
+	// ExpiresAt is when the share stops being served, if ever.
+	ExpiresAt *time.Time `db:"expires_at" json:"expiresAt"`
+	// RevokedAt is set while the share is revoked.
+	RevokedAt *time.Time `db:"revoked_at" json:"revokedAt"`
 }
 
-func FindSharedPhotoBySlug(ctx context.Context, tx sqlx.QueryerContext, shareSite ShareSite, slug string) (ShareWithPhotos, error) {
+// ErrShareGone is returned when looking up a share that expired or was revoked.
+var ErrShareGone = errors.New("share expired or was revoked")
+
+// Gone returns whether the share expired or was revoked at the given time.
+func (s Share) Gone(now time.Time) bool {
+	return s.RevokedAt != nil || (s.ExpiresAt != nil && !now.Before(*s.ExpiresAt))
+}
+
+// SharePhotosPaginator are the paginator settings for the photos of a share. Photos are in the order they were picked
+// in, or in album order for album shares.
+var SharePhotosPaginator = database.OffsetPaginatorOpts{
+	MinLimit:           1,
+	DefaultLimit:       50,
+	MaxLimit:           200,
+	ValidOrderColumns:  []string{"sort_order"},
+	DefaultOrderColumn: "sort_order",
+	DefaultOrder:       "asc",
+}
+
+// FindSharedPhotosBySlug finds the share with the given slug on the share site together with a page of its photos and
+// their renditions.
+func FindSharedPhotosBySlug(ctx context.Context, tx sqlx.QueryerContext, shareSite ShareSite, slug string, paginator database.OffsetPaginator) (ShareWithPhotos, database.OffsetPaginator, error) {
 	var shareWithPhotos ShareWithPhotos
 	share, err := FindShareBySiteAndSlug(ctx, tx, shareSite, slug)
 	if err != nil {
-		return shareWithPhotos, errors.Wrap(err, "could not find share for slug")
+		return shareWithPhotos, paginator, errors.Wrap(err, "could not find share for slug")
 	}
 
 	renditionConfigs, err := FindRenditionConfigurationsForShare(ctx, tx, share)
 	if err != nil {
-		return shareWithPhotos, errors.Wrap(err, "could not find rendition configurations for share")
+		return shareWithPhotos, paginator, errors.Wrap(err, "could not find rendition configurations for share")
 	}
 
-	// TODO right now we only support single photos in a share
-	photo, err := NewPhotoRepo().FindByID(ctx, tx, share.PhotoID)
-	renditions, err := FindRenditionsForPhoto(ctx, tx, photo, renditionConfigs...)
+	photos, paginator, err := FindPhotosInShare(ctx, tx, share, paginator)
+	if err != nil {
+		return shareWithPhotos, paginator, err
+	}
 
 	shareWithPhotos.Share = share
 	shareWithPhotos.RenditionConfigurations = renditionConfigs
-	shareWithPhotos.Photos = []PhotoWithRenditions{
-		{
+	shareWithPhotos.Photos = []PhotoWithRenditions{}
+	for _, photo := range photos {
+		renditions, err := FindRenditionsForPhoto(ctx, tx, photo, renditionConfigs...)
+		if err != nil {
+			return shareWithPhotos, paginator, errors.Wrapf(err, "could not find renditions for photo %d", photo.ID)
+		}
+		shareWithPhotos.Photos = append(shareWithPhotos.Photos, PhotoWithRenditions{
 			Photo:      photo,
 			Renditions: renditions,
-		},
+		})
 	}
 
-	return shareWithPhotos, nil
+	return shareWithPhotos, paginator, nil
+}
+
+// FindPhotosInShare finds a page of the photos of the share. Trashed photos are left out.
+func FindPhotosInShare(ctx context.Context, tx sqlx.QueryerContext, share Share, paginator database.OffsetPaginator) ([]Photo, database.OffsetPaginator, error) {
+	stmt := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	sql, args, err := sharedPhotos(stmt.Select("count(*)"), share).ToSql()
+	if err != nil {
+		return nil, paginator, errors.Wrap(err, "could not build query")
+	}
+	var count uint64
+	if err := sqlx.GetContext(ctx, tx, &count, sql, args...); err != nil {
+		return nil, paginator, errors.Wrap(err, "could not count photos")
+	}
+	paginator = paginator.WithCount(count)
+
+	sql, args, err = paginator.Paginate(sharedPhotos(stmt.Select("photos.*"), share)).OrderBy("photos.id").ToSql()
+	if err != nil {
+		return nil, paginator, errors.Wrap(err, "could not build query")
+	}
+	photos := []Photo{}
+	if err := sqlx.SelectContext(ctx, tx, &photos, sql, args...); err != nil {
+		return nil, paginator, errors.Wrap(err, "could not select photos")
+	}
+	return photos, paginator, nil
+}
+
+// sharedPhotos selects from the photos of the share that are not trashed. Album shares have the photos of their album,
+// other shares the photos picked for them. sort_order orders them.
+func sharedPhotos(stmt sq.SelectBuilder, share Share) sq.SelectBuilder {
+	return stmt.
+		From("photos").
+		JoinClause(
+			"join (select photo_id, sort_order from share_photos where share_id = ? union all select photo_id, sort_order from album_photos where album_id = ?) sp on (sp.photo_id = photos.id)",
+			share.ID,
+			share.AlbumID,
+		).
+		Where(sq.Eq{"photos.collection_id": share.CollectionID, "photos.deleted_at": nil})
+}
+
+// photoInShare is a condition that the photo id in the given column is one of the photos of the share.
+func photoInShare(column string, share Share) (sq.Sqlizer, error) {
+	sql, args, err := sharedPhotos(sq.Select("photos.id"), share).ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+	return sq.Expr(column+" in ("+sql+")", args...), nil
 }
 
 // ShareWithPhotos holds a share, its photos, and the associated rendition configurations.
@@ -59,12 +141,14 @@ type PhotoWithRenditions struct {
 	Renditions []Rendition
 }
 
+// FindRenditionConfigurationsForShare finds the rendition configurations of the given share. Configurations that keep
+// any metadata are left out even if they are attached to the share.
 func FindRenditionConfigurationsForShare(ctx context.Context, tx sqlx.QueryerContext, share Share) ([]RenditionConfiguration, error) {
 	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
 		Select("rc.*").
 		From("rendition_configurations AS rc").
 		Join("share_rendition_configurations AS src ON rc.id = src.rendition_configuration_id").
-		Where(sq.Eq{"src.share_id": share.ID}).
+		Where(sq.Eq{"src.share_id": share.ID, "rc.metadata": images.MetadataStrip}).
 		Limit(10). // TODO rather arbitrary, but do we really need more than ten?
 		ToSql()
 	if err != nil {
@@ -90,7 +174,8 @@ func FindRenditionConfigurationsForShare(ctx context.Context, tx sqlx.QueryerCon
 	return configs, nil
 }
 
-// FindShareBySiteAndSlug looks up a share by the given share site and slug.
+// FindShareBySiteAndSlug looks up a share by the given share site and slug. Returns the share and ErrShareGone if it
+// expired or was revoked.
 func FindShareBySiteAndSlug(ctx context.Context, tx sqlx.QueryerContext, shareSite ShareSite, slug string) (Share, error) {
 	var share Share
 	sql, args, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
@@ -100,6 +185,9 @@ func FindShareBySiteAndSlug(ctx context.Context, tx sqlx.QueryerContext, shareSi
 			"share_site_id": shareSite.ID,
 			"slug":          slug,
 		}).
+		// Shares of trashed collections and albums are gone until they are restored.
+		Where("exists (select 1 from collections c where c.id = shares.collection_id and c.deleted_at is null)").
+		Where("(shares.album_id is null or exists (select 1 from albums a where a.id = shares.album_id and a.deleted_at is null))").
 		Limit(1).
 		ToSql()
 	if err != nil {
@@ -114,6 +202,9 @@ func FindShareBySiteAndSlug(ctx context.Context, tx sqlx.QueryerContext, shareSi
 	if err != nil {
 		return share, errors.Wrap(err, "could not query row")
 	}
+	if share.Gone(time.Now().UTC()) {
+		return share, ErrShareGone
+	}
 
 	return share, nil
 }
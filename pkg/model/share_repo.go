@@ -0,0 +1,91 @@
+package model
+
+import (
+	"context"
+	godb "database/sql"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrShareNotFound is returned when changing a share that is not in the collection.
+var ErrShareNotFound = errors.New("share not found")
+
+func NewShareRepo() *ShareRepo {
+	return &ShareRepo{
+		clock: time.Now,
+		stmt:  sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// ShareRepo changes and deletes published shares. Expired and revoked shares are kept so they can be extended or
+// unrevoked, but share sites answer them with 410 Gone.
+type ShareRepo struct {
+	clock func() time.Time
+	stmt  sq.StatementBuilderType
+}
+
+// SetExpiry changes when the share with the given id expires; nil means never. Returns ErrShareNotFound if it is not
+// in the collection.
+func (s *ShareRepo) SetExpiry(ctx context.Context, tx sqlx.QueryerContext, collection Collection, id int64, expiresAt *time.Time) (Share, error) {
+	if expiresAt != nil {
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+	return s.update(ctx, tx, collection, id, map[string]interface{}{"expires_at": expiresAt})
+}
+
+// Revoke stops the share with the given id from being served until it is unrevoked. Revoking a revoked share keeps
+// the time it was first revoked. Returns ErrShareNotFound if it is not in the collection.
+func (s *ShareRepo) Revoke(ctx context.Context, tx sqlx.QueryerContext, collection Collection, id int64) (Share, error) {
+	return s.update(ctx, tx, collection, id, map[string]interface{}{
+		"revoked_at": sq.Expr("coalesce(revoked_at, ?)", s.clock().UTC()),
+	})
+}
+
+// Unrevoke serves the revoked share with the given id again, unless it expired. Returns ErrShareNotFound if it is not
+// in the collection.
+func (s *ShareRepo) Unrevoke(ctx context.Context, tx sqlx.QueryerContext, collection Collection, id int64) (Share, error) {
+	return s.update(ctx, tx, collection, id, map[string]interface{}{"revoked_at": nil})
+}
+
+// Delete deletes the share with the given id together with its photos and rendition configurations. Returns
+// ErrShareNotFound if it is not in the collection.
+func (s *ShareRepo) Delete(ctx context.Context, tx sqlx.ExecerContext, collection Collection, id int64) error {
+	sql, args, err := s.stmt.
+		Delete("shares").
+		Where(sq.Eq{"id": id, "collection_id": collection.ID}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not delete share")
+	}
+	return expectRowsAffected(result, 1, ErrShareNotFound)
+}
+
+func (s *ShareRepo) update(ctx context.Context, tx sqlx.QueryerContext, collection Collection, id int64, values map[string]interface{}) (Share, error) {
+	sql, args, err := s.stmt.
+		Update("shares").
+		SetMap(values).
+		Set("updated_at", s.clock().UTC()).
+		Where(sq.Eq{"id": id, "collection_id": collection.ID}).
+		Suffix("returning *").
+		ToSql()
+	if err != nil {
+		return Share{}, errors.Wrap(err, "could not build query")
+	}
+
+	var share Share
+	err = sqlx.GetContext(ctx, tx, &share, sql, args...)
+	if err == godb.ErrNoRows {
+		return share, ErrShareNotFound
+	} else if err != nil {
+		return share, errors.Wrap(err, "could not update share")
+	}
+	return share, nil
+}
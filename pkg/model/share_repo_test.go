@@ -0,0 +1,53 @@
+package model
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShareGone(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	assert.False(t, Share{}.Gone(now))
+	assert.False(t, Share{ExpiresAt: &future}.Gone(now))
+	assert.True(t, Share{ExpiresAt: &past}.Gone(now))
+	assert.True(t, Share{ExpiresAt: &now}.Gone(now))
+	assert.True(t, Share{RevokedAt: &past}.Gone(now))
+}
+
+func TestRevokeShareKeepsFirstRevocation(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		repo := NewShareRepo()
+		repo.clock = func() time.Time { return now }
+
+		mock.ExpectQuery("UPDATE shares SET revoked_at = coalesce\\(revoked_at, \\$1\\), updated_at = \\$2 WHERE collection_id = \\$3 AND id = \\$4 returning \\*").
+			WithArgs(now.UTC(), now.UTC(), 3, 5).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "revoked_at"}).AddRow(5, 3, now))
+
+		share, err := repo.Revoke(ctx, dbx, Collection{Record: db.Record{ID: 3}}, 5)
+
+		assert.NoError(t, err)
+		assert.True(t, share.Gone(now))
+	})
+}
+
+func TestDeleteShareNotInCollection(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec("DELETE FROM shares WHERE collection_id = \\$1 AND id = \\$2").
+			WithArgs(3, 5).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := NewShareRepo().Delete(ctx, dbx, Collection{Record: db.Record{ID: 3}}, 5)
+
+		assert.Equal(t, ErrShareNotFound, err)
+	})
+}
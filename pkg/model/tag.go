@@ -0,0 +1,288 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// MaxTagLength is the length of the longest tag name in characters.
+const MaxTagLength = 64
+
+// ErrPhotoNotInCollection is returned when photos to tag are not in the collection.
+var ErrPhotoNotInCollection = errors.New("photo not in collection")
+
+// Tag labels photos in a collection. Names are unique within a collection, ignoring case.
+type Tag struct {
+	db.Record
+	db.Timestamps
+
+	CollectionID int64  `db:"collection_id" json:"collectionID"`
+	Name         string `db:"name" json:"name"`
+}
+
+// TagWithCount is a tag and the number of photos tagged with it.
+type TagWithCount struct {
+	Tag
+	PhotoCount int `db:"photo_count" json:"photoCount"`
+}
+
+// NormalizeTagName trims the given name and collapses whitespace in it. Names must not be empty, contain commas, which
+// separate tags in queries, or be longer than MaxTagLength.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	switch {
+	case name == "":
+		return "", errors.New("tag name must not be empty")
+	case strings.Contains(name, ","):
+		return "", errors.Errorf("tag name %q must not contain commas", name)
+	case utf8.RuneCountInString(name) > MaxTagLength:
+		return "", errors.Errorf("tag name %q is longer than %d characters", name, MaxTagLength)
+	}
+	return name, nil
+}
+
+// NormalizeTagNames normalizes the given names and removes duplicates, ignoring case.
+func NormalizeTagNames(names []string) ([]string, error) {
+	var normalized []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		name, err := NormalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+func NewTagRepo() *TagRepo {
+	return &TagRepo{
+		clock: time.Now,
+		stmt:  sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// TagRepo stores tags and which photos are tagged with them.
+type TagRepo struct {
+	clock func() time.Time
+	stmt  sq.StatementBuilderType
+}
+
+// lowerNames returns the given names in lower case for comparisons with lower(tags.name).
+func lowerNames(names []string) []string {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return lower
+}
+
+// FindOrCreate returns the tags with the given names in the given collection, creating the ones that do not exist
+// yet. Names must be normalized.
+func (r *TagRepo) FindOrCreate(ctx context.Context, tx sqlx.ExtContext, collection Collection, names []string) ([]Tag, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	timestamps := db.JustCreated(r.clock)
+	insert := r.stmt.
+		Insert("tags").
+		Columns("collection_id", "name", "created_at", "updated_at")
+	for _, name := range names {
+		insert = insert.Values(collection.ID, name, timestamps.CreatedAt, timestamps.UpdatedAt)
+	}
+	sql, args, err := insert.Suffix("on conflict do nothing").ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not insert tags")
+	}
+
+	sql, args, err = r.stmt.
+		Select("*").
+		From("tags").
+		Where(sq.Eq{"collection_id": collection.ID, "lower(name)": lowerNames(names)}).
+		OrderBy("lower(name)").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	var tags []Tag
+	if err := sqlx.SelectContext(ctx, tx, &tags, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return tags, nil
+}
+
+// AddToPhotos tags the photos with the given ids with the given names, creating tags as needed. Names must be
+// normalized. Returns ErrPhotoNotInCollection if any of the photos is not in the given collection.
+func (r *TagRepo) AddToPhotos(ctx context.Context, tx sqlx.ExtContext, collection Collection, photoIDs []int64, names []string) ([]Tag, error) {
+	if len(photoIDs) == 0 || len(names) == 0 {
+		return nil, nil
+	}
+	if err := checkPhotosInCollection(ctx, tx, r.stmt, collection, photoIDs); err != nil {
+		return nil, err
+	}
+	return r.tagPhotos(ctx, tx, collection, photoIDs, names)
+}
+
+// tagPhotos tags the photos with the given ids, which must be in the given collection, with the given names.
+func (r *TagRepo) tagPhotos(ctx context.Context, tx sqlx.ExtContext, collection Collection, photoIDs []int64, names []string) ([]Tag, error) {
+	tags, err := r.FindOrCreate(ctx, tx, collection, names)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not find or create tags")
+	}
+
+	insert := r.stmt.
+		Insert("photo_tags").
+		Columns("photo_id", "tag_id", "created_at")
+	now := r.clock()
+	for _, photoID := range photoIDs {
+		for _, tag := range tags {
+			insert = insert.Values(photoID, tag.ID, now)
+		}
+	}
+	sql, args, err := insert.Suffix("on conflict do nothing").ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not tag photos")
+	}
+
+	return tags, nil
+}
+
+// RemoveFromPhotos removes the tags with the given names from the photos with the given ids. Tags no photo is tagged
+// with anymore are deleted. Returns the number of tags removed from photos.
+func (r *TagRepo) RemoveFromPhotos(ctx context.Context, tx sqlx.ExecerContext, collection Collection, photoIDs []int64, names []string) (int64, error) {
+	if len(photoIDs) == 0 || len(names) == 0 {
+		return 0, nil
+	}
+
+	tagIDs, tagArgs, err := sq.
+		Select("id").
+		From("tags").
+		Where(sq.Eq{"collection_id": collection.ID, "lower(name)": lowerNames(names)}).
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	sql, args, err := r.stmt.
+		Delete("photo_tags").
+		Where("tag_id in ("+tagIDs+")", tagArgs...).
+		Where(sq.Eq{"photo_id": photoIDs}).
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not untag photos")
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not get number of affected rows")
+	}
+
+	sql, args, err = r.stmt.
+		Delete("tags").
+		Where(sq.Eq{"collection_id": collection.ID, "lower(name)": lowerNames(names)}).
+		Where("not exists (select 1 from photo_tags where photo_tags.tag_id = tags.id)").
+		ToSql()
+	if err != nil {
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return 0, errors.Wrap(err, "could not delete unused tags")
+	}
+
+	return removed, nil
+}
+
+// checkPhotosInCollection returns ErrPhotoNotInCollection unless all photos with the given ids are in the collection.
+func checkPhotosInCollection(ctx context.Context, tx sqlx.QueryerContext, stmt sq.StatementBuilderType, collection Collection, photoIDs []int64) error {
+	distinct := map[int64]bool{}
+	for _, id := range photoIDs {
+		distinct[id] = true
+	}
+
+	sql, args, err := stmt.
+		Select("count(*)").
+		From("photos").
+		Where(sq.Eq{"collection_id": collection.ID, "id": photoIDs, "deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+
+	var count int
+	if err := sqlx.GetContext(ctx, tx, &count, sql, args...); err != nil {
+		return errors.Wrap(err, "could not count photos")
+	}
+	if count != len(distinct) {
+		return ErrPhotoNotInCollection
+	}
+	return nil
+}
+
+// ForPhoto returns the tags of the given photo ordered by name.
+func (r *TagRepo) ForPhoto(ctx context.Context, tx sqlx.QueryerContext, photo Photo) ([]Tag, error) {
+	sql, args, err := r.stmt.
+		Select("tags.*").
+		From("tags").
+		Join("photo_tags pt on (pt.tag_id = tags.id)").
+		Where(sq.Eq{"pt.photo_id": photo.ID}).
+		OrderBy("lower(tags.name)").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	tags := []Tag{}
+	if err := sqlx.SelectContext(ctx, tx, &tags, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return tags, nil
+}
+
+// Autocomplete returns up to n tags in the given collection whose names start with the given prefix, ignoring case.
+// The most used tags come first.
+func (r *TagRepo) Autocomplete(ctx context.Context, tx sqlx.QueryerContext, collection Collection, prefix string, n uint64) ([]TagWithCount, error) {
+	sql, args, err := r.stmt.
+		Select("tags.*", "count(pt.photo_id) as photo_count").
+		From("tags").
+		LeftJoin("photo_tags pt on (pt.tag_id = tags.id)").
+		Where(sq.Eq{"tags.collection_id": collection.ID}).
+		Where("lower(tags.name) like ?", escapeLike(strings.ToLower(strings.TrimSpace(prefix)))+"%").
+		GroupBy("tags.id").
+		OrderBy("photo_count desc", "lower(tags.name)").
+		Limit(n).
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	tags := []TagWithCount{}
+	if err := sqlx.SelectContext(ctx, tx, &tags, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return tags, nil
+}
+
+// escapeLike escapes the wildcards of like patterns in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
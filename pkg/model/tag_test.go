@@ -0,0 +1,100 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTagName(t *testing.T) {
+	name, err := NormalizeTagName("  old \t town ")
+	assert.NoError(t, err)
+	assert.Equal(t, "old town", name)
+
+	for _, invalid := range []string{"", " ", "a,b", strings.Repeat("ä", MaxTagLength+1)} {
+		_, err := NormalizeTagName(invalid)
+		assert.Error(t, err, "expected %q to be invalid", invalid)
+	}
+}
+
+func TestNormalizeTagNames(t *testing.T) {
+	names, err := NormalizeTagNames([]string{"Tram", "tram ", "Lisbon"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Tram", "Lisbon"}, names)
+}
+
+func TestAddTagsToPhotos(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		repo := NewTagRepo()
+		repo.clock = func() time.Time { return now }
+		collection := Collection{Record: db.Record{ID: 3}}
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND id IN \\(\\$2,\\$3\\)").
+			WithArgs(3, 11, 12).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectExec("INSERT INTO tags \\(collection_id,name,created_at,updated_at\\) VALUES \\(\\$1,\\$2,\\$3,\\$4\\) on conflict do nothing").
+			WithArgs(3, "tram", now, now).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT \\* FROM tags WHERE collection_id = \\$1 AND lower\\(name\\) IN \\(\\$2\\) ORDER BY lower\\(name\\)").
+			WithArgs(3, "tram").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "collection_id", "name"}).AddRow(7, 3, "Tram"))
+		mock.ExpectExec("INSERT INTO photo_tags \\(photo_id,tag_id,created_at\\) VALUES \\(\\$1,\\$2,\\$3\\),\\(\\$4,\\$5,\\$6\\) on conflict do nothing").
+			WithArgs(11, 7, now, 12, 7, now).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		tags, err := repo.AddToPhotos(ctx, dbx, collection, []int64{11, 12}, []string{"tram"})
+
+		assert.NoError(t, err)
+		assert.Len(t, tags, 1)
+		assert.Equal(t, "Tram", tags[0].Name)
+	})
+}
+
+func TestAddTagsToPhotosRejectsPhotosInOtherCollections(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos").
+			WithArgs(3, 11, 12, 11).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+		_, err := NewTagRepo().AddToPhotos(ctx, dbx, Collection{Record: db.Record{ID: 3}}, []int64{11, 12, 11}, []string{"tram"})
+
+		assert.Equal(t, ErrPhotoNotInCollection, err)
+	})
+}
+
+func TestRemoveTagsFromPhotos(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec("DELETE FROM photo_tags WHERE tag_id in \\(SELECT id FROM tags WHERE collection_id = \\$1 AND lower\\(name\\) IN \\(\\$2\\)\\) AND photo_id IN \\(\\$3,\\$4\\)").
+			WithArgs(3, "tram", 11, 12).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM tags WHERE collection_id = \\$1 AND lower\\(name\\) IN \\(\\$2\\) AND not exists").
+			WithArgs(3, "tram").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		removed, err := NewTagRepo().RemoveFromPhotos(ctx, dbx, Collection{Record: db.Record{ID: 3}}, []int64{11, 12}, []string{"Tram"})
+
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), removed)
+	})
+}
+
+func TestAutocompleteTags(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT tags.\\*, count\\(pt.photo_id\\) as photo_count FROM tags LEFT JOIN photo_tags pt on \\(pt.tag_id = tags.id\\) WHERE tags.collection_id = \\$1 AND lower\\(tags.name\\) like \\$2 GROUP BY tags.id ORDER BY photo_count desc, lower\\(tags.name\\) LIMIT 5").
+			WithArgs(3, `100\%\_a%`).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "photo_count"}).AddRow(7, "100%_aperture", 4))
+
+		tags, err := NewTagRepo().Autocomplete(ctx, dbx, Collection{Record: db.Record{ID: 3}}, " 100%_A", 5)
+
+		assert.NoError(t, err)
+		assert.Equal(t, []TagWithCount{{Tag: Tag{Record: db.Record{ID: 7}, Name: "100%_aperture"}, PhotoCount: 4}}, tags)
+	})
+}
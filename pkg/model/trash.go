@@ -0,0 +1,356 @@
+package model
+
+import (
+	"context"
+	godb "database/sql"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/database"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrNotInTrash is returned when restoring something that is not in the trash.
+var ErrNotInTrash = errors.New("not in trash")
+
+func NewTrashRepo() *TrashRepo {
+	return &TrashRepo{
+		clock: time.Now,
+		stmt:  sq.StatementBuilder.PlaceholderFormat(sq.Dollar),
+	}
+}
+
+// TrashRepo moves photos, albums and collections to the trash and back. Trashed rows have deleted_at set and are
+// hidden everywhere else. Purge deletes them for good once they have been in the trash for the retention period.
+type TrashRepo struct {
+	clock func() time.Time
+	stmt  sq.StatementBuilderType
+}
+
+// TrashPhotos moves the photos with the given ids to the trash. All photos must be in the collection and not trashed,
+// otherwise returns ErrPhotoNotInCollection.
+func (t *TrashRepo) TrashPhotos(ctx context.Context, tx sqlx.ExtContext, collection Collection, photoIDs []int64) error {
+	if len(photoIDs) == 0 {
+		return nil
+	}
+	if err := checkPhotosInCollection(ctx, tx, t.stmt, collection, photoIDs); err != nil {
+		return err
+	}
+
+	sql, args, err := t.stmt.
+		Update("photos").
+		Set("deleted_at", t.now()).
+		Where(sq.Eq{"collection_id": collection.ID, "id": photoIDs, "deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return errors.Wrap(err, "could not trash photos")
+	}
+	return updatePhotoCounts(ctx, tx, collection)
+}
+
+// RestorePhotos takes the photos with the given ids out of the trash. All photos must be trashed photos of the
+// collection, otherwise returns ErrNotInTrash.
+func (t *TrashRepo) RestorePhotos(ctx context.Context, tx sqlx.ExtContext, collection Collection, photoIDs []int64) error {
+	if len(photoIDs) == 0 {
+		return nil
+	}
+	distinct := map[int64]bool{}
+	for _, id := range photoIDs {
+		distinct[id] = true
+	}
+
+	sql, args, err := t.stmt.
+		Update("photos").
+		Set("deleted_at", nil).
+		Where(sq.Eq{"collection_id": collection.ID, "id": photoIDs}).
+		Where(sq.NotEq{"deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not restore photos")
+	}
+	if err := expectRowsAffected(result, len(distinct), ErrNotInTrash); err != nil {
+		return err
+	}
+	return updatePhotoCounts(ctx, tx, collection)
+}
+
+// ListPhotos lists the trashed photos of the collection, most recently trashed first.
+func (t *TrashRepo) ListPhotos(ctx context.Context, tx sqlx.QueryerContext, collection Collection, paginator database.Paginator) ([]Photo, database.Paginator, error) {
+	paginator.Column = "deleted_at"
+	stmt := t.stmt.
+		Select("*").
+		From("photos").
+		Where(sq.Eq{"collection_id": collection.ID}).
+		Where(sq.NotEq{"deleted_at": nil})
+
+	sql, args, err := paginator.Paginate(stmt).ToSql()
+	if err != nil {
+		return nil, paginator, errors.Wrap(err, "could not build query")
+	}
+
+	photos := []Photo{}
+	if err := sqlx.SelectContext(ctx, tx, &photos, sql, args...); err != nil {
+		return nil, paginator, errors.Wrap(err, "could not select rows")
+	}
+	return photos, paginator, nil
+}
+
+// TrashAlbum moves the album with the given id to the trash. Its photos are not trashed. Returns sql.ErrNoRows if the
+// collection has no such album.
+func (t *TrashRepo) TrashAlbum(ctx context.Context, tx sqlx.ExecerContext, collection Collection, albumID int64) error {
+	sql, args, err := t.stmt.
+		Update("albums").
+		Set("deleted_at", t.now()).
+		Where(sq.Eq{"collection_id": collection.ID, "id": albumID, "deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not trash album")
+	}
+	return expectRowsAffected(result, 1, godb.ErrNoRows)
+}
+
+// RestoreAlbum takes the album with the given id out of the trash. Returns ErrNotInTrash unless it is a trashed album
+// of the collection.
+func (t *TrashRepo) RestoreAlbum(ctx context.Context, tx sqlx.ExecerContext, collection Collection, albumID int64) error {
+	sql, args, err := t.stmt.
+		Update("albums").
+		Set("deleted_at", nil).
+		Where(sq.Eq{"collection_id": collection.ID, "id": albumID}).
+		Where(sq.NotEq{"deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not restore album")
+	}
+	return expectRowsAffected(result, 1, ErrNotInTrash)
+}
+
+// ListAlbums lists the trashed albums of the collection, most recently trashed first.
+func (t *TrashRepo) ListAlbums(ctx context.Context, tx sqlx.QueryerContext, collection Collection) ([]db.AlbumRecord, error) {
+	sql, args, err := t.stmt.
+		Select("*").
+		From("albums").
+		Where(sq.Eq{"collection_id": collection.ID}).
+		Where(sq.NotEq{"deleted_at": nil}).
+		OrderBy("deleted_at desc", "id desc").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	albums := []db.AlbumRecord{}
+	if err := sqlx.SelectContext(ctx, tx, &albums, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return albums, nil
+}
+
+// TrashCollection moves the collection to the trash, with it all its photos and albums are hidden.
+func (t *TrashRepo) TrashCollection(ctx context.Context, tx sqlx.ExecerContext, collection Collection) error {
+	sql, args, err := t.stmt.
+		Update("collections").
+		Set("deleted_at", t.now()).
+		Where(sq.Eq{"id": collection.ID, "deleted_at": nil}).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not trash collection")
+	}
+	return expectRowsAffected(result, 1, godb.ErrNoRows)
+}
+
+// RestoreCollection takes the collection with the given id out of the trash. Returns ErrNotInTrash unless it is a
+// trashed collection the user owns.
+func (t *TrashRepo) RestoreCollection(ctx context.Context, tx sqlx.ExecerContext, user User, collectionID int64) error {
+	sql, args, err := t.stmt.
+		Update("collections").
+		Set("deleted_at", nil).
+		Where(sq.Eq{"id": collectionID}).
+		Where(sq.NotEq{"deleted_at": nil}).
+		Where("exists (select 1 from users_collections uc where uc.collection_id = collections.id and uc.user_id = ? and uc.role = ?)", user.ID, RoleOwner).
+		ToSql()
+	if err != nil {
+		return errors.Wrap(err, "could not build query")
+	}
+	result, err := tx.ExecContext(ctx, sql, args...)
+	if err != nil {
+		return errors.Wrap(err, "could not restore collection")
+	}
+	return expectRowsAffected(result, 1, ErrNotInTrash)
+}
+
+// ListCollections lists the trashed collections of the user, most recently trashed first.
+func (t *TrashRepo) ListCollections(ctx context.Context, tx sqlx.QueryerContext, user User) ([]Collection, error) {
+	sql, args, err := t.stmt.
+		Select("collections.*").
+		From("collections").
+		Join("users_collections uc on (uc.collection_id = collections.id)").
+		Where(sq.Eq{"uc.user_id": user.ID}).
+		Where(sq.NotEq{"collections.deleted_at": nil}).
+		OrderBy("collections.deleted_at desc", "collections.id desc").
+		ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not build query")
+	}
+
+	collections := []Collection{}
+	if err := sqlx.SelectContext(ctx, tx, &collections, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "could not select rows")
+	}
+	return collections, nil
+}
+
+// Purge deletes up to n photos that were trashed before the given time, or whose collection was, together with their
+// renditions, exif tags, album memberships and shares. The binaries of their renditions are removed from the backend
+// once the deletion is committed. Albums and collections trashed before the given time are deleted once they have no
+// photos left. Returns the number of deleted photos; if it is n there may be more to purge.
+func (t *TrashRepo) Purge(ctx context.Context, dbx *sqlx.DB, backend storage.Backend, before time.Time, n uint64) (int, error) {
+	before = before.UTC()
+	expired := sq.Or{
+		sq.Lt{"deleted_at": before},
+		sq.Expr("collection_id in (select id from collections where deleted_at < ?)", before),
+	}
+
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not begin transaction")
+	}
+
+	sql, args, err := t.stmt.
+		Select("id").
+		From("photos").
+		Where(expired).
+		OrderBy("id").
+		Limit(n).
+		Suffix("for update").
+		ToSql()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	photoIDs := []int64{}
+	if err := sqlx.SelectContext(ctx, tx, &photoIDs, sql, args...); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not select expired photos")
+	}
+
+	renditionIDs := []int64{}
+	if len(photoIDs) > 0 {
+		sql, args, err = t.stmt.
+			Delete("renditions").
+			Where(sq.Eq{"photo_id": photoIDs}).
+			Suffix("returning id").
+			ToSql()
+		if err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "could not build query")
+		}
+		if err := sqlx.SelectContext(ctx, tx, &renditionIDs, sql, args...); err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "could not delete renditions")
+		}
+
+		sql, args, err = t.stmt.Delete("photos").Where(sq.Eq{"id": photoIDs}).ToSql()
+		if err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "could not build query")
+		}
+		if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+			tx.Rollback()
+			return 0, errors.Wrap(err, "could not delete photos")
+		}
+	}
+
+	sql, args, err = t.stmt.Delete("albums").Where(expired).ToSql()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not delete albums")
+	}
+
+	// Shares don't cascade with their collection, unlike shared photos and albums.
+	emptied := sq.And{
+		sq.Lt{"deleted_at": before},
+		sq.Expr("not exists (select 1 from photos where photos.collection_id = collections.id)"),
+	}
+	emptiedSQL, emptiedArgs, err := emptied.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	sql, args, err = t.stmt.
+		Delete("shares").
+		Where(sq.Expr("collection_id in (select id from collections where "+emptiedSQL+")", emptiedArgs...)).
+		ToSql()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not delete shares")
+	}
+
+	sql, args, err = t.stmt.Delete("collections").Where(emptied).ToSql()
+	if err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not build query")
+	}
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		tx.Rollback()
+		return 0, errors.Wrap(err, "could not delete collections")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "could not commit transaction")
+	}
+
+	for _, id := range renditionIDs {
+		if err := backend.Delete(id); err != nil {
+			log.Printf("could not delete binary of rendition %d: %v", id, err)
+		}
+	}
+
+	return len(photoIDs), nil
+}
+
+// expectRowsAffected returns notFound unless the result affected n rows.
+func expectRowsAffected(result godb.Result, n int, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "could not get number of affected rows")
+	}
+	if affected != int64(n) {
+		return notFound
+	}
+	return nil
+}
+
+// now returns the current time as stored in deleted_at.
+func (t *TrashRepo) now() time.Time {
+	return t.clock().UTC()
+}
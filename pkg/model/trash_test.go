@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashPhotos(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		now := time.Now()
+		repo := NewTrashRepo()
+		repo.clock = func() time.Time { return now }
+
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM photos WHERE collection_id = \\$1 AND deleted_at IS NULL AND id IN \\(\\$2,\\$3\\)").
+			WithArgs(3, 42, 43).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectExec("UPDATE photos SET deleted_at = \\$1 WHERE collection_id = \\$2 AND deleted_at IS NULL AND id IN \\(\\$3,\\$4\\)").
+			WithArgs(now.UTC(), 3, 42, 43).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("update collections set photo_count = \\(select count\\(\\*\\) from photos where collection_id = \\$1 and deleted_at is null\\) where id = \\$1").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("update albums set photo_count").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 4))
+
+		err := repo.TrashPhotos(ctx, dbx, Collection{Record: db.Record{ID: 3}}, []int64{42, 43})
+
+		assert.NoError(t, err)
+	})
+}
+
+func TestRestorePhotosNotInTrash(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec("UPDATE photos SET deleted_at = \\$1 WHERE collection_id = \\$2 AND id IN \\(\\$3,\\$4\\) AND deleted_at IS NOT NULL").
+			WithArgs(nil, 3, 42, 43).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := NewTrashRepo().RestorePhotos(ctx, dbx, Collection{Record: db.Record{ID: 3}}, []int64{42, 43})
+
+		assert.Equal(t, ErrNotInTrash, err)
+	})
+}
+
+func TestRestoreCollectionOfOtherUser(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		mock.ExpectExec("UPDATE collections SET deleted_at = \\$1 WHERE id = \\$2 AND deleted_at IS NOT NULL AND exists \\(select 1 from users_collections uc where uc.collection_id = collections.id and uc.user_id = \\$3 and uc.role = \\$4\\)").
+			WithArgs(nil, 3, 5, "owner").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := NewTrashRepo().RestoreCollection(ctx, dbx, User{Record: db.Record{ID: 5}}, 3)
+
+		assert.Equal(t, ErrNotInTrash, err)
+	})
+}
+
+func TestPurgeDeletesBinaries(t *testing.T) {
+	WithSQLMock(t, func(t *testing.T, ctx context.Context, dbx *sqlx.DB, mock sqlmock.Sqlmock) {
+		dir, err := ioutil.TempDir("", "phts")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		backend := storage.NewFileBackend(dir)
+		if err := backend.Put(101, strings.NewReader("jpeg"), 4, "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+		before := time.Now().Add(-30 * 24 * time.Hour)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT id FROM photos WHERE \\(deleted_at < \\$1 OR collection_id in \\(select id from collections where deleted_at < \\$2\\)\\) ORDER BY id LIMIT 10 for update").
+			WithArgs(before.UTC(), before.UTC()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+		mock.ExpectQuery("DELETE FROM renditions WHERE photo_id IN \\(\\$1\\) returning id").
+			WithArgs(42).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(101))
+		mock.ExpectExec("DELETE FROM photos WHERE id IN \\(\\$1\\)").
+			WithArgs(42).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM albums WHERE \\(deleted_at < \\$1 OR collection_id in").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM shares WHERE collection_id in \\(select id from collections where \\(deleted_at < \\$1 AND not exists").
+			WithArgs(before.UTC()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("DELETE FROM collections WHERE \\(deleted_at < \\$1 AND not exists").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		n, err := NewTrashRepo().Purge(ctx, dbx, backend, before, 10)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+		_, _, err = backend.Open(101)
+		assert.Error(t, err)
+	})
+}
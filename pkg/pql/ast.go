@@ -0,0 +1,60 @@
+package pql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node is a node of the syntax tree of a query.
+type Node interface {
+	// String returns the node in a canonical, fully parenthesized form.
+	String() string
+}
+
+// And matches photos matched by all of its nodes. Terms separated by whitespace are combined with And.
+type And []Node
+
+// Or matches photos matched by any of its nodes.
+type Or []Node
+
+// Not matches photos not matched by its operand.
+type Not struct {
+	Operand Node
+	Token   Token
+}
+
+// Term matches photos by a field, like tag:family or rating>=4, or by text if it has no field.
+type Term struct {
+	// Field and Operator are empty for text terms.
+	Field    Token
+	Operator Token
+	Value    Token
+}
+
+func (n And) String() string {
+	return "(and " + joinNodes(n) + ")"
+}
+
+func (n Or) String() string {
+	return "(or " + joinNodes(n) + ")"
+}
+
+func (n Not) String() string {
+	return "(not " + n.Operand.String() + ")"
+}
+
+func (n Term) String() string {
+	value := n.Value.Text
+	if value == "" || strings.IndexFunc(value, isSpecial) >= 0 {
+		value = strconv.Quote(value)
+	}
+	return n.Field.Text + n.Operator.Text + value
+}
+
+func joinNodes(nodes []Node) string {
+	s := make([]string, len(nodes))
+	for i, node := range nodes {
+		s[i] = node.String()
+	}
+	return strings.Join(s, " ")
+}
@@ -0,0 +1,291 @@
+package pql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// field compiles terms of one field into conditions on the photos of the given scope.
+type field struct {
+	operators []string
+	compile   func(s scope, term Term) (sq.Sqlizer, error)
+}
+
+var (
+	equality   = []string{":", "="}
+	comparison = []string{":", "=", "<", "<=", ">", ">="}
+	contains   = []string{":"}
+)
+
+// fields are the fields queries can filter by and the operators they support.
+var fields = map[string]field{
+	"tag":         {equality, compileTag},
+	"camera":      {contains, exifContains("Make", "Model")},
+	"lens":        {contains, exifContains("LensMake", "LensModel")},
+	"taken":       {comparison, compileTaken},
+	"rating":      {comparison, compileRating},
+	"in":          {contains, compileIn},
+	"is":          {contains, compileIs},
+	"city":        {equality, placeEquals("city")},
+	"region":      {equality, placeEquals("region")},
+	"country":     {equality, compileCountry},
+	"title":       {contains, columnContains("title")},
+	"description": {contains, columnContains("description")},
+	"filename":    {contains, columnContains("filename")},
+}
+
+// scope is what queries are compiled against: a photos table or alias, and the user whose ratings rating terms match.
+type scope struct {
+	table   string
+	ratedBy int64
+}
+
+// compile turns the given node into a condition on the photos of the given scope.
+func compile(node Node, s scope) (sq.Sqlizer, error) {
+	switch node := node.(type) {
+	case And:
+		conditions, err := compileAll(node, s)
+		if err != nil {
+			return nil, err
+		}
+		return sq.And(conditions), nil
+	case Or:
+		conditions, err := compileAll(node, s)
+		if err != nil {
+			return nil, err
+		}
+		return sq.Or(conditions), nil
+	case Not:
+		operand, err := compile(node.Operand, s)
+		if err != nil {
+			return nil, err
+		}
+		return not{operand}, nil
+	case Term:
+		return compileTerm(node, s)
+	}
+	return nil, fmt.Errorf("unknown node %T", node)
+}
+
+func compileAll(nodes []Node, s scope) ([]sq.Sqlizer, error) {
+	conditions := make([]sq.Sqlizer, len(nodes))
+	for i, node := range nodes {
+		condition, err := compile(node, s)
+		if err != nil {
+			return nil, err
+		}
+		conditions[i] = condition
+	}
+	return conditions, nil
+}
+
+func compileTerm(term Term, s scope) (sq.Sqlizer, error) {
+	if term.Field.Text == "" {
+		return sq.Expr(fmt.Sprintf("exists (select 1 from photo_search s where s.photo_id = %s.id and s.search_vector @@ plainto_tsquery('simple', ?))", s.table), term.Value.Text), nil
+	}
+
+	f, ok := fields[strings.ToLower(term.Field.Text)]
+	if !ok {
+		return nil, errorAt(term.Field, "unknown field %q", term.Field.Text)
+	}
+	if !supportsOperator(f.operators, term.Operator.Text) {
+		return nil, errorAt(term.Operator, "%s does not support %q", term.Field.Text, term.Operator.Text)
+	}
+	if strings.TrimSpace(term.Value.Text) == "" {
+		return nil, errorAt(term.Value, "empty value for %s", term.Field.Text)
+	}
+	return f.compile(s, term)
+}
+
+func supportsOperator(operators []string, operator string) bool {
+	for _, supported := range operators {
+		if operator == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// not negates a condition.
+type not struct {
+	operand sq.Sqlizer
+}
+
+func (n not) ToSql() (string, []interface{}, error) {
+	sql, args, err := n.operand.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+	return "not (" + sql + ")", args, nil
+}
+
+// escapeLike escapes the wildcards of like patterns in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// containsPattern returns a like pattern matching lower case strings containing s.
+func containsPattern(s string) string {
+	return "%" + escapeLike(strings.ToLower(s)) + "%"
+}
+
+func compileTag(s scope, term Term) (sq.Sqlizer, error) {
+	return sq.Expr(fmt.Sprintf("exists (select 1 from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = %s.id and lower(t.name) = lower(?))", s.table), strings.TrimSpace(term.Value.Text)), nil
+}
+
+// exifContains matches photos with any of the given exif tags containing the value, ignoring case.
+func exifContains(tags ...string) func(scope, Term) (sq.Sqlizer, error) {
+	return func(s scope, term Term) (sq.Sqlizer, error) {
+		return sq.Expr(fmt.Sprintf("exists (select 1 from exif e where e.photo_id = %s.id and e.tag in ('%s') and lower(e.string) like ?)", s.table, strings.Join(tags, "', '")), containsPattern(term.Value.Text)), nil
+	}
+}
+
+// columnContains matches photos whose column contains the value, ignoring case.
+func columnContains(column string) func(scope, Term) (sq.Sqlizer, error) {
+	return func(s scope, term Term) (sq.Sqlizer, error) {
+		return sq.Expr(fmt.Sprintf("lower(%s.%s) like ?", s.table, column), containsPattern(term.Value.Text)), nil
+	}
+}
+
+// placeEquals matches photos taken in a place, ignoring case.
+func placeEquals(column string) func(scope, Term) (sq.Sqlizer, error) {
+	return func(s scope, term Term) (sq.Sqlizer, error) {
+		return sq.Expr(fmt.Sprintf("lower(%s.%s) = lower(?)", s.table, column), term.Value.Text), nil
+	}
+}
+
+func compileCountry(s scope, term Term) (sq.Sqlizer, error) {
+	return sq.Expr(fmt.Sprintf("(lower(%s.country) = lower(?) or %s.country_code = upper(?))", s.table, s.table), term.Value.Text, term.Value.Text), nil
+}
+
+func compileIn(s scope, term Term) (sq.Sqlizer, error) {
+	parts := strings.SplitN(term.Value.Text, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, errorAt(term.Value, "expected album/<slug> or collection/<slug> but got %q", term.Value.Text)
+	}
+
+	switch parts[0] {
+	case "album":
+		return sq.Expr(fmt.Sprintf("exists (select 1 from album_photos ap join albums a on (a.id = ap.album_id) where ap.photo_id = %s.id and a.slug = ?)", s.table), parts[1]), nil
+	case "collection":
+		return sq.Expr(fmt.Sprintf("exists (select 1 from collections c where c.id = %s.collection_id and c.slug = ?)", s.table), parts[1]), nil
+	}
+	return nil, errorAt(term.Value, "expected album/<slug> or collection/<slug> but got %q", term.Value.Text)
+}
+
+func compileIs(s scope, term Term) (sq.Sqlizer, error) {
+	switch strings.ToLower(term.Value.Text) {
+	case "published":
+		return sq.Expr(fmt.Sprintf("%s.published", s.table)), nil
+	case "located":
+		return sq.Expr(fmt.Sprintf("%s.latitude is not null", s.table)), nil
+	case "tagged":
+		return sq.Expr(fmt.Sprintf("exists (select 1 from photo_tags pt where pt.photo_id = %s.id)", s.table)), nil
+	}
+	return nil, errorAt(term.Value, "expected published, located or tagged but got %q", term.Value.Text)
+}
+
+// splitRange splits values like a..b into tokens for both ends. Returns false if the value is not a range.
+func splitRange(value Token) (Token, Token, bool) {
+	i := strings.Index(value.Text, "..")
+	if i < 0 {
+		return value, Token{}, false
+	}
+	offset := value.Offset
+	if value.kind == tokenString {
+		offset++
+	}
+	from := Token{Text: value.Text[:i], Offset: offset, Length: len([]rune(value.Text[:i]))}
+	to := Token{Text: value.Text[i+2:], Offset: from.end() + 2, Length: len([]rune(value.Text[i+2:]))}
+	return from, to, true
+}
+
+// compileRange compiles a term whose value may be a range of values. bounds returns the first value of a period and
+// the first value after it, like the first day of a month and of the next one.
+func compileRange(column string, term Term, bounds func(Token) (interface{}, interface{}, error)) (sq.Sqlizer, error) {
+	from, to, isRange := splitRange(term.Value)
+	if isRange {
+		if term.Operator.Text != ":" {
+			return nil, errorAt(term.Operator, "ranges only work with \":\"")
+		}
+		if from.Text == "" && to.Text == "" {
+			return nil, errorAt(term.Value, "range needs a start or an end")
+		}
+		var conditions sq.And
+		if from.Text != "" {
+			start, _, err := bounds(from)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, sq.GtOrEq{column: start})
+		}
+		if to.Text != "" {
+			_, end, err := bounds(to)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, sq.Lt{column: end})
+		}
+		return conditions, nil
+	}
+
+	start, end, err := bounds(term.Value)
+	if err != nil {
+		return nil, err
+	}
+	switch term.Operator.Text {
+	case "<":
+		return sq.Lt{column: start}, nil
+	case "<=":
+		return sq.Lt{column: end}, nil
+	case ">":
+		return sq.GtOrEq{column: end}, nil
+	case ">=":
+		return sq.GtOrEq{column: start}, nil
+	}
+	return sq.And{sq.GtOrEq{column: start}, sq.Lt{column: end}}, nil
+}
+
+// dateLayouts are the supported date formats and the period each of them covers.
+var dateLayouts = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+func dateBounds(value Token) (interface{}, interface{}, error) {
+	for _, date := range dateLayouts {
+		if t, err := time.Parse(date.layout, value.Text); err == nil {
+			return t, date.next(t), nil
+		}
+	}
+	return nil, nil, errorAt(value, "expected a date like 2023, 2023-05 or 2023-05-17 but got %q", value.Text)
+}
+
+func compileTaken(s scope, term Term) (sq.Sqlizer, error) {
+	return compileRange(s.table+".taken_at", term, dateBounds)
+}
+
+// ratingExpression returns the rating the user of the given scope gave photos, 0 if they didn't rate them.
+func ratingExpression(s scope) string {
+	return fmt.Sprintf("coalesce((select pr.rating from photo_ratings pr where pr.photo_id = %s.id and pr.user_id = %d), 0)", s.table, s.ratedBy)
+}
+
+func ratingBounds(value Token) (interface{}, interface{}, error) {
+	rating, err := strconv.Atoi(value.Text)
+	if err != nil || rating < 0 || rating > 5 {
+		return nil, nil, errorAt(value, "expected a rating from 0 to 5 but got %q", value.Text)
+	}
+	return rating, rating + 1, nil
+}
+
+func compileRating(s scope, term Term) (sq.Sqlizer, error) {
+	return compileRange(ratingExpression(s), term, ratingBounds)
+}
@@ -0,0 +1,83 @@
+package pql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCondition(t *testing.T) {
+	tests := []struct {
+		input string
+		sql   string
+		args  []interface{}
+	}{
+		{
+			"tram",
+			"exists (select 1 from photo_search s where s.photo_id = p.id and s.search_vector @@ plainto_tsquery('simple', ?))",
+			[]interface{}{"tram"},
+		},
+		{
+			"tag:Family -tag:private",
+			"(exists (select 1 from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = p.id and lower(t.name) = lower(?)) AND not (exists (select 1 from photo_tags pt join tags t on (t.id = pt.tag_id) where pt.photo_id = p.id and lower(t.name) = lower(?))))",
+			[]interface{}{"Family", "private"},
+		},
+		{
+			"camera:X_T4 OR lens:50%",
+			"(exists (select 1 from exif e where e.photo_id = p.id and e.tag in ('Make', 'Model') and lower(e.string) like ?) OR exists (select 1 from exif e where e.photo_id = p.id and e.tag in ('LensMake', 'LensModel') and lower(e.string) like ?))",
+			[]interface{}{`%x\_t4%`, `%50\%%`},
+		},
+		{
+			"taken:2023-05",
+			"(p.taken_at >= ? AND p.taken_at < ?)",
+			[]interface{}{time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"taken:2023-05..2023-08-02",
+			"(p.taken_at >= ? AND p.taken_at < ?)",
+			[]interface{}{time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 8, 3, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"taken<=2020",
+			"p.taken_at < ?",
+			[]interface{}{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"taken>2020",
+			"p.taken_at >= ?",
+			[]interface{}{time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			"rating>=4",
+			"coalesce((select pr.rating from photo_ratings pr where pr.photo_id = p.id and pr.user_id = 5), 0) >= ?",
+			[]interface{}{4},
+		},
+		{
+			"in:album/summer-2023 in:collection/family",
+			"(exists (select 1 from album_photos ap join albums a on (a.id = ap.album_id) where ap.photo_id = p.id and a.slug = ?) AND exists (select 1 from collections c where c.id = p.collection_id and c.slug = ?))",
+			[]interface{}{"summer-2023", "family"},
+		},
+		{
+			"is:published -is:located is:tagged",
+			"(p.published AND not (p.latitude is not null) AND exists (select 1 from photo_tags pt where pt.photo_id = p.id))",
+			nil,
+		},
+		{
+			"country:pt city:Lisbon title:Tram",
+			"((lower(p.country) = lower(?) or p.country_code = upper(?)) AND lower(p.city) = lower(?) AND lower(p.title) like ?)",
+			[]interface{}{"pt", "pt", "Lisbon", "%tram%"},
+		},
+	}
+
+	for _, test := range tests {
+		query, err := Parse(test.input)
+		require.NoError(t, err, "query %q", test.input)
+
+		sql, args, err := query.Condition("p", 5).ToSql()
+		require.NoError(t, err, "query %q", test.input)
+		assert.Equal(t, test.sql, sql, "query %q", test.input)
+		assert.Equal(t, test.args, args, "query %q", test.input)
+	}
+}
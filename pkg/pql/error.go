@@ -0,0 +1,21 @@
+package pql
+
+import "fmt"
+
+// Error is a syntax or semantic error in a query. It points at the offending token so clients can highlight it.
+type Error struct {
+	Message string `json:"error"`
+	// Token is the offending part of the query, Offset and Length are where it is in characters.
+	Token  string `json:"token"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+}
+
+// errorAt returns an error pointing at the given token.
+func errorAt(token Token, format string, args ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, args...), Token: token.Text, Offset: token.Offset, Length: token.Length}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Message, e.Offset)
+}
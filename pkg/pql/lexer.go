@@ -0,0 +1,110 @@
+package pql
+
+import (
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenWord is a bare word like tag, family or 2023-05..2023-08.
+	tokenWord
+	// tokenString is a double quoted string, its text is unquoted.
+	tokenString
+	// tokenOperator separates a field from its value: one of : = < <= > >=
+	tokenOperator
+	// tokenNot negates the term it precedes.
+	tokenNot
+	tokenLeftParen
+	tokenRightParen
+)
+
+// Token is a part of a query and where it is in the query. Offset and Length count characters, not bytes.
+type Token struct {
+	Text   string
+	Offset int
+	Length int
+
+	kind tokenKind
+}
+
+// end returns the offset of the character after this token.
+func (t Token) end() int {
+	return t.Offset + t.Length
+}
+
+// isSpecial returns whether r ends a bare word.
+func isSpecial(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`():"<>=`, r)
+}
+
+// lex splits the given query into tokens. The last token is always tokenEOF.
+func lex(input string) ([]Token, error) {
+	runes := []rune(input)
+	var tokens []Token
+	emit := func(kind tokenKind, text string, offset, length int) {
+		tokens = append(tokens, Token{Text: text, Offset: offset, Length: length, kind: kind})
+	}
+	// startsTerm returns whether a token starting at i begins a new term rather than being the value of a field.
+	startsTerm := func(i int) bool {
+		if len(tokens) == 0 {
+			return true
+		}
+		last := tokens[len(tokens)-1]
+		return last.kind != tokenOperator || last.end() != i
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			emit(tokenLeftParen, "(", i, 1)
+			i++
+		case r == ')':
+			emit(tokenRightParen, ")", i, 1)
+			i++
+		case r == ':' || r == '=':
+			emit(tokenOperator, string(r), i, 1)
+			i++
+		case r == '<' || r == '>':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				emit(tokenOperator, string(runes[i:i+2]), i, 2)
+				i += 2
+			} else {
+				emit(tokenOperator, string(r), i, 1)
+				i++
+			}
+		case r == '-' && startsTerm(i) && (i+1 == len(runes) || !unicode.IsSpace(runes[i+1])):
+			emit(tokenNot, "-", i, 1)
+			i++
+		case r == '"':
+			var text strings.Builder
+			start := i
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				text.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &Error{Message: "missing closing quote", Token: string(runes[start:]), Offset: start, Length: len(runes) - start}
+			}
+			i++
+			emit(tokenString, text.String(), start, i-start)
+		default:
+			start := i
+			for i < len(runes) && !isSpecial(runes[i]) {
+				i++
+			}
+			emit(tokenWord, string(runes[start:i]), start, i-start)
+		}
+	}
+
+	emit(tokenEOF, "", len(runes), 0)
+	return tokens, nil
+}
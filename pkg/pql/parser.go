@@ -0,0 +1,198 @@
+// Package pql implements the photo query language of the admin API. Queries combine terms like
+//
+//	camera:"X-T4" taken:2023-05..2023-08 tag:family -tag:private rating>=4 in:album/summer
+//
+// Terms separated by whitespace must all match, OR matches either side, a leading - negates a term and parentheses
+// group terms. Words without a field search the text of photos.
+package pql
+
+import (
+	sq "github.com/Masterminds/squirrel"
+)
+
+// MaxQueryLength is the length of the longest query in characters.
+const MaxQueryLength = 1024
+
+// Query is a parsed and checked query.
+type Query struct {
+	// Root is the root of the syntax tree, nil if the query is blank.
+	Root Node
+}
+
+// Parse parses and checks the given query. Returns an *Error pointing at the offending token if the query is invalid.
+// A blank query matches all photos.
+func Parse(input string) (*Query, error) {
+	if runes := []rune(input); len(runes) > MaxQueryLength {
+		return nil, &Error{Message: "query is too long", Token: string(runes[MaxQueryLength:]), Offset: MaxQueryLength, Length: len(runes) - MaxQueryLength}
+	}
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return &Query{}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != tokenEOF {
+		return nil, errorAt(token, "unexpected %q", token.Text)
+	}
+
+	// Compiling the query checks its fields and values.
+	if _, err := compile(root, scope{table: "photos"}); err != nil {
+		return nil, err
+	}
+	return &Query{Root: root}, nil
+}
+
+// Condition returns the condition matching the photos of this query on the given photos table or alias, nil if the
+// query is blank. Rating terms match the ratings of the given user; without one all photos count as unrated.
+func (q *Query) Condition(table string, ratedBy int64) sq.Sqlizer {
+	if q == nil || q.Root == nil {
+		return nil
+	}
+	// Parse already compiled the query once, so this cannot fail.
+	condition, _ := compile(q.Root, scope{table: table, ratedBy: ratedBy})
+	return condition
+}
+
+func (q *Query) String() string {
+	if q == nil || q.Root == nil {
+		return ""
+	}
+	return q.Root.String()
+}
+
+// parser is a recursive descent parser for the grammar
+//
+//	or      = and { "OR" and }
+//	and     = unary { unary }
+//	unary   = "-" unary | primary
+//	primary = "(" or ")" | term
+//	term    = word operator value | value
+//	value   = word | string
+type parser struct {
+	tokens []Token
+	pos    int
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	token := p.tokens[p.pos]
+	if token.kind != tokenEOF {
+		p.pos++
+	}
+	return token
+}
+
+// atOr returns whether the next token is the OR keyword.
+func (p *parser) atOr() bool {
+	token := p.peek()
+	return token.kind == tokenWord && token.Text == "OR"
+}
+
+func (p *parser) parseOr() (Node, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := Or{first}
+	for p.atOr() {
+		or := p.next()
+		if kind := p.peek().kind; kind == tokenEOF || kind == tokenRightParen {
+			return nil, errorAt(or, "missing term after OR")
+		}
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes And
+	for {
+		token := p.peek()
+		if token.kind == tokenEOF || token.kind == tokenRightParen || p.atOr() {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch len(nodes) {
+	case 0:
+		token := p.peek()
+		return nil, errorAt(token, "expected a term but got %q", token.Text)
+	case 1:
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind != tokenNot {
+		return p.parsePrimary()
+	}
+
+	not := p.next()
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return Not{Operand: operand, Token: not}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenLeftParen:
+		if p.peek().kind == tokenRightParen {
+			return nil, errorAt(p.peek(), "expected a term but got %q", ")")
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != tokenRightParen {
+			return nil, errorAt(token, "missing closing parenthesis")
+		}
+		p.next()
+		return node, nil
+	case tokenString:
+		return Term{Value: token}, nil
+	case tokenWord:
+		operator := p.peek()
+		if operator.kind != tokenOperator || operator.Offset != token.end() {
+			return Term{Value: token}, nil
+		}
+		p.next()
+		value := p.peek()
+		if (value.kind != tokenWord && value.kind != tokenString) || value.Offset != operator.end() {
+			return nil, errorAt(operator, "missing value after %s%s", token.Text, operator.Text)
+		}
+		p.next()
+		return Term{Field: token, Operator: operator, Value: value}, nil
+	case tokenEOF:
+		return nil, errorAt(token, "unexpected end of query")
+	}
+	return nil, errorAt(token, "unexpected %q", token.Text)
+}
@@ -0,0 +1,88 @@
+package pql
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"tram":                                 "tram",
+		`"tram 28"`:                            `"tram 28"`,
+		"tag:family -tag:private":              "(and tag:family (not tag:private))",
+		"tag:a OR tag:b tag:c":                 "(or tag:a (and tag:b tag:c))",
+		"(tag:a OR tag:b) tag:c":               "(and (or tag:a tag:b) tag:c)",
+		"-(tag:a OR tag:b)":                    "(not (or tag:a tag:b))",
+		"rating>=4 rating<5 taken=2023":        "(and rating>=4 rating<5 taken=2023)",
+		`camera:"X-T4" taken:2023-05..2023-08`: `(and camera:X-T4 taken:2023-05..2023-08)`,
+		`title:"say \"cheese\""`:               `title:"say \"cheese\""`,
+		"rating:0":                             "rating:0",
+		"tram - bus":                           "(and tram - bus)",
+		"or tag:a":                             "(and or tag:a)",
+		"Tag:Family":                           "Tag:Family",
+		"  (  tag:a  )  ":                      "tag:a",
+		"in:album/summer is:published":         "(and in:album/summer is:published)",
+		"tag:a OR -tag:b OR (rating:5 tag:c)":  "(or tag:a (not tag:b) (and rating:5 tag:c))",
+		"taken:..2020":                         "taken:..2020",
+		"country:PT city:lisbon region:lisboa": "(and country:PT city:lisbon region:lisboa)",
+	}
+
+	for input, expected := range tests {
+		query, err := Parse(input)
+		if assert.NoError(t, err, "query %q", input) {
+			assert.Equal(t, expected, query.String(), "query %q", input)
+		}
+	}
+}
+
+func TestParseBlank(t *testing.T) {
+	query, err := Parse("   ")
+	require.NoError(t, err)
+	assert.Nil(t, query.Root)
+	assert.Nil(t, query.Condition("photos", 0))
+	assert.Equal(t, "", query.String())
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   Error
+	}{
+		{`tag:"family`, Error{Message: "missing closing quote", Token: `"family`, Offset: 4, Length: 7}},
+		{"(tag:a tag:b", Error{Message: "missing closing parenthesis", Token: "(", Offset: 0, Length: 1}},
+		{"tag:a)", Error{Message: `unexpected ")"`, Token: ")", Offset: 5, Length: 1}},
+		{"()", Error{Message: `expected a term but got ")"`, Token: ")", Offset: 1, Length: 1}},
+		{"tag:a OR", Error{Message: "missing term after OR", Token: "OR", Offset: 6, Length: 2}},
+		{"OR tag:a", Error{Message: `expected a term but got "OR"`, Token: "OR", Offset: 0, Length: 2}},
+		{"tag: family", Error{Message: "missing value after tag:", Token: ":", Offset: 3, Length: 1}},
+		{":family", Error{Message: `unexpected ":"`, Token: ":", Offset: 0, Length: 1}},
+		{"tag:a -", Error{Message: "unexpected end of query", Token: "", Offset: 7, Length: 0}},
+		{"colour:red", Error{Message: `unknown field "colour"`, Token: "colour", Offset: 0, Length: 6}},
+		{"tag>a", Error{Message: `tag does not support ">"`, Token: ">", Offset: 3, Length: 1}},
+		{`tag:""`, Error{Message: "empty value for tag", Token: "", Offset: 4, Length: 2}},
+		{"rating:7", Error{Message: `expected a rating from 0 to 5 but got "7"`, Token: "7", Offset: 7, Length: 1}},
+		{"taken:2023-05..2023-13", Error{Message: `expected a date like 2023, 2023-05 or 2023-05-17 but got "2023-13"`, Token: "2023-13", Offset: 15, Length: 7}},
+		{`taken:"2023-99..2024"`, Error{Message: `expected a date like 2023, 2023-05 or 2023-05-17 but got "2023-99"`, Token: "2023-99", Offset: 7, Length: 7}},
+		{"taken>=2020..2021", Error{Message: `ranges only work with ":"`, Token: ">=", Offset: 5, Length: 2}},
+		{"rating:..", Error{Message: "range needs a start or an end", Token: "..", Offset: 7, Length: 2}},
+		{"in:summer", Error{Message: `expected album/<slug> or collection/<slug> but got "summer"`, Token: "summer", Offset: 3, Length: 6}},
+		{"is:deleted", Error{Message: `expected published, located or tagged but got "deleted"`, Token: "deleted", Offset: 3, Length: 7}},
+		{"größe tag:a OR -taken:x", Error{Message: `expected a date like 2023, 2023-05 or 2023-05-17 but got "x"`, Token: "x", Offset: 22, Length: 1}},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		if assert.Error(t, err, "query %q", test.input) {
+			assert.Equal(t, &test.err, err, "query %q", test.input)
+		}
+	}
+}
+
+func TestParseTooLong(t *testing.T) {
+	_, err := Parse(strings.Repeat("a", MaxQueryLength+1))
+	assert.Equal(t, &Error{Message: "query is too long", Token: "a", Offset: MaxQueryLength, Length: 1}, err)
+	assert.EqualError(t, err, "query is too long at offset 1024")
+}
@@ -101,6 +101,29 @@ func AdminAPIRoutes(secret string) []web.Section {
 						},
 					},
 				},
+				{
+					Path: "/search",
+					Routes: []web.Route{
+						{
+							Path:    "/",
+							Handler: api.SearchHandler,
+						},
+					},
+				},
+				{
+					Path: "/trash",
+					Routes: []web.Route{
+						{
+							Path:    "/collections",
+							Handler: api.ListTrashedCollectionsHandler,
+						},
+						{
+							Path:    "/collections/{id:[0-9]+}/restore",
+							Handler: api.RestoreCollectionHandler,
+							Methods: []string{"POST"},
+						},
+					},
+				},
 				{
 					Path:       "/collections",
 					Middleware: []func(http.Handler) http.Handler{},
@@ -136,6 +159,14 @@ func AdminAPIRoutes(secret string) []web.Section {
 									Path:    "/photos/recent",
 									Handler: api.ListRecentPhotosHandler,
 								},
+								{
+									Path:    "/photos/locations",
+									Handler: api.ListPhotosInBoundingBoxHandler,
+								},
+								{
+									Path:    "/photos/locations/clusters",
+									Handler: api.PhotoLocationClustersHandler,
+								},
 								{
 									Path:    "/photos/{id:[0-9]+}",
 									Handler: api.ShowPhotoHandler,
@@ -145,11 +176,82 @@ func AdminAPIRoutes(secret string) []web.Section {
 									Handler: api.DeletePhotoHandler,
 									Methods: []string{"DELETE"},
 								},
+								{
+									Path:    "/photos/{id:[0-9]+}",
+									Handler: api.UpdatePhotoHandler,
+									Methods: []string{"PATCH", "POST"},
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/rating",
+									Handler: api.ShowPhotoRatingHandler,
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/rating",
+									Handler: api.RatePhotoHandler,
+									Methods: []string{"PATCH", "POST"},
+								},
+								{
+									Path:    "/photos/ratings",
+									Handler: api.BulkRatePhotosHandler,
+									Methods: []string{"PATCH", "POST"},
+								},
+								{
+									Path:    "/photos/bulk",
+									Handler: api.BulkUpdatePhotosHandler,
+									Methods: []string{"PATCH", "POST"},
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/move",
+									Handler: api.MovePhotoHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/copy",
+									Handler: api.CopyPhotoHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/photos/move",
+									Handler: api.BulkMovePhotosHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/photos/copy",
+									Handler: api.BulkCopyPhotosHandler,
+									Methods: []string{"POST"},
+								},
 								{
 									Path:    "/photos/renditions/{id:[0-9]+}",
 									Handler: api.ServeRenditionHandler,
 									Methods: []string{"GET", "HEAD"},
 								},
+								{
+									Path:    "/photos/{id:[0-9]+}/focal_point",
+									Handler: api.SetPhotoFocalPointHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/tags",
+									Handler: api.ListPhotoTagsHandler,
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/tags",
+									Handler: api.UpdatePhotoTagsHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/photos/tags",
+									Handler: api.BulkUpdatePhotoTagsHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/tags",
+									Handler: api.ListTagsHandler,
+								},
+								{
+									Path:    "/photos/{id:[0-9]+}/rendition_jobs",
+									Handler: api.ListPhotoRenditionJobsHandler,
+								},
 								{
 									Path:    "/photos/{id:[0-9]+}/shares",
 									Handler: api.ShowPhotoSharesHandler,
@@ -171,6 +273,31 @@ func AdminAPIRoutes(secret string) []web.Section {
 									Path:    "/photos",
 									Handler: api.ListPhotosHandler,
 								},
+								{
+									Path:    "/shares",
+									Handler: api.CreateShareHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/shares/{shareID:[0-9]+}",
+									Handler: api.UpdateShareHandler,
+									Methods: []string{"PATCH", "POST"},
+								},
+								{
+									Path:    "/shares/{shareID:[0-9]+}",
+									Handler: api.DeleteShareHandler,
+									Methods: []string{"DELETE"},
+								},
+								{
+									Path:    "/shares/{shareID:[0-9]+}/revoke",
+									Handler: api.RevokeShareHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/shares/{shareID:[0-9]+}/unrevoke",
+									Handler: api.UnrevokeShareHandler,
+									Methods: []string{"POST"},
+								},
 								{
 									Path:    "/albums",
 									Handler: api.ListAlbumsHandler,
@@ -180,7 +307,40 @@ func AdminAPIRoutes(secret string) []web.Section {
 									Handler: api.CreateAlbumHandler,
 									Methods: []string{"POST"},
 								},
+								{
+									Path:    "/trash",
+									Handler: api.ListTrashHandler,
+								},
+								{
+									Path:    "/trash/photos/restore",
+									Handler: api.RestorePhotosHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/trash/albums/{albumID:[0-9]+}/restore",
+									Handler: api.RestoreAlbumHandler,
+									Methods: []string{"POST"},
+								},
 
+								{
+									Path:    "/members",
+									Handler: api.ListCollectionMembersHandler,
+								},
+								{
+									Path:    "/members",
+									Handler: api.AddCollectionMemberHandler,
+									Methods: []string{"POST"},
+								},
+								{
+									Path:    "/members/{userID:[0-9]+}",
+									Handler: api.ChangeCollectionMemberHandler,
+									Methods: []string{"PATCH", "POST"},
+								},
+								{
+									Path:    "/members/{userID:[0-9]+}",
+									Handler: api.RemoveCollectionMemberHandler,
+									Methods: []string{"DELETE"},
+								},
 								{
 									Path:    "/rendition_configurations",
 									Handler: api.ListRenditionConfigurationsHandler,
@@ -190,8 +350,58 @@ func AdminAPIRoutes(secret string) []web.Section {
 									Handler: api.CreateRenditionConfigurationHandler,
 									Methods: []string{"POST"},
 								},
+								{
+									Path:    "/rendition_jobs",
+									Handler: api.ListRenditionJobsHandler,
+								},
+								{
+									Path:    "/rendition_jobs/requeue",
+									Handler: api.RequeueFailedRenditionJobsHandler,
+									Methods: []string{"POST"},
+								},
 							},
 							Sections: []web.Section{
+								{
+									Path: "/rendition_configurations/{configID:[0-9]+}",
+									Routes: []web.Route{
+										{
+											Path:    "/",
+											Handler: api.ShowRenditionConfigurationHandler,
+										},
+										{
+											Path:    "/",
+											Handler: api.UpdateRenditionConfigurationHandler,
+											Methods: []string{"POST"},
+										},
+										{
+											Path:    "/",
+											Handler: api.DeleteRenditionConfigurationHandler,
+											Methods: []string{"DELETE"},
+										},
+									},
+								},
+								{
+									Path: "/rendition_jobs/{jobID:[0-9]+}",
+									Middleware: []func(http.Handler) http.Handler{
+										api.RequireRenditionJob,
+									},
+									Routes: []web.Route{
+										{
+											Path:    "/",
+											Handler: api.ShowRenditionJobHandler,
+										},
+										{
+											Path:    "/retry",
+											Handler: api.RetryRenditionJobHandler,
+											Methods: []string{"POST"},
+										},
+										{
+											Path:    "/cancel",
+											Handler: api.CancelRenditionJobHandler,
+											Methods: []string{"POST"},
+										},
+									},
+								},
 								{
 									Path: "/albums/{albumID:[0-9]+}",
 									Middleware: []func(http.Handler) http.Handler{
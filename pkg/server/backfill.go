@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+
+	"github.com/ilikeorangutans/phts/pkg/metadata"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// backfillBatchSize is how many photos BackfillExif and BackfillPlaces look up at a time.
+const backfillBatchSize = 50
+
+// BackfillExif extracts and stores exif tags for all photos that have none, reading them from the original
+// renditions. Photos whose originals have no exif data are skipped. Each photo is updated in its own transaction so
+// a failure does not undo the photos already processed.
+func (m *Main) BackfillExif(ctx context.Context) error {
+	metadata.RegisterParsers()
+
+	if err := m.MigrateDatabase(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	photoRepo := model.NewPhotoRepo()
+	var afterID int64
+	var photos, tags, failures int
+	for {
+		batch, err := photoRepo.FindPhotosWithoutExif(ctx, m.db, afterID, backfillBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "could not find photos without exif tags")
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, photo := range batch {
+			afterID = photo.ID
+			count, err := m.backfillPhotoExif(ctx, photoRepo, photo)
+			if err != nil {
+				log.Warn().Err(err).Int64("photo-id", photo.ID).Msg("could not backfill exif tags")
+				failures++
+				continue
+			}
+			log.Debug().Int64("photo-id", photo.ID).Int("tags", count).Msg("backfilled exif tags")
+			photos++
+			tags += count
+		}
+	}
+
+	log.Info().Int("photos", photos).Int("tags", tags).Int("failures", failures).Msg("exif backfill done")
+	if failures > 0 {
+		return errors.Errorf("could not backfill exif tags for %d photos", failures)
+	}
+	return nil
+}
+
+func (m *Main) backfillPhotoExif(ctx context.Context, photoRepo *model.PhotoRepo, photo model.Photo) (int, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	count, err := photoRepo.BackfillExif(ctx, tx, m.backend, m.geocoder, photo)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, errors.Wrap(err, "could not commit transaction")
+	}
+	return count, nil
+}
+
+// BackfillPlaces names the places photos with a location but no place names were taken in, using the GeoNames data
+// from the configured path. Photos too far from any known place are skipped. Each photo is updated in its own
+// transaction.
+func (m *Main) BackfillPlaces(ctx context.Context) error {
+	if m.config.GeoNamesPath == "" {
+		return errors.New("no geonames path configured")
+	}
+
+	if err := m.MigrateDatabase(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	photoRepo := model.NewPhotoRepo()
+	var afterID int64
+	var photos, skipped, failures int
+	for {
+		batch, err := photoRepo.FindPhotosWithoutPlace(ctx, m.db, afterID, backfillBatchSize)
+		if err != nil {
+			return errors.Wrap(err, "could not find photos without places")
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, photo := range batch {
+			afterID = photo.ID
+			found, err := m.backfillPhotoPlace(ctx, photoRepo, photo)
+			if err != nil {
+				log.Warn().Err(err).Int64("photo-id", photo.ID).Msg("could not backfill place")
+				failures++
+				continue
+			}
+			if !found {
+				skipped++
+				continue
+			}
+			photos++
+		}
+	}
+
+	log.Info().Int("photos", photos).Int("skipped", skipped).Int("failures", failures).Msg("place backfill done")
+	if failures > 0 {
+		return errors.Errorf("could not backfill places for %d photos", failures)
+	}
+	return nil
+}
+
+func (m *Main) backfillPhotoPlace(ctx context.Context, photoRepo *model.PhotoRepo, photo model.Photo) (bool, error) {
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "could not begin transaction")
+	}
+	defer tx.Rollback()
+
+	photo, found, err := photoRepo.GeocodePhoto(ctx, tx, m.geocoder, photo)
+	if err != nil || !found {
+		return false, err
+	}
+	log.Debug().Int64("photo-id", photo.ID).Str("city", photo.City).Str("country", photo.Country).Msg("backfilled place")
+
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "could not commit transaction")
+	}
+	return true, nil
+}
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/ilikeorangutans/phts/pkg/geocode"
 	"github.com/ilikeorangutans/phts/storage"
 	"github.com/pkg/errors"
 )
@@ -41,6 +43,11 @@ type Config struct {
 	AdminStaticFilePath string
 	// JWTSecret is used to encrypt JWT settings
 	JWTSecret string
+	// GeoNamesPath is the directory with the GeoNames files used to name photo locations. Locations are not named
+	// if it is empty.
+	GeoNamesPath string
+	// TrashRetention is how long deleted photos, albums and collections stay in the trash before they are purged.
+	TrashRetention time.Duration
 }
 
 func (c Config) Validate() error {
@@ -54,6 +61,9 @@ func (c Config) Validate() error {
 	if c.DatabaseHost == "" {
 		errors = append(errors, "PHTS_DB_HOST not provided")
 	}
+	if c.TrashRetention <= 0 {
+		errors = append(errors, "PHTS_TRASH_RETENTION must be positive")
+	}
 	if c.AdminEmail == "" || c.AdminPassword == "" {
 		errors = append(errors, "admin email and password must be provided")
 	}
@@ -77,6 +87,20 @@ func (c Config) DatabaseConnectionString() string {
 	return fmt.Sprintf("user=%s host=%s password=%s dbname=%s sslmode=%s", c.DatabaseUser, c.DatabaseHost, c.DatabasePassword, c.DatabaseName, ssl)
 }
 
+// Geocoder loads the place dataset configured by GeoNamesPath.
+func (c Config) Geocoder() (geocode.Geocoder, error) {
+	if c.GeoNamesPath == "" {
+		return geocode.None, nil
+	}
+
+	index, err := geocode.LoadGeoNames(c.GeoNamesPath, geocode.DefaultMaxDistance)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not load GeoNames")
+	}
+	log.Printf("loaded %d places from %s", index.Len(), c.GeoNamesPath)
+	return index, nil
+}
+
 func (c Config) StorageBackend(ctx context.Context) (storage.Backend, error) {
 	var backend storage.Backend
 	var err error
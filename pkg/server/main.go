@@ -11,6 +11,8 @@ import (
 	"github.com/ilikeorangutans/phts/api/public"
 	"github.com/ilikeorangutans/phts/db"
 	"github.com/ilikeorangutans/phts/model"
+	"github.com/ilikeorangutans/phts/pkg/geocode"
+	"github.com/ilikeorangutans/phts/pkg/metadata"
 	newmodel "github.com/ilikeorangutans/phts/pkg/model"
 	"github.com/ilikeorangutans/phts/pkg/security"
 	"github.com/ilikeorangutans/phts/pkg/services"
@@ -30,8 +32,6 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
-	"github.com/rwcarlsen/goexif/exif"
-	"github.com/rwcarlsen/goexif/mknote"
 )
 
 func NewMain(ctx context.Context, config Config) (*Main, error) {
@@ -40,27 +40,34 @@ func NewMain(ctx context.Context, config Config) (*Main, error) {
 		return nil, errors.Wrap(err, "could not create Main")
 	}
 
+	geocoder, err := config.Geocoder()
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create Main")
+	}
+
 	dbx, err := sqlx.ConnectContext(ctx, "postgres", config.DatabaseConnectionString())
 	if err != nil {
 		log.Fatal().Err(err).Msg("could not connect to database")
 	}
 
 	return &Main{
-		backend: storage,
-		db:      dbx,
-		config:  config,
+		backend:  storage,
+		geocoder: geocoder,
+		db:       dbx,
+		config:   config,
 	}, nil
 }
 
 // Main is the phts server application.
 type Main struct {
-	backend storage.Backend
-	db      *sqlx.DB
-	config  Config
+	backend  storage.Backend
+	geocoder geocode.Geocoder
+	db       *sqlx.DB
+	config   Config
 }
 
 func (m *Main) Run(ctx context.Context) error {
-	exif.RegisterParsers(mknote.All...)
+	metadata.RegisterParsers()
 
 	if err := m.MigrateDatabase(); err != nil {
 		return errors.WithStack(err)
@@ -74,17 +81,17 @@ func (m *Main) Run(ctx context.Context) error {
 		return errors.WithStack(err)
 	}
 
-	renditionUpdateRequestQueue := make(chan newmodel.RenditionUpdateRequest, 100)
-	StartRenditionUpdateQueueHandler(ctx, m.db, m.backend, renditionUpdateRequestQueue, 2, 30*time.Minute)
+	StartRenditionUpdateQueueHandler(ctx, m.db, m.backend, 2, time.Minute)
+	StartTrashPurger(ctx, m.db, m.backend, m.config.TrashRetention, time.Hour)
 
-	if err := m.SetupWebServer(ctx, renditionUpdateRequestQueue); err != nil {
+	if err := m.SetupWebServer(ctx); err != nil {
 		return errors.WithStack(err)
 	}
 
 	return nil
 }
 
-func (m *Main) SetupWebServer(ctx context.Context, renditionUpdateRequestQueue chan newmodel.RenditionUpdateRequest) error {
+func (m *Main) SetupWebServer(ctx context.Context) error {
 	sessionStorage := session.NewInMemoryStorage(30, time.Hour*1, time.Hour*24)
 	email := smtp.NewEmailSender(m.config.SmtpHost, m.config.SmtpPort, m.config.SmtpUser, m.config.SmtpPassword, m.config.SmtpFrom)
 
@@ -92,12 +99,13 @@ func (m *Main) SetupWebServer(ctx context.Context, renditionUpdateRequestQueue c
 	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(AddServicesToContext(m.db, m.backend, sessionStorage, renditionUpdateRequestQueue))
+	r.Use(AddServicesToContext(m.db, m.backend, m.geocoder, sessionStorage))
 	cors := cors.New(cors.Options{
 		// Add AllowOriginFunc to dynamically check origins
 		AllowedOrigins:   []string{"*"}, // I'm pretty sure this defeats the entire purpose of CORS
-		AllowedHeaders:   []string{"Authorization", "Origin", "Accept", "Content-Type", "Cookie", "Content-Length", "Last-Modified", "Cache-Control"},
-		AllowedMethods:   []string{"GET", "HEAD", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Origin", "Accept", "Content-Type", "Cookie", "Content-Length", "Last-Modified", "Cache-Control", "Range", "If-Range", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders:   []string{"ETag", "Content-Range", "Accept-Ranges"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PATCH", "DELETE"},
 		AllowCredentials: true,
 		MaxAge:           3600,
 		Debug:            false,
@@ -225,7 +233,7 @@ func (m *Main) MigrateDatabase() error {
 	return nil
 }
 
-func AddServicesToContext(dbx *sqlx.DB, backend storage.Backend, sessions session.Storage, queue chan newmodel.RenditionUpdateRequest) func(http.Handler) http.Handler {
+func AddServicesToContext(dbx *sqlx.DB, backend storage.Backend, geocoder geocode.Geocoder, sessions session.Storage) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 
@@ -235,7 +243,7 @@ func AddServicesToContext(dbx *sqlx.DB, backend storage.Backend, sessions sessio
 			ctx = context.WithValue(ctx, "backend", backend)
 			ctx = context.WithValue(ctx, "sessions", sessions)
 			ctx = web.AddStorageBackendToContext(ctx, backend)
-			ctx = web.AddRenditionUpdateRequestQueueToContext(ctx, queue)
+			ctx = web.AddGeocoderToContext(ctx, geocoder)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		}
 
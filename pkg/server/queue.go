@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/ilikeorangutans/phts/pkg/model"
@@ -13,27 +15,37 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-//  StartRenditionUpdateQueueHandler starts a go routine to continuously check for missing renditions and numWorkers go routines to process rendition updates.
-func StartRenditionUpdateQueueHandler(ctx context.Context, dbx *sqlx.DB, backend storage.Backend, queue chan model.RenditionUpdateRequest, numWorkers uint, frequency time.Duration) {
-	go enqueueMissingRenditions(ctx, dbx, queue, frequency)
+const (
+	// renditionJobLease is how long a worker may hold on to a job before other workers may claim it again. It must be
+	// longer than renditionJobTimeout.
+	renditionJobLease = 5 * time.Minute
+	// renditionJobTimeout is how long a worker may spend on a single job.
+	renditionJobTimeout = 60 * time.Second
+	// renditionJobPollInterval is how long an idle worker waits before checking for new jobs.
+	renditionJobPollInterval = 2 * time.Second
+)
+
+// StartRenditionUpdateQueueHandler starts a go routine to periodically enqueue jobs for photos with missing renditions and numWorkers go routines to process rendition jobs.
+func StartRenditionUpdateQueueHandler(ctx context.Context, dbx *sqlx.DB, backend storage.Backend, numWorkers uint, frequency time.Duration) {
+	go enqueueMissingRenditions(ctx, dbx, frequency)
 
 	// TODO make the number of workers configurable
 	for i := uint(0); i < numWorkers; i++ {
-		worker := newRenditionUpdateWorker(dbx, backend, queue, i)
+		worker := newRenditionUpdateWorker(dbx, backend, i)
 		go worker.start(ctx)
 	}
 }
 
-// enqueueMissingRenditions finds photos with missing renditions and enqueues them for processing.
-func enqueueMissingRenditions(ctx context.Context, dbx *sqlx.DB, queue chan model.RenditionUpdateRequest, frequency time.Duration) {
+// enqueueMissingRenditions finds photos with missing renditions and enqueues jobs for them. This catches photos that
+// need renditions for newly added rendition configurations.
+func enqueueMissingRenditions(ctx context.Context, dbx *sqlx.DB, frequency time.Duration) {
 	log.Debug().Dur("frequency", frequency).Msg("scanning for missing renditions")
 	photoRepo := model.NewPhotoRepo()
-	ticker := time.NewTicker(10 * time.Second)
+	jobRepo := model.NewRenditionJobRepo()
+	ticker := time.NewTicker(frequency)
 	for {
 		select {
 		case <-ticker.C:
-			// TODO this sometimes picks up photos we are already processing
-			// It's not bad, but annoying
 			photos, err := photoRepo.FindPhotosWithMissingRenditions(ctx, dbx, 20)
 			if err != nil {
 				log.Warn().Err(err).Msg("error scanning for photos with missing renditions")
@@ -47,8 +59,8 @@ func enqueueMissingRenditions(ctx context.Context, dbx *sqlx.DB, queue chan mode
 			log.Debug().Int("count", len(photos)).Msg("found photos with missing renditions")
 
 			for _, photo := range photos {
-				queue <- model.RenditionUpdateRequest{
-					Photo: photo,
+				if err := jobRepo.Enqueue(ctx, dbx, photo.ID); err != nil {
+					log.Warn().Err(err).Int64("photo-id", photo.ID).Msg("could not enqueue rendition job")
 				}
 			}
 
@@ -60,12 +72,12 @@ func enqueueMissingRenditions(ctx context.Context, dbx *sqlx.DB, queue chan mode
 }
 
 // newRenditionUpdateWorker creates a new worker.
-func newRenditionUpdateWorker(dbx *sqlx.DB, backend storage.Backend, queue <-chan model.RenditionUpdateRequest, id uint) *renditionUpdateWorker {
+func newRenditionUpdateWorker(dbx *sqlx.DB, backend storage.Backend, id uint) *renditionUpdateWorker {
 	return &renditionUpdateWorker{
 		dbx:     dbx,
 		backend: backend,
 		logger:  log.With().Uint("worker-id", id).Logger(),
-		queue:   queue,
+		jobs:    model.NewRenditionJobRepo(),
 	}
 }
 
@@ -73,85 +85,145 @@ type renditionUpdateWorker struct {
 	logger  zerolog.Logger
 	dbx     *sqlx.DB
 	backend storage.Backend
-	queue   <-chan model.RenditionUpdateRequest
+	jobs    *model.RenditionJobRepo
 }
 
-// start makes the worker consume events from the queue until the ctx says to stop.
+// start makes the worker claim and process jobs until the ctx says to stop.
 func (r *renditionUpdateWorker) start(ctx context.Context) {
 	r.logger.Debug().Msg("worker starting")
 	for {
+		processed, err := r.processNextJob(ctx)
+		if err != nil {
+			r.logger.Warn().Err(err).Msg("could not process rendition job")
+		}
+		if processed {
+			continue
+		}
+
 		select {
 		case <-ctx.Done():
 			r.logger.Debug().Msg("worker shutting down")
 			return
-		case req := <-r.queue:
-			ctx, cancel := context.WithTimeout(r.logger.WithContext(ctx), 60*time.Second)
-			defer cancel()
+		case <-time.After(renditionJobPollInterval):
+		}
+	}
+}
 
-			err := r.processUpdateRequest(ctx, req)
-			if err != nil {
-				r.logger.Warn().Int64("photo-id", req.Photo.ID).Err(err)
-			}
+// processNextJob claims the next job and processes it. Returns whether a job was claimed.
+func (r *renditionUpdateWorker) processNextJob(ctx context.Context) (bool, error) {
+	job, err := r.jobs.Claim(ctx, r.dbx, renditionJobLease)
+	if errors.Is(err, model.ErrNoRenditionJob) {
+		return false, nil
+	} else if err != nil {
+		return false, errors.Wrap(err, "could not claim job")
+	}
+
+	l := r.logger.With().Int64("job-id", job.ID).Int64("photo-id", job.PhotoID).Int("attempt", job.Attempts).Logger()
+
+	jobCtx, cancel := context.WithTimeout(l.WithContext(ctx), renditionJobTimeout)
+	defer cancel()
+
+	if err := r.processJob(jobCtx, l, job); err != nil {
+		job, failErr := r.jobs.Fail(ctx, r.dbx, job, err)
+		if failErr != nil {
+			return true, errors.Wrap(failErr, "could not record job failure")
 		}
+		l.Warn().Err(err).Str("state", string(job.State)).Msg("rendition job failed")
+		return true, nil
+	}
+
+	if _, err := r.jobs.Complete(ctx, r.dbx, job); err != nil {
+		return true, errors.Wrap(err, "could not complete job")
 	}
+
+	return true, nil
 }
 
-func (r *renditionUpdateWorker) processUpdateRequest(ctx context.Context, req model.RenditionUpdateRequest) error {
-	l := r.logger.With().Int64("photo-id", req.Photo.ID).Logger()
-	l.Debug().Msg("processing queue entry")
+func (r *renditionUpdateWorker) processJob(ctx context.Context, l zerolog.Logger, job model.RenditionJob) error {
+	l.Debug().Msg("processing rendition job")
 
-	missingRenditions, err := model.FindMissingRenditionConfigurations(ctx, r.dbx, req.Photo)
+	photo, err := model.NewPhotoRepo().FindByID(ctx, r.dbx, job.PhotoID)
 	if err != nil {
-		return errors.Wrap(err, "could not find original rendition")
+		return errors.Wrap(err, "could not find photo")
+	}
+
+	missingRenditions, err := model.FindMissingRenditionConfigurations(ctx, r.dbx, photo)
+	if err != nil {
+		return errors.Wrap(err, "could not find missing rendition configurations")
 	}
 
 	if len(missingRenditions) == 0 {
 		return nil
 	}
 
-	original, err := model.FindOriginalRenditionByPhoto(ctx, r.dbx, req.Photo)
+	original, err := model.FindOriginalRenditionByPhoto(ctx, r.dbx, photo)
 	if err != nil {
 		return errors.Wrap(err, "could not find original rendition")
 	}
 
-	data, err := r.backend.Get(original.ID)
+	data, _, err := r.backend.Open(original.ID)
 	if err != nil {
 		return errors.Wrap(err, "error fetching original binary")
 	}
+	defer data.Close()
 
+	var failures []string
 	for _, config := range missingRenditions {
 		l.Debug().Str("rendition", config.Name).Msg("generating rendition")
-		err := r.processRenditionUpdate(ctx, config, req.Photo, data)
+		if _, err := data.Seek(0, io.SeekStart); err != nil {
+			return errors.Wrap(err, "could not rewind original binary")
+		}
+		err := r.processRenditionUpdate(ctx, l, config, photo, data)
 		if err != nil {
 			l.Warn().Err(err).Int64("rendition-configuration-id", config.ID).Msg("could not process config")
+			failures = append(failures, config.Name+": "+err.Error())
 			continue
 		}
 		l.Debug().Str("rendition", config.Name).Msg("rendition created")
 	}
+
+	if len(failures) > 0 {
+		return errors.Errorf("could not create %d/%d renditions: %s", len(failures), len(missingRenditions), strings.Join(failures, "; "))
+	}
 	l.Debug().Msg("renditions up to date")
 
 	return nil
 }
 
-func (r *renditionUpdateWorker) processRenditionUpdate(ctx context.Context, config model.RenditionConfiguration, photo model.Photo, data []byte) error {
+// processRenditionUpdate creates the rendition for the given config and replaces any rendition made from an older
+// version of the config. Binaries of replaced renditions are deleted once the new rendition is committed.
+func (r *renditionUpdateWorker) processRenditionUpdate(ctx context.Context, l zerolog.Logger, config model.RenditionConfiguration, photo model.Photo, data io.ReadSeeker) error {
 	photoRepo := model.NewPhotoRepo()
-	rendition, binary, err := config.Process(ctx, data)
+	rendition, binary, err := config.Process(ctx, data, photo.FocalPoint())
 	if err != nil {
 		return errors.Wrap(err, "could not process config")
 	}
+	defer binary.Close()
 
 	tx, err := r.dbx.Beginx()
 	if err != nil {
 		return errors.Wrap(err, "could not start transaction")
 	}
 
+	outdated, err := model.DeleteRenditionsForPhotoAndConfiguration(ctx, tx, photo, config)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "could not delete outdated renditions")
+	}
+
 	_, rendition, err = photoRepo.AddRendition(ctx, tx, photo, rendition)
 	if err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "error adding rendition")
 	}
 
-	err = r.backend.Store(rendition.ID, binary)
+	size, err := storage.Size(binary)
+	if err != nil {
+		tx.Rollback()
+		return errors.Wrap(err, "could not determine binary size")
+	}
+
+	_, err = model.PutRenditionBinary(ctx, tx, r.backend, rendition, binary, size)
 	if err != nil {
 		tx.Rollback()
 		return errors.Wrap(err, "could not store binary")
@@ -164,5 +236,11 @@ func (r *renditionUpdateWorker) processRenditionUpdate(ctx context.Context, conf
 		return errors.Wrap(err, "could not commit")
 	}
 
+	for _, id := range outdated {
+		if err := r.backend.Delete(id); err != nil {
+			l.Warn().Err(err).Int64("rendition-id", id).Msg("could not delete binary of outdated rendition")
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+// trashPurgeBatchSize is the number of photos purged in one transaction.
+const trashPurgeBatchSize = 100
+
+// StartTrashPurger starts a go routine that periodically deletes photos, albums and collections that have been in the
+// trash for longer than retention, including the binaries of their renditions.
+func StartTrashPurger(ctx context.Context, dbx *sqlx.DB, backend storage.Backend, retention time.Duration, frequency time.Duration) {
+	go purgeTrash(ctx, dbx, backend, retention, frequency)
+}
+
+func purgeTrash(ctx context.Context, dbx *sqlx.DB, backend storage.Backend, retention time.Duration, frequency time.Duration) {
+	log.Debug().Dur("retention", retention).Dur("frequency", frequency).Msg("purging trash")
+	trashRepo := model.NewTrashRepo()
+	ticker := time.NewTicker(frequency)
+	for {
+		select {
+		case <-ticker.C:
+			before := time.Now().Add(-retention)
+			for {
+				n, err := trashRepo.Purge(ctx, dbx, backend, before, trashPurgeBatchSize)
+				if err != nil {
+					log.Warn().Err(err).Msg("error purging trash")
+					break
+				}
+				if n > 0 {
+					log.Debug().Int("count", n).Msg("purged photos from trash")
+				}
+				if n < trashPurgeBatchSize {
+					break
+				}
+			}
+
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package storage
 
 import (
-	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"strconv"
@@ -34,11 +35,17 @@ type GCSBackend struct {
 	bucket    *storage.BucketHandle
 }
 
-func (b *GCSBackend) Store(id int64, data []byte) error {
-	name := strconv.FormatInt(id, 10)
-	obj := b.bucket.Object(name)
+func (b *GCSBackend) Put(id int64, reader io.Reader, size int64, contentType string) error {
+	obj := b.bucket.Object(strconv.FormatInt(id, 10))
 	writer := obj.NewWriter(b.ctx)
-	if _, err := writer.Write(data); err != nil {
+	writer.ContentType = contentType
+	written, err := io.Copy(writer, io.LimitReader(reader, size))
+	if err == nil && written != size {
+		err = fmt.Errorf("expected %d bytes but got %d", size, written)
+	}
+	if err != nil {
+		// Closing with an error aborts the upload so no truncated object is stored.
+		writer.CloseWithError(err)
 		return err
 	}
 	if err := writer.Close(); err != nil {
@@ -47,19 +54,79 @@ func (b *GCSBackend) Store(id int64, data []byte) error {
 	return nil
 }
 
-func (b *GCSBackend) Get(id int64) ([]byte, error) {
+func (b *GCSBackend) Open(id int64) (ReadSeekCloser, ObjectInfo, error) {
 	obj := b.bucket.Object(strconv.FormatInt(id, 10))
-	reader, err := obj.NewReader(b.ctx)
+	attrs, err := obj.Attrs(b.ctx)
 	if err != nil {
-		return nil, err
+		return nil, ObjectInfo{}, err
 	}
-	defer reader.Close()
-	buffer := bytes.NewBuffer([]byte{})
-	_, err = io.Copy(buffer, reader)
-	return buffer.Bytes(), err
+
+	return &gcsObject{ctx: b.ctx, obj: obj, size: attrs.Size}, ObjectInfo{
+		Size:        attrs.Size,
+		ModTime:     attrs.Updated,
+		ContentType: attrs.ContentType,
+	}, nil
 }
 
 func (b *GCSBackend) Delete(id int64) error {
 	obj := b.bucket.Object(strconv.FormatInt(id, 10))
 	return obj.Delete(b.ctx)
 }
+
+// gcsObject implements ReadSeekCloser on top of GCS range reads. The underlying reader is opened lazily at the
+// current offset and reopened after every seek.
+type gcsObject struct {
+	ctx    context.Context
+	obj    *storage.ObjectHandle
+	size   int64
+	offset int64
+	reader *storage.Reader
+}
+
+func (o *gcsObject) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+	if o.reader == nil {
+		reader, err := o.obj.NewRangeReader(o.ctx, o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.reader = reader
+	}
+
+	n, err := o.reader.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *gcsObject) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = o.offset + offset
+	case io.SeekEnd:
+		abs = o.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if abs != o.offset && o.reader != nil {
+		o.reader.Close()
+		o.reader = nil
+	}
+	o.offset = abs
+	return abs, nil
+}
+
+func (o *gcsObject) Close() error {
+	if o.reader == nil {
+		return nil
+	}
+	return o.reader.Close()
+}
@@ -1,7 +1,6 @@
 package storage
 
 import (
-	"bytes"
 	"io"
 	"log"
 	"strconv"
@@ -39,25 +38,31 @@ type MinIOBackend struct {
 	bucket string
 }
 
-func (m *MinIOBackend) Store(id int64, data []byte) error {
-	_, err := m.client.PutObject(m.bucket, strconv.FormatInt(id, 10), bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{})
+func (m *MinIOBackend) Put(id int64, reader io.Reader, size int64, contentType string) error {
+	_, err := m.client.PutObject(m.bucket, strconv.FormatInt(id, 10), reader, size, minio.PutObjectOptions{ContentType: contentType})
 	if err != nil {
 		return errors.Wrap(err, "could not store object")
 	}
 	return nil
 }
 
-func (m *MinIOBackend) Get(id int64) ([]byte, error) {
+func (m *MinIOBackend) Open(id int64) (ReadSeekCloser, ObjectInfo, error) {
 	obj, err := m.client.GetObject(m.bucket, strconv.FormatInt(id, 10), minio.GetObjectOptions{})
 	if err != nil {
-		return nil, errors.Wrap(err, "could not get object")
+		return nil, ObjectInfo{}, errors.Wrap(err, "could not get object")
 	}
-	buffer := bytes.NewBuffer([]byte{})
-	_, err = io.Copy(buffer, obj)
+
+	stat, err := obj.Stat()
 	if err != nil {
-		return nil, errors.Wrap(err, "could not copy bytes")
+		obj.Close()
+		return nil, ObjectInfo{}, errors.Wrap(err, "could not stat object")
 	}
-	return buffer.Bytes(), nil
+
+	return obj, ObjectInfo{
+		Size:        stat.Size,
+		ModTime:     stat.LastModified,
+		ContentType: stat.ContentType,
+	}, nil
 }
 
 func (m *MinIOBackend) Delete(id int64) error {
@@ -2,18 +2,51 @@ package storage
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 )
 
+// Backend stores binaries by id. Binaries are streamed in and out so memory use does not depend on their size.
 type Backend interface {
-	Store(int64, []byte) error
-	Get(int64) ([]byte, error)
+	// Put stores size bytes read from the reader under the given id.
+	Put(id int64, reader io.Reader, size int64, contentType string) error
+	// Open returns a reader for the binary with the given id along with information about it. Callers must close
+	// the reader.
+	Open(id int64) (ReadSeekCloser, ObjectInfo, error)
 	Delete(int64) error
 }
 
+// ReadSeekCloser groups the basic Read, Seek and Close methods.
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// ObjectInfo describes a stored binary.
+type ObjectInfo struct {
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Size returns the size of the given seeker by seeking to its end and rewinding.
+func Size(seeker io.Seeker) (int64, error) {
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 func NewFileBackend(dir string) Backend {
 	backend := &FileBackend{BaseDir: dir}
 	backend.Init()
@@ -33,16 +66,65 @@ func (b *FileBackend) Init() {
 	log.Printf("FileBackend ready at %s", b.BaseDir)
 }
 
-func (b *FileBackend) Store(id int64, data []byte) error {
+func (b *FileBackend) Put(id int64, reader io.Reader, size int64, contentType string) error {
 	p := b.path(id)
-	log.Printf("Writing %d bytes to %s", len(data), p)
+	log.Printf("Writing %d bytes to %s", size, p)
+
+	// Write to a temporary file first so readers never see a partially written binary.
+	tmp, err := ioutil.TempFile(b.BaseDir, fmt.Sprintf(".%d-*", id))
+	if err != nil {
+		return err
+	}
+
+	written, err := io.Copy(tmp, io.LimitReader(reader, size))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("expected %d bytes but got %d", size, written)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
 
-	return ioutil.WriteFile(p, data, 0644)
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p)
 }
 
-// TODO this should probably return a Reader
-func (b *FileBackend) Get(id int64) ([]byte, error) {
-	return ioutil.ReadFile(filepath.Join(b.BaseDir, fmt.Sprintf("%d", id)))
+func (b *FileBackend) Open(id int64) (ReadSeekCloser, ObjectInfo, error) {
+	file, err := os.Open(b.path(id))
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	// Files don't carry a content type, so sniff it from the first bytes.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	return file, ObjectInfo{
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		ContentType: http.DetectContentType(head[:n]),
+	}, nil
 }
 
 func (b *FileBackend) Delete(id int64) error {
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withFileBackend(t *testing.T, f func(backend Backend)) {
+	dir, err := ioutil.TempDir("", "phts-storage")
+	if err != nil {
+		t.Fatalf("could not create temp dir")
+	}
+	defer os.RemoveAll(dir)
+
+	f(NewFileBackend(dir))
+}
+
+func TestFileBackendPutAndOpen(t *testing.T) {
+	withFileBackend(t, func(backend Backend) {
+		data, err := ioutil.ReadFile("../test/integration/files/1x1.jpg")
+		assert.NoError(t, err)
+
+		err = backend.Put(13, bytes.NewReader(data), int64(len(data)), "image/jpeg")
+		assert.NoError(t, err)
+
+		reader, info, err := backend.Open(13)
+		assert.NoError(t, err)
+		defer reader.Close()
+
+		assert.Equal(t, int64(len(data)), info.Size)
+		assert.Equal(t, "image/jpeg", info.ContentType)
+		assert.False(t, info.ModTime.IsZero())
+
+		stored, err := ioutil.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.Equal(t, data, stored)
+	})
+}
+
+func TestFileBackendPutShortRead(t *testing.T) {
+	withFileBackend(t, func(backend Backend) {
+		err := backend.Put(13, bytes.NewReader([]byte{1, 2, 3}), 10, "application/octet-stream")
+		assert.Error(t, err)
+
+		_, _, err = backend.Open(13)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestFileBackendDelete(t *testing.T) {
+	withFileBackend(t, func(backend Backend) {
+		err := backend.Put(13, bytes.NewReader([]byte{1, 2, 3}), 3, "application/octet-stream")
+		assert.NoError(t, err)
+
+		assert.NoError(t, backend.Delete(13))
+
+		_, _, err = backend.Open(13)
+		assert.True(t, os.IsNotExist(err))
+	})
+}
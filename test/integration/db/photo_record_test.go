@@ -37,7 +37,7 @@ func TestList(t *testing.T) {
 		photo, _ = photoDB.FindByID(col.ID, photo.ID)
 
 		paginator := db.NewPaginator()
-		records, err := repo.List(col.ID, paginator)
+		records, err := repo.List(col.ID, paginator, db.PhotoFilter{})
 
 		assert.Nil(t, err)
 		assert.Equal(t, []db.PhotoRecord{photo}, records)
@@ -57,7 +57,7 @@ func TestListAlbum(t *testing.T) {
 		photo1, _ = photoRepo.FindByID(col.ID, photo1.ID)
 
 		paginator := db.NewPaginator()
-		records, err := repo.ListAlbum(col.ID, album.ID, paginator)
+		records, err := repo.ListAlbum(col.ID, album.ID, paginator, db.PhotoFilter{})
 
 		assert.Nil(t, err)
 		assert.Equal(t, []db.PhotoRecord{photo1}, records)
@@ -82,7 +82,7 @@ func TestListAlbumWithPaginaton(t *testing.T) {
 		paginator.PrevID = photo2.ID
 		paginator.PrevTimestamp = &photo2.UpdatedAt
 		paginator.Direction = db.Asc
-		records, err := repo.ListAlbum(col.ID, album.ID, paginator)
+		records, err := repo.ListAlbum(col.ID, album.ID, paginator, db.PhotoFilter{})
 
 		assert.Nil(t, err)
 		assert.Equal(t, []db.PhotoRecord{photo1}, records)
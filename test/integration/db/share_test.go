@@ -16,7 +16,6 @@ func TestSaveNewShareRecord(t *testing.T) {
 		shareDB := db.NewShareDB(dbx)
 
 		share := db.ShareRecord{
-			PhotoID:      photo.ID,
 			CollectionID: collection.ID,
 			ShareSiteID:  shareSite.ID,
 			Slug:         "testing",
@@ -25,6 +24,7 @@ func TestSaveNewShareRecord(t *testing.T) {
 		share, err := shareDB.Save(share)
 		assert.Nil(t, err)
 		assert.True(t, share.IsPersisted())
+		assert.Nil(t, shareDB.SetPhotos(share.ID, []int64{photo.ID}))
 	})
 }
 
@@ -38,13 +38,13 @@ func TestFindByPhoto(t *testing.T) {
 		shareRendConfDB := db.NewShareRenditionConfigurationDB(dbx)
 
 		share := db.ShareRecord{
-			PhotoID:      photo.ID,
 			CollectionID: collection.ID,
 			ShareSiteID:  shareSite.ID,
 			Slug:         "testing",
 		}
 		share, err := shareDB.Save(share)
 		assert.Nil(t, err)
+		assert.Nil(t, shareDB.SetPhotos(share.ID, []int64{photo.ID}))
 		_, err = shareRendConfDB.SetForShare(share.ID, []db.ShareRenditionConfigurationRecord{{ShareID: share.ID, RenditionConfigurationID: renditionConfig.ID}})
 		assert.Nil(t, err)
 
@@ -63,8 +63,9 @@ func TestFindByShareSiteAndSlug(t *testing.T) {
 		shareDB := db.NewShareDB(dbx)
 		renditionConfig1, _ := CreateRenditionConfiguration(t, dbx, collection.ID)
 		CreateRenditionConfiguration(t, dbx, collection.ID)
-		share, err := shareDB.Save(db.ShareRecord{PhotoID: photo.ID, CollectionID: collection.ID, ShareSiteID: shareSite.ID, Slug: "testing"})
+		share, err := shareDB.Save(db.ShareRecord{CollectionID: collection.ID, ShareSiteID: shareSite.ID, Slug: "testing"})
 		assert.Nil(t, err)
+		assert.Nil(t, shareDB.SetPhotos(share.ID, []int64{photo.ID}))
 		shareRendConfDB := db.NewShareRenditionConfigurationDB(dbx)
 		_, err = shareRendConfDB.SetForShare(share.ID, []db.ShareRenditionConfigurationRecord{{ShareID: share.ID, RenditionConfigurationID: renditionConfig1.ID}})
 		assert.Nil(t, err)
@@ -112,7 +112,6 @@ func CreateShare(t *testing.T, dbx db.DB, collection *db.Collection, shareSite d
 	slug, _ := model.SlugFromString(time.Now().Format(time.RFC822Z))
 	repo := db.NewShareDB(dbx)
 	record := db.ShareRecord{
-		PhotoID:      photo.ID,
 		CollectionID: collection.ID,
 		ShareSiteID:  shareSite.ID,
 		Slug:         slug,
@@ -120,6 +119,7 @@ func CreateShare(t *testing.T, dbx db.DB, collection *db.Collection, shareSite d
 
 	record, err := repo.Save(record)
 	assert.Nil(t, err)
+	assert.Nil(t, repo.SetPhotos(record.ID, []int64{photo.ID}))
 
 	return record, repo
 }
@@ -40,7 +40,7 @@ func TestAddPhotoToCollectionCreatesRenditions(t *testing.T) {
 		assert.Nil(t, err)
 
 		photoDB := db.NewPhotoDB(dbx)
-		photos, err := photoDB.List(col.ID, db.NewPaginator())
+		photos, err := photoDB.List(col.ID, db.NewPaginator(), db.PhotoFilter{})
 		assert.Nil(t, err)
 		photoRecord := photos[0]
 
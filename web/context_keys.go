@@ -7,6 +7,7 @@ const (
 	SessionsKey
 	UserKey
 	CollectionKey
-	UpdateRenditionQueue
 	ShareSiteKey
+	RenditionJobKey
+	GeocoderKey
 )
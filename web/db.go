@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/ilikeorangutans/phts/pkg/geocode"
 	"github.com/ilikeorangutans/phts/pkg/model"
 	"github.com/ilikeorangutans/phts/storage"
 	"github.com/jmoiron/sqlx"
@@ -63,14 +64,29 @@ func StorageBackendFromRequest(r *http.Request) storage.Backend {
 	return storage
 }
 
-func AddRenditionUpdateRequestQueueToContext(ctx context.Context, queue chan model.RenditionUpdateRequest) context.Context {
-	return context.WithValue(ctx, UpdateRenditionQueue, queue)
+func AddGeocoderToContext(ctx context.Context, geocoder geocode.Geocoder) context.Context {
+	return context.WithValue(ctx, GeocoderKey, geocoder)
 }
 
-func GetRenditionUpdateRequestQueueFromRequest(r *http.Request) chan model.RenditionUpdateRequest {
-	queue, ok := r.Context().Value(UpdateRenditionQueue).(chan model.RenditionUpdateRequest)
+// GeocoderFromRequest returns the geocoder in the request context, or geocode.None if there's none.
+func GeocoderFromRequest(r *http.Request) geocode.Geocoder {
+	geocoder, ok := r.Context().Value(GeocoderKey).(geocode.Geocoder)
 	if !ok {
-		log.Fatal("no rendition update request queue in context")
+		return geocode.None
 	}
-	return queue
+
+	return geocoder
+}
+
+func AddRenditionJobToContext(ctx context.Context, job model.RenditionJob) context.Context {
+	return context.WithValue(ctx, RenditionJobKey, job)
+}
+
+func RenditionJobFromRequest(r *http.Request) model.RenditionJob {
+	job, ok := r.Context().Value(RenditionJobKey).(model.RenditionJob)
+	if !ok {
+		log.Fatal("Could not get rendition job from request, wrong type")
+	}
+
+	return job
 }
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ilikeorangutans/phts/pkg/model"
+)
+
+// mediaRange is a single entry of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// parseAccept parses the media ranges in the given Accept header. Malformed quality values count as 1.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		r := mediaRange{q: 1}
+		slash := strings.Index(mediaType, "/")
+		if slash < 0 {
+			r.typ, r.subtype = mediaType, "*"
+		} else {
+			r.typ, r.subtype = mediaType[:slash], mediaType[slash+1:]
+		}
+
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if q, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+// quality returns the quality the given ranges assign to the content type and how specific the matching range was:
+// 2 for an exact match, 1 for type/*, 0 for */* and -1 if none matched. The most specific matching range wins.
+func quality(ranges []mediaRange, contentType string) (float64, int) {
+	typ, subtype := contentType, ""
+	if slash := strings.Index(contentType, "/"); slash >= 0 {
+		typ, subtype = contentType[:slash], contentType[slash+1:]
+	}
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		s := -1
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q, specificity
+}
+
+// NegotiateRendition picks the variant whose format the Accept header prefers. Formats named explicitly beat those
+// only matched by a wildcard at the same quality, so a client listing image/png gets PNG even if it also sends
+// image/*. The requested rendition wins remaining ties and is also returned if the client accepts none of the variants.
+func NegotiateRendition(accept string, requested model.ServableRendition, variants []model.ServableRendition) model.ServableRendition {
+	if strings.TrimSpace(accept) == "" {
+		return requested
+	}
+
+	ranges := parseAccept(accept)
+	best := requested
+	bestQ, bestSpecificity := quality(ranges, requested.Format)
+	for _, variant := range variants {
+		q, specificity := quality(ranges, variant.Format)
+		if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = variant, q, specificity
+		}
+	}
+
+	return best
+}
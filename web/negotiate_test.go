@@ -0,0 +1,41 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func variant(id int64, format string) model.ServableRendition {
+	return model.ServableRendition{Rendition: model.Rendition{Record: db.Record{ID: id}, Format: format}}
+}
+
+func TestNegotiateRendition(t *testing.T) {
+	jpeg := variant(1, "image/jpeg")
+	png := variant(2, "image/png")
+	variants := []model.ServableRendition{jpeg, png}
+
+	tests := []struct {
+		name     string
+		accept   string
+		expected int64
+	}{
+		{"no accept header", "", 1},
+		{"browser", "image/avif,image/webp,image/apng,image/*,*/*;q=0.8", 1},
+		{"named format beats wildcard", "image/png,image/*", 2},
+		{"wildcard only", "*/*", 1},
+		{"image wildcard", "image/*", 1},
+		{"explicit preference", "image/jpeg;q=0.5, image/png", 2},
+		{"requested is refused", "image/jpeg;q=0, image/*;q=0.5", 2},
+		{"nothing acceptable", "text/html", 1},
+		{"case insensitive", "IMAGE/PNG", 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, NegotiateRendition(test.accept, jpeg, variants).ID)
+		})
+	}
+}
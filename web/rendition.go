@@ -0,0 +1,57 @@
+package web
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/jmoiron/sqlx"
+)
+
+// ServeRendition writes the binary of the given rendition to the response. It sets a strong ETag from the content
+// hash and the rendition configuration's Cache-Control policy, and leaves conditional requests (If-None-Match,
+// If-Modified-Since), Range and If-Range requests to http.ServeContent.
+// Renditions stored before content hashes were recorded get theirs computed and persisted through dbx.
+func ServeRendition(w http.ResponseWriter, r *http.Request, dbx sqlx.ExecerContext, backend storage.Backend, rendition model.ServableRendition) {
+	data, _, err := backend.Open(rendition.ID)
+	if err != nil {
+		log.Printf("binary not found for rendition: %v", err.Error())
+		http.Error(w, "binary not found for rendition", http.StatusNotFound)
+		return
+	}
+	defer data.Close()
+
+	if rendition.ContentHash == "" {
+		hash, err := model.ContentHash(data)
+		if err != nil {
+			log.Printf("could not hash binary for rendition %d: %v", rendition.ID, err.Error())
+			http.Error(w, "could not read binary for rendition", http.StatusInternalServerError)
+			return
+		}
+		if _, err := data.Seek(0, io.SeekStart); err != nil {
+			log.Printf("could not rewind binary for rendition %d: %v", rendition.ID, err.Error())
+			http.Error(w, "could not read binary for rendition", http.StatusInternalServerError)
+			return
+		}
+
+		rendition.ContentHash = hash
+		if err := model.UpdateRenditionContentHash(r.Context(), dbx, rendition.Rendition); err != nil {
+			log.Printf("could not persist content hash for rendition %d: %v", rendition.ID, err.Error())
+		}
+	}
+
+	cacheControl := strings.TrimSpace(rendition.CacheControl)
+	if cacheControl == "" {
+		cacheControl = db.DefaultCacheControl
+	}
+
+	w.Header().Set("ETag", `"`+rendition.ContentHash+`"`)
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("Content-Type", rendition.Format)
+
+	http.ServeContent(w, r, "", rendition.UpdatedAt, data)
+}
@@ -0,0 +1,164 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ilikeorangutans/phts/db"
+	"github.com/ilikeorangutans/phts/pkg/model"
+	"github.com/ilikeorangutans/phts/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryBackend map[int64][]byte
+
+func (m memoryBackend) Put(id int64, reader io.Reader, size int64, contentType string) error {
+	data, err := ioutil.ReadAll(io.LimitReader(reader, size))
+	m[id] = data
+	return err
+}
+
+func (m memoryBackend) Open(id int64) (storage.ReadSeekCloser, storage.ObjectInfo, error) {
+	data := m[id]
+	return nopCloser{bytes.NewReader(data)}, storage.ObjectInfo{Size: int64(len(data))}, nil
+}
+
+func (m memoryBackend) Delete(id int64) error {
+	delete(m, id)
+	return nil
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+func servableRendition(updatedAt time.Time) model.ServableRendition {
+	return model.ServableRendition{
+		Rendition: model.Rendition{
+			Record:      db.Record{ID: 13},
+			Timestamps:  db.Timestamps{CreatedAt: updatedAt, UpdatedAt: updatedAt},
+			Format:      "image/jpeg",
+			ContentHash: "abc123",
+		},
+		CacheControl: "private, no-store",
+	}
+}
+
+func serveRendition(req *http.Request, rendition model.ServableRendition) *httptest.ResponseRecorder {
+	backend := memoryBackend{13: []byte("0123456789")}
+	w := httptest.NewRecorder()
+	ServeRendition(w, req, nil, backend, rendition)
+	return w
+}
+
+func TestServeRendition(t *testing.T) {
+	updatedAt := time.Date(2020, time.May, 1, 12, 0, 0, 0, time.UTC)
+	req := httptest.NewRequest("GET", "/renditions/13", nil)
+
+	w := serveRendition(req, servableRendition(updatedAt))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0123456789", w.Body.String())
+	assert.Equal(t, `"abc123"`, w.Header().Get("ETag"))
+	assert.Equal(t, "private, no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+	assert.Equal(t, updatedAt.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+}
+
+func TestServeRenditionDefaultCacheControl(t *testing.T) {
+	rendition := servableRendition(time.Now())
+	rendition.CacheControl = ""
+	req := httptest.NewRequest("GET", "/renditions/13", nil)
+
+	w := serveRendition(req, rendition)
+
+	assert.Equal(t, db.DefaultCacheControl, w.Header().Get("Cache-Control"))
+}
+
+func TestServeRenditionIfNoneMatch(t *testing.T) {
+	req := httptest.NewRequest("GET", "/renditions/13", nil)
+	req.Header.Set("If-None-Match", `"abc123"`)
+
+	w := serveRendition(req, servableRendition(time.Now()))
+
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestServeRenditionIfModifiedSince(t *testing.T) {
+	updatedAt := time.Date(2020, time.May, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		modifiedSince time.Time
+		status        int
+	}{
+		{"client copy is current", updatedAt, http.StatusNotModified},
+		{"client copy is newer", updatedAt.Add(time.Hour), http.StatusNotModified},
+		{"client copy is older", updatedAt.Add(-time.Hour), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/renditions/13", nil)
+			req.Header.Set("If-Modified-Since", test.modifiedSince.Format(http.TimeFormat))
+
+			w := serveRendition(req, servableRendition(updatedAt))
+
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
+
+func TestServeRenditionRange(t *testing.T) {
+	req := httptest.NewRequest("GET", "/renditions/13", nil)
+	req.Header.Set("Range", "bytes=2-5")
+
+	w := serveRendition(req, servableRendition(time.Now()))
+
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "2345", w.Body.String())
+	assert.Equal(t, "bytes 2-5/10", w.Header().Get("Content-Range"))
+}
+
+func TestServeRenditionIfRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		ifRange string
+		status  int
+		body    string
+	}{
+		{"matching etag", `"abc123"`, http.StatusPartialContent, "2345"},
+		{"stale etag", `"other"`, http.StatusOK, "0123456789"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/renditions/13", nil)
+			req.Header.Set("Range", "bytes=2-5")
+			req.Header.Set("If-Range", test.ifRange)
+
+			w := serveRendition(req, servableRendition(time.Now()))
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.body, w.Body.String())
+		})
+	}
+}
+
+func TestServeRenditionHead(t *testing.T) {
+	req := httptest.NewRequest("HEAD", "/renditions/13", nil)
+
+	w := serveRendition(req, servableRendition(time.Now()))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.String())
+}
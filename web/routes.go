@@ -46,6 +46,8 @@ func BuildRoutes(router chi.Router, sections []Section, base string) {
 					subrouter.With(route.Middleware...).Get(route.Path, route.Handler)
 				case "POST":
 					subrouter.With(route.Middleware...).Post(route.Path, route.Handler)
+				case "PATCH":
+					subrouter.With(route.Middleware...).Patch(route.Path, route.Handler)
 				case "HEAD":
 					subrouter.With(route.Middleware...).Head(route.Path, route.Handler)
 				case "DELETE":